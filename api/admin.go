@@ -18,8 +18,10 @@ type adminUserParams struct {
 	Aud          string                 `json:"aud"`
 	Role         string                 `json:"role"`
 	Email        string                 `json:"email"`
+	Phone        string                 `json:"phone"`
 	Password     string                 `json:"password"`
 	Confirm      bool                   `json:"confirm"`
+	PhoneConfirm bool                   `json:"phone_confirm"`
 	UserMetaData map[string]interface{} `json:"user_metadata"`
 	AppMetaData  map[string]interface{} `json:"app_metadata"`
 }
@@ -137,6 +139,19 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	if params.Phone != "" {
+		if params.Phone, err = validatePhone(params.Phone); err != nil {
+			return err
+		}
+		if params.Phone != user.Phone {
+			if exists, err := models.IsDuplicatedPhone(a.db, instanceID, params.Phone, user.Aud); err != nil {
+				return internalServerError("Database error checking phone number").WithInternalError(err)
+			} else if exists {
+				return unprocessableEntityError("Phone number already registered by another user")
+			}
+		}
+	}
+
 	err = a.db.Transaction(func(tx *storage.Connection) error {
 		if params.Role != "" {
 			if terr := user.SetRole(tx, params.Role); terr != nil {
@@ -162,6 +177,18 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 			}
 		}
 
+		if params.Phone != "" {
+			if terr := user.SetPhone(tx, params.Phone); terr != nil {
+				return terr
+			}
+		}
+
+		if params.PhoneConfirm && user.Phone != "" {
+			if terr := user.ConfirmPhone(tx); terr != nil {
+				return terr
+			}
+		}
+
 		if params.AppMetaData != nil {
 			if terr := user.UpdateAppMetaData(tx, params.AppMetaData); terr != nil {
 				return terr
@@ -205,8 +232,15 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	if err := a.validateEmail(ctx, params.Email); err != nil {
-		return err
+	if params.Email != "" || params.Phone == "" {
+		if err := a.validateEmail(ctx, params.Email); err != nil {
+			return err
+		}
+	}
+	if params.Phone != "" {
+		if params.Phone, err = validatePhone(params.Phone); err != nil {
+			return err
+		}
 	}
 
 	aud := a.requestAud(ctx, r)
@@ -214,10 +248,19 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 		aud = params.Aud
 	}
 
-	if exists, err := models.IsDuplicatedEmail(a.db, instanceID, params.Email, aud); err != nil {
-		return internalServerError("Database error checking email").WithInternalError(err)
-	} else if exists {
-		return unprocessableEntityError("Email address already registered by another user")
+	if params.Email != "" {
+		if exists, err := models.IsDuplicatedEmail(a.db, instanceID, params.Email, aud); err != nil {
+			return internalServerError("Database error checking email").WithInternalError(err)
+		} else if exists {
+			return unprocessableEntityError("Email address already registered by another user")
+		}
+	}
+	if params.Phone != "" {
+		if exists, err := models.IsDuplicatedPhone(a.db, instanceID, params.Phone, aud); err != nil {
+			return internalServerError("Database error checking phone number").WithInternalError(err)
+		} else if exists {
+			return unprocessableEntityError("Phone number already registered by another user")
+		}
 	}
 
 	user, err := models.NewUser(instanceID, params.Email, params.Password, aud, params.UserMetaData)
@@ -228,6 +271,10 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 		user.AppMetaData = make(map[string]interface{})
 	}
 	user.AppMetaData["provider"] = "email"
+	if params.Email == "" {
+		user.AppMetaData["provider"] = "phone"
+	}
+	user.Phone = params.Phone
 
 	config := a.getConfig(ctx)
 	err = a.db.Transaction(func(tx *storage.Connection) error {
@@ -256,6 +303,12 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 			}
 		}
 
+		if params.PhoneConfirm && user.Phone != "" {
+			if terr := user.ConfirmPhone(tx); terr != nil {
+				return terr
+			}
+		}
+
 		return nil
 	})
 
@@ -281,7 +334,7 @@ func (a *API) adminUserDelete(w http.ResponseWriter, r *http.Request) error {
 			return internalServerError("Error recording audit log entry").WithInternalError(terr)
 		}
 
-		if terr := tx.Destroy(user); terr != nil {
+		if terr := models.DeleteUser(tx, user); terr != nil {
 			return internalServerError("Database error deleting user").WithInternalError(terr)
 		}
 		return nil
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/metering"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// AnonymousGrant implements the anonymous grant type flow, which signs up a
+// user without an email to be upgraded to a real account later.
+func (a *API) AnonymousGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	cookie := r.Header.Get(useCookieHeader)
+
+	if !config.External.Anonymous.Enabled {
+		return oauthError("unsupported_grant_type", "Anonymous sign-ins are disabled")
+	}
+	if config.DisableSignup {
+		return forbiddenError("Signups not allowed for this instance")
+	}
+
+	var (
+		user  *models.User
+		token *AccessTokenResponse
+	)
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		user, terr = a.signupNewUser(ctx, tx, &SignupParams{
+			Provider: "anonymous",
+			Aud:      a.requestAud(ctx, r),
+		})
+		if terr != nil {
+			return terr
+		}
+		user.IsAnonymous = true
+		if terr = tx.UpdateOnly(user, "is_anonymous"); terr != nil {
+			return internalServerError("Database error updating user").WithInternalError(terr)
+		}
+
+		if terr = models.NewAuditLogEntry(tx, instanceID, user, models.LoginAction, map[string]interface{}{
+			"provider": "anonymous",
+		}); terr != nil {
+			return terr
+		}
+
+		token, terr = a.issueRefreshToken(ctx, tx, user, a.newTokenParams(r, "anonymous"))
+		if terr != nil {
+			return terr
+		}
+
+		if cookie != "" && config.Cookie.Duration > 0 {
+			if terr = a.setCookieToken(config, token.Token, cookie == useSessionCookie, w); terr != nil {
+				return internalServerError("Failed to set JWT cookie. %s", terr)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metering.RecordLogin("anonymous", user.ID, instanceID)
+	return sendJSON(w, http.StatusOK, token)
+}
+
+// upgradeAnonymousUser attaches an email to an anonymous user. Like an email
+// change, the address is only set once it's confirmed, so nobody can take
+// over an account by confirming an address they didn't know was pending. The
+// user stays anonymous until then.
+func (a *API) upgradeAnonymousUser(r *http.Request, tx *storage.Connection, user *models.User, email string) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if err := a.validateEmail(ctx, email); err != nil {
+		return err
+	}
+	if exists, err := models.IsDuplicatedEmail(tx, instanceID, email, user.Aud); err != nil {
+		return internalServerError("Database error checking email").WithInternalError(err)
+	} else if exists {
+		return unprocessableEntityError("Email address already registered by another user")
+	}
+	if err := user.UpdateAppMetaData(tx, map[string]interface{}{
+		"provider": "email",
+	}); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+
+	if config.Mailer.Autoconfirm {
+		if err := user.SetEmail(tx, email); err != nil {
+			return internalServerError("Database error updating user").WithInternalError(err)
+		}
+		return a.confirmAnonymousUser(ctx, tx, user)
+	}
+
+	mailer := a.Mailer(ctx)
+	referrer := a.getReferrer(r)
+	if err := a.sendEmailChange(tx, user, mailer, email, referrer); err != nil {
+		return internalServerError("Error sending change email").WithInternalError(err)
+	}
+	return nil
+}
+
+// confirmAnonymousUser signs up an anonymous user whose email was confirmed.
+// The sessions of the anonymous user are revoked, so that only someone who
+// can sign in to the account keeps access to it.
+func (a *API) confirmAnonymousUser(ctx context.Context, tx *storage.Connection, user *models.User) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if err := models.NewAuditLogEntry(tx, instanceID, user, models.UserSignedUpAction, nil); err != nil {
+		return err
+	}
+	if err := triggerEventHooks(ctx, tx, SignupEvent, user, instanceID, config); err != nil {
+		return err
+	}
+	if err := user.Confirm(tx); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+	if err := models.Logout(tx, instanceID, user.ID); err != nil {
+		return internalServerError("Database error revoking sessions").WithInternalError(err)
+	}
+	return nil
+}
+
+// linkAnonymousUser upgrades an anonymous user with the verified email of
+// an external account.
+func (a *API) linkAnonymousUser(ctx context.Context, tx *storage.Connection, user *models.User, userData *provider.UserProvidedData, instanceID uuid.UUID, providerType string) error {
+	config := a.getConfig(ctx)
+
+	emailData := verifiedEmail(userData, config.Mailer.Autoconfirm)
+	if emailData == nil {
+		return badRequestError("External account has no verified email")
+	}
+
+	if exists, err := models.IsDuplicatedEmail(tx, instanceID, emailData.Email, user.Aud); err != nil {
+		return internalServerError("Database error checking email").WithInternalError(err)
+	} else if exists {
+		return unprocessableEntityError("Email address already registered by another user")
+	}
+
+	if err := user.SetEmail(tx, emailData.Email); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+	if err := user.UpdateAppMetaData(tx, map[string]interface{}{
+		"provider": providerType,
+	}); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+	updates := make(map[string]interface{})
+	for k, v := range userData.Metadata {
+		if v != "" {
+			updates[k] = v
+		}
+	}
+	if err := user.UpdateUserMetaData(tx, updates); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+
+	if err := models.NewAuditLogEntry(tx, instanceID, user, models.UserSignedUpAction, map[string]interface{}{
+		"provider": providerType,
+	}); err != nil {
+		return err
+	}
+	if err := triggerEventHooks(ctx, tx, SignupEvent, user, instanceID, config); err != nil {
+		return err
+	}
+	if err := user.Confirm(tx); err != nil {
+		return internalServerError("Error updating user").WithInternalError(err)
+	}
+	return nil
+}
+
+// adminPurgeAnonymousUsers deletes the anonymous users that have been
+// inactive for longer than the older_than duration, 30 days by default.
+func (a *API) adminPurgeAnonymousUsers(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	olderThan := 30 * 24 * time.Hour
+	if v := r.URL.Query().Get("older_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return badRequestError("older_than must be a positive duration, like 720h")
+		}
+		olderThan = d
+	}
+
+	var deleted int
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if deleted, terr = models.DeleteStaleAnonymousUsers(tx, instanceID, time.Now().Add(-olderThan)); terr != nil {
+			return internalServerError("Database error deleting anonymous users").WithInternalError(terr)
+		}
+		return models.NewAuditLogEntry(tx, instanceID, adminUser, models.AnonymousUsersPurgedAction, map[string]interface{}{
+			"count": deleted,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{"deleted": deleted})
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type AnonymousTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestAnonymous(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &AnonymousTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *AnonymousTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+	ts.Config.DisableSignup = false
+	ts.Config.Mailer.Autoconfirm = false
+	ts.Config.External.Anonymous.Enabled = true
+}
+
+func (ts *AnonymousTestSuite) request(method, path, bearer string, body interface{}) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	if body != nil {
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+	}
+	req := httptest.NewRequest(method, "http://localhost"+path, &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *AnonymousTestSuite) signIn() (*AccessTokenResponse, *GoTrueClaims) {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", strings.NewReader(url.Values{
+		"grant_type": {"anonymous"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	tokens := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(tokens))
+	claims := &GoTrueClaims{}
+	_, err := jwt.ParseWithClaims(tokens.Token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	return tokens, claims
+}
+
+func (ts *AnonymousTestSuite) findUser(id string) *models.User {
+	u, err := models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, uuid.FromStringOrNil(id))
+	require.NoError(ts.T(), err)
+	return u
+}
+
+func (ts *AnonymousTestSuite) TestAnonymousGrant() {
+	tokens, claims := ts.signIn()
+	assert.NotEmpty(ts.T(), tokens.RefreshToken)
+	assert.True(ts.T(), claims.IsAnonymous)
+	assert.Empty(ts.T(), claims.Email)
+
+	u := ts.findUser(claims.Subject)
+	assert.True(ts.T(), u.IsAnonymous)
+	assert.Empty(ts.T(), u.Email)
+	assert.Equal(ts.T(), "anonymous", u.AppMetaData["provider"])
+}
+
+func (ts *AnonymousTestSuite) TestAnonymousGrantDisabled() {
+	ts.Config.External.Anonymous.Enabled = false
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=anonymous", nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *AnonymousTestSuite) refresh(refreshToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", strings.NewReader(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *AnonymousTestSuite) TestUpgradeWithEmail() {
+	tokens, claims := ts.signIn()
+
+	w := ts.request(http.MethodPut, "/user", tokens.Token, map[string]interface{}{
+		"email":    "anonymous@example.com",
+		"password": "secret",
+	})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	// the account keeps its ID and stays anonymous until the email is
+	// confirmed, and the address isn't the user's before that
+	u := ts.findUser(claims.Subject)
+	assert.Empty(ts.T(), u.Email)
+	assert.Equal(ts.T(), "anonymous@example.com", u.EmailChange)
+	assert.Equal(ts.T(), "email", u.AppMetaData["provider"])
+	assert.True(ts.T(), u.IsAnonymous)
+	require.NotEmpty(ts.T(), u.EmailChangeToken)
+	_, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "anonymous@example.com", ts.Config.JWT.Aud)
+	assert.True(ts.T(), models.IsNotFoundError(err))
+
+	w = ts.request(http.MethodPut, "/user", tokens.Token, map[string]interface{}{
+		"email_change_token": u.EmailChangeToken,
+	})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	u = ts.findUser(claims.Subject)
+	assert.Equal(ts.T(), "anonymous@example.com", u.Email)
+	assert.False(ts.T(), u.IsAnonymous)
+	assert.True(ts.T(), u.IsConfirmed())
+	assert.True(ts.T(), u.Authenticate("secret"))
+
+	// the anonymous session ends with the upgrade
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.refresh(tokens.RefreshToken).Code)
+}
+
+func (ts *AnonymousTestSuite) TestUpgradeWithEmailAutoconfirm() {
+	ts.Config.Mailer.Autoconfirm = true
+	tokens, claims := ts.signIn()
+
+	w := ts.request(http.MethodPut, "/user", tokens.Token, map[string]interface{}{
+		"email":    "anonymous@example.com",
+		"password": "secret",
+	})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	u := ts.findUser(claims.Subject)
+	assert.Equal(ts.T(), "anonymous@example.com", u.Email)
+	assert.False(ts.T(), u.IsAnonymous)
+	assert.True(ts.T(), u.IsConfirmed())
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.refresh(tokens.RefreshToken).Code)
+}
+
+func (ts *AnonymousTestSuite) TestUpgradeWithTakenEmail() {
+	existing, err := models.NewUser(ts.instanceID, "taken@example.com", "secret", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(existing))
+
+	tokens, _ := ts.signIn()
+	w := ts.request(http.MethodPut, "/user", tokens.Token, map[string]interface{}{"email": "taken@example.com"})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+}
+
+func (ts *AnonymousTestSuite) TestLink() {
+	ts.Config.External.Github.Enabled = true
+	tokens, claims := ts.signIn()
+
+	w := ts.request(http.MethodGet, "/user/link?provider=github", tokens.Token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	data := map[string]string{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	u, err := url.Parse(data["url"])
+	require.NoError(ts.T(), err)
+
+	state := ExternalProviderClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err = p.ParseWithClaims(u.Query().Get("state"), &state, func(*jwt.Token) (interface{}, error) {
+		return []byte(ts.API.config.OperatorToken), nil
+	})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "github", state.Provider)
+	assert.Equal(ts.T(), claims.Subject, state.LinkUserID)
+}
+
+func (ts *AnonymousTestSuite) TestAdminPurge() {
+	_, stale := ts.signIn()
+	_, recent := ts.signIn()
+
+	users := (&models.User{}).TableName()
+	require.NoError(ts.T(), ts.API.db.RawQuery("UPDATE "+users+" SET created_at = ? WHERE id = ?", time.Now().Add(-48*time.Hour), stale.Subject).Exec())
+	require.NoError(ts.T(), ts.API.db.RawQuery("UPDATE "+users+" SET created_at = ? WHERE id = ?", time.Now().Add(-48*time.Hour), recent.Subject).Exec())
+	// a refresh token issued after the cutoff keeps the user around
+	refreshTokens := (&models.RefreshToken{}).TableName()
+	require.NoError(ts.T(), ts.API.db.RawQuery("UPDATE "+refreshTokens+" SET created_at = ? WHERE user_id = ?", time.Now().Add(-48*time.Hour), stale.Subject).Exec())
+
+	admin, err := models.NewUser(ts.instanceID, "admin@example.com", "secret", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	admin.IsSuperAdmin = true
+	require.NoError(ts.T(), ts.API.db.Create(admin))
+	token, err := generateAccessToken(admin, time.Second*time.Duration(ts.Config.JWT.Exp), newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	require.NoError(ts.T(), err)
+
+	w := ts.request(http.MethodDelete, "/admin/users/anonymous?older_than=nope", token, nil)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	w = ts.request(http.MethodDelete, "/admin/users/anonymous?older_than=24h", token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	data := map[string]int{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Equal(ts.T(), 1, data["deleted"])
+
+	_, err = models.FindUserByInstanceIDAndID(ts.API.db, ts.instanceID, uuid.FromStringOrNil(stale.Subject))
+	assert.True(ts.T(), models.IsNotFoundError(err))
+	ts.findUser(recent.Subject)
+}
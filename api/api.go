@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/imdario/mergo"
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/mailer"
+	"github.com/netlify/gotrue/sms"
 	"github.com/netlify/gotrue/storage"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
@@ -34,6 +36,9 @@ type API struct {
 	db      *storage.Connection
 	config  *conf.GlobalConfiguration
 	version string
+
+	keyMutex    sync.Mutex
+	signingKeys signingKeyCache
 }
 
 // ListenAndServe starts the REST API
@@ -81,6 +86,12 @@ func NewAPI(globalConfig *conf.GlobalConfiguration, db *storage.Connection) *API
 func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfiguration, db *storage.Connection, version string) *API {
 	api := &API{config: globalConfig, db: db, version: version}
 
+	if config := getConfig(ctx); config != nil {
+		if err := ensurePrivateKey(config); err != nil {
+			logrus.Fatalf("Error generating JWT private key: %+v", err)
+		}
+	}
+
 	logger := newStructuredLogger(logrus.StandardLogger())
 
 	r := newRouter()
@@ -113,6 +124,8 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 			r.Use(api.loadInstanceConfig)
 		}
 		r.Get("/", api.ExternalProviderCallback)
+		// providers like Apple post back with response_mode=form_post
+		r.Post("/", api.ExternalProviderCallback)
 	})
 
 	r.Route("/", func(r *router) {
@@ -124,27 +137,105 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 		}
 
 		r.Get("/settings", api.Settings)
+		r.Get("/.well-known/jwks.json", api.JWKS)
+		r.Get("/.well-known/openid-configuration", api.OpenIDConfiguration)
 
-		r.Get("/authorize", api.ExternalProviderRedirect)
+		r.Get("/authorize", api.Authorize)
+		r.With(api.requireAuthentication).With(api.requireAssuranceLevel).Post("/authorize", api.OAuthAuthorizeConsent)
 
 		r.With(api.requireAdminCredentials).Post("/invite", api.Invite)
 
 		r.With(api.requireEmailProvider).Post("/signup", api.Signup)
 		r.With(api.requireEmailProvider).Post("/recover", api.Recover)
-		r.With(api.requireEmailProvider).With(api.limitHandler(
+		r.With(api.requireEmailProvider).Post("/magiclink", api.MagicLink)
+		r.With(api.requirePhoneProvider).Post("/otp", api.OTP)
+		r.With(api.limitHandler(
 			// Allow requests at a rate of 30 per 5 minutes.
 			tollbooth.NewLimiter(30.0/(60*5), &limiter.ExpirableOptions{
 				DefaultExpirationTTL: time.Hour,
 			}).SetBurst(30),
 		)).Post("/token", api.Token)
+		r.With(api.requireTokenEndpointAuth).Post("/token/revoke", api.TokenRevoke)
+		r.With(api.requireTokenEndpointAuth).Post("/token/introspect", api.TokenIntrospect)
 		r.Post("/verify", api.Verify)
 
 		r.With(api.requireAuthentication).Post("/logout", api.Logout)
 
+		r.Route("/userinfo", func(r *router) {
+			r.Use(api.requireAuthentication)
+			r.Use(api.requireAssuranceLevel)
+			r.Get("/", api.UserInfo)
+			r.Post("/", api.UserInfo)
+		})
+
 		r.Route("/user", func(r *router) {
 			r.Use(api.requireAuthentication)
+			r.Use(api.requireAssuranceLevel)
 			r.Get("/", api.UserGet)
 			r.Put("/", api.UserUpdate)
+			r.Get("/link", api.UserLink)
+
+			r.Route("/identities", func(r *router) {
+				r.Get("/", api.UserIdentities)
+				r.Delete("/{identity_id}", api.UserIdentityDelete)
+				r.Get("/{identity_id}/token", api.UserIdentityToken)
+			})
+
+			r.Route("/sessions", func(r *router) {
+				r.Get("/", api.UserSessions)
+				r.Delete("/", api.UserSessionsDelete)
+				r.Delete("/{session_id}", api.UserSessionDelete)
+			})
+		})
+
+		r.Route("/factors", func(r *router) {
+			r.Use(api.requireMFAEnabled)
+			r.Use(api.requireAuthentication)
+			r.Get("/", api.Factors)
+			r.Post("/", api.EnrollFactor)
+
+			// Allow verification attempts at a rate of 30 per 5 minutes.
+			verifyLimiter := api.limitHandler(
+				tollbooth.NewLimiter(30.0/(60*5), &limiter.ExpirableOptions{
+					DefaultExpirationTTL: time.Hour,
+				}).SetBurst(30),
+			)
+
+			r.Route("/recovery_codes", func(r *router) {
+				r.Post("/", api.RegenerateRecoveryCodes)
+				r.With(verifyLimiter).Post("/verify", api.VerifyRecoveryCode)
+			})
+
+			r.Route("/{factor_id}", func(r *router) {
+				r.Use(api.loadFactor)
+
+				r.Post("/challenge", api.ChallengeFactor)
+				r.With(verifyLimiter).Post("/verify", api.VerifyFactor)
+				r.Delete("/", api.UnenrollFactor)
+			})
+		})
+
+		r.Route("/webauthn", func(r *router) {
+			r.Use(api.requireWebAuthnEnabled)
+
+			// Unauthenticated challenges are limited to 30 per 5 minutes.
+			r.With(api.limitHandler(
+				tollbooth.NewLimiter(30.0/(60*5), &limiter.ExpirableOptions{
+					DefaultExpirationTTL: time.Hour,
+				}).SetBurst(30),
+			)).Post("/login/begin", api.WebAuthnLoginBegin)
+
+			r.Route("/register", func(r *router) {
+				r.Use(api.requireAuthentication)
+				r.Post("/begin", api.WebAuthnRegisterBegin)
+				r.Post("/finish", api.WebAuthnRegisterFinish)
+			})
+
+			r.Route("/credentials", func(r *router) {
+				r.Use(api.requireAuthentication)
+				r.Get("/", api.WebAuthnCredentials)
+				r.Delete("/{credential_id}", api.DeleteWebAuthnCredential)
+			})
 		})
 
 		r.Route("/admin", func(r *router) {
@@ -154,12 +245,45 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 				r.Get("/", api.adminAuditLog)
 			})
 
+			r.Route("/clients", func(r *router) {
+				r.Get("/", api.adminOAuthClients)
+				r.Post("/", api.adminOAuthClientCreate)
+
+				r.Route("/{client_id}", func(r *router) {
+					r.Use(api.loadOAuthClient)
+
+					r.Get("/", api.adminOAuthClientGet)
+					r.Put("/", api.adminOAuthClientUpdate)
+					r.Delete("/", api.adminOAuthClientDelete)
+				})
+			})
+
+			r.Route("/keys", func(r *router) {
+				r.Get("/", api.adminSigningKeys)
+				r.Post("/rotate", api.adminSigningKeysRotate)
+				r.With(api.loadSigningKey).Delete("/{key_id}", api.adminSigningKeyDelete)
+			})
+
+			r.Route("/service_accounts", func(r *router) {
+				r.Get("/", api.adminServiceAccounts)
+				r.Post("/", api.adminServiceAccountCreate)
+
+				r.Route("/{service_account_id}", func(r *router) {
+					r.Use(api.loadServiceAccount)
+
+					r.Get("/", api.adminServiceAccountGet)
+					r.Put("/", api.adminServiceAccountUpdate)
+					r.Delete("/", api.adminServiceAccountDelete)
+				})
+			})
+
 			r.Route("/users", func(r *router) {
 				r.Get("/", api.adminUsers)
 				if globalConfig.API.ExportSecret != "" {
 					r.Get("/export", api.adminExportUsers(globalConfig.API.ExportSecret))
 				}
 				r.With(api.requireEmailProvider).Post("/", api.adminUserCreate)
+				r.Delete("/anonymous", api.adminPurgeAnonymousUsers)
 
 				r.Route("/{user_id}", func(r *router) {
 					r.Use(api.loadUser)
@@ -167,6 +291,14 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 					r.Get("/", api.adminUserGet)
 					r.Put("/", api.adminUserUpdate)
 					r.Delete("/", api.adminUserDelete)
+
+					r.Get("/identities/{identity_id}/token", api.adminUserIdentityToken)
+
+					r.Route("/sessions", func(r *router) {
+						r.Get("/", api.adminUserSessions)
+						r.Delete("/", api.adminUserSessionsDelete)
+						r.Delete("/{session_id}", api.adminUserSessionDelete)
+					})
 				})
 			})
 		})
@@ -195,6 +327,9 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 				r.Get("/", api.GetInstance)
 				r.Put("/", api.UpdateInstance)
 				r.Delete("/", api.DeleteInstance)
+
+				r.Get("/keys", api.GetInstanceSigningKeys)
+				r.Post("/keys/rotate", api.RotateInstanceSigningKeys)
 			})
 		})
 	}
@@ -253,6 +388,11 @@ func (a *API) Mailer(ctx context.Context) mailer.Mailer {
 	return mailer.NewMailer(config)
 }
 
+func (a *API) SMSSender(ctx context.Context) sms.Sender {
+	config := a.getConfig(ctx)
+	return sms.NewSender(config)
+}
+
 func (a *API) getConfig(ctx context.Context) *conf.Configuration {
 	obj := ctx.Value(configKey)
 	if obj == nil {
@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	jwt "github.com/golang-jwt/jwt/v4"
@@ -56,6 +58,11 @@ func (a *API) requireAdmin(ctx context.Context, w http.ResponseWriter, r *http.R
 	if !a.isAdmin(ctx, adminUser, aud) {
 		return nil, unauthorizedError("User not allowed")
 	}
+	if mfaRequired(a.getConfig(ctx), true) {
+		if err := requireAAL2(ctx); err != nil {
+			return nil, err
+		}
+	}
 	return withAdminUser(ctx, adminUser), nil
 }
 
@@ -75,12 +82,7 @@ func (a *API) extractBearerToken(w http.ResponseWriter, r *http.Request) (string
 
 func (a *API) parseJWTClaims(bearer string, r *http.Request, w http.ResponseWriter) (context.Context, error) {
 	ctx := r.Context()
-	config := a.getConfig(ctx)
-
-	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
-	token, err := p.ParseWithClaims(bearer, &GoTrueClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWT.Secret), nil
-	})
+	token, err := a.parseAccessToken(ctx, bearer)
 	if err != nil {
 		a.clearCookieToken(ctx, w)
 		return nil, unauthorizedError("Invalid token: %v", err)
@@ -88,3 +90,29 @@ func (a *API) parseJWTClaims(bearer string, r *http.Request, w http.ResponseWrit
 
 	return withToken(ctx, token), nil
 }
+
+// parseAccessToken verifies the signature and expiry of an access token.
+// ID tokens are signed with the same keys but don't grant access.
+func (a *API) parseAccessToken(ctx context.Context, bearer string) (*jwt.Token, error) {
+	p := jwt.Parser{}
+	return p.ParseWithClaims(bearer, &GoTrueClaims{}, a.accessTokenKey(ctx))
+}
+
+// accessTokenKey returns the function that looks up the key to verify an
+// access token with.
+func (a *API) accessTokenKey(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ == idTokenType {
+			return nil, errors.New("ID tokens can't be used as access tokens")
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := a.getVerificationKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("Unexpected signing method %s", token.Method.Alg())
+		}
+		return key.verificationKey(), nil
+	}
+}
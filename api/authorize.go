@@ -0,0 +1,228 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/netlify/gotrue/models"
+)
+
+// AuthorizeParams are the parameters of an authorization code request.
+type AuthorizeParams struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// AuthorizeResponse tells the login page where to send the user after consent.
+type AuthorizeResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+func authorizeParamsFromQuery(q url.Values) *AuthorizeParams {
+	return &AuthorizeParams{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+}
+
+// Authorize starts a login with an external provider, or the authorization
+// code flow when a response_type is requested.
+func (a *API) Authorize(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Query().Get("response_type") == "" {
+		return a.ExternalProviderRedirect(w, r)
+	}
+	return a.OAuthAuthorize(w, r)
+}
+
+// OAuthAuthorize handles authorization code requests. Users already logged in
+// to a first party client get a code right away, everyone else is sent to the
+// login page to log in and approve the client.
+func (a *API) OAuthAuthorize(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	params := authorizeParamsFromQuery(r.URL.Query())
+
+	client, err := a.validateAuthorizeRequest(r, params)
+	if err != nil {
+		return err
+	}
+	if oerr := validateAuthorizeParams(params); oerr != nil {
+		http.Redirect(w, r, authorizeRedirectURL(params, url.Values{
+			"error":             {oerr.Err},
+			"error_description": {oerr.Description},
+		}), http.StatusFound)
+		return nil
+	}
+
+	if client.FirstParty {
+		if user := a.getSessionUser(w, r); user != nil {
+			redirectTo, err := a.issueAuthorizationCode(client, user, params)
+			if err != nil {
+				return err
+			}
+			http.Redirect(w, r, redirectTo, http.StatusFound)
+			return nil
+		}
+	}
+
+	loginURL := config.OAuthServer.LoginURL
+	if loginURL == "" {
+		loginURL = config.SiteURL
+	}
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		return internalServerError("Invalid login URL").WithInternalError(err)
+	}
+	q := u.Query()
+	for k, v := range r.URL.Query() {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+	return nil
+}
+
+// OAuthAuthorizeConsent records the decision of the authenticated user on an
+// authorization request and returns where the user should be redirected to.
+func (a *API) OAuthAuthorizeConsent(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	params := &AuthorizeParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read authorization params: %v", err)
+	}
+
+	client, err := a.validateAuthorizeRequest(r, params)
+	if err != nil {
+		return err
+	}
+	if oerr := validateAuthorizeParams(params); oerr != nil {
+		return oerr
+	}
+
+	if !params.Approve {
+		return sendJSON(w, http.StatusOK, &AuthorizeResponse{
+			RedirectTo: authorizeRedirectURL(params, url.Values{
+				"error":             {"access_denied"},
+				"error_description": {"The user denied the request"},
+			}),
+		})
+	}
+
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	redirectTo, err := a.issueAuthorizationCode(client, user, params)
+	if err != nil {
+		return err
+	}
+	return sendJSON(w, http.StatusOK, &AuthorizeResponse{RedirectTo: redirectTo})
+}
+
+// validateAuthorizeRequest loads the client and checks the redirect URI.
+// Until both are known to be valid errors can't be redirected to the client.
+func (a *API) validateAuthorizeRequest(r *http.Request, params *AuthorizeParams) (*models.OAuthClient, error) {
+	instanceID := getInstanceID(r.Context())
+
+	client, err := models.FindOAuthClientByClientID(a.db, instanceID, params.ClientID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, badRequestError("Unknown client_id")
+		}
+		return nil, internalServerError("Database error finding client").WithInternalError(err)
+	}
+
+	if !client.HasRedirectURI(params.RedirectURI) {
+		return nil, badRequestError("redirect_uri is not allowed for this client")
+	}
+	return client, nil
+}
+
+func validateAuthorizeParams(params *AuthorizeParams) *OAuthError {
+	if params.ResponseType != "code" {
+		return oauthError("unsupported_response_type", "Only the code response type is supported")
+	}
+	if params.CodeChallenge == "" {
+		return oauthError("invalid_request", "code_challenge is required")
+	}
+	if params.CodeChallengeMethod != models.CodeChallengeS256 {
+		return oauthError("invalid_request", "code_challenge_method must be S256")
+	}
+	return nil
+}
+
+// getSessionUser returns the user logged in through the JWT cookie or
+// Authorization header, if any.
+func (a *API) getSessionUser(w http.ResponseWriter, r *http.Request) *models.User {
+	config := a.getConfig(r.Context())
+
+	bearer, err := a.extractBearerToken(w, r)
+	if err != nil {
+		if config.Cookie.Key == "" {
+			return nil
+		}
+		cookie, err := r.Cookie(config.Cookie.Key)
+		if err != nil || cookie.Value == "" {
+			return nil
+		}
+		bearer = cookie.Value
+	}
+
+	ctx, err := a.parseJWTClaims(bearer, r, w)
+	if err != nil {
+		return nil
+	}
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+func (a *API) issueAuthorizationCode(client *models.OAuthClient, user *models.User, params *AuthorizeParams) (string, error) {
+	code, err := models.NewAuthorizationCode(client, user, params.RedirectURI, params.Scope, params.Nonce, params.CodeChallenge)
+	if err != nil {
+		return "", internalServerError("Error creating authorization code").WithInternalError(err)
+	}
+	if err := a.db.Create(code); err != nil {
+		return "", internalServerError("Database error saving authorization code").WithInternalError(err)
+	}
+
+	return authorizeRedirectURL(params, url.Values{"code": {code.Code}}), nil
+}
+
+// authorizeRedirectURL adds values and the state of the request to the redirect URI.
+func authorizeRedirectURL(params *AuthorizeParams, values url.Values) string {
+	u, err := url.Parse(params.RedirectURI)
+	if err != nil {
+		// redirect URIs are validated when a client is registered
+		return params.RedirectURI
+	}
+
+	q := u.Query()
+	for k, v := range values {
+		q[k] = v
+	}
+	if params.State != "" {
+		q.Set("state", params.State)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
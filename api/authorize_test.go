@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	testRedirectURI   = "https://app.example.com/callback"
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+type AuthorizeTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+	user       *models.User
+	token      string
+}
+
+func TestAuthorize(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &AuthorizeTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *AuthorizeTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+	ts.Config.OAuthServer.LoginURL = "https://login.example.com/authorize"
+
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+	ts.user = u
+
+	ts.token, err = generateAccessToken(u, time.Minute, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	require.NoError(ts.T(), err)
+}
+
+func (ts *AuthorizeTestSuite) createClient(firstParty, confidential bool) (*models.OAuthClient, string) {
+	client, secret, err := models.NewOAuthClient(ts.instanceID, "Example", []string{testRedirectURI}, firstParty, confidential)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(client))
+	return client, secret
+}
+
+func authorizeQuery(client *models.OAuthClient) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"code_challenge":        {testCodeChallenge},
+		"code_challenge_method": {models.CodeChallengeS256},
+	}
+}
+
+// authorize requests a code for a first party client as the logged in user.
+func (ts *AuthorizeTestSuite) authorize(client *models.OAuthClient) string {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/authorize?"+authorizeQuery(client).Encode(), nil)
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusFound, w.Code)
+
+	u, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), "app.example.com", u.Host)
+	assert.Equal(ts.T(), "xyz", u.Query().Get("state"))
+
+	code := u.Query().Get("code")
+	require.NotEmpty(ts.T(), code)
+	return code
+}
+
+func (ts *AuthorizeTestSuite) exchange(client *models.OAuthClient, secret, code, verifier string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", strings.NewReader(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+		"client_id":     {client.ClientID},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(client.ClientID, secret)
+	}
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *AuthorizeTestSuite) TestAuthorize_RedirectsToLogin() {
+	client, _ := ts.createClient(false, false)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/authorize?"+authorizeQuery(client).Encode(), nil)
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusFound, w.Code)
+
+	u, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "login.example.com", u.Host)
+	assert.Equal(ts.T(), client.ClientID, u.Query().Get("client_id"))
+}
+
+func (ts *AuthorizeTestSuite) TestAuthorize_UnknownRedirectURI() {
+	client, _ := ts.createClient(true, false)
+	q := authorizeQuery(client)
+	q.Set("redirect_uri", "https://evil.example.com/callback")
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *AuthorizeTestSuite) TestAuthorize_RequiresPKCE() {
+	client, _ := ts.createClient(true, false)
+	q := authorizeQuery(client)
+	q.Del("code_challenge")
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusFound, w.Code)
+
+	u, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "invalid_request", u.Query().Get("error"))
+}
+
+func (ts *AuthorizeTestSuite) TestAuthorizationCodeGrant() {
+	client, _ := ts.createClient(true, false)
+	code := ts.authorize(client)
+
+	w := ts.exchange(client, "", code, testCodeVerifier)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	assert.NotEmpty(ts.T(), token.Token)
+	assert.NotEmpty(ts.T(), token.RefreshToken)
+
+	// codes can't be used twice
+	w = ts.exchange(client, "", code, testCodeVerifier)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *AuthorizeTestSuite) TestAuthorizationCodeGrant_InvalidVerifier() {
+	client, _ := ts.createClient(true, false)
+	code := ts.authorize(client)
+
+	w := ts.exchange(client, "", code, "wrong-verifier")
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *AuthorizeTestSuite) TestAuthorizationCodeGrant_ConfidentialClient() {
+	client, secret := ts.createClient(true, true)
+
+	code := ts.authorize(client)
+	w := ts.exchange(client, "", code, testCodeVerifier)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code, "confidential clients must authenticate")
+
+	w = ts.exchange(client, secret, code, testCodeVerifier)
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+}
+
+func (ts *AuthorizeTestSuite) TestAuthorizeConsent() {
+	client, _ := ts.createClient(false, false)
+
+	var buffer bytes.Buffer
+	params := authorizeQuery(client)
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"response_type":         params.Get("response_type"),
+		"client_id":             params.Get("client_id"),
+		"redirect_uri":          params.Get("redirect_uri"),
+		"state":                 params.Get("state"),
+		"code_challenge":        params.Get("code_challenge"),
+		"code_challenge_method": params.Get("code_challenge_method"),
+		"approve":               true,
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/authorize", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	resp := &AuthorizeResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(resp))
+	u, err := url.Parse(resp.RedirectTo)
+	require.NoError(ts.T(), err)
+	code := u.Query().Get("code")
+	require.NotEmpty(ts.T(), code)
+
+	w = ts.exchange(client, "", code, testCodeVerifier)
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+}
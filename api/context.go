@@ -27,8 +27,15 @@ const (
 	externalProviderTypeKey = contextKey("external_provider_type")
 	userKey                 = contextKey("user")
 	externalReferrerKey     = contextKey("external_referrer")
+	linkUserIDKey           = contextKey("link_user_id")
+	linkVerifierKey         = contextKey("link_verifier")
+	externalScopesKey       = contextKey("external_scopes")
 	functionHooksKey        = contextKey("function_hooks")
 	adminUserKey            = contextKey("admin_user")
+	signingKeyKey           = contextKey("signing_key")
+	oauthClientKey          = contextKey("oauth_client")
+	serviceAccountKey       = contextKey("service_account")
+	factorKey               = contextKey("factor")
 )
 
 // withToken adds the JWT token to the context.
@@ -195,6 +202,45 @@ func getExternalReferrer(ctx context.Context) string {
 	return obj.(string)
 }
 
+func withLinkUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, linkUserIDKey, id)
+}
+
+func getLinkUserID(ctx context.Context) string {
+	obj := ctx.Value(linkUserIDKey)
+	if obj == nil {
+		return ""
+	}
+
+	return obj.(string)
+}
+
+func withLinkVerifier(ctx context.Context, hash string) context.Context {
+	return context.WithValue(ctx, linkVerifierKey, hash)
+}
+
+func getLinkVerifier(ctx context.Context) string {
+	obj := ctx.Value(linkVerifierKey)
+	if obj == nil {
+		return ""
+	}
+
+	return obj.(string)
+}
+
+func withExternalScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, externalScopesKey, scopes)
+}
+
+func getExternalScopes(ctx context.Context) []string {
+	obj := ctx.Value(externalScopesKey)
+	if obj == nil {
+		return nil
+	}
+
+	return obj.([]string)
+}
+
 // withFunctionHooks adds the provided function hooks to the context.
 func withFunctionHooks(ctx context.Context, hooks map[string][]string) context.Context {
 	return context.WithValue(ctx, functionHooksKey, hooks)
@@ -223,3 +269,59 @@ func getAdminUser(ctx context.Context) *models.User {
 	}
 	return obj.(*models.User)
 }
+
+// withSigningKey adds the signing key to the context.
+func withSigningKey(ctx context.Context, k *models.SigningKey) context.Context {
+	return context.WithValue(ctx, signingKeyKey, k)
+}
+
+// getSigningKey reads the signing key from the context.
+func getSigningKey(ctx context.Context) *models.SigningKey {
+	obj := ctx.Value(signingKeyKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.SigningKey)
+}
+
+// withOAuthClient adds the OAuth client to the context.
+func withOAuthClient(ctx context.Context, c *models.OAuthClient) context.Context {
+	return context.WithValue(ctx, oauthClientKey, c)
+}
+
+// getOAuthClient reads the OAuth client from the context.
+func getOAuthClient(ctx context.Context) *models.OAuthClient {
+	obj := ctx.Value(oauthClientKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.OAuthClient)
+}
+
+// withServiceAccount adds the service account to the context.
+func withServiceAccount(ctx context.Context, s *models.ServiceAccount) context.Context {
+	return context.WithValue(ctx, serviceAccountKey, s)
+}
+
+// getServiceAccount reads the service account from the context.
+func getServiceAccount(ctx context.Context) *models.ServiceAccount {
+	obj := ctx.Value(serviceAccountKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.ServiceAccount)
+}
+
+// withFactor adds the MFA factor to the context.
+func withFactor(ctx context.Context, f *models.Factor) context.Context {
+	return context.WithValue(ctx, factorKey, f)
+}
+
+// getFactor reads the MFA factor from the context.
+func getFactor(ctx context.Context) *models.Factor {
+	obj := ctx.Value(factorKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.Factor)
+}
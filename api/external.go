@@ -2,7 +2,6 @@ package api
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -12,9 +11,11 @@ import (
 	"github.com/gofrs/uuid"
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/crypto"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
 )
 
 type ExternalProviderClaims struct {
@@ -22,6 +23,18 @@ type ExternalProviderClaims struct {
 	Provider    string `json:"provider"`
 	InviteToken string `json:"invite_token,omitempty"`
 	Referrer    string `json:"referrer,omitempty"`
+	// LinkUserID is the user the external account is linked to.
+	LinkUserID string `json:"link_user_id,omitempty"`
+	// LinkVerifier is the hash of the verifier in the link cookie of the
+	// browser that started linking.
+	LinkVerifier string `json:"link_verifier,omitempty"`
+	// Nonce binds the ID token of OpenID Connect providers to the request.
+	Nonce string `json:"nonce,omitempty"`
+	// Scopes are the scopes requested on top of the ones of the provider,
+	// separated by spaces.
+	Scopes string `json:"scopes,omitempty"`
+	// AuthParams are the query parameters passed on to the provider.
+	AuthParams map[string]string `json:"auth_params,omitempty"`
 }
 
 // SignupParams are the parameters the Signup endpoint accepts
@@ -31,15 +44,9 @@ type ExternalSignupParams struct {
 }
 
 func (a *API) ExternalProviderRedirect(w http.ResponseWriter, r *http.Request) error {
-	ctx := r.Context()
-	config := a.getConfig(ctx)
-
-	providerType := r.URL.Query().Get("provider")
-	provider, err := a.Provider(ctx, providerType)
-	if err != nil {
-		return badRequestError("Unsupported provider: %+v", err).WithInternalError(err)
-	}
-
+	// providers are looked up by any case, but their rules and identities
+	// are kept by the lowercase name
+	providerType := strings.ToLower(r.URL.Query().Get("provider"))
 	inviteToken := strings.TrimSpace(r.URL.Query().Get("invite_token"))
 	if inviteToken != "" {
 		_, userErr := models.FindUserByConfirmationToken(a.db, inviteToken)
@@ -51,9 +58,35 @@ func (a *API) ExternalProviderRedirect(w http.ResponseWriter, r *http.Request) e
 		}
 	}
 
-	referrer := a.getReferrer(r)
+	authURL, err := a.externalProviderURL(r, providerType, inviteToken, "", "")
+	if err != nil {
+		return err
+	}
+
 	log := getLogEntry(r)
 	log.WithField("provider", providerType).Info("Redirecting to external provider")
+	http.Redirect(w, r, authURL, http.StatusFound)
+	return nil
+}
+
+// externalProviderURL returns the authorization URL of a provider, with
+// the state the callback continues from.
+func (a *API) externalProviderURL(r *http.Request, providerType, inviteToken, linkUserID, linkVerifier string) (string, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+
+	p, err := a.Provider(ctx, providerType)
+	if err != nil {
+		return "", badRequestError("Unsupported provider: %+v", err).WithInternalError(err)
+	}
+	scopes, authParams, err := a.authorizeOptions(ctx, r.URL.Query(), providerType)
+	if err != nil {
+		return "", err
+	}
+	if gp, ok := p.(provider.GroupProvider); ok && len(config.External.Groups.RulesFor(providerType)) > 0 {
+		scopes = append(scopes, gp.GroupScopes()...)
+	}
+	nonce := crypto.SecureToken()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, ExternalProviderClaims{
 		NetlifyMicroserviceClaims: NetlifyMicroserviceClaims{
@@ -65,17 +98,62 @@ func (a *API) ExternalProviderRedirect(w http.ResponseWriter, r *http.Request) e
 			NetlifyID:     getNetlifyID(ctx),
 			FunctionHooks: getFunctionHooks(ctx),
 		},
-		Provider:    providerType,
-		InviteToken: inviteToken,
-		Referrer:    referrer,
+		Provider:     providerType,
+		InviteToken:  inviteToken,
+		Referrer:     a.getReferrer(r),
+		LinkUserID:   linkUserID,
+		LinkVerifier: linkVerifier,
+		Nonce:        nonce,
+		Scopes:       strings.Join(scopes, " "),
+		AuthParams:   authParams,
 	})
 	tokenString, err := token.SignedString([]byte(a.config.OperatorToken))
 	if err != nil {
-		return internalServerError("Error creating state").WithInternalError(err)
+		return "", internalServerError("Error creating state").WithInternalError(err)
 	}
 
-	http.Redirect(w, r, provider.AuthCodeURL(tokenString), http.StatusFound)
-	return nil
+	opts := []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("nonce", nonce)}
+	if len(scopes) > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("scope", strings.Join(provider.Scopes(p, scopes), " ")))
+	}
+	for name, value := range authParams {
+		opts = append(opts, oauth2.SetAuthURLParam(name, value))
+	}
+	return p.AuthCodeURL(tokenString, opts...), nil
+}
+
+// authorizeOptions returns the scopes and the query parameters for the
+// provider that clients passed to /authorize. Scopes the provider doesn't
+// allow clients to request are rejected, parameters it doesn't take from
+// them are left out.
+func (a *API) authorizeOptions(ctx context.Context, query url.Values, providerType string) ([]string, map[string]string, error) {
+	config := a.getConfig(ctx)
+	providerConfig, err := provider.LookupConfig(&config.External, providerType)
+	if err != nil {
+		return nil, nil, badRequestError("Unsupported provider: %+v", err).WithInternalError(err)
+	}
+	authorizeConfig, ok := providerConfig.(provider.AuthorizeConfig)
+
+	scopes := provider.SplitScopes(query.Get("scopes"))
+	for _, scope := range scopes {
+		if !ok || !authorizeConfig.AllowsScope(scope) {
+			return nil, nil, badRequestError("Scope %s can't be requested from provider %s", scope, providerType)
+		}
+	}
+
+	var authParams map[string]string
+	if ok {
+		for name := range query {
+			if !authorizeConfig.AllowsAuthParam(name) {
+				continue
+			}
+			if authParams == nil {
+				authParams = make(map[string]string)
+			}
+			authParams[name] = query.Get(name)
+		}
+	}
+	return scopes, authParams, nil
 }
 
 func (a *API) ExternalProviderCallback(w http.ResponseWriter, r *http.Request) error {
@@ -103,31 +181,70 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 		}
 		userData = oAuthUserData
 	}
+	if err := checkGroups(config, providerType, userData); err != nil {
+		return err
+	}
 
 	var user *models.User
 	var token *AccessTokenResponse
 	err := a.db.Transaction(func(tx *storage.Connection) error {
 		var terr error
 		inviteToken := getInviteToken(ctx)
-		if inviteToken != "" {
+		if linkUserID := getLinkUserID(ctx); linkUserID != "" {
+			if terr = checkLinkVerifier(r, config, getLinkVerifier(ctx)); terr != nil {
+				return terr
+			}
+			if user, terr = a.linkIdentity(ctx, tx, userData, instanceID, linkUserID, providerType); terr != nil {
+				return terr
+			}
+		} else if inviteToken != "" {
 			if user, terr = a.processInvite(ctx, tx, userData, instanceID, inviteToken, providerType); terr != nil {
 				return terr
 			}
 		} else {
 			aud := a.requestAud(ctx, r)
 
-			// search user using all available emails
+			// an account linked before signs in its user, whatever its emails
 			var emailData provider.Email
-			for _, e := range userData.Emails {
-				if e.Verified || config.Mailer.Autoconfirm {
-					user, terr = models.FindUserByEmailAndAudience(tx, instanceID, e.Email, aud)
-					if terr != nil && !models.IsNotFoundError(terr) {
-						return internalServerError("Error checking for duplicate users").WithInternalError(terr)
+			if userData.ID != "" {
+				identity, terr := models.FindIdentityByProviderID(tx, instanceID, providerType, userData.ID)
+				if terr != nil && !models.IsNotFoundError(terr) {
+					return internalServerError("Database error finding identity").WithInternalError(terr)
+				}
+				if identity != nil {
+					if user, terr = models.FindUserByInstanceIDAndID(tx, instanceID, identity.UserID); terr != nil {
+						if !models.IsNotFoundError(terr) {
+							return internalServerError("Database error finding user").WithInternalError(terr)
+						}
+						// the identity outlived its user, so the account is linked to no one
+						if terr = tx.Destroy(identity); terr != nil {
+							return internalServerError("Database error deleting identity").WithInternalError(terr)
+						}
+						user = nil
+					}
+				}
+				if user != nil {
+					for _, e := range userData.Emails {
+						if e.Email == user.Email {
+							emailData = e
+						}
 					}
+				}
+			}
 
-					if user != nil {
-						emailData = e
-						break
+			// search user using all available emails
+			if user == nil {
+				for _, e := range userData.Emails {
+					if e.Verified || config.Mailer.Autoconfirm {
+						user, terr = models.FindUserByEmailAndAudience(tx, instanceID, e.Email, aud)
+						if terr != nil && !models.IsNotFoundError(terr) {
+							return internalServerError("Error checking for duplicate users").WithInternalError(terr)
+						}
+
+						if user != nil {
+							emailData = e
+							break
+						}
 					}
 				}
 			}
@@ -164,11 +281,15 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 				}
 			}
 
+			if _, terr = a.saveIdentity(ctx, tx, user, providerType, userData, emailData.Email); terr != nil {
+				return terr
+			}
+
 			if !user.IsConfirmed() {
 				if !emailData.Verified && !config.Mailer.Autoconfirm {
 					mailer := a.Mailer(ctx)
 					referrer := a.getReferrer(r)
-					if terr = sendConfirmation(tx, user, mailer, config.SMTP.MaxFrequency, referrer); terr != nil {
+					if terr = sendConfirmation(tx, user, mailer, config, referrer); terr != nil {
 						return internalServerError("Error sending confirmation mail").WithInternalError(terr)
 					}
 					// email must be verified to issue a token
@@ -196,7 +317,7 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 			}
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user)
+		token, terr = a.issueRefreshToken(ctx, tx, user, a.newTokenParams(r, providerType))
 		if terr != nil {
 			return oauthError("server_error", terr.Error())
 		}
@@ -213,6 +334,9 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 		q.Set("token_type", token.TokenType)
 		q.Set("expires_in", strconv.Itoa(token.ExpiresIn))
 		q.Set("refresh_token", token.RefreshToken)
+		if config.External.Tokens.ReturnInCallback && userData.Token != nil {
+			q.Set("provider_token", userData.Token.AccessToken)
+		}
 		rurl += "#" + q.Encode()
 	}
 	http.Redirect(w, r, rurl, http.StatusFound)
@@ -243,6 +367,10 @@ func (a *API) processInvite(ctx context.Context, tx *storage.Connection, userDat
 		return nil, badRequestError("Invited email does not match emails from external provider").WithInternalMessage("invited=%s external=%s", user.Email, strings.Join(emails, ", "))
 	}
 
+	if _, err := a.saveIdentity(ctx, tx, user, providerType, userData, emailData.Email); err != nil {
+		return nil, err
+	}
+
 	if err := user.UpdateAppMetaData(tx, map[string]interface{}{
 		"provider": providerType,
 	}); err != nil {
@@ -288,6 +416,16 @@ func (a *API) loadExternalState(ctx context.Context, state string) (context.Cont
 	if claims.Referrer != "" {
 		ctx = withExternalReferrer(ctx, claims.Referrer)
 	}
+	if claims.LinkUserID != "" {
+		ctx = withLinkUserID(ctx, claims.LinkUserID)
+		ctx = withLinkVerifier(ctx, claims.LinkVerifier)
+	}
+	if claims.Nonce != "" {
+		ctx = provider.WithNonce(ctx, claims.Nonce)
+	}
+	if claims.Scopes != "" {
+		ctx = withExternalScopes(ctx, provider.SplitScopes(claims.Scopes))
+	}
 	if len(claims.FunctionHooks) > 0 {
 		ctx = withFunctionHooks(ctx, claims.FunctionHooks)
 	}
@@ -299,24 +437,10 @@ func (a *API) loadExternalState(ctx context.Context, state string) (context.Cont
 // Provider returns a Provider interface for the given name.
 func (a *API) Provider(ctx context.Context, name string) (provider.Provider, error) {
 	config := a.getConfig(ctx)
-	name = strings.ToLower(name)
-
-	switch name {
-	case "bitbucket":
-		return provider.NewBitbucketProvider(config.External.Bitbucket)
-	case "github":
-		return provider.NewGithubProvider(config.External.Github)
-	case "gitlab":
-		return provider.NewGitlabProvider(config.External.Gitlab)
-	case "google":
-		return provider.NewGoogleProvider(config.External.Google)
-	case "facebook":
-		return provider.NewFacebookProvider(config.External.Facebook)
-	case "saml":
-		return provider.NewSamlProvider(config.External.Saml, a.db, getInstanceID(ctx))
-	default:
-		return nil, fmt.Errorf("Provider %s could not be found", name)
-	}
+	return provider.New(ctx, &config.External, name, provider.Options{
+		DB:         a.db,
+		InstanceID: getInstanceID(ctx),
+	})
 }
 
 func (a *API) redirectErrors(handler apiHandler, w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/models"
+)
+
+// AppleTestSignupSetup fakes the Apple endpoints. Its ID tokens carry the
+// nonce of the last authorization request.
+func AppleTestSignupSetup(ts *ExternalTestSuite, nonce *string, email string) *httptest.Server {
+	teamKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ts.Require().NoError(err)
+	der, err := x509.MarshalPKCS8PrivateKey(teamKey)
+	ts.Require().NoError(err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	ts.Require().NoError(err)
+	jwk, err := crypto.NewJWK(&key.PublicKey, "apple", "RS256")
+	ts.Require().NoError(err)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/auth/keys":
+			ts.Require().NoError(json.NewEncoder(w).Encode(&crypto.JWKSet{Keys: []*crypto.JWK{jwk}}))
+		case "/auth/token":
+			ts.Require().NotEmpty(r.FormValue("client_secret"))
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+				"iss":            server.URL,
+				"sub":            "001234.apple",
+				"aud":            "com.example.web",
+				"exp":            time.Now().Add(time.Hour).Unix(),
+				"nonce":          *nonce,
+				"email":          email,
+				"email_verified": "true",
+			})
+			token.Header["kid"] = "apple"
+			idToken, err := token.SignedString(key)
+			ts.Require().NoError(err)
+			fmt.Fprintf(w, `{"access_token":"apple_token","token_type":"bearer","expires_in":3600,"id_token":%q}`, idToken)
+		default:
+			w.WriteHeader(500)
+			ts.Fail("unknown apple call %s", r.URL.Path)
+		}
+	}))
+
+	ts.Config.External.Apple = conf.AppleProviderConfiguration{
+		Enabled:     true,
+		ClientID:    "com.example.web",
+		TeamID:      "TEAM123",
+		KeyID:       "KEY123",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		RedirectURI: "https://example.netlify.com/callback",
+		URL:         server.URL,
+	}
+	return server
+}
+
+// appleCallback posts the authorization response back like Apple does with
+// response_mode=form_post, in a browser with the given cookies.
+func appleCallback(ts *ExternalTestSuite, authURL, user string, cookies ...*http.Cookie) url.Values {
+	u, err := url.Parse(authURL)
+	ts.Require().NoError(err)
+
+	v := url.Values{"code": {"authcode"}, "state": {u.Query().Get("state")}}
+	if user != "" {
+		v.Set("user", user)
+	}
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/callback", strings.NewReader(v.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	ts.Require().Equal(http.StatusFound, w.Code)
+
+	u, err = url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err)
+	fragment, err := url.ParseQuery(u.Fragment)
+	ts.Require().NoError(err)
+	return fragment
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalApple() {
+	nonce := ""
+	server := AppleTestSignupSetup(ts, &nonce, "apple@example.com")
+	defer server.Close()
+	defer func() { ts.Config.External.Apple = conf.AppleProviderConfiguration{} }()
+
+	w := performAuthorizationRequest(ts, "apple", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err)
+	ts.Equal("form_post", u.Query().Get("response_mode"))
+	nonce = u.Query().Get("nonce")
+
+	v := appleCallback(ts, w.Header().Get("Location"), `{"name":{"firstName":"Apple","lastName":"Test"}}`)
+	ts.Require().Empty(v.Get("error_description"))
+	ts.NotEmpty(v.Get("access_token"))
+
+	user, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "apple@example.com", ts.Config.JWT.Aud)
+	ts.Require().NoError(err)
+	ts.Equal("Apple Test", user.UserMetaData["full_name"])
+	ts.Equal("apple", user.AppMetaData["provider"])
+
+	// later sign-ins don't include the name, which the identity keeps
+	w = performAuthorizationRequest(ts, "apple", "")
+	u, err = url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err)
+	nonce = u.Query().Get("nonce")
+	v = appleCallback(ts, w.Header().Get("Location"), "")
+	ts.Require().Empty(v.Get("error_description"))
+
+	identity, err := models.FindIdentityByProviderID(ts.API.db, ts.instanceID, "apple", "001234.apple")
+	ts.Require().NoError(err)
+	ts.Equal(user.ID, identity.UserID)
+	ts.Equal("Apple Test", identity.IdentityData["full_name"])
+}
+
+func (ts *ExternalTestSuite) TestLinkExternalApple() {
+	nonce := ""
+	server := AppleTestSignupSetup(ts, &nonce, "apple@example.com")
+	defer server.Close()
+	defer func() { ts.Config.External.Apple = conf.AppleProviderConfiguration{} }()
+
+	u, err := ts.createUser("test@example.com", "Test", "", "")
+	ts.Require().NoError(err)
+	token, err := generateAccessToken(u, time.Hour, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	ts.Require().NoError(err)
+
+	w := ts.identityRequest(http.MethodGet, "/user/link?provider=apple", token)
+	ts.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	data := map[string]string{}
+	ts.Require().NoError(json.NewDecoder(w.Body).Decode(&data))
+	authURL, err := url.Parse(data["url"])
+	ts.Require().NoError(err)
+	nonce = authURL.Query().Get("nonce")
+
+	// Apple posts the callback from its own site, which browsers only send
+	// the link cookie with if it allows cross-site requests
+	cookies := w.Result().Cookies()
+	ts.Require().Len(cookies, 1)
+	ts.Equal(http.SameSiteNoneMode, cookies[0].SameSite)
+
+	v := appleCallback(ts, data["url"], "", cookies...)
+	ts.Require().Empty(v.Get("error_description"))
+	identities := ts.identities(token)
+	ts.Require().Len(identities, 1)
+	ts.Equal("apple", identities[0].Provider)
+	ts.Equal("001234.apple", identities[0].ProviderID)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/models"
+)
+
+func (ts *ExternalTestSuite) TestSignupExternalDiscord() {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/authorize?provider=discord", nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	ts.Require().Equal(http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err, "redirect url parse failed")
+	q := u.Query()
+	ts.Equal(ts.Config.External.Discord.RedirectURI, q.Get("redirect_uri"))
+	ts.Equal(ts.Config.External.Discord.ClientID, q.Get("client_id"))
+	ts.Equal("code", q.Get("response_type"))
+	ts.Equal("identify email", q.Get("scope"))
+
+	claims := ExternalProviderClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err = p.ParseWithClaims(q.Get("state"), &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.API.config.OperatorToken), nil
+	})
+	ts.Require().NoError(err)
+
+	ts.Equal("discord", claims.Provider)
+	ts.Equal(ts.Config.SiteURL, claims.SiteURL)
+}
+
+func DiscordTestSignupSetup(ts *ExternalTestSuite, tokenCount *int, userCount *int, code string, user string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/oauth2/token":
+			*tokenCount++
+			ts.Equal(code, r.FormValue("code"))
+			ts.Equal("authorization_code", r.FormValue("grant_type"))
+			ts.Equal(ts.Config.External.Discord.RedirectURI, r.FormValue("redirect_uri"))
+
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"discord_token","expires_in":100000}`)
+		case "/api/users/@me":
+			*userCount++
+			ts.Equal("Bearer discord_token", r.Header.Get("Authorization"))
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprint(w, user)
+		default:
+			w.WriteHeader(500)
+			ts.Fail("unknown discord oauth call %s", r.URL.Path)
+		}
+	}))
+
+	ts.Config.External.Discord.URL = server.URL
+
+	return server
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalDiscord_AuthorizationCode() {
+	tokenCount, userCount := 0, 0
+	code := "authcode"
+	discordUser := `{"id":"80351110224678912","username":"discordtest","global_name":"Discord Test","avatar":"8342729096ea3675442027381ff50dfe","email":"discord@example.com","verified":true}`
+	server := DiscordTestSignupSetup(ts, &tokenCount, &userCount, code, discordUser)
+	defer server.Close()
+
+	u := performAuthorization(ts, "discord", code, "")
+
+	assertAuthorizationSuccess(ts, u, tokenCount, userCount, "discord@example.com", "Discord Test", "https://cdn.discordapp.com/avatars/80351110224678912/8342729096ea3675442027381ff50dfe.png")
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalDiscordUnverifiedEmail() {
+	tokenCount, userCount := 0, 0
+	code := "authcode"
+	discordUser := `{"id":"80351110224678912","username":"discordtest","email":"discord@example.com","verified":false}`
+	server := DiscordTestSignupSetup(ts, &tokenCount, &userCount, code, discordUser)
+	defer server.Close()
+
+	u := performAuthorization(ts, "discord", code, "")
+
+	// the email has to be confirmed before a token is issued
+	v, err := url.ParseQuery(u.Fragment)
+	ts.Require().NoError(err)
+	ts.Empty(v.Get("error"))
+	ts.Empty(v.Get("access_token"))
+
+	user, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "discord@example.com", ts.Config.JWT.Aud)
+	ts.Require().NoError(err)
+	ts.False(user.IsConfirmed())
+	ts.Equal("discordtest", user.UserMetaData["full_name"])
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalDiscordErrorWhenEmptyEmail() {
+	tokenCount, userCount := 0, 0
+	code := "authcode"
+	discordUser := `{"id":"80351110224678912","username":"discordtest","verified":false}`
+	server := DiscordTestSignupSetup(ts, &tokenCount, &userCount, code, discordUser)
+	defer server.Close()
+
+	u := performAuthorization(ts, "discord", code, "")
+
+	assertAuthorizationFailure(ts, u, "Error getting user email from external provider", "server_error", "discord@example.com")
+}
@@ -7,6 +7,8 @@ import (
 	"net/url"
 
 	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
 )
 
 func (ts *ExternalTestSuite) TestSignupExternalGithub() {
@@ -217,3 +219,142 @@ func (ts *ExternalTestSuite) TestInviteTokenExternalGitHubErrorWhenEmailDoesntMa
 
 	assertAuthorizationFailure(ts, u, "Invited email does not match emails from external provider", "invalid_request", "")
 }
+
+func (ts *ExternalTestSuite) TestSignupExternalGithubScopes() {
+	ts.Config.External.Github.AdditionalScopes = []string{"repo", "read:org"}
+	ts.Config.External.Github.AuthParams = []string{"allow_signup", "state"}
+	defer func() {
+		ts.Config.External.Github.AdditionalScopes = nil
+		ts.Config.External.Github.AuthParams = nil
+	}()
+
+	authorize := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/authorize?provider=github&"+query, nil)
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := authorize("scopes=admin:org")
+	ts.Require().Equal(http.StatusBadRequest, w.Code)
+
+	w = authorize(url.Values{"scopes": {"repo"}, "allow_signup": {"false"}, "login": {"someone"}, "state": {"forged"}}.Encode())
+	ts.Require().Equal(http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err)
+	q := u.Query()
+	ts.Equal("user:email repo", q.Get("scope"))
+	ts.Equal("false", q.Get("allow_signup"))
+	ts.Empty(q.Get("login"))
+
+	claims := ExternalProviderClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err = p.ParseWithClaims(q.Get("state"), &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.API.config.OperatorToken), nil
+	})
+	ts.Require().NoError(err)
+	ts.Equal("repo", claims.Scopes)
+	ts.Equal(map[string]string{"allow_signup": "false"}, claims.AuthParams)
+
+	// the scopes requested are recorded if the provider doesn't list the
+	// granted ones
+	id, email := 123, "github@example.com"
+	server := githubAccountServer(ts, &id, &email)
+	defer server.Close()
+	externalCallback(ts, w.Header().Get("Location"))
+
+	identity, err := models.FindIdentityByProviderID(ts.API.db, ts.instanceID, "github", "123")
+	ts.Require().NoError(err)
+	ts.Equal("user:email repo", identity.Scopes)
+}
+
+func githubGroupsServer(ts *ExternalTestSuite) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			fmt.Fprint(w, `{"access_token":"github_token","expires_in":100000}`)
+		case "/api/v3/user":
+			fmt.Fprint(w, `{"id":123,"name":"GitHub Test","avatar_url":"http://example.com/avatar"}`)
+		case "/api/v3/user/emails":
+			fmt.Fprint(w, `[{"email":"github@example.com","primary":true,"verified":true}]`)
+		case "/api/v3/user/orgs":
+			// the organizations are listed a page at a time
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=2&per_page=100>; rel="next", <http://%[1]s%[2]s?page=2&per_page=100>; rel="last"`, r.Host, r.URL.Path))
+				fmt.Fprint(w, `[{"login":"other"}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"login":"acme"}]`)
+		case "/api/v3/user/teams":
+			fmt.Fprint(w, `[{"slug":"admins","organization":{"login":"acme"}}]`)
+		default:
+			w.WriteHeader(500)
+			ts.Fail("unknown github oauth call %s", r.URL.Path)
+		}
+	}))
+	ts.Config.External.Github.URL = server.URL
+	return server
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalGithubGroups() {
+	ts.Config.External.Groups = conf.GroupsConfiguration{
+		Rules: conf.GroupRules{
+			{Provider: "github", Group: "acme/admins", Role: "admin", Roles: []string{"admin"}},
+			{Provider: "github", Group: "acme", Role: "member", Roles: []string{"member"}},
+		},
+		Required: true,
+	}
+	defer func() { ts.Config.External.Groups = conf.GroupsConfiguration{} }()
+	server := githubGroupsServer(ts)
+	defer server.Close()
+
+	w := performAuthorizationRequest(ts, "github", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err)
+	ts.Equal("user:email read:org", u.Query().Get("scope"))
+
+	v := externalCallback(ts, w.Header().Get("Location"))
+	ts.Require().NotEmpty(v.Get("access_token"))
+
+	user, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "github@example.com", ts.Config.JWT.Aud)
+	ts.Require().NoError(err)
+	ts.Equal("admin", user.Role)
+	ts.Equal([]interface{}{"admin", "member"}, user.AppMetaData["roles"])
+
+	// roles follow the groups on every login
+	ts.Config.External.Groups.Rules = ts.Config.External.Groups.Rules[1:]
+	w = performAuthorizationRequest(ts, "github", "")
+	externalCallback(ts, w.Header().Get("Location"))
+	user, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "github@example.com", ts.Config.JWT.Aud)
+	ts.Require().NoError(err)
+	ts.Equal("member", user.Role)
+	ts.Equal([]interface{}{"member"}, user.AppMetaData["roles"])
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalGithubGroupsRequired() {
+	ts.Config.External.Groups = conf.GroupsConfiguration{
+		Rules:    conf.GroupRules{{Provider: "github", Group: "other-org", Role: "admin"}},
+		Required: true,
+	}
+	defer func() { ts.Config.External.Groups = conf.GroupsConfiguration{} }()
+	server := githubGroupsServer(ts)
+	defer server.Close()
+
+	u := performAuthorization(ts, "github", "authcode", "")
+	assertAuthorizationFailure(ts, u, "User is not a member of an allowed group", "access_denied", "github@example.com")
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalGithubGroupsRequiredMixedCase() {
+	ts.Config.External.Groups = conf.GroupsConfiguration{
+		Rules:    conf.GroupRules{{Provider: "github", Group: "missing-org", Role: "admin"}},
+		Required: true,
+	}
+	defer func() { ts.Config.External.Groups = conf.GroupsConfiguration{} }()
+	server := githubGroupsServer(ts)
+	defer server.Close()
+
+	u := performAuthorization(ts, "GitHub", "authcode", "")
+	assertAuthorizationFailure(ts, u, "User is not a member of an allowed group", "access_denied", "github@example.com")
+}
@@ -7,6 +7,8 @@ import (
 	"net/url"
 
 	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
 )
 
 func (ts *ExternalTestSuite) TestSignupExternalGitlab() {
@@ -205,3 +207,43 @@ func (ts *ExternalTestSuite) TestInviteTokenExternalGitLabErrorWhenEmailDoesntMa
 
 	assertAuthorizationFailure(ts, u, "Invited email does not match emails from external provider", "invalid_request", "")
 }
+
+func (ts *ExternalTestSuite) TestSignupExternalGitlabGroups() {
+	ts.Config.Mailer.Autoconfirm = true
+	ts.Config.External.Groups = conf.GroupsConfiguration{
+		Rules: conf.GroupRules{{Provider: "gitlab", Group: "acme/backend", Role: "developer"}},
+	}
+	defer func() { ts.Config.External.Groups = conf.GroupsConfiguration{} }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth/token":
+			fmt.Fprint(w, `{"access_token":"gitlab_token","expires_in":100000}`)
+		case "/api/v4/user":
+			fmt.Fprint(w, `{"id":123,"name":"GitLab Test","email":"gitlab@example.com","confirmed_at":"2020-01-01T00:00:00Z"}`)
+		case "/api/v4/user/emails":
+			fmt.Fprint(w, `[]`)
+		case "/api/v4/groups":
+			// the groups are listed a page at a time
+			if r.URL.Query().Get("page") != "2" {
+				w.Header().Set("X-Next-Page", "2")
+				fmt.Fprint(w, `[{"full_path":"acme"}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"full_path":"acme/backend"}]`)
+		default:
+			w.WriteHeader(500)
+			ts.Fail("unknown gitlab oauth call %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	ts.Config.External.Gitlab.URL = server.URL
+
+	u := performAuthorization(ts, "gitlab", "authcode", "")
+	ts.Require().NotEmpty(u.Fragment)
+
+	user, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "gitlab@example.com", ts.Config.JWT.Aud)
+	ts.Require().NoError(err)
+	ts.Equal("developer", user.Role)
+}
@@ -11,7 +11,7 @@ import (
 // loadOAuthState parses the `state` query parameter as a JWS payload,
 // extracting the provider requested
 func (a *API) loadOAuthState(w http.ResponseWriter, r *http.Request) (context.Context, error) {
-	state := r.URL.Query().Get("state")
+	state := r.FormValue("state")
 	if state == "" {
 		return nil, badRequestError("OAuth state parameter missing")
 	}
@@ -21,14 +21,12 @@ func (a *API) loadOAuthState(w http.ResponseWriter, r *http.Request) (context.Co
 }
 
 func (a *API) oAuthCallback(ctx context.Context, r *http.Request, providerType string) (*provider.UserProvidedData, error) {
-	rq := r.URL.Query()
-
-	extError := rq.Get("error")
+	extError := r.FormValue("error")
 	if extError != "" {
-		return nil, oauthError(extError, rq.Get("error_description"))
+		return nil, oauthError(extError, r.FormValue("error_description"))
 	}
 
-	oauthCode := rq.Get("code")
+	oauthCode := r.FormValue("code")
 	if oauthCode == "" {
 		return nil, badRequestError("Authorization code missing")
 	}
@@ -48,10 +46,16 @@ func (a *API) oAuthCallback(ctx context.Context, r *http.Request, providerType s
 		return nil, internalServerError("Unable to exchange external code for %s provider", providerType)
 	}
 
-	userData, err := oAuthProvider.GetUserData(ctx, tok)
+	providerCtx := provider.WithCallbackValues(ctx, r.Form)
+	if len(a.getConfig(ctx).External.Groups.RulesFor(providerType)) > 0 {
+		providerCtx = provider.WithGroups(providerCtx)
+	}
+	userData, err := oAuthProvider.GetUserData(providerCtx, tok)
 	if err != nil {
 		return nil, internalServerError("Error getting user email from external provider").WithInternalError(err)
 	}
+	userData.Token = tok
+	userData.Scopes = provider.GrantedScopes(tok, provider.Scopes(oAuthProvider, getExternalScopes(ctx)))
 
 	return userData, nil
 }
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/models"
+)
+
+// OIDCTestSignupSetup fakes an OpenID Connect issuer configured as the okta
+// provider. Its ID tokens carry the nonce of the last authorization request.
+func OIDCTestSignupSetup(ts *ExternalTestSuite, nonce *string, email string) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	ts.Require().NoError(err)
+	jwk, err := crypto.NewJWK(&key.PublicKey, "k1", "RS256")
+	ts.Require().NoError(err)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/authorize","token_endpoint":"%[1]s/token","jwks_uri":"%[1]s/keys"}`, server.URL)
+		case "/keys":
+			ts.Require().NoError(json.NewEncoder(w).Encode(&crypto.JWKSet{Keys: []*crypto.JWK{jwk}}))
+		case "/token":
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+				"iss":            server.URL,
+				"sub":            "okta-user",
+				"aud":            "okta-client",
+				"exp":            time.Now().Add(time.Hour).Unix(),
+				"nonce":          *nonce,
+				"email":          email,
+				"email_verified": true,
+				"name":           "Okta Test",
+				"picture":        "http://example.com/avatar",
+			})
+			token.Header["kid"] = "k1"
+			idToken, err := token.SignedString(key)
+			ts.Require().NoError(err)
+			fmt.Fprintf(w, `{"access_token":"okta_token","token_type":"bearer","expires_in":3600,"id_token":%q}`, idToken)
+		default:
+			w.WriteHeader(500)
+			ts.Fail("unknown oidc call %s", r.URL.Path)
+		}
+	}))
+
+	ts.Config.External.OIDC = conf.OIDCProviders{
+		"okta": {
+			Enabled:     true,
+			Name:        "Okta",
+			Issuer:      server.URL,
+			ClientID:    "okta-client",
+			Secret:      "okta-secret",
+			RedirectURI: "https://example.netlify.com/callback",
+		},
+	}
+	return server
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalOIDC() {
+	nonce := ""
+	server := OIDCTestSignupSetup(ts, &nonce, "okta@example.com")
+	defer server.Close()
+	defer func() { ts.Config.External.OIDC = nil }()
+
+	w := performAuthorizationRequest(ts, "okta", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err)
+	ts.Equal(server.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	ts.Equal("openid email profile", u.Query().Get("scope"))
+	nonce = u.Query().Get("nonce")
+	ts.Require().NotEmpty(nonce)
+
+	v := externalCallback(ts, w.Header().Get("Location"))
+	ts.Require().Empty(v.Get("error_description"))
+	ts.NotEmpty(v.Get("access_token"))
+
+	user, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "okta@example.com", ts.Config.JWT.Aud)
+	ts.Require().NoError(err)
+	ts.Equal("Okta Test", user.UserMetaData["full_name"])
+	ts.Equal("okta", user.AppMetaData["provider"])
+	identity, err := models.FindIdentityByProviderID(ts.API.db, ts.instanceID, "okta", "okta-user")
+	ts.Require().NoError(err)
+	ts.Equal(user.ID, identity.UserID)
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalOIDCNonceMismatch() {
+	nonce := "another-request"
+	server := OIDCTestSignupSetup(ts, &nonce, "okta@example.com")
+	defer server.Close()
+	defer func() { ts.Config.External.OIDC = nil }()
+
+	w := performAuthorizationRequest(ts, "okta", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+
+	v := externalCallback(ts, w.Header().Get("Location"))
+	ts.Equal("Error getting user email from external provider", v.Get("error_description"))
+	_, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "okta@example.com", ts.Config.JWT.Aud)
+	ts.True(models.IsNotFoundError(err))
+}
@@ -48,11 +48,17 @@ func (a *API) samlCallback(r *http.Request, ctx context.Context) (*provider.User
 		return nil, internalServerError("SAML Assertion is missing")
 	}
 	userData := &provider.UserProvidedData{
+		ID: assertionInfo.NameID,
 		Emails: []provider.Email{{
 			Email:    assertionInfo.NameID,
 			Verified: true,
 		}},
 	}
+	groupsAttribute := config.External.Saml.GroupsAttribute
+	if groupsAttribute == "" {
+		groupsAttribute = "groups"
+	}
+	userData.Groups = assertionInfo.Values.GetAll(groupsAttribute)
 	return userData, nil
 }
 
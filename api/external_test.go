@@ -37,6 +37,7 @@ func TestExternal(t *testing.T) {
 func (ts *ExternalTestSuite) SetupTest() {
 	ts.Config.DisableSignup = false
 	ts.Config.Mailer.Autoconfirm = false
+	ts.Config.External.Email.Disabled = false
 
 	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
 }
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+func (ts *ExternalTestSuite) TestSignupExternalTwitch() {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/authorize?provider=twitch", nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	ts.Require().Equal(http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err, "redirect url parse failed")
+	q := u.Query()
+	ts.Equal(ts.Config.External.Twitch.RedirectURI, q.Get("redirect_uri"))
+	ts.Equal(ts.Config.External.Twitch.ClientID, q.Get("client_id"))
+	ts.Equal("code", q.Get("response_type"))
+	ts.Equal("user:read:email", q.Get("scope"))
+
+	claims := ExternalProviderClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err = p.ParseWithClaims(q.Get("state"), &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.API.config.OperatorToken), nil
+	})
+	ts.Require().NoError(err)
+
+	ts.Equal("twitch", claims.Provider)
+	ts.Equal(ts.Config.SiteURL, claims.SiteURL)
+}
+
+func TwitchTestSignupSetup(ts *ExternalTestSuite, tokenCount *int, userCount *int, code string, users string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			*tokenCount++
+			ts.Equal(code, r.FormValue("code"))
+			ts.Equal("authorization_code", r.FormValue("grant_type"))
+			ts.Equal(ts.Config.External.Twitch.RedirectURI, r.FormValue("redirect_uri"))
+			ts.Equal(ts.Config.External.Twitch.ClientID, r.FormValue("client_id"))
+
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"twitch_token","expires_in":100000,"token_type":"bearer"}`)
+		case "/helix/users":
+			*userCount++
+			ts.Equal("Bearer twitch_token", r.Header.Get("Authorization"))
+			ts.Equal(ts.Config.External.Twitch.ClientID, r.Header.Get("Client-Id"))
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprint(w, users)
+		default:
+			w.WriteHeader(500)
+			ts.Fail("unknown twitch oauth call %s", r.URL.Path)
+		}
+	}))
+
+	ts.Config.External.Twitch.URL = server.URL
+
+	return server
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalTwitch_AuthorizationCode() {
+	tokenCount, userCount := 0, 0
+	code := "authcode"
+	users := `{"data":[{"id":"141981764","login":"twitchtest","display_name":"Twitch Test","profile_image_url":"http://example.com/avatar","email":"twitch@example.com"}]}`
+	server := TwitchTestSignupSetup(ts, &tokenCount, &userCount, code, users)
+	defer server.Close()
+
+	u := performAuthorization(ts, "twitch", code, "")
+
+	assertAuthorizationSuccess(ts, u, tokenCount, userCount, "twitch@example.com", "Twitch Test", "http://example.com/avatar")
+}
+
+func (ts *ExternalTestSuite) TestSignupExternalTwitchErrorWhenEmptyEmail() {
+	tokenCount, userCount := 0, 0
+	code := "authcode"
+	users := `{"data":[{"id":"141981764","login":"twitchtest","display_name":"Twitch Test"}]}`
+	server := TwitchTestSignupSetup(ts, &tokenCount, &userCount, code, users)
+	defer server.Close()
+
+	u := performAuthorization(ts, "twitch", code, "")
+
+	assertAuthorizationFailure(ts, u, "Error getting user email from external provider", "server_error", "twitch@example.com")
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// groupRoles returns the role and the roles rules give to a member of
+// groups, and whether any rule matched. The role is empty if no matching
+// rule has one.
+func groupRoles(rules []conf.GroupRule, groups []string) (string, []string, bool) {
+	member := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		member[g] = true
+	}
+
+	role := ""
+	roles := []string{}
+	seen := make(map[string]bool)
+	matched := false
+	for _, rule := range rules {
+		if !member[rule.Group] {
+			continue
+		}
+		matched = true
+		if role == "" {
+			role = rule.Role
+		}
+		for _, r := range rule.Roles {
+			if !seen[r] {
+				seen[r] = true
+				roles = append(roles, r)
+			}
+		}
+	}
+	return role, roles, matched
+}
+
+// checkGroups rejects users who are in none of the groups with rules for
+// their provider, if the instance requires them to be.
+func checkGroups(config *conf.Configuration, providerType string, userData *provider.UserProvidedData) error {
+	rules := config.External.Groups.RulesFor(providerType)
+	if !config.External.Groups.Required || len(rules) == 0 {
+		return nil
+	}
+	if _, _, matched := groupRoles(rules, userData.Groups); !matched {
+		return forbiddenError("User is not a member of an allowed group")
+	}
+	return nil
+}
+
+// applyGroups sets the role of user and the roles in their app metadata
+// from the groups of their external account. Users in no group with a role
+// get the default one.
+func (a *API) applyGroups(ctx context.Context, tx *storage.Connection, user *models.User, providerType string, userData *provider.UserProvidedData) error {
+	config := a.getConfig(ctx)
+	rules := config.External.Groups.RulesFor(providerType)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	role, roles, _ := groupRoles(rules, userData.Groups)
+	if role == "" {
+		role = config.JWT.DefaultGroupName
+	}
+	if err := user.SetRole(tx, role); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+
+	metadataRoles := make([]interface{}, len(roles))
+	for i, r := range roles {
+		metadataRoles[i] = r
+	}
+	if err := user.UpdateAppMetaData(tx, map[string]interface{}{"roles": metadataRoles}); err != nil {
+		return internalServerError("Database error updating user").WithInternalError(err)
+	}
+	return nil
+}
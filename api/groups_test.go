@@ -0,0 +1,31 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupRoles(t *testing.T) {
+	rules := []conf.GroupRule{
+		{Provider: "github", Group: "acme/admins", Role: "admin", Roles: []string{"admin", "editor"}},
+		{Provider: "github", Group: "acme/editors", Roles: []string{"editor"}},
+		{Provider: "github", Group: "acme", Role: "member"},
+	}
+
+	role, roles, matched := groupRoles(rules, []string{"acme", "acme/editors"})
+	assert.True(t, matched)
+	assert.Equal(t, "member", role)
+	assert.Equal(t, []string{"editor"}, roles)
+
+	role, roles, matched = groupRoles(rules, []string{"acme", "acme/admins", "acme/editors"})
+	assert.True(t, matched)
+	assert.Equal(t, "admin", role)
+	assert.Equal(t, []string{"admin", "editor"}, roles)
+
+	role, roles, matched = groupRoles(rules, []string{"other"})
+	assert.False(t, matched)
+	assert.Empty(t, role)
+	assert.Empty(t, roles)
+}
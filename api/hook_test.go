@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage/test"
@@ -428,3 +429,85 @@ func TestUserModifiedHookFromClaims(t *testing.T) {
 }
 
 func squash(f func() error) { _ = f }
+
+func TestTokenHookAddsClaims(t *testing.T) {
+	iid := uuid.Must(uuid.NewV4())
+	user, err := models.NewUser(iid, "test@truth.com", "thisisapassword", "", nil)
+	require.NoError(t, err)
+
+	var callCount int
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		defer squash(r.Body.Close)
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		data := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(raw, &data))
+
+		assert.Equal(t, "identity_token", r.Header.Get("X-Netlify-Event"))
+		assert.Equal(t, "test@truth.com", data["user"].(map[string]interface{})["email"])
+		claims := data["claims"].(map[string]interface{})
+		assert.Equal(t, user.ID.String(), claims["sub"])
+
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"claims": map[string]interface{}{
+				"role":  "editor",
+				"email": "other@truth.com",
+				"https://hasura.io/jwt/claims": map[string]interface{}{
+					"x-hasura-default-role": "editor",
+				},
+				"sub": "someone-else",
+				"exp": 0,
+			},
+		}))
+	}))
+	defer svr.Close()
+
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+
+	config := &conf.Configuration{
+		Webhook: conf.WebhookConfig{
+			URL:    svr.URL,
+			Events: []string{TokenEvent},
+		},
+	}
+
+	claims := newAccessTokenClaims(user, time.Hour, nil)
+	require.NoError(t, triggerTokenHook(context.Background(), user, claims, iid, config))
+	assert.Equal(t, 1, callCount)
+
+	key := newHMACSigningKey("test-secret")
+	tokenStr, err := key.sign(claims)
+	require.NoError(t, err)
+
+	parsed := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenStr, parsed, func(*jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "editor", parsed["role"])
+	assert.Equal(t, "other@truth.com", parsed["email"])
+	assert.Equal(t, "editor", parsed["https://hasura.io/jwt/claims"].(map[string]interface{})["x-hasura-default-role"])
+	assert.Equal(t, user.ID.String(), parsed["sub"])
+	assert.Equal(t, float64(claims.ExpiresAt), parsed["exp"])
+}
+
+func TestTokenHookNotSubscribed(t *testing.T) {
+	iid := uuid.Must(uuid.NewV4())
+	user, err := models.NewUser(iid, "test@truth.com", "thisisapassword", "", nil)
+	require.NoError(t, err)
+
+	config := &conf.Configuration{
+		Webhook: conf.WebhookConfig{
+			URL:    "http://localhost:1",
+			Events: []string{SignupEvent},
+		},
+	}
+
+	claims := newAccessTokenClaims(user, time.Hour, nil)
+	require.NoError(t, triggerTokenHook(context.Background(), user, claims, iid, config))
+	assert.Empty(t, claims.Custom)
+}
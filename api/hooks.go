@@ -26,14 +26,17 @@ import (
 type HookEvent string
 
 const (
-	headerHookSignature = "x-webhook-signature"
-	defaultHookRetries  = 3
-	gotrueIssuer        = "gotrue"
-	ValidateEvent       = "validate"
-	SignupEvent         = "signup"
-	LoginEvent          = "login"
-	UserDeletedEvent    = "userdeleted"
-	UserModifiedEvent   = "usermodified"
+	headerHookSignature   = "x-webhook-signature"
+	defaultHookRetries    = 3
+	gotrueIssuer          = "gotrue"
+	ValidateEvent         = "validate"
+	SignupEvent           = "signup"
+	LoginEvent            = "login"
+	UserDeletedEvent      = "userdeleted"
+	UserModifiedEvent     = "usermodified"
+	TokenReusedEvent      = "tokenreused"
+	TokenEvent            = "token"
+	RecoveryCodeUsedEvent = "recoverycodeused"
 )
 
 var defaultTimeout = time.Second * 5
@@ -158,29 +161,50 @@ func closeBody(rsp *http.Response) {
 	}
 }
 
-func triggerEventHooks(ctx context.Context, conn *storage.Connection, event HookEvent, user *models.User, instanceID uuid.UUID, config *conf.Configuration) error {
+// hookTarget is an endpoint an event is sent to, with the secret its requests are signed with.
+type hookTarget struct {
+	url    *url.URL
+	secret string
+}
+
+// eventHookTargets returns the endpoints of event: the webhook when it's
+// configured and subscribed to the event, otherwise the function hooks.
+func eventHookTargets(ctx context.Context, event HookEvent, config *conf.Configuration) ([]hookTarget, error) {
 	if config.Webhook.URL != "" {
 		hookURL, err := url.Parse(config.Webhook.URL)
 		if err != nil {
-			return errors.Wrapf(err, "Failed to parse Webhook URL")
+			return nil, errors.Wrapf(err, "Failed to parse Webhook URL")
 		}
 		if !config.Webhook.HasEvent(string(event)) {
-			return nil
+			return nil, nil
 		}
-		return triggerHook(ctx, hookURL, config.Webhook.Secret, conn, event, user, instanceID, config)
+		return []hookTarget{{url: hookURL, secret: config.Webhook.Secret}}, nil
 	}
 
 	fun := getFunctionHooks(ctx)
 	if fun == nil {
-		return nil
+		return nil, nil
 	}
 
+	targets := []hookTarget{}
 	for _, eventHookURL := range fun[string(event)] {
 		hookURL, err := url.Parse(eventHookURL)
 		if err != nil {
-			return errors.Wrapf(err, "Failed to parse Event Function Hook URL")
+			return nil, errors.Wrapf(err, "Failed to parse Event Function Hook URL")
 		}
-		err = triggerHook(ctx, hookURL, config.JWT.Secret, conn, event, user, instanceID, config)
+		targets = append(targets, hookTarget{url: hookURL, secret: config.JWT.Secret})
+	}
+	return targets, nil
+}
+
+func triggerEventHooks(ctx context.Context, conn *storage.Connection, event HookEvent, user *models.User, instanceID uuid.UUID, config *conf.Configuration) error {
+	targets, err := eventHookTargets(ctx, event, config)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		err = triggerHook(ctx, target.url, target.secret, conn, event, user, instanceID, config)
 		if err != nil {
 			return err
 		}
@@ -188,35 +212,26 @@ func triggerEventHooks(ctx context.Context, conn *storage.Connection, event Hook
 	return nil
 }
 
-// TODO: use ctx for request cancellation in webhook calls
-func triggerHook(ctx context.Context, hookURL *url.URL, secret string, conn *storage.Connection, event HookEvent, user *models.User, instanceID uuid.UUID, config *conf.Configuration) error {
+// sendHook posts the payload of event to hookURL and returns the response body, if any.
+func sendHook(hookURL *url.URL, secret string, event HookEvent, payload interface{}, instanceID uuid.UUID, config *conf.Configuration) ([]byte, error) {
 	if !hookURL.IsAbs() {
 		siteURL, err := url.Parse(config.SiteURL)
 		if err != nil {
-			return errors.Wrapf(err, "Failed to parse Site URL")
+			return nil, errors.Wrapf(err, "Failed to parse Site URL")
 		}
 		hookURL.Scheme = siteURL.Scheme
 		hookURL.Host = siteURL.Host
 		hookURL.User = siteURL.User
 	}
 
-	payload := struct {
-		Event      HookEvent    `json:"event"`
-		InstanceID uuid.UUID    `json:"instance_id,omitempty"`
-		User       *models.User `json:"user"`
-	}{
-		Event:      event,
-		InstanceID: instanceID,
-		User:       user,
-	}
-	data, err := json.Marshal(&payload)
+	data, err := json.Marshal(payload)
 	if err != nil {
-		return internalServerError("Failed to serialize the data for signup webhook").WithInternalError(err)
+		return nil, internalServerError("Failed to serialize the data for signup webhook").WithInternalError(err)
 	}
 
 	sha, err := checksum(data)
 	if err != nil {
-		return internalServerError("Failed to checksum the data for signup webhook").WithInternalError(err)
+		return nil, internalServerError("Failed to checksum the data for signup webhook").WithInternalError(err)
 	}
 
 	claims := webhookClaims{
@@ -246,45 +261,124 @@ func triggerHook(ctx context.Context, hookURL *url.URL, secret string, conn *sto
 			body.Close()
 		}
 	}()
-	if err == nil && body != nil {
-		if event == UserDeletedEvent {
-			return nil
+	if err != nil || body == nil {
+		return nil, err
+	}
+
+	// handle case where response from the trigger is streamed but has no
+	// Body
+	rsp, err := io.ReadAll(body)
+	if err != nil {
+		return nil, internalServerError("Webhook returned malformed BODY: %v", err).WithInternalError(err)
+	}
+	return rsp, nil
+}
+
+// TODO: use ctx for request cancellation in webhook calls
+func triggerHook(ctx context.Context, hookURL *url.URL, secret string, conn *storage.Connection, event HookEvent, user *models.User, instanceID uuid.UUID, config *conf.Configuration) error {
+	payload := struct {
+		Event      HookEvent    `json:"event"`
+		InstanceID uuid.UUID    `json:"instance_id,omitempty"`
+		User       *models.User `json:"user"`
+	}{
+		Event:      event,
+		InstanceID: instanceID,
+		User:       user,
+	}
+
+	data, err := sendHook(hookURL, secret, event, &payload, instanceID, config)
+	if err != nil || event == UserDeletedEvent || len(data) == 0 {
+		return err
+	}
+
+	webhookRsp := &WebhookResponse{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err = decoder.Decode(webhookRsp); err != nil {
+		return internalServerError("Webhook returned malformed JSON: %v", err).WithInternalError(err)
+	}
+	return conn.Transaction(func(tx *storage.Connection) error {
+		if webhookRsp.UserMetaData != nil {
+			user.UserMetaData = nil
+			if terr := user.UpdateUserMetaData(tx, webhookRsp.UserMetaData); terr != nil {
+				return terr
+			}
+		}
+		if webhookRsp.AppMetaData != nil {
+			user.AppMetaData = nil
+			if terr := user.UpdateAppMetaData(tx, webhookRsp.AppMetaData); terr != nil {
+				return terr
+			}
 		}
+		return nil
+	})
+}
 
-		// handle case where response from the trigger is streamed but has no
-		// Body
-		data, err := io.ReadAll(body)
-		if err != nil {
-			return internalServerError("Webhook returned malformed BODY: %v", err).WithInternalError(err)
+// protectedTokenClaims can't be changed by the token hook.
+var protectedTokenClaims = map[string]bool{
+	"iss":          true,
+	"sub":          true,
+	"aud":          true,
+	"exp":          true,
+	"iat":          true,
+	"nbf":          true,
+	"jti":          true,
+	"session_id":   true,
+	"aal":          true,
+	"client_id":    true,
+	"scope":        true,
+	"is_anonymous": true,
+}
+
+// TokenHookResponse is the response of the token hook.
+type TokenHookResponse struct {
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// triggerTokenHook sends the proposed claims of an access token to the token
+// hooks, and adds the claims they return to it.
+func triggerTokenHook(ctx context.Context, user *models.User, claims *GoTrueClaims, instanceID uuid.UUID, config *conf.Configuration) error {
+	targets, err := eventHookTargets(ctx, TokenEvent, config)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		payload := struct {
+			Event      HookEvent     `json:"event"`
+			InstanceID uuid.UUID     `json:"instance_id,omitempty"`
+			User       *models.User  `json:"user"`
+			Claims     *GoTrueClaims `json:"claims"`
+		}{
+			Event:      TokenEvent,
+			InstanceID: instanceID,
+			User:       user,
+			Claims:     claims,
 		}
 
+		data, err := sendHook(target.url, target.secret, TokenEvent, &payload, instanceID, config)
+		if err != nil {
+			return err
+		}
 		if len(data) == 0 {
-			return nil
+			continue
 		}
 
-		bodyReader := bytes.NewReader(data)
-		webhookRsp := &WebhookResponse{}
-		decoder := json.NewDecoder(bodyReader)
-		if err = decoder.Decode(webhookRsp); err != nil {
+		hookRsp := &TokenHookResponse{}
+		if err := json.Unmarshal(data, hookRsp); err != nil {
 			return internalServerError("Webhook returned malformed JSON: %v", err).WithInternalError(err)
 		}
-		return conn.Transaction(func(tx *storage.Connection) error {
-			if webhookRsp.UserMetaData != nil {
-				user.UserMetaData = nil
-				if terr := user.UpdateUserMetaData(tx, webhookRsp.UserMetaData); terr != nil {
-					return terr
-				}
+		for name, value := range hookRsp.Claims {
+			if protectedTokenClaims[name] {
+				logrus.WithField("instance_id", instanceID).Warnf("Token hook tried to change the protected %s claim", name)
+				continue
 			}
-			if webhookRsp.AppMetaData != nil {
-				user.AppMetaData = nil
-				if terr := user.UpdateAppMetaData(tx, webhookRsp.AppMetaData); terr != nil {
-					return terr
-				}
+			if claims.Custom == nil {
+				claims.Custom = make(map[string]interface{})
 			}
-			return nil
-		})
+			claims.Custom[name] = value
+		}
 	}
-	return err
+	return nil
 }
 
 func watchForConnection(req *http.Request) (*connectionWatcher, *http.Request) {
@@ -0,0 +1,410 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"golang.org/x/oauth2"
+)
+
+// verifiedEmail returns the email of an external account to trust, the
+// primary one among the verified emails.
+func verifiedEmail(userData *provider.UserProvidedData, autoconfirm bool) *provider.Email {
+	var emailData *provider.Email
+	for i, e := range userData.Emails {
+		if e.Verified || autoconfirm {
+			if emailData == nil || e.Primary {
+				emailData = &userData.Emails[i]
+			}
+		}
+	}
+	return emailData
+}
+
+// identityData returns the data of an external account kept on its identity.
+func identityData(userData *provider.UserProvidedData, email string) map[string]interface{} {
+	data := make(map[string]interface{})
+	for k, v := range userData.Metadata {
+		if v != "" {
+			data[k] = v
+		}
+	}
+	if email != "" {
+		data["email"] = email
+	}
+	return data
+}
+
+// saveIdentity links the external account to user, or records a sign-in if
+// it already is. Accounts without an ID at the provider are identified by
+// their email. The roles of user follow the groups of the account, the
+// granted scopes are recorded, and the token of the provider is kept if the
+// instance stores them.
+func (a *API) saveIdentity(ctx context.Context, tx *storage.Connection, user *models.User, providerType string, userData *provider.UserProvidedData, email string) (*models.Identity, error) {
+	identity, err := saveIdentityData(tx, user, providerType, userData, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.applyGroups(ctx, tx, user, providerType, userData); err != nil {
+		return nil, err
+	}
+
+	if len(userData.Scopes) > 0 {
+		if err := identity.SetScopes(tx, userData.Scopes); err != nil {
+			return nil, internalServerError("Database error updating identity").WithInternalError(err)
+		}
+	}
+
+	config := a.getConfig(ctx)
+	if userData.Token == nil || config.External.Tokens.EncryptionKey == "" {
+		return identity, nil
+	}
+	key, err := crypto.ParseEncryptionKey(config.External.Tokens.EncryptionKey)
+	if err != nil {
+		return nil, internalServerError("Error storing provider token").WithInternalError(err)
+	}
+	if err := identity.SetProviderToken(tx, key, newProviderToken(userData.Token)); err != nil {
+		return nil, internalServerError("Database error storing provider token").WithInternalError(err)
+	}
+	return identity, nil
+}
+
+func saveIdentityData(tx *storage.Connection, user *models.User, providerType string, userData *provider.UserProvidedData, email string) (*models.Identity, error) {
+	providerID := userData.ID
+	if providerID == "" {
+		providerID = email
+	}
+	if providerID == "" {
+		return nil, badRequestError("External account has no ID")
+	}
+
+	identity, err := models.FindIdentityByProviderID(tx, user.InstanceID, providerType, providerID)
+	if err != nil && !models.IsNotFoundError(err) {
+		return nil, internalServerError("Database error finding identity").WithInternalError(err)
+	}
+	if identity != nil {
+		if identity.UserID != user.ID {
+			return nil, unprocessableEntityError("External account is already linked to another user")
+		}
+		if err := identity.UpdateSignIn(tx, identityData(userData, email)); err != nil {
+			return nil, internalServerError("Database error updating identity").WithInternalError(err)
+		}
+		return identity, nil
+	}
+
+	identity, err = models.NewIdentity(user, providerType, providerID, identityData(userData, email))
+	if err != nil {
+		return nil, internalServerError("Error creating identity").WithInternalError(err)
+	}
+	if err := tx.Create(identity); err != nil {
+		return nil, internalServerError("Database error saving identity").WithInternalError(err)
+	}
+	return identity, nil
+}
+
+// linkIdentity adds the external account to the user who started linking
+// it. Anonymous users are upgraded with it.
+func (a *API) linkIdentity(ctx context.Context, tx *storage.Connection, userData *provider.UserProvidedData, instanceID uuid.UUID, linkUserID, providerType string) (*models.User, error) {
+	config := a.getConfig(ctx)
+	userID, err := uuid.FromString(linkUserID)
+	if err != nil {
+		return nil, badRequestError("OAuth state is invalid")
+	}
+	user, err := models.FindUserByInstanceIDAndID(tx, instanceID, userID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("%s", err.Error())
+		}
+		return nil, internalServerError("Database error finding user").WithInternalError(err)
+	}
+
+	var email string
+	if emailData := verifiedEmail(userData, config.Mailer.Autoconfirm); emailData != nil {
+		email = emailData.Email
+	}
+	identity, err := a.saveIdentity(ctx, tx, user, providerType, userData, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsAnonymous {
+		if err := a.linkAnonymousUser(ctx, tx, user, userData, instanceID, providerType); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := models.NewAuditLogEntry(tx, instanceID, user, models.IdentityLinkedAction, identityTraits(identity)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func identityTraits(identity *models.Identity) map[string]interface{} {
+	return map[string]interface{}{
+		"identity_id": identity.ID.String(),
+		"provider":    identity.Provider,
+	}
+}
+
+// linkCookieMaxAge matches how long the state of the provider is valid.
+const linkCookieMaxAge = 5 * time.Minute
+
+func linkCookieName(config *conf.Configuration) string {
+	return config.Cookie.Key + "_link"
+}
+
+func hashLinkVerifier(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkLinkVerifier checks that the callback of a link flow comes from the
+// browser that started it, so a link URL handed to someone else can't add
+// their account to the user.
+func checkLinkVerifier(r *http.Request, config *conf.Configuration, hash string) error {
+	cookie, err := r.Cookie(linkCookieName(config))
+	if err != nil || hash == "" || subtle.ConstantTimeCompare([]byte(hashLinkVerifier(cookie.Value)), []byte(hash)) != 1 {
+		return forbiddenError("Linking an account must be completed in the browser that started it")
+	}
+	return nil
+}
+
+// UserLink returns the URL the logged in user follows to link an external
+// account. The flow is bound to the browser through a cookie.
+func (a *API) UserLink(w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(r.Context())
+	user, err := getUserFromClaims(r.Context(), a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	verifier := crypto.SecureToken()
+	providerType := strings.ToLower(r.URL.Query().Get("provider"))
+	authURL, err := a.externalProviderURL(r, providerType, "", user.ID.String(), hashLinkVerifier(verifier))
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkCookieName(config),
+		Value:    verifier,
+		Expires:  time.Now().Add(linkCookieMaxAge),
+		MaxAge:   int(linkCookieMaxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		// providers like Apple post the callback from their own site
+		SameSite: http.SameSiteNoneMode,
+		Path:     "/",
+	})
+	return sendJSON(w, http.StatusOK, map[string]string{"url": authURL})
+}
+
+// UserIdentities lists the external accounts linked to the logged in user.
+func (a *API) UserIdentities(w http.ResponseWriter, r *http.Request) error {
+	user, err := getUserFromClaims(r.Context(), a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	identities, err := models.FindIdentitiesByUserID(a.db, user.InstanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding identities").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, identities)
+}
+
+// canSignInWithoutIdentity reports whether a user can sign in with their
+// confirmed email address or phone number, with a password or a one-time
+// link or code.
+func canSignInWithoutIdentity(config *conf.Configuration, user *models.User) bool {
+	if user.Email != "" && user.IsConfirmed() && !config.External.Email.Disabled {
+		return true
+	}
+	return user.Phone != "" && user.IsPhoneConfirmed() && config.External.Phone.Enabled
+}
+
+// UserIdentityDelete unlinks an external account from the logged in user,
+// who must keep a way to sign in.
+func (a *API) UserIdentityDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	id, err := uuid.FromString(chi.URLParam(r, "identity_id"))
+	if err != nil {
+		return badRequestError("identity_id must be an UUID")
+	}
+	identity, err := models.FindIdentityByUserIDAndID(a.db, instanceID, user.ID, id)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError("Identity not found")
+		}
+		return internalServerError("Database error finding identity").WithInternalError(err)
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		count, terr := models.CountIdentitiesByUserID(tx, instanceID, user.ID)
+		if terr != nil {
+			return internalServerError("Database error finding identities").WithInternalError(terr)
+		}
+		if count <= 1 && !canSignInWithoutIdentity(config, user) {
+			return unprocessableEntityError("The last identity of a user who can't sign in otherwise can't be unlinked")
+		}
+
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.IdentityUnlinkedAction, identityTraits(identity)); terr != nil {
+			return terr
+		}
+		if terr := tx.Destroy(identity); terr != nil {
+			return internalServerError("Database error deleting identity").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func newProviderToken(tok *oauth2.Token) *models.ProviderToken {
+	return &models.ProviderToken{
+		AccessToken:  tok.AccessToken,
+		TokenType:    tok.TokenType,
+		RefreshToken: tok.RefreshToken,
+		Expiry:       tok.Expiry,
+	}
+}
+
+// ProviderTokenResponse is a token of an external provider.
+type ProviderTokenResponse struct {
+	Provider    string `json:"provider"`
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type,omitempty"`
+	// ExpiresAt is the unix time the token expires at, if it does.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// UserIdentityToken returns the token of the provider for the identity of
+// the logged in user, refreshing it if it has expired.
+func (a *API) UserIdentityToken(w http.ResponseWriter, r *http.Request) error {
+	user, err := getUserFromClaims(r.Context(), a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+	return a.sendProviderToken(w, r, user)
+}
+
+// adminUserIdentityToken returns the token of the provider for the identity
+// of a user, refreshing it if it has expired.
+func (a *API) adminUserIdentityToken(w http.ResponseWriter, r *http.Request) error {
+	return a.sendProviderToken(w, r, getUser(r.Context()))
+}
+
+func (a *API) sendProviderToken(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	if config.External.Tokens.EncryptionKey == "" {
+		return notFoundError("Provider tokens are not stored")
+	}
+	key, err := crypto.ParseEncryptionKey(config.External.Tokens.EncryptionKey)
+	if err != nil {
+		return internalServerError("Error reading provider token").WithInternalError(err)
+	}
+
+	id, err := uuid.FromString(chi.URLParam(r, "identity_id"))
+	if err != nil {
+		return badRequestError("identity_id must be an UUID")
+	}
+
+	var resp *ProviderTokenResponse
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		// concurrent requests wait for the first one to refresh an expired
+		// token, since providers may only take a refresh token once
+		identity, terr := models.FindIdentityForUpdate(tx, user.InstanceID, user.ID, id)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return notFoundError("Identity not found")
+			}
+			return internalServerError("Database error finding identity").WithInternalError(terr)
+		}
+		token, terr := identity.ProviderToken(key)
+		if terr != nil {
+			return internalServerError("Error reading provider token").WithInternalError(terr)
+		}
+		if token == nil {
+			return notFoundError("Provider token not found")
+		}
+
+		tok := &oauth2.Token{
+			AccessToken:  token.AccessToken,
+			TokenType:    token.TokenType,
+			RefreshToken: token.RefreshToken,
+			Expiry:       token.Expiry,
+		}
+		if !tok.Valid() {
+			if tok, terr = a.refreshProviderToken(ctx, identity.Provider, tok); terr != nil {
+				return terr
+			}
+			if terr := identity.SetProviderToken(tx, key, newProviderToken(tok)); terr != nil {
+				return internalServerError("Database error storing provider token").WithInternalError(terr)
+			}
+		}
+
+		resp = &ProviderTokenResponse{
+			Provider:    identity.Provider,
+			AccessToken: tok.AccessToken,
+			TokenType:   tok.TokenType,
+		}
+		if !tok.Expiry.IsZero() {
+			resp.ExpiresAt = tok.Expiry.Unix()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return sendJSON(w, http.StatusOK, resp)
+}
+
+// refreshProviderToken exchanges the refresh token of an expired token of a
+// provider for a new token.
+func (a *API) refreshProviderToken(ctx context.Context, providerType string, tok *oauth2.Token) (*oauth2.Token, error) {
+	if tok.RefreshToken == "" {
+		return nil, unprocessableEntityError("Provider token has expired and can't be refreshed")
+	}
+	p, err := a.OAuthProvider(ctx, providerType)
+	if err != nil {
+		return nil, unprocessableEntityError("Provider %s is not available", providerType).WithInternalError(err)
+	}
+	refresher, ok := p.(provider.TokenRefresher)
+	if !ok {
+		return nil, unprocessableEntityError("Provider token has expired and can't be refreshed")
+	}
+
+	refreshed, err := refresher.TokenSource(ctx, tok).Token()
+	if err != nil {
+		if _, ok := err.(*oauth2.RetrieveError); ok {
+			return nil, unprocessableEntityError("Provider token could not be refreshed").WithInternalError(err)
+		}
+		return nil, internalServerError("Error refreshing provider token").WithInternalError(err)
+	}
+	return refreshed, nil
+}
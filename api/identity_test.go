@@ -0,0 +1,275 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+)
+
+// githubAccountServer fakes GitHub for the account with the given ID and
+// verified email.
+func githubAccountServer(ts *ExternalTestSuite, id *int, email *string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			fmt.Fprint(w, `{"access_token":"github_token","expires_in":100000}`)
+		case "/api/v3/user":
+			fmt.Fprintf(w, `{"id":%d,"name":"GitHub Test","avatar_url":"http://example.com/avatar"}`, *id)
+		case "/api/v3/user/emails":
+			fmt.Fprintf(w, `[{"email":%q,"primary":true,"verified":true}]`, *email)
+		default:
+			w.WriteHeader(500)
+			ts.Fail("unknown github oauth call %s", r.URL.Path)
+		}
+	}))
+	ts.Config.External.Github.URL = server.URL
+	return server
+}
+
+// externalCallback completes the flow started with the authorization URL
+// in a browser with the given cookies and returns the fragment of the final
+// redirect.
+func externalCallback(ts *ExternalTestSuite, authURL string, cookies ...*http.Cookie) url.Values {
+	u, err := url.Parse(authURL)
+	ts.Require().NoError(err)
+
+	v := url.Values{"code": {"authcode"}, "state": {u.Query().Get("state")}}
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/callback?"+v.Encode(), nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	ts.Require().Equal(http.StatusFound, w.Code)
+
+	u, err = url.Parse(w.Header().Get("Location"))
+	ts.Require().NoError(err)
+	fragment, err := url.ParseQuery(u.Fragment)
+	ts.Require().NoError(err)
+	return fragment
+}
+
+func (ts *ExternalTestSuite) identityRequest(method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "http://localhost"+path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *ExternalTestSuite) identities(token string) []*models.Identity {
+	w := ts.identityRequest(http.MethodGet, "/user/identities", token)
+	ts.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	identities := []*models.Identity{}
+	ts.Require().NoError(json.NewDecoder(w.Body).Decode(&identities))
+	return identities
+}
+
+func (ts *ExternalTestSuite) TestIdentityMatchedByProviderID() {
+	id, email := 123, "github@example.com"
+	server := githubAccountServer(ts, &id, &email)
+	defer server.Close()
+
+	w := performAuthorizationRequest(ts, "github", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+	ts.Require().NotEmpty(externalCallback(ts, w.Header().Get("Location")).Get("access_token"))
+	user, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "github@example.com", ts.Config.JWT.Aud)
+	ts.Require().NoError(err)
+
+	// the account changed its email, but still signs in the same user
+	email = "renamed@example.com"
+	w = performAuthorizationRequest(ts, "github", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+	ts.Require().NotEmpty(externalCallback(ts, w.Header().Get("Location")).Get("access_token"))
+	_, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "renamed@example.com", ts.Config.JWT.Aud)
+	ts.True(models.IsNotFoundError(err))
+
+	identity, err := models.FindIdentityByProviderID(ts.API.db, ts.instanceID, "github", "123")
+	ts.Require().NoError(err)
+	ts.Equal(user.ID, identity.UserID)
+	ts.Equal("renamed@example.com", identity.IdentityData["email"])
+}
+
+func (ts *ExternalTestSuite) TestIdentityLinkAndUnlink() {
+	u, err := ts.createUser("test@example.com", "Test", "", "")
+	ts.Require().NoError(err)
+	now := time.Now()
+	u.ConfirmedAt = &now
+	ts.Require().NoError(ts.API.db.Update(u))
+	token, err := generateAccessToken(u, time.Hour, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	ts.Require().NoError(err)
+
+	id, email := 123, "other@example.com"
+	server := githubAccountServer(ts, &id, &email)
+	defer server.Close()
+
+	link := func() url.Values {
+		w := ts.identityRequest(http.MethodGet, "/user/link?provider=github", token)
+		ts.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+		data := map[string]string{}
+		ts.Require().NoError(json.NewDecoder(w.Body).Decode(&data))
+		return externalCallback(ts, data["url"], w.Result().Cookies()...)
+	}
+
+	ts.Require().Empty(link().Get("error_description"))
+	id = 456
+	ts.Require().Empty(link().Get("error_description"))
+
+	identities := ts.identities(token)
+	ts.Require().Len(identities, 2)
+	ts.Equal("github", identities[0].Provider)
+	ts.Equal("123", identities[0].ProviderID)
+	ts.Equal("456", identities[1].ProviderID)
+
+	// a linked account can't be linked to another user
+	other, err := ts.createUser("other-user@example.com", "Other", "", "")
+	ts.Require().NoError(err)
+	otherToken, err := generateAccessToken(other, time.Hour, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	ts.Require().NoError(err)
+	w := ts.identityRequest(http.MethodGet, "/user/link?provider=github", otherToken)
+	ts.Require().Equal(http.StatusOK, w.Code)
+	data := map[string]string{}
+	ts.Require().NoError(json.NewDecoder(w.Body).Decode(&data))
+	ts.Equal("External account is already linked to another user", externalCallback(ts, data["url"], w.Result().Cookies()...).Get("error_description"))
+
+	w = ts.identityRequest(http.MethodDelete, "/user/identities/"+identities[0].ID.String(), token)
+	ts.Equal(http.StatusNoContent, w.Code)
+	w = ts.identityRequest(http.MethodDelete, "/user/identities/"+identities[0].ID.String(), token)
+	ts.Equal(http.StatusNotFound, w.Code)
+
+	// the last identity stays while the user can't sign in with their email
+	ts.Config.External.Email.Disabled = true
+	w = ts.identityRequest(http.MethodDelete, "/user/identities/"+identities[1].ID.String(), token)
+	ts.Equal(http.StatusUnprocessableEntity, w.Code)
+	ts.Len(ts.identities(token), 1)
+
+	ts.Config.External.Email.Disabled = false
+	w = ts.identityRequest(http.MethodDelete, "/user/identities/"+identities[1].ID.String(), token)
+	ts.Equal(http.StatusNoContent, w.Code)
+	ts.Empty(ts.identities(token))
+}
+
+func (ts *ExternalTestSuite) TestIdentityLinkRequiresStartingBrowser() {
+	u, err := ts.createUser("test@example.com", "Test", "", "")
+	ts.Require().NoError(err)
+	token, err := generateAccessToken(u, time.Hour, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	ts.Require().NoError(err)
+
+	id, email := 123, "other@example.com"
+	server := githubAccountServer(ts, &id, &email)
+	defer server.Close()
+
+	w := ts.identityRequest(http.MethodGet, "/user/link?provider=github", token)
+	ts.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	data := map[string]string{}
+	ts.Require().NoError(json.NewDecoder(w.Body).Decode(&data))
+
+	// someone else following the link URL doesn't link their account
+	ts.Equal("access_denied", externalCallback(ts, data["url"]).Get("error"))
+	ts.Empty(ts.identities(token))
+}
+
+func (ts *ExternalTestSuite) TestIdentityOfDeletedUser() {
+	id, email := 123, "github@example.com"
+	server := githubAccountServer(ts, &id, &email)
+	defer server.Close()
+
+	w := performAuthorizationRequest(ts, "github", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+	ts.Require().NotEmpty(externalCallback(ts, w.Header().Get("Location")).Get("access_token"))
+	user, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "github@example.com", ts.Config.JWT.Aud)
+	ts.Require().NoError(err)
+
+	// an identity left behind by a deleted user doesn't stop the account from signing up again
+	ts.Require().NoError(ts.API.db.Destroy(user))
+	w = performAuthorizationRequest(ts, "github", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+	ts.Require().NotEmpty(externalCallback(ts, w.Header().Get("Location")).Get("access_token"))
+
+	identity, err := models.FindIdentityByProviderID(ts.API.db, ts.instanceID, "github", "123")
+	ts.Require().NoError(err)
+	ts.NotEqual(user.ID, identity.UserID)
+}
+
+func (ts *ExternalTestSuite) TestProviderTokens() {
+	ts.Config.External.Tokens = conf.ProviderTokensConfiguration{
+		EncryptionKey:    base64.StdEncoding.EncodeToString(make([]byte, 32)),
+		ReturnInCallback: true,
+	}
+	defer func() { ts.Config.External.Tokens = conf.ProviderTokensConfiguration{} }()
+
+	refreshCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			if r.FormValue("grant_type") == "refresh_token" {
+				refreshCount++
+				ts.Equal("github_refresh", r.FormValue("refresh_token"))
+				fmt.Fprint(w, `{"access_token":"github_refreshed","token_type":"bearer","expires_in":3600}`)
+				return
+			}
+			// the first token has already expired
+			fmt.Fprint(w, `{"access_token":"github_token","token_type":"bearer","refresh_token":"github_refresh","expires_in":1}`)
+		case "/api/v3/user":
+			fmt.Fprint(w, `{"id":123,"name":"GitHub Test","avatar_url":"http://example.com/avatar"}`)
+		case "/api/v3/user/emails":
+			fmt.Fprint(w, `[{"email":"github@example.com","primary":true,"verified":true}]`)
+		default:
+			w.WriteHeader(500)
+			ts.Fail("unknown github oauth call %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	ts.Config.External.Github.URL = server.URL
+
+	w := performAuthorizationRequest(ts, "github", "")
+	ts.Require().Equal(http.StatusFound, w.Code)
+	v := externalCallback(ts, w.Header().Get("Location"))
+	ts.Require().NotEmpty(v.Get("access_token"))
+	ts.Equal("github_token", v.Get("provider_token"))
+
+	identity, err := models.FindIdentityByProviderID(ts.API.db, ts.instanceID, "github", "123")
+	ts.Require().NoError(err)
+	ts.NotEmpty(identity.EncryptedProviderToken)
+	ts.NotContains(identity.EncryptedProviderToken, "github_token")
+
+	providerToken := func(path, token string) *ProviderTokenResponse {
+		w := ts.identityRequest(http.MethodGet, path, token)
+		ts.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+		resp := &ProviderTokenResponse{}
+		ts.Require().NoError(json.NewDecoder(w.Body).Decode(resp))
+		return resp
+	}
+
+	// the expired token is refreshed once
+	tokenPath := "/identities/" + identity.ID.String() + "/token"
+	resp := providerToken("/user"+tokenPath, v.Get("access_token"))
+	ts.Equal("github", resp.Provider)
+	ts.Equal("github_refreshed", resp.AccessToken)
+	ts.Greater(resp.ExpiresAt, time.Now().Unix())
+	resp = providerToken("/user"+tokenPath, v.Get("access_token"))
+	ts.Equal("github_refreshed", resp.AccessToken)
+	ts.Equal(1, refreshCount)
+
+	w = ts.identityRequest(http.MethodGet, "/user/identities/"+uuid.Must(uuid.NewV4()).String()+"/token", v.Get("access_token"))
+	ts.Equal(http.StatusNotFound, w.Code)
+
+	admin, err := models.NewUser(ts.instanceID, "admin@example.com", "test", ts.Config.JWT.Aud, nil)
+	ts.Require().NoError(err)
+	admin.IsSuperAdmin = true
+	ts.Require().NoError(ts.API.db.Create(admin))
+	adminToken, err := generateAccessToken(admin, time.Hour, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	ts.Require().NoError(err)
+	resp = providerToken("/admin/users/"+identity.UserID.String()+tokenPath, adminToken)
+	ts.Equal("github_refreshed", resp.AccessToken)
+}
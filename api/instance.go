@@ -82,6 +82,7 @@ func (a *API) CreateInstance(w http.ResponseWriter, r *http.Request) error {
 	// hide pass in response
 	if i.BaseConfig != nil {
 		i.BaseConfig.SMTP.Pass = ""
+		i.BaseConfig.JWT.PrivateKey = ""
 	}
 
 	resp := InstanceResponse{
@@ -96,6 +97,7 @@ func (a *API) GetInstance(w http.ResponseWriter, r *http.Request) error {
 	i := getInstance(r.Context())
 	if i.BaseConfig != nil {
 		i.BaseConfig.SMTP.Pass = ""
+		i.BaseConfig.JWT.PrivateKey = ""
 	}
 	return sendJSON(w, http.StatusOK, i)
 }
@@ -115,6 +117,7 @@ func (a *API) UpdateInstance(w http.ResponseWriter, r *http.Request) error {
 	// Hide SMTP credential from response
 	if i.BaseConfig != nil {
 		i.BaseConfig.SMTP.Pass = ""
+		i.BaseConfig.JWT.PrivateKey = ""
 	}
 	return sendJSON(w, http.StatusOK, i)
 }
@@ -124,6 +127,7 @@ func (a *API) DeleteInstance(w http.ResponseWriter, r *http.Request) error {
 	if err := models.DeleteInstance(a.db, i); err != nil {
 		return internalServerError("Database error deleting instance").WithInternalError(err)
 	}
+	a.signingKeys.invalidate(i.ID)
 
 	w.WriteHeader(http.StatusNoContent)
 	return nil
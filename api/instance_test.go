@@ -82,7 +82,8 @@ func (ts *InstanceTestSuite) TestGet() {
 		UUID: testUUID,
 		BaseConfig: &conf.Configuration{
 			JWT: conf.JWTConfiguration{
-				Secret: "testsecret",
+				Secret:     "testsecret",
+				PrivateKey: "private key",
 			},
 		},
 	})
@@ -97,6 +98,8 @@ func (ts *InstanceTestSuite) TestGet() {
 	require.Equal(ts.T(), w.Code, http.StatusOK)
 	resp := models.Instance{}
 	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&resp))
+	require.NotNil(ts.T(), resp.BaseConfig)
+	require.Empty(ts.T(), resp.BaseConfig.JWT.PrivateKey)
 }
 
 func (ts *InstanceTestSuite) TestUpdate() {
@@ -250,3 +253,38 @@ func (ts *InstanceTestSuite) TestUpdate_ClearPassword() {
 	require.NoError(ts.T(), err)
 	require.Equal(ts.T(), "", i.BaseConfig.SMTP.Pass)
 }
+
+func (ts *InstanceTestSuite) TestRotateSigningKeys() {
+	instanceID := uuid.Must(uuid.NewV4())
+	err := ts.API.db.Create(&models.Instance{
+		ID:   instanceID,
+		UUID: testUUID,
+		BaseConfig: &conf.Configuration{
+			JWT: conf.JWTConfiguration{
+				Secret: "testsecret",
+			},
+		},
+	})
+	require.NoError(ts.T(), err)
+
+	req := httptest.NewRequest(http.MethodPost, "/instances/"+instanceID.String()+"/keys/rotate", nil)
+	req.Header.Set("Authorization", "Bearer "+operatorToken)
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	resp := signingKeysResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&resp))
+	require.Len(ts.T(), resp.Keys, 3)
+
+	states := map[models.SigningKeyState]int{}
+	for _, k := range resp.Keys {
+		states[k.State]++
+	}
+	assert.Equal(ts.T(), map[models.SigningKeyState]int{
+		models.SigningKeyNext:    1,
+		models.SigningKeyCurrent: 1,
+		models.SigningKeyRetired: 1,
+	}, states)
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+const (
+	accessTokenType  = "access_token"
+	refreshTokenType = "refresh_token"
+)
+
+// IntrospectionResponse is the response of the introspection endpoint (RFC 7662).
+// Inactive tokens only include the active field.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// requireTokenEndpointAuth authenticates requests to the revocation and
+// introspection endpoints with the credentials of a registered client, or
+// with admin credentials like the admin endpoints.
+func (a *API) requireTokenEndpointAuth(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	if _, _, ok := r.BasicAuth(); ok || r.FormValue("client_id") != "" {
+		client, err := a.authenticateClient(r)
+		if err != nil {
+			return nil, err
+		}
+		return withOAuthClient(r.Context(), client), nil
+	}
+
+	c, t, err := a.extractOperatorRequest(w, r)
+	if err == nil {
+		return c, nil
+	}
+	if t == "" {
+		return nil, err
+	}
+
+	c, err = a.parseJWTClaims(t, r, w)
+	if err != nil {
+		return nil, err
+	}
+	adminUser, err := getUserFromClaims(c, a.db)
+	if err != nil {
+		return nil, unauthorizedError("Invalid admin user").WithInternalError(err)
+	}
+	if !a.isAdmin(c, adminUser, a.requestAud(c, r)) {
+		return nil, unauthorizedError("User not allowed")
+	}
+	if mfaRequired(a.getConfig(c), true) {
+		if err := requireAAL2(c); err != nil {
+			return nil, err
+		}
+	}
+	return withAdminUser(c, adminUser), nil
+}
+
+// isAccessToken tells access tokens, which are JWTs, from refresh tokens.
+func isAccessToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// TokenRevoke revokes a refresh token, or the session of an access token
+// (RFC 7009). Unknown and already revoked tokens are not an error.
+func (a *API) TokenRevoke(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	tokenStr := r.FormValue("token")
+	if tokenStr == "" {
+		return oauthError("invalid_request", "token required")
+	}
+
+	var user *models.User
+	var refreshToken *models.RefreshToken
+	var sessionID uuid.UUID
+	var clientID string
+	if isAccessToken(tokenStr) {
+		token, err := a.parseAccessToken(ctx, tokenStr)
+		if err != nil {
+			return sendJSON(w, http.StatusOK, map[string]interface{}{})
+		}
+		claims := token.Claims.(*GoTrueClaims)
+		sessionID = uuid.FromStringOrNil(claims.SessionID)
+		if sessionID == uuid.Nil {
+			return oauthError("unsupported_token_type", "Access tokens without a session can't be revoked")
+		}
+		user, err = getUserFromClaims(withToken(ctx, token), a.db)
+		if err != nil {
+			return sendJSON(w, http.StatusOK, map[string]interface{}{})
+		}
+		clientID = claims.ClientID
+	} else {
+		var err error
+		user, refreshToken, err = models.FindUserWithRefreshToken(a.db, tokenStr)
+		if err != nil {
+			if models.IsNotFoundError(err) {
+				return sendJSON(w, http.StatusOK, map[string]interface{}{})
+			}
+			return internalServerError("Database error finding refresh token").WithInternalError(err)
+		}
+		if refreshToken.InstanceID != instanceID {
+			return sendJSON(w, http.StatusOK, map[string]interface{}{})
+		}
+		sessionID = refreshToken.SessionID.UUID
+		if refreshToken.SessionID.Valid {
+			session, err := models.FindSessionByUserIDAndID(a.db, instanceID, user.ID, sessionID)
+			if err != nil {
+				if models.IsNotFoundError(err) {
+					return sendJSON(w, http.StatusOK, map[string]interface{}{})
+				}
+				return internalServerError("Database error finding session").WithInternalError(err)
+			}
+			clientID = session.ClientID
+		}
+	}
+
+	// clients may only revoke the tokens issued to them, and aren't told
+	// about the others
+	if client := getOAuthClient(ctx); client != nil && client.ClientID != clientID {
+		return sendJSON(w, http.StatusOK, map[string]interface{}{})
+	}
+
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.TokenRevokedAction, nil); terr != nil {
+			return terr
+		}
+
+		if sessionID != uuid.Nil {
+			session, terr := models.FindSessionByUserIDAndID(tx, instanceID, user.ID, sessionID)
+			if terr != nil {
+				if models.IsNotFoundError(terr) {
+					return nil
+				}
+				return terr
+			}
+			return models.DeleteSession(tx, session)
+		}
+		return tx.Destroy(refreshToken)
+	})
+	if err != nil {
+		return internalServerError("Database error revoking token").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+// TokenIntrospect returns whether a token is active and what it was issued for (RFC 7662).
+func (a *API) TokenIntrospect(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if client := getOAuthClient(ctx); client != nil && !client.Confidential {
+		return oauthError("invalid_client", "Only confidential clients can introspect tokens")
+	}
+
+	tokenStr := r.FormValue("token")
+	if tokenStr == "" {
+		return oauthError("invalid_request", "token required")
+	}
+	inactive := &IntrospectionResponse{Active: false}
+
+	if isAccessToken(tokenStr) {
+		token, err := a.parseAccessToken(ctx, tokenStr)
+		if err != nil {
+			return sendJSON(w, http.StatusOK, inactive)
+		}
+		claims := token.Claims.(*GoTrueClaims)
+
+		// access tokens of signed out sessions are no longer active
+		if claims.SessionID != "" {
+			userID, err := uuid.FromString(claims.Subject)
+			if err != nil {
+				return sendJSON(w, http.StatusOK, inactive)
+			}
+			if _, err := models.FindSessionByUserIDAndID(a.db, instanceID, userID, uuid.FromStringOrNil(claims.SessionID)); err != nil {
+				if models.IsNotFoundError(err) {
+					return sendJSON(w, http.StatusOK, inactive)
+				}
+				return internalServerError("Database error finding session").WithInternalError(err)
+			}
+		}
+
+		return sendJSON(w, http.StatusOK, &IntrospectionResponse{
+			Active:    true,
+			TokenType: accessTokenType,
+			Scope:     claims.Scope,
+			Subject:   claims.Subject,
+			Username:  claims.Email,
+			Audience:  claims.Audience,
+			Issuer:    claims.Issuer,
+			ExpiresAt: claims.ExpiresAt,
+			IssuedAt:  claims.IssuedAt,
+			SessionID: claims.SessionID,
+		})
+	}
+
+	user, token, err := models.FindUserWithRefreshToken(a.db, tokenStr)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return sendJSON(w, http.StatusOK, inactive)
+		}
+		return internalServerError("Database error finding refresh token").WithInternalError(err)
+	}
+	if token.InstanceID != instanceID || token.Revoked || token.Expired(config.JWT.RefreshTokenLifetime) {
+		return sendJSON(w, http.StatusOK, inactive)
+	}
+
+	resp := &IntrospectionResponse{
+		Active:    true,
+		TokenType: refreshTokenType,
+		Subject:   user.ID.String(),
+		Username:  user.Email,
+		Audience:  user.Aud,
+		Issuer:    a.getIssuer(ctx),
+		IssuedAt:  token.CreatedAt.Unix(),
+		ExpiresAt: token.CreatedAt.Add(time.Second * time.Duration(config.JWT.RefreshTokenLifetime)).Unix(),
+	}
+	if token.SessionID.Valid {
+		resp.SessionID = token.SessionID.UUID.String()
+	}
+	return sendJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type IntrospectTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID   uuid.UUID
+	client       *models.OAuthClient
+	clientSecret string
+}
+
+func TestIntrospect(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &IntrospectTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *IntrospectTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.ConfirmedAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	ts.client, ts.clientSecret, err = models.NewOAuthClient(ts.instanceID, "Gateway", []string{"https://gateway.example.com/callback"}, false, true)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(ts.client))
+}
+
+func (ts *IntrospectTestSuite) login() *AccessTokenResponse {
+	body := strings.NewReader(url.Values{
+		"grant_type": {"password"},
+		"username":   {"test@example.com"},
+		"password":   {"password"},
+	}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	return token
+}
+
+// clientLogin returns the tokens of a login through ts.client.
+func (ts *IntrospectTestSuite) clientLogin() *AccessTokenResponse {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+
+	ctx := withConfig(withInstanceID(context.Background(), ts.instanceID), ts.Config)
+	token, err := ts.API.issueRefreshToken(ctx, ts.API.db, u, &tokenParams{
+		ClientID:             ts.client.ClientID,
+		AuthenticationMethod: "authorization_code",
+	})
+	require.NoError(ts.T(), err)
+	return token
+}
+
+func (ts *IntrospectTestSuite) post(path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost"+path, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(ts.client.ClientID, ts.clientSecret)
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *IntrospectTestSuite) introspect(token string) *IntrospectionResponse {
+	w := ts.post("/token/introspect", token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	resp := &IntrospectionResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(resp))
+	return resp
+}
+
+func (ts *IntrospectTestSuite) TestIntrospect() {
+	token := ts.login()
+
+	resp := ts.introspect(token.Token)
+	assert.True(ts.T(), resp.Active)
+	assert.Equal(ts.T(), accessTokenType, resp.TokenType)
+	assert.Equal(ts.T(), "test@example.com", resp.Username)
+	assert.NotEmpty(ts.T(), resp.SessionID)
+
+	resp = ts.introspect(token.RefreshToken)
+	assert.True(ts.T(), resp.Active)
+	assert.Equal(ts.T(), refreshTokenType, resp.TokenType)
+	assert.Equal(ts.T(), "test@example.com", resp.Username)
+
+	resp = ts.introspect("unknown")
+	assert.False(ts.T(), resp.Active)
+}
+
+func (ts *IntrospectTestSuite) TestIntrospectRequiresAuthentication() {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token/introspect", strings.NewReader(url.Values{"token": {"unknown"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(ts.client.ClientID, "wrong")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(ts.T(), w.Body.String(), "invalid_client")
+
+	req = httptest.NewRequest(http.MethodPost, "http://localhost/token/introspect", strings.NewReader(url.Values{"token": {"unknown"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (ts *IntrospectTestSuite) TestRevokeRefreshToken() {
+	token := ts.clientLogin()
+	other := ts.clientLogin()
+
+	w := ts.post("/token/revoke", token.RefreshToken)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	assert.False(ts.T(), ts.introspect(token.RefreshToken).Active)
+	assert.False(ts.T(), ts.introspect(token.Token).Active, "access tokens of the revoked session are inactive")
+	assert.True(ts.T(), ts.introspect(other.RefreshToken).Active, "other sessions stay active")
+
+	// revoking again is not an error
+	w = ts.post("/token/revoke", token.RefreshToken)
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+}
+
+func (ts *IntrospectTestSuite) TestRevokeAccessToken() {
+	token := ts.clientLogin()
+
+	w := ts.post("/token/revoke", token.Token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	assert.False(ts.T(), ts.introspect(token.Token).Active)
+	assert.False(ts.T(), ts.introspect(token.RefreshToken).Active)
+}
+
+func (ts *IntrospectTestSuite) TestRevokeTokenOfAnotherClient() {
+	token := ts.login()
+
+	// tokens issued to someone else are left alone, without telling the client
+	w := ts.post("/token/revoke", token.RefreshToken)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	w = ts.post("/token/revoke", token.Token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	assert.True(ts.T(), ts.introspect(token.RefreshToken).Active)
+	assert.True(ts.T(), ts.introspect(token.Token).Active)
+}
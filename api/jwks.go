@@ -0,0 +1,370 @@
+package api
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// hmacKeyID is the kid of tokens signed with the shared JWT secret.
+const hmacKeyID = "nf-ident"
+
+// signingKey is a key that access tokens are signed and verified with.
+type signingKey struct {
+	ID     string
+	State  models.SigningKeyState
+	Method jwt.SigningMethod
+	key    interface{}
+}
+
+func newHMACSigningKey(secret string) *signingKey {
+	return &signingKey{
+		ID:     hmacKeyID,
+		State:  models.SigningKeyCurrent,
+		Method: jwt.SigningMethodHS256,
+		key:    []byte(secret),
+	}
+}
+
+func newAsymmetricSigningKey(alg string, key stdcrypto.Signer) (*signingKey, error) {
+	jwk, err := crypto.NewJWK(key.Public(), "", alg)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{
+		ID:     jwk.Thumbprint(),
+		State:  models.SigningKeyCurrent,
+		Method: jwt.GetSigningMethod(alg),
+		key:    key,
+	}, nil
+}
+
+func (k *signingKey) sign(claims jwt.Claims) (string, error) {
+	return k.signWithType("", claims)
+}
+
+// signWithType signs claims with typ in the header in place of the default.
+func (k *signingKey) signWithType(typ string, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.Method, claims)
+	token.Header["kid"] = k.ID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(k.key)
+}
+
+func (k *signingKey) verificationKey() interface{} {
+	if signer, ok := k.key.(stdcrypto.Signer); ok {
+		return signer.Public()
+	}
+	return k.key
+}
+
+// jwk returns the public JWK for the key, or nil for shared secrets.
+func (k *signingKey) jwk() (*crypto.JWK, error) {
+	signer, ok := k.key.(stdcrypto.Signer)
+	if !ok {
+		return nil, nil
+	}
+	return crypto.NewJWK(signer.Public(), k.ID, k.Method.Alg())
+}
+
+// signingKeyCacheTTL bounds how long keys rotated by another process, like
+// the admin command, go unnoticed. Rotations through the API invalidate the
+// cache right away.
+const signingKeyCacheTTL = time.Minute
+
+type cachedSigningKeys struct {
+	keys      []*signingKey
+	expiresAt time.Time
+}
+
+// signingKeyCache holds the stored signing keys of instances, as they're
+// needed to verify every authenticated request.
+type signingKeyCache struct {
+	sync.Mutex
+	instances map[uuid.UUID]cachedSigningKeys
+}
+
+func (c *signingKeyCache) get(instanceID uuid.UUID) ([]*signingKey, bool) {
+	c.Lock()
+	defer c.Unlock()
+	cached, ok := c.instances[instanceID]
+	if !ok || time.Now().After(cached.expiresAt) {
+		return nil, false
+	}
+	return cached.keys, true
+}
+
+func (c *signingKeyCache) set(instanceID uuid.UUID, keys []*signingKey) {
+	c.Lock()
+	defer c.Unlock()
+	if c.instances == nil {
+		c.instances = make(map[uuid.UUID]cachedSigningKeys)
+	}
+	c.instances[instanceID] = cachedSigningKeys{keys: keys, expiresAt: time.Now().Add(signingKeyCacheTTL)}
+}
+
+// invalidate drops the keys of an instance after they changed.
+func (c *signingKeyCache) invalidate(instanceID uuid.UUID) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.instances, instanceID)
+}
+
+// getSigningKeys returns every key tokens of the current instance may be
+// signed with. Instances that never rotated their keys only use the key from
+// their configuration.
+func (a *API) getSigningKeys(ctx context.Context) ([]*signingKey, error) {
+	instanceID := getInstanceID(ctx)
+	keys, err := a.getStoredSigningKeys(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return keys, nil
+	}
+
+	config := a.getConfig(ctx)
+	if !crypto.IsAsymmetricAlgorithm(config.JWT.Algorithm) || config.JWT.PrivateKey != "" {
+		key, err := newConfigSigningKey(config)
+		if err != nil {
+			return nil, err
+		}
+		return []*signingKey{key}, nil
+	}
+
+	if err := a.generateInstanceSigningKey(instanceID, config.JWT.Algorithm); err != nil {
+		return nil, err
+	}
+	return a.getStoredSigningKeys(instanceID)
+}
+
+// getStoredSigningKeys returns the keys stored for an instance, from the
+// cache if they were loaded recently.
+func (a *API) getStoredSigningKeys(instanceID uuid.UUID) ([]*signingKey, error) {
+	if keys, ok := a.signingKeys.get(instanceID); ok {
+		return keys, nil
+	}
+
+	stored, err := models.FindSigningKeys(a.db, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*signingKey, 0, len(stored))
+	for _, k := range stored {
+		key, err := newStoredSigningKey(k)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error loading signing key %s", k.ID)
+		}
+		keys = append(keys, key)
+	}
+	a.signingKeys.set(instanceID, keys)
+	return keys, nil
+}
+
+// getSigningKey returns the key used to sign access tokens for the current instance.
+func (a *API) getSigningKey(ctx context.Context) (*signingKey, error) {
+	keys, err := a.getSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.State == models.SigningKeyCurrent {
+			return key, nil
+		}
+	}
+	return nil, errors.New("No current signing key")
+}
+
+// getVerificationKey returns the key with the given ID. Tokens issued before
+// key IDs were introduced carry none and were signed with the shared secret.
+func (a *API) getVerificationKey(ctx context.Context, kid string) (*signingKey, error) {
+	if kid == "" {
+		kid = hmacKeyID
+	}
+
+	keys, err := a.getSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown signing key %s", kid)
+}
+
+func newConfigSigningKey(config *conf.Configuration) (*signingKey, error) {
+	alg := config.JWT.Algorithm
+	if !crypto.IsAsymmetricAlgorithm(alg) {
+		if alg != crypto.HS256 {
+			return nil, fmt.Errorf("Unsupported JWT signing algorithm %s", alg)
+		}
+		return newHMACSigningKey(config.JWT.Secret), nil
+	}
+
+	key, err := crypto.ParseSigningKey(alg, config.JWT.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricSigningKey(alg, key)
+}
+
+func newStoredSigningKey(k *models.SigningKey) (*signingKey, error) {
+	if k.Algorithm == crypto.HS256 {
+		return &signingKey{
+			ID:     k.KeyID,
+			State:  k.State,
+			Method: jwt.SigningMethodHS256,
+			key:    []byte(k.PrivateKey),
+		}, nil
+	}
+
+	key, err := crypto.ParseSigningKey(k.Algorithm, k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{
+		ID:     k.KeyID,
+		State:  k.State,
+		Method: jwt.GetSigningMethod(k.Algorithm),
+		key:    key,
+	}, nil
+}
+
+// RotateSigningKeys rotates the signing keys of an instance. On the first
+// rotation the configured key is kept as a retired key, so that tokens it
+// signed stay valid until they expire.
+func RotateSigningKeys(conn *storage.Connection, instanceID uuid.UUID, config *conf.Configuration) error {
+	return conn.Transaction(func(tx *storage.Connection) error {
+		keys, terr := models.FindSigningKeys(tx, instanceID)
+		if terr != nil {
+			return terr
+		}
+
+		if len(keys) == 0 {
+			if terr = importConfigSigningKey(tx, instanceID, config); terr != nil {
+				return terr
+			}
+		}
+
+		alg := config.JWT.Algorithm
+		if !crypto.IsAsymmetricAlgorithm(alg) && alg != crypto.HS256 {
+			return fmt.Errorf("Unsupported JWT signing algorithm %s", alg)
+		}
+		retention := time.Second * time.Duration(config.JWT.Exp)
+		return models.RotateSigningKeys(tx, instanceID, alg, retention)
+	})
+}
+
+func importConfigSigningKey(tx *storage.Connection, instanceID uuid.UUID, config *conf.Configuration) error {
+	material := config.JWT.Secret
+	if crypto.IsAsymmetricAlgorithm(config.JWT.Algorithm) {
+		material = config.JWT.PrivateKey
+	}
+	if material == "" {
+		// no token was ever signed with this configuration
+		return nil
+	}
+
+	key, err := newConfigSigningKey(config)
+	if err != nil {
+		return err
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "Error generating unique id")
+	}
+
+	return errors.Wrap(tx.Create(&models.SigningKey{
+		InstanceID: instanceID,
+		ID:         id,
+		KeyID:      key.ID,
+		Algorithm:  key.Method.Alg(),
+		PrivateKey: material,
+		State:      models.SigningKeyCurrent,
+	}), "Error importing configured signing key")
+}
+
+// generateInstanceSigningKey creates the signing key of an instance that
+// uses an asymmetric algorithm without configuring a private key. It's kept
+// with the signing keys of the instance rather than its configuration, so
+// that the private key is never served with it.
+func (a *API) generateInstanceSigningKey(instanceID uuid.UUID, alg string) error {
+	a.keyMutex.Lock()
+	defer a.keyMutex.Unlock()
+	defer a.signingKeys.invalidate(instanceID)
+
+	return a.db.Transaction(func(tx *storage.Connection) error {
+		// another request may have generated the key already
+		keys, terr := models.FindSigningKeys(tx, instanceID)
+		if terr != nil || len(keys) > 0 {
+			return terr
+		}
+
+		key, terr := models.NewSigningKey(instanceID, alg, models.SigningKeyCurrent)
+		if terr != nil {
+			return terr
+		}
+		return errors.Wrap(tx.Create(key), "Error saving signing key")
+	})
+}
+
+// ensurePrivateKey generates an in-memory private key when a single instance
+// is configured with an asymmetric algorithm but without a key.
+func ensurePrivateKey(config *conf.Configuration) error {
+	if !crypto.IsAsymmetricAlgorithm(config.JWT.Algorithm) || config.JWT.PrivateKey != "" {
+		return nil
+	}
+
+	pem, err := generatePrivateKeyPEM(config.JWT.Algorithm)
+	if err != nil {
+		return err
+	}
+	logrus.Warnf("No JWT private key configured, generated a new %s key. Tokens will be invalidated on restart, set GOTRUE_JWT_PRIVATE_KEY to keep them.", config.JWT.Algorithm)
+	config.JWT.PrivateKey = pem
+	return nil
+}
+
+func generatePrivateKeyPEM(alg string) (string, error) {
+	key, err := crypto.GenerateSigningKey(alg)
+	if err != nil {
+		return "", errors.Wrap(err, "Error generating private key")
+	}
+	return crypto.EncodeSigningKey(key)
+}
+
+// JWKS publishes the public keys that access tokens can be verified with,
+// including the next key so verifiers learn about it before it's used.
+func (a *API) JWKS(w http.ResponseWriter, r *http.Request) error {
+	keys, err := a.getSigningKeys(r.Context())
+	if err != nil {
+		return internalServerError("Error loading signing keys").WithInternalError(err)
+	}
+
+	set := &crypto.JWKSet{Keys: []*crypto.JWK{}}
+	for _, key := range keys {
+		jwk, err := key.jwk()
+		if err != nil {
+			return internalServerError("Error encoding signing key").WithInternalError(err)
+		}
+		if jwk != nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return sendJSON(w, http.StatusOK, set)
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type JWKSTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestJWKS(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &JWKSTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *JWKSTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+	ts.API.signingKeys.invalidate(ts.instanceID)
+	ts.Config.JWT.Algorithm = crypto.HS256
+	ts.Config.JWT.PrivateKey = ""
+	require.NoError(ts.T(), ts.API.db.Create(&models.Instance{
+		ID:         ts.instanceID,
+		UUID:       testUUID,
+		BaseConfig: ts.Config,
+	}))
+}
+
+func (ts *JWKSTestSuite) createUser(email string, superAdmin bool) (*models.User, string) {
+	u, err := models.NewUser(ts.instanceID, email, "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	u.IsSuperAdmin = superAdmin
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	return u, ts.signToken(u)
+}
+
+func (ts *JWKSTestSuite) signToken(u *models.User) string {
+	ctx := withConfig(withInstanceID(context.Background(), ts.instanceID), ts.Config)
+	key, err := ts.API.getSigningKey(ctx)
+	require.NoError(ts.T(), err)
+
+	token, err := generateAccessToken(u, time.Minute, key, nil)
+	require.NoError(ts.T(), err)
+	return token
+}
+
+func (ts *JWKSTestSuite) getUserStatus(token string) int {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/user", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (ts *JWKSTestSuite) getJWKS() *crypto.JWKSet {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	set := &crypto.JWKSet{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(set))
+	return set
+}
+
+func (ts *JWKSTestSuite) TestJWKS_SharedSecret() {
+	set := ts.getJWKS()
+	assert.Empty(ts.T(), set.Keys, "shared secrets must never be published")
+}
+
+func (ts *JWKSTestSuite) TestJWKS_GeneratedKey() {
+	ts.Config.JWT.Algorithm = crypto.ES256
+
+	set := ts.getJWKS()
+	require.Len(ts.T(), set.Keys, 1)
+	assert.Equal(ts.T(), "EC", set.Keys[0].KeyType)
+	assert.Equal(ts.T(), crypto.ES256, set.Keys[0].Algorithm)
+	assert.Equal(ts.T(), "sig", set.Keys[0].Use)
+
+	// the generated key is stored with the signing keys, not the instance
+	keys, err := models.FindSigningKeys(ts.API.db, ts.instanceID)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), keys, 1)
+	assert.Equal(ts.T(), set.Keys[0].KeyID, keys[0].KeyID)
+	assert.Equal(ts.T(), models.SigningKeyCurrent, keys[0].State)
+
+	i, err := models.GetInstance(ts.API.db, ts.instanceID)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), i.BaseConfig.JWT.PrivateKey)
+	assert.Len(ts.T(), ts.getJWKS().Keys, 1)
+}
+
+func (ts *JWKSTestSuite) TestAuthenticateWithAsymmetricToken() {
+	ts.Config.JWT.Algorithm = crypto.RS256
+	u, token := ts.createUser("test@example.com", false)
+	assert.Equal(ts.T(), http.StatusOK, ts.getUserStatus(token))
+
+	// a token signed with the shared secret is no longer accepted
+	token, err := generateAccessToken(u, time.Minute, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), http.StatusUnauthorized, ts.getUserStatus(token))
+}
+
+func (ts *JWKSTestSuite) TestRotateSigningKeys() {
+	u, oldToken := ts.createUser("test@example.com", false)
+
+	require.NoError(ts.T(), RotateSigningKeys(ts.API.db, ts.instanceID, ts.Config))
+	ts.API.signingKeys.invalidate(ts.instanceID)
+
+	newToken := ts.signToken(u)
+	assert.NotEqual(ts.T(), oldToken, newToken)
+	assert.Equal(ts.T(), http.StatusOK, ts.getUserStatus(oldToken), "tokens of the configured key must survive the rotation")
+	assert.Equal(ts.T(), http.StatusOK, ts.getUserStatus(newToken))
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, &GoTrueClaims{})
+	require.NoError(ts.T(), err)
+	assert.NotEqual(ts.T(), hmacKeyID, parsed.Header["kid"])
+
+	// the configured secret alone no longer verifies once it's deleted
+	keys, err := models.FindSigningKeys(ts.API.db, ts.instanceID)
+	require.NoError(ts.T(), err)
+	for _, k := range keys {
+		if k.KeyID == hmacKeyID {
+			require.NoError(ts.T(), ts.API.db.Destroy(k))
+		}
+	}
+	ts.API.signingKeys.invalidate(ts.instanceID)
+	assert.Equal(ts.T(), http.StatusUnauthorized, ts.getUserStatus(oldToken))
+	assert.Equal(ts.T(), http.StatusOK, ts.getUserStatus(newToken))
+}
+
+func (ts *JWKSTestSuite) TestJWKS_PublishesRotatedKeys() {
+	ts.Config.JWT.Algorithm = crypto.EdDSA
+	u, _ := ts.createUser("test@example.com", false)
+
+	require.NoError(ts.T(), RotateSigningKeys(ts.API.db, ts.instanceID, ts.Config))
+	ts.API.signingKeys.invalidate(ts.instanceID)
+
+	// the configured key is retired, plus the current and next keys
+	set := ts.getJWKS()
+	require.Len(ts.T(), set.Keys, 3)
+
+	current, err := ts.API.getSigningKey(withConfig(withInstanceID(context.Background(), ts.instanceID), ts.Config))
+	require.NoError(ts.T(), err)
+	published := false
+	for _, k := range set.Keys {
+		published = published || k.KeyID == current.ID
+	}
+	assert.True(ts.T(), published, "expected current key to be published")
+	assert.Equal(ts.T(), http.StatusOK, ts.getUserStatus(ts.signToken(u)))
+}
+
+func (ts *JWKSTestSuite) TestAdminSigningKeys() {
+	_, token := ts.createUser("admin@example.com", true)
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/admin/keys/rotate", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := signingKeysResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	require.Len(ts.T(), data.Keys, 3)
+	assert.NotContains(ts.T(), w.Body.String(), ts.Config.JWT.Secret)
+
+	// the admin token was signed with the now retired key, which is kept
+	for _, k := range data.Keys {
+		if k.State == models.SigningKeyRetired {
+			continue
+		}
+
+		req = httptest.NewRequest(http.MethodDelete, "http://localhost/admin/keys/"+k.ID.String(), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+
+		switch k.State {
+		case models.SigningKeyCurrent:
+			assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+		case models.SigningKeyNext:
+			assert.Equal(ts.T(), http.StatusOK, w.Code)
+		}
+	}
+
+	keys, err := models.FindSigningKeys(ts.API.db, ts.instanceID)
+	require.NoError(ts.T(), err)
+	assert.Len(ts.T(), keys, 2)
+}
+
+func TestSigningKeyCache(t *testing.T) {
+	instanceID := uuid.Must(uuid.NewV4())
+	key := newHMACSigningKey("secret")
+	c := signingKeyCache{}
+
+	_, ok := c.get(instanceID)
+	assert.False(t, ok)
+
+	c.set(instanceID, []*signingKey{key})
+	keys, ok := c.get(instanceID)
+	assert.True(t, ok)
+	assert.Equal(t, []*signingKey{key}, keys)
+
+	c.invalidate(instanceID)
+	_, ok = c.get(instanceID)
+	assert.False(t, ok)
+
+	c.set(instanceID, nil)
+	c.instances[instanceID] = cachedSigningKeys{expiresAt: time.Now().Add(-time.Second)}
+	_, ok = c.get(instanceID)
+	assert.False(t, ok, "expired keys must be reloaded")
+}
+
+func TestAsymmetricSigningKeys(t *testing.T) {
+	user := &models.User{Email: "test@example.com", Aud: "myapp"}
+	user.ID = uuid.Must(uuid.NewV4())
+
+	for _, alg := range []string{crypto.RS256, crypto.ES256, crypto.EdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			pem, err := generatePrivateKeyPEM(alg)
+			require.NoError(t, err)
+
+			signer, err := crypto.ParseSigningKey(alg, pem)
+			require.NoError(t, err)
+
+			key, err := newAsymmetricSigningKey(alg, signer)
+			require.NoError(t, err)
+
+			tokenStr, err := generateAccessToken(user, time.Hour, key, nil)
+			require.NoError(t, err)
+
+			jwk, err := key.jwk()
+			require.NoError(t, err)
+			require.NotNil(t, jwk)
+			assert.Equal(t, key.ID, jwk.KeyID)
+			assert.Equal(t, jwk.Thumbprint(), jwk.KeyID)
+
+			p := jwt.Parser{ValidMethods: []string{alg}}
+			token, err := p.ParseWithClaims(tokenStr, &GoTrueClaims{}, func(token *jwt.Token) (interface{}, error) {
+				return key.verificationKey(), nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, token.Header["kid"])
+			assert.Equal(t, user.ID.String(), token.Claims.(*GoTrueClaims).Subject)
+		})
+	}
+}
+
+func TestParseSigningKeyRejectsMismatchedAlgorithm(t *testing.T) {
+	pem, err := generatePrivateKeyPEM(crypto.EdDSA)
+	require.NoError(t, err)
+
+	_, err = crypto.ParseSigningKey(crypto.RS256, pem)
+	assert.Error(t, err)
+}
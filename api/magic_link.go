@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// MagicLinkParams holds the parameters for a magic link request
+type MagicLinkParams struct {
+	Email string                 `json:"email"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// MagicLink sends an email with a link to log in without a password. Unknown
+// emails are signed up unless signups are disabled.
+func (a *API) MagicLink(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	params := &MagicLinkParams{}
+	jsonDecoder := json.NewDecoder(r.Body)
+	if err := jsonDecoder.Decode(params); err != nil {
+		return badRequestError("Could not read magic link params: %v", err)
+	}
+
+	if err := a.validateEmail(ctx, params.Email); err != nil {
+		return err
+	}
+
+	aud := a.requestAud(ctx, r)
+	user, err := models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, aud)
+	if err != nil {
+		if !models.IsNotFoundError(err) {
+			return internalServerError("Database error finding user").WithInternalError(err)
+		}
+		// don't tell apart unknown emails when new users can't sign up
+		if config.DisableSignup {
+			return sendJSON(w, http.StatusOK, &map[string]string{})
+		}
+	}
+
+	if user != nil && user.MagicLinkSentAt != nil && !user.MagicLinkSentAt.Add(config.SMTP.MaxFrequency).Before(time.Now()) {
+		return tooManyRequestsError("Rate limit exceeded, try again later")
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if user == nil {
+			user, terr = a.signupNewUser(ctx, tx, &SignupParams{
+				Email:    params.Email,
+				Data:     params.Data,
+				Provider: "email",
+				Aud:      aud,
+			})
+			if terr != nil {
+				return terr
+			}
+		}
+
+		if terr = models.NewAuditLogEntry(tx, instanceID, user, models.UserMagicLinkRequestedAction, nil); terr != nil {
+			return terr
+		}
+
+		mailer := a.Mailer(ctx)
+		referrer := a.getReferrer(r)
+		if terr = a.sendMagicLink(tx, user, mailer, config, referrer); terr != nil {
+			return internalServerError("Error sending magic link").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, &map[string]string{})
+}
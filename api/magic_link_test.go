@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MagicLinkTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestMagicLink(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &MagicLinkTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *MagicLinkTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+	ts.Config.DisableSignup = false
+
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error creating test user model")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error saving new test user")
+}
+
+func (ts *MagicLinkTestSuite) post(path string, body map[string]interface{}) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost"+path, &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *MagicLinkTestSuite) TestMagicLink_ExistingUser() {
+	w := ts.post("/magiclink", map[string]interface{}{"email": "test@example.com"})
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	require.NotEmpty(ts.T(), u.MagicLinkToken)
+	assert.WithinDuration(ts.T(), time.Now(), *u.MagicLinkSentAt, 1*time.Second)
+
+	// a second link is throttled like other emails
+	w = ts.post("/magiclink", map[string]interface{}{"email": "test@example.com"})
+	assert.Equal(ts.T(), http.StatusTooManyRequests, w.Code)
+
+	magicLinkToken := u.MagicLinkToken
+	w = ts.post("/verify", map[string]interface{}{"type": "magiclink", "token": magicLinkToken})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	assert.NotEmpty(ts.T(), token.Token)
+
+	u, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), u.IsConfirmed())
+	assert.Empty(ts.T(), u.MagicLinkToken)
+
+	// the link works only once
+	w = ts.post("/verify", map[string]interface{}{"type": "magiclink", "token": magicLinkToken})
+	assert.Equal(ts.T(), http.StatusNotFound, w.Code)
+}
+
+func (ts *MagicLinkTestSuite) TestMagicLink_SignsUpUnknownEmail() {
+	w := ts.post("/magiclink", map[string]interface{}{
+		"email": "new@example.com",
+		"data":  map[string]interface{}{"name": "New"},
+	})
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "new@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), u.EncryptedPassword)
+	assert.Equal(ts.T(), "New", u.UserMetaData["name"])
+	assert.False(ts.T(), u.IsConfirmed())
+	assert.NotEmpty(ts.T(), u.MagicLinkToken)
+
+	// it isn't a recovery token
+	w = ts.post("/verify", map[string]interface{}{"type": "recovery", "token": u.MagicLinkToken})
+	assert.Equal(ts.T(), http.StatusNotFound, w.Code)
+}
+
+func (ts *MagicLinkTestSuite) TestMagicLink_SignupDisabled() {
+	ts.Config.DisableSignup = true
+
+	w := ts.post("/magiclink", map[string]interface{}{"email": "new@example.com"})
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+
+	_, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "new@example.com", ts.Config.JWT.Aud)
+	assert.True(ts.T(), models.IsNotFoundError(err))
+}
+
+func (ts *MagicLinkTestSuite) TestMagicLink_Expired() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+
+	u.MagicLinkToken = "expired-test-token"
+	expired := time.Now().Add(-2 * time.Hour)
+	u.MagicLinkSentAt = &expired
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	w := ts.post("/verify", map[string]interface{}{"type": "magiclink", "token": u.MagicLinkToken})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+}
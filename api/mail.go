@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/crypto"
 	"github.com/netlify/gotrue/mailer"
 	"github.com/netlify/gotrue/models"
@@ -11,15 +12,29 @@ import (
 	"github.com/pkg/errors"
 )
 
-func sendConfirmation(tx *storage.Connection, u *models.User, mailer mailer.Mailer, maxFrequency time.Duration, referrerURL string) error {
-	if u.ConfirmationSentAt != nil && !u.ConfirmationSentAt.Add(maxFrequency).Before(time.Now()) {
+// newEmailOTP replaces the one-time passcode of a verification type when
+// they are enabled.
+func newEmailOTP(tx *storage.Connection, config *conf.Configuration, u *models.User, verificationType string) (string, error) {
+	if !config.Mailer.OTPEnabled {
+		return "", nil
+	}
+	otp, err := models.GenerateEmailOTP(tx, u, verificationType)
+	return otp, errors.Wrap(err, "Database error creating one-time passcode")
+}
+
+func sendConfirmation(tx *storage.Connection, u *models.User, mailer mailer.Mailer, config *conf.Configuration, referrerURL string) error {
+	if u.ConfirmationSentAt != nil && !u.ConfirmationSentAt.Add(config.SMTP.MaxFrequency).Before(time.Now()) {
 		return nil
 	}
 
+	otp, err := newEmailOTP(tx, config, u, signupVerification)
+	if err != nil {
+		return err
+	}
 	oldToken := u.ConfirmationToken
 	u.ConfirmationToken = crypto.SecureToken()
 	now := time.Now()
-	if err := mailer.ConfirmationMail(u, referrerURL); err != nil {
+	if err := mailer.ConfirmationMail(u, otp, referrerURL); err != nil {
 		u.ConfirmationToken = oldToken
 		return errors.Wrap(err, "Error sending confirmation email")
 	}
@@ -39,11 +54,15 @@ func sendInvite(tx *storage.Connection, u *models.User, mailer mailer.Mailer, re
 	return errors.Wrap(tx.UpdateOnly(u, "confirmation_token", "invited_at"), "Database error updating user for invite")
 }
 
-func (a *API) sendPasswordRecovery(tx *storage.Connection, u *models.User, mailer mailer.Mailer, referrerURL string) error {
+func (a *API) sendPasswordRecovery(tx *storage.Connection, u *models.User, mailer mailer.Mailer, config *conf.Configuration, referrerURL string) error {
+	otp, err := newEmailOTP(tx, config, u, recoveryVerification)
+	if err != nil {
+		return err
+	}
 	oldToken := u.RecoveryToken
 	u.RecoveryToken = crypto.SecureToken()
 	now := time.Now()
-	if err := mailer.RecoveryMail(u, referrerURL); err != nil {
+	if err := mailer.RecoveryMail(u, otp, referrerURL); err != nil {
 		u.RecoveryToken = oldToken
 		return errors.Wrap(err, "Error sending recovery email")
 	}
@@ -51,6 +70,22 @@ func (a *API) sendPasswordRecovery(tx *storage.Connection, u *models.User, maile
 	return errors.Wrap(tx.UpdateOnly(u, "recovery_token", "recovery_sent_at"), "Database error updating user for recovery")
 }
 
+func (a *API) sendMagicLink(tx *storage.Connection, u *models.User, mailer mailer.Mailer, config *conf.Configuration, referrerURL string) error {
+	otp, err := newEmailOTP(tx, config, u, magicLinkVerification)
+	if err != nil {
+		return err
+	}
+	oldToken := u.MagicLinkToken
+	u.MagicLinkToken = crypto.SecureToken()
+	now := time.Now()
+	if err := mailer.MagicLinkMail(u, otp, referrerURL); err != nil {
+		u.MagicLinkToken = oldToken
+		return errors.Wrap(err, "Error sending magic link email")
+	}
+	u.MagicLinkSentAt = &now
+	return errors.Wrap(tx.UpdateOnly(u, "magic_link_token", "magic_link_sent_at"), "Database error updating user for magic link")
+}
+
 func (a *API) sendEmailChange(tx *storage.Connection, u *models.User, mailer mailer.Mailer, email string, referrerURL string) error {
 	oldToken := u.EmailChangeToken
 	oldEmail := u.EmailChange
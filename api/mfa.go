@@ -0,0 +1,512 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// totpSkew is how many time steps a TOTP code may be off, for clock drift.
+const totpSkew = 1
+
+type enrollFactorParams struct {
+	FactorType   string `json:"factor_type"`
+	FriendlyName string `json:"friendly_name"`
+}
+
+type verifyFactorParams struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"`
+}
+
+type recoveryCodeParams struct {
+	Code string `json:"code"`
+}
+
+// TOTPEnrollment is what authenticator apps need to enrol a TOTP factor. The
+// URI is usually shown as a QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollFactorResponse includes the secret of a new factor, which is only
+// returned on enrolment.
+type EnrollFactorResponse struct {
+	*models.Factor
+	TOTP          *TOTPEnrollment `json:"totp,omitempty"`
+	RecoveryCodes []string        `json:"recovery_codes,omitempty"`
+}
+
+// ChallengeResponse is a challenge of a factor and when it expires.
+type ChallengeResponse struct {
+	ID        uuid.UUID `json:"id"`
+	ExpiresAt int64     `json:"expires_at"`
+}
+
+// mfaRequired returns whether requests need an aal2 token: on the admin API
+// when MFA is required for admins, and on every request when it's required
+// for everyone.
+func mfaRequired(config *conf.Configuration, admin bool) bool {
+	if !config.MFA.Enabled {
+		return false
+	}
+	switch config.MFA.Required {
+	case conf.MFARequiredAll:
+		return true
+	case conf.MFARequiredAdmins:
+		return admin
+	}
+	return false
+}
+
+// requireAAL2 checks that the access token of the request was issued after
+// verifying a second factor.
+func requireAAL2(ctx context.Context) error {
+	claims := getClaims(ctx)
+	if claims == nil || claims.AAL != models.AAL2 {
+		return forbiddenError("Multi-factor authentication is required")
+	}
+	return nil
+}
+
+// requireAssuranceLevel rejects aal1 tokens when the instance requires
+// multi-factor authentication for everyone.
+func (a *API) requireAssuranceLevel(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if mfaRequired(a.getConfig(ctx), false) {
+		if err := requireAAL2(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
+
+func (a *API) requireMFAEnabled(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if !a.getConfig(ctx).MFA.Enabled {
+		return nil, badRequestError("Multi-factor authentication is disabled")
+	}
+	return ctx, nil
+}
+
+func (a *API) loadFactor(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return nil, unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	factorID, err := uuid.FromString(chi.URLParam(r, "factor_id"))
+	if err != nil {
+		return nil, badRequestError("factor_id must be an UUID")
+	}
+
+	logEntrySetField(r, "factor_id", factorID)
+
+	factor, err := models.FindFactorByUserIDAndID(a.db, user.InstanceID, user.ID, factorID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("Factor not found")
+		}
+		return nil, internalServerError("Database error loading factor").WithInternalError(err)
+	}
+
+	return withFactor(withUser(ctx, user), factor), nil
+}
+
+// totpIssuer names the instance in authenticator apps.
+func totpIssuer(config *conf.Configuration) string {
+	if u, err := url.Parse(config.SiteURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "GoTrue"
+}
+
+func factorTraits(factor *models.Factor) map[string]interface{} {
+	return map[string]interface{}{
+		"factor_id":   factor.ID,
+		"factor_type": factor.FactorType,
+	}
+}
+
+// Factors lists the factors of the logged in user.
+func (a *API) Factors(w http.ResponseWriter, r *http.Request) error {
+	user, err := getUserFromClaims(r.Context(), a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	factors, err := models.FindFactorsByUserID(a.db, user.InstanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding factors").WithInternalError(err)
+	}
+	remaining, err := models.CountUnusedRecoveryCodes(a.db, user.InstanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error counting recovery codes").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"factors":                  factors,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// EnrollFactor adds an unverified factor to the logged in user. It's only
+// used to sign in once a challenge of it was verified.
+func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	params := &enrollFactorParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read factor params: %v", err)
+	}
+	if params.FactorType != models.FactorTypeTOTP {
+		return unprocessableEntityError("factor_type must be %s", models.FactorTypeTOTP)
+	}
+
+	factors, err := models.FindFactorsByUserID(a.db, instanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding factors").WithInternalError(err)
+	}
+	if len(factors) >= config.MFA.MaxEnrolledFactors {
+		return unprocessableEntityError("Maximum number of enrolled factors reached")
+	}
+	// otherwise a stolen password is enough to add a factor
+	if err := a.requireAAL2ForSecondFactor(ctx, user); err != nil {
+		return err
+	}
+	verified := false
+	for _, f := range factors {
+		verified = verified || f.IsVerified()
+	}
+
+	secret := crypto.GenerateTOTPSecret()
+	factor, err := models.NewFactor(user, params.FriendlyName, models.FactorTypeTOTP, secret)
+	if err != nil {
+		return internalServerError("Error creating factor").WithInternalError(err)
+	}
+
+	var recoveryCodes []string
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.FactorEnrolledAction, factorTraits(factor)); terr != nil {
+			return terr
+		}
+		if terr := tx.Create(factor); terr != nil {
+			return terr
+		}
+
+		// the first factor comes with recovery codes
+		if !verified {
+			var terr error
+			recoveryCodes, terr = models.GenerateRecoveryCodes(tx, user)
+			return terr
+		}
+		return nil
+	})
+	if err != nil {
+		return internalServerError("Database error creating factor").WithInternalError(err)
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.ID.String()
+	}
+	return sendJSON(w, http.StatusOK, &EnrollFactorResponse{
+		Factor: factor,
+		TOTP: &TOTPEnrollment{
+			Secret: secret,
+			URI:    crypto.TOTPURI(totpIssuer(config), account, secret),
+		},
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// ChallengeFactor starts the verification of a factor.
+func (a *API) ChallengeFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	factor := getFactor(ctx)
+
+	challenge, err := models.NewChallenge(factor, a.newTokenParams(r, "").IP)
+	if err != nil {
+		return internalServerError("Error creating challenge").WithInternalError(err)
+	}
+	if err := a.db.Create(challenge); err != nil {
+		return internalServerError("Database error creating challenge").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, &ChallengeResponse{
+		ID:        challenge.ID,
+		ExpiresAt: challenge.ExpiresAt(config.MFA.ChallengeExpiry).Unix(),
+	})
+}
+
+// VerifyFactor checks the code of a challenge. The session of the access
+// token is raised to aal2 and new tokens are issued for it.
+func (a *API) VerifyFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	user := getUser(ctx)
+	factor := getFactor(ctx)
+
+	params := &verifyFactorParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read verification params: %v", err)
+	}
+	challengeID, err := uuid.FromString(params.ChallengeID)
+	if err != nil {
+		return badRequestError("challenge_id must be an UUID")
+	}
+
+	// The factor and challenge are read again under a lock, so that parallel
+	// requests can't both accept the same code or challenge.
+	tokens, err := a.issueAAL2Tokens(r, user, func(tx *storage.Connection) error {
+		factor, terr := models.FindFactorForUpdate(tx, instanceID, user.ID, factor.ID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return notFoundError("Factor not found")
+			}
+			return internalServerError("Database error finding factor").WithInternalError(terr)
+		}
+		challenge, terr := models.FindChallengeForUpdate(tx, instanceID, factor.ID, challengeID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return notFoundError("Challenge not found")
+			}
+			return internalServerError("Database error finding challenge").WithInternalError(terr)
+		}
+		if challenge.VerifiedAt != nil || challenge.HasExpired(config.MFA.ChallengeExpiry) {
+			return unprocessableEntityError("Challenge has expired, please request a new one")
+		}
+
+		step, ok := crypto.ValidateTOTP(factor.Secret, params.Code, time.Now(), totpSkew)
+		if !ok || step <= factor.LastUsedStep {
+			return unprocessableEntityError("Invalid TOTP code")
+		}
+
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.FactorVerifiedAction, factorTraits(factor)); terr != nil {
+			return terr
+		}
+		if terr := challenge.Verify(tx); terr != nil {
+			return internalServerError("Database error verifying challenge").WithInternalError(terr)
+		}
+		if terr := factor.UpdateLastUsedStep(tx, step); terr != nil {
+			return internalServerError("Database error updating factor").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return sendJSON(w, http.StatusOK, tokens)
+}
+
+// issueAAL2Tokens raises the session of the access token to aal2 once verify
+// succeeded in the same transaction, and issues new tokens for it.
+func (a *API) issueAAL2Tokens(r *http.Request, user *models.User, verify func(tx *storage.Connection) error) (*AccessTokenResponse, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	sessionID := currentSessionID(r)
+	if sessionID == uuid.Nil {
+		return nil, badRequestError("Access token has no session, please sign in again")
+	}
+
+	key, err := a.getSigningKey(ctx)
+	if err != nil {
+		return nil, internalServerError("Error loading signing key").WithInternalError(err)
+	}
+
+	tokenParams := a.newTokenParams(r, "")
+	var tokenString, idTokenString string
+	var refreshToken *models.RefreshToken
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		terr := verify(tx)
+		if terr != nil {
+			return terr
+		}
+
+		session, terr := models.FindSessionByUserIDAndID(tx, instanceID, user.ID, sessionID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return unauthorizedError("Session not found, please sign in again")
+			}
+			return internalServerError("Database error finding session").WithInternalError(terr)
+		}
+		if terr = session.UpdateAAL(tx, models.AAL2); terr != nil {
+			return internalServerError("Database error updating session").WithInternalError(terr)
+		}
+		tokenParams.SessionID = session.ID
+		tokenParams.AAL = session.AAL
+
+		refreshToken, terr = models.GrantAuthenticatedUser(tx, user, session)
+		if terr != nil {
+			return internalServerError("Database error granting user").WithInternalError(terr)
+		}
+
+		tokenString, idTokenString, terr = a.generateTokens(ctx, user, time.Second*time.Duration(config.JWT.Exp), key, tokenParams)
+		return terr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessTokenResponse{
+		Token:        tokenString,
+		TokenType:    "bearer",
+		ExpiresIn:    config.JWT.Exp,
+		RefreshToken: refreshToken.Token,
+		IDToken:      idTokenString,
+	}, nil
+}
+
+// UnenrollFactor deletes a factor of the logged in user. Verified factors can
+// only be deleted with an aal2 token.
+func (a *API) UnenrollFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	user := getUser(ctx)
+	factor := getFactor(ctx)
+
+	if factor.IsVerified() {
+		if err := requireAAL2(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.FactorUnenrolledAction, factorTraits(factor)); terr != nil {
+			return terr
+		}
+		if terr := models.DeleteFactor(tx, factor); terr != nil {
+			return terr
+		}
+
+		// recovery codes are useless without a factor to recover
+		verified, terr := models.HasVerifiedFactors(tx, instanceID, user.ID)
+		if terr != nil || verified {
+			return terr
+		}
+		return models.DeleteRecoveryCodes(tx, instanceID, user.ID)
+	})
+	if err != nil {
+		return internalServerError("Database error deleting factor").WithInternalError(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// requireVerifiedFactor loads the logged in user, who must have verified a factor.
+func (a *API) requireVerifiedFactor(ctx context.Context) (*models.User, error) {
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return nil, unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	verified, err := models.HasVerifiedFactors(a.db, user.InstanceID, user.ID)
+	if err != nil {
+		return nil, internalServerError("Database error finding factors").WithInternalError(err)
+	}
+	if !verified {
+		return nil, unprocessableEntityError("No verified factor enrolled")
+	}
+	return user, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the logged in user,
+// which requires an aal2 token.
+func (a *API) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+
+	user, err := a.requireVerifiedFactor(ctx)
+	if err != nil {
+		return err
+	}
+	if err := requireAAL2(ctx); err != nil {
+		return err
+	}
+
+	var codes []string
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.RecoveryCodesGeneratedAction, nil); terr != nil {
+			return terr
+		}
+		var terr error
+		codes, terr = models.GenerateRecoveryCodes(tx, user)
+		return terr
+	})
+	if err != nil {
+		return internalServerError("Database error generating recovery codes").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// VerifyRecoveryCode accepts a recovery code in place of a second factor.
+// Every code can only be used once.
+func (a *API) VerifyRecoveryCode(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	user, err := a.requireVerifiedFactor(ctx)
+	if err != nil {
+		return err
+	}
+
+	params := &recoveryCodeParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read recovery code params: %v", err)
+	}
+	if params.Code == "" {
+		return unprocessableEntityError("A recovery code is required")
+	}
+
+	tokens, err := a.issueAAL2Tokens(r, user, func(tx *storage.Connection) error {
+		if _, terr := models.UseRecoveryCode(tx, user, params.Code); terr != nil {
+			if models.IsNotFoundError(terr) {
+				return unprocessableEntityError("Invalid recovery code")
+			}
+			return internalServerError("Database error using recovery code").WithInternalError(terr)
+		}
+		remaining, terr := models.CountUnusedRecoveryCodes(tx, instanceID, user.ID)
+		if terr != nil {
+			return internalServerError("Database error counting recovery codes").WithInternalError(terr)
+		}
+		return models.NewAuditLogEntry(tx, instanceID, user, models.RecoveryCodeUsedAction, map[string]interface{}{
+			"recovery_codes_remaining": remaining,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// the code stays used even if the webhook fails
+	if err := triggerEventHooks(ctx, a.db, RecoveryCodeUsedEvent, user, instanceID, config); err != nil {
+		getLogEntry(r).WithError(err).Warn("Failed to trigger recovery code webhook")
+	}
+	return sendJSON(w, http.StatusOK, tokens)
+}
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MFATestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestMFA(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &MFATestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *MFATestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+	ts.Config.MFA.Enabled = true
+	ts.Config.MFA.Required = ""
+
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.ConfirmedAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+}
+
+func (ts *MFATestSuite) login() *AccessTokenResponse {
+	body := strings.NewReader(url.Values{
+		"grant_type": {"password"},
+		"username":   {"test@example.com"},
+		"password":   {"password"},
+	}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	return token
+}
+
+func (ts *MFATestSuite) request(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	if body != nil {
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+	}
+	req := httptest.NewRequest(method, "http://localhost"+path, &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *MFATestSuite) enroll(token string) *EnrollFactorResponse {
+	w := ts.request(http.MethodPost, "/factors", token, map[string]interface{}{
+		"factor_type":   "totp",
+		"friendly_name": "phone",
+	})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	factor := &EnrollFactorResponse{Factor: &models.Factor{}}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(factor))
+	return factor
+}
+
+func (ts *MFATestSuite) challenge(token string, factorID uuid.UUID) *ChallengeResponse {
+	w := ts.request(http.MethodPost, fmt.Sprintf("/factors/%s/challenge", factorID), token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	challenge := &ChallengeResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(challenge))
+	return challenge
+}
+
+func (ts *MFATestSuite) verify(token string, factorID, challengeID uuid.UUID, code string) *httptest.ResponseRecorder {
+	return ts.request(http.MethodPost, fmt.Sprintf("/factors/%s/verify", factorID), token, map[string]interface{}{
+		"challenge_id": challengeID.String(),
+		"code":         code,
+	})
+}
+
+// enrollAndVerify returns a factor of the user and aal2 tokens.
+func (ts *MFATestSuite) enrollAndVerify(token string) (*EnrollFactorResponse, *AccessTokenResponse) {
+	factor := ts.enroll(token)
+	challenge := ts.challenge(token, factor.ID)
+	code, err := crypto.TOTPCode(factor.TOTP.Secret, crypto.TOTPStep(time.Now()))
+	require.NoError(ts.T(), err)
+
+	w := ts.verify(token, factor.ID, challenge.ID, code)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	tokens := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(tokens))
+	return factor, tokens
+}
+
+func (ts *MFATestSuite) claims(token string) *GoTrueClaims {
+	claims := &GoTrueClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	return claims
+}
+
+func (ts *MFATestSuite) TestEnrollAndVerify() {
+	login := ts.login()
+	assert.Equal(ts.T(), models.AAL1, ts.claims(login.Token).AAL)
+
+	factor := ts.enroll(login.Token)
+	assert.Equal(ts.T(), models.FactorStatusUnverified, factor.Status)
+	assert.Contains(ts.T(), factor.TOTP.URI, "otpauth://totp/")
+	assert.Contains(ts.T(), factor.TOTP.URI, "secret="+factor.TOTP.Secret)
+
+	challenge := ts.challenge(login.Token, factor.ID)
+	w := ts.verify(login.Token, factor.ID, challenge.ID, "000000")
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	code, err := crypto.TOTPCode(factor.TOTP.Secret, crypto.TOTPStep(time.Now()))
+	require.NoError(ts.T(), err)
+	w = ts.verify(login.Token, factor.ID, challenge.ID, code)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	tokens := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(tokens))
+	claims := ts.claims(tokens.Token)
+	assert.Equal(ts.T(), models.AAL2, claims.AAL)
+	assert.Equal(ts.T(), ts.claims(login.Token).SessionID, claims.SessionID)
+
+	// refreshing keeps the assurance level of the session
+	body := strings.NewReader(url.Values{"refresh_token": {tokens.RefreshToken}}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rw := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(rw, req)
+	require.Equal(ts.T(), http.StatusOK, rw.Code)
+	refreshed := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(rw.Body).Decode(refreshed))
+	assert.Equal(ts.T(), models.AAL2, ts.claims(refreshed.Token).AAL)
+
+	// neither the challenge nor the code can be used again
+	w = ts.verify(login.Token, factor.ID, challenge.ID, code)
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+	challenge = ts.challenge(login.Token, factor.ID)
+	w = ts.verify(login.Token, factor.ID, challenge.ID, code)
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = ts.request(http.MethodGet, "/factors", login.Token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	var list struct {
+		Factors []*models.Factor `json:"factors"`
+	}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&list))
+	require.Len(ts.T(), list.Factors, 1)
+	assert.Equal(ts.T(), models.FactorStatusVerified, list.Factors[0].Status)
+}
+
+func (ts *MFATestSuite) TestVerifiedFactorsRequireAAL2() {
+	login := ts.login()
+	factor, tokens := ts.enrollAndVerify(login.Token)
+
+	// an aal1 token can neither add nor remove factors anymore
+	w := ts.request(http.MethodPost, "/factors", login.Token, map[string]interface{}{"factor_type": "totp"})
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+	w = ts.request(http.MethodDelete, fmt.Sprintf("/factors/%s", factor.ID), login.Token, nil)
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+
+	w = ts.request(http.MethodDelete, fmt.Sprintf("/factors/%s", factor.ID), tokens.Token, nil)
+	assert.Equal(ts.T(), http.StatusNoContent, w.Code)
+}
+
+func (ts *MFATestSuite) TestMFARequiredForAll() {
+	ts.Config.MFA.Required = conf.MFARequiredAll
+	login := ts.login()
+
+	w := ts.request(http.MethodGet, "/user", login.Token, nil)
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+
+	_, tokens := ts.enrollAndVerify(login.Token)
+	w = ts.request(http.MethodGet, "/user", tokens.Token, nil)
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+}
+
+func (ts *MFATestSuite) TestRecoveryCodes() {
+	login := ts.login()
+	factor := ts.enroll(login.Token)
+	require.Len(ts.T(), factor.RecoveryCodes, models.RecoveryCodeCount)
+
+	// codes can't be used before a factor was verified
+	w := ts.request(http.MethodPost, "/factors/recovery_codes/verify", login.Token, map[string]interface{}{"code": factor.RecoveryCodes[0]})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	challenge := ts.challenge(login.Token, factor.ID)
+	code, err := crypto.TOTPCode(factor.TOTP.Secret, crypto.TOTPStep(time.Now()))
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), http.StatusOK, ts.verify(login.Token, factor.ID, challenge.ID, code).Code)
+
+	// a new login without the device recovers with a code, once
+	lost := ts.login()
+	w = ts.request(http.MethodPost, "/factors/recovery_codes/verify", lost.Token, map[string]interface{}{"code": strings.ToUpper(factor.RecoveryCodes[0])})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	tokens := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(tokens))
+	assert.Equal(ts.T(), models.AAL2, ts.claims(tokens.Token).AAL)
+
+	w = ts.request(http.MethodPost, "/factors/recovery_codes/verify", lost.Token, map[string]interface{}{"code": factor.RecoveryCodes[0]})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = ts.request(http.MethodGet, "/factors", tokens.Token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	var list struct {
+		Remaining int `json:"recovery_codes_remaining"`
+	}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&list))
+	assert.Equal(ts.T(), models.RecoveryCodeCount-1, list.Remaining)
+
+	// regenerating needs aal2 and replaces the old codes
+	w = ts.request(http.MethodPost, "/factors/recovery_codes", lost.Token, nil)
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+	w = ts.request(http.MethodPost, "/factors/recovery_codes", tokens.Token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	var regenerated struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&regenerated))
+	require.Len(ts.T(), regenerated.RecoveryCodes, models.RecoveryCodeCount)
+
+	w = ts.request(http.MethodPost, "/factors/recovery_codes/verify", lost.Token, map[string]interface{}{"code": factor.RecoveryCodes[1]})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+	w = ts.request(http.MethodPost, "/factors/recovery_codes/verify", lost.Token, map[string]interface{}{"code": regenerated.RecoveryCodes[1]})
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+}
+
+func (ts *MFATestSuite) TestMFADisabled() {
+	ts.Config.MFA.Enabled = false
+	login := ts.login()
+
+	w := ts.request(http.MethodGet, "/factors", login.Token, nil)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
@@ -187,6 +187,17 @@ func (a *API) requireAdminCredentials(w http.ResponseWriter, req *http.Request)
 	return a.requireAdmin(c, w, req)
 }
 
+func (a *API) requirePhoneProvider(w http.ResponseWriter, req *http.Request) (context.Context, error) {
+	ctx := req.Context()
+	config := a.getConfig(ctx)
+
+	if !config.External.Phone.Enabled {
+		return nil, badRequestError("Unsupported phone provider")
+	}
+
+	return ctx, nil
+}
+
 func (a *API) requireEmailProvider(w http.ResponseWriter, req *http.Request) (context.Context, error) {
 	ctx := req.Context()
 	config := a.getConfig(ctx)
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+type adminOAuthClientParams struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	FirstParty   *bool    `json:"first_party"`
+	Confidential bool     `json:"confidential"`
+}
+
+// OAuthClientResponse includes the secret of a client, which is only returned
+// when the client is created.
+type OAuthClientResponse struct {
+	*models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// authenticateClient identifies the client of a token request. Confidential
+// clients authenticate with HTTP Basic authentication or the client_secret
+// parameter, public clients only send their client_id.
+func (a *API) authenticateClient(r *http.Request) (*models.OAuthClient, error) {
+	instanceID := getInstanceID(r.Context())
+
+	clientID, secret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID = r.FormValue("client_id")
+		secret = r.FormValue("client_secret")
+	}
+	if clientID == "" {
+		return nil, oauthError("invalid_client", "client_id required")
+	}
+
+	client, err := models.FindOAuthClientByClientID(a.db, instanceID, clientID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, oauthError("invalid_client", "Invalid client credentials")
+		}
+		return nil, internalServerError("Database error finding client").WithInternalError(err)
+	}
+
+	if client.Confidential && !client.Authenticate(secret) {
+		return nil, oauthError("invalid_client", "Invalid client credentials")
+	}
+	return client, nil
+}
+
+func (a *API) loadOAuthClient(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	id, err := uuid.FromString(chi.URLParam(r, "client_id"))
+	if err != nil {
+		return nil, badRequestError("client_id must be an UUID")
+	}
+
+	logEntrySetField(r, "oauth_client_id", id)
+	instanceID := getInstanceID(r.Context())
+
+	c, err := models.FindOAuthClientByID(a.db, instanceID, id)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("OAuth client not found")
+		}
+		return nil, internalServerError("Database error loading OAuth client").WithInternalError(err)
+	}
+
+	return withOAuthClient(r.Context(), c), nil
+}
+
+func getOAuthClientParams(r *http.Request) (*adminOAuthClientParams, error) {
+	params := &adminOAuthClientParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return nil, badRequestError("Could not decode OAuth client params: %v", err)
+	}
+
+	for _, uri := range params.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, unprocessableEntityError("Invalid redirect URI %q, it must be absolute and without a fragment", uri)
+		}
+	}
+	return params, nil
+}
+
+// adminOAuthClients lists the OAuth clients of the instance.
+func (a *API) adminOAuthClients(w http.ResponseWriter, r *http.Request) error {
+	clients, err := models.FindOAuthClients(a.db, getInstanceID(r.Context()))
+	if err != nil {
+		return internalServerError("Database error finding OAuth clients").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"clients": clients,
+	})
+}
+
+// adminOAuthClientCreate registers a new OAuth client.
+func (a *API) adminOAuthClientCreate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	params, err := getOAuthClientParams(r)
+	if err != nil {
+		return err
+	}
+	if params.Name == "" {
+		return unprocessableEntityError("A name is required")
+	}
+	if len(params.RedirectURIs) == 0 {
+		return unprocessableEntityError("At least one redirect URI is required")
+	}
+
+	client, secret, err := models.NewOAuthClient(instanceID, params.Name, params.RedirectURIs, params.FirstParty != nil && *params.FirstParty, params.Confidential)
+	if err != nil {
+		return internalServerError("Error creating OAuth client").WithInternalError(err)
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, adminUser, models.OAuthClientCreatedAction, map[string]interface{}{
+			"client_id":   client.ClientID,
+			"client_name": client.Name,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Create(client)
+	})
+	if err != nil {
+		return internalServerError("Database error creating OAuth client").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusCreated, &OAuthClientResponse{OAuthClient: client, ClientSecret: secret})
+}
+
+// adminOAuthClientGet returns information about a single OAuth client.
+func (a *API) adminOAuthClientGet(w http.ResponseWriter, r *http.Request) error {
+	return sendJSON(w, http.StatusOK, getOAuthClient(r.Context()))
+}
+
+// adminOAuthClientUpdate updates the name, redirect URIs or first party flag of a client.
+func (a *API) adminOAuthClientUpdate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	client := getOAuthClient(ctx)
+
+	params, err := getOAuthClientParams(r)
+	if err != nil {
+		return err
+	}
+
+	if params.Name != "" {
+		client.Name = params.Name
+	}
+	if params.RedirectURIs != nil {
+		if len(params.RedirectURIs) == 0 {
+			return unprocessableEntityError("At least one redirect URI is required")
+		}
+		client.RedirectURIs = params.RedirectURIs
+	}
+	if params.FirstParty != nil {
+		client.FirstParty = *params.FirstParty
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, adminUser, models.OAuthClientModifiedAction, map[string]interface{}{
+			"client_id":   client.ClientID,
+			"client_name": client.Name,
+		}); terr != nil {
+			return terr
+		}
+		return tx.UpdateOnly(client, "name", "redirect_uris", "first_party")
+	})
+	if err != nil {
+		return internalServerError("Database error updating OAuth client").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, client)
+}
+
+// adminOAuthClientDelete removes an OAuth client.
+func (a *API) adminOAuthClientDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	client := getOAuthClient(ctx)
+
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, adminUser, models.OAuthClientDeletedAction, map[string]interface{}{
+			"client_id":   client.ClientID,
+			"client_name": client.Name,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Destroy(client)
+	})
+	if err != nil {
+		return internalServerError("Database error deleting OAuth client").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
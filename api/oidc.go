@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/models"
+)
+
+// OpenID Connect scopes.
+const (
+	scopeOpenID  = "openid"
+	scopeEmail   = "email"
+	scopeProfile = "profile"
+)
+
+// idTokenType is the typ header of ID tokens, which tells them apart from
+// access tokens signed with the same keys.
+const idTokenType = "id_token+jwt"
+
+// tokenParams are the parameters of the tokens issued for a grant.
+type tokenParams struct {
+	Issuer   string
+	Scope    string
+	Nonce    string
+	ClientID string
+
+	// SessionID is set once the session of the grant is known. The other
+	// fields describe the session started by a new login.
+	SessionID            uuid.UUID
+	AAL                  string
+	AuthenticationMethod string
+	IP                   string
+	UserAgent            string
+}
+
+func (p *tokenParams) hasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	return hasScope(p.Scope, scope)
+}
+
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubScope reports whether every scope in scopes is also in granted.
+func isSubScope(scopes, granted string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if !hasScope(granted, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// newTokenParams returns the token parameters of a grant where the user
+// authenticated with method.
+func (a *API) newTokenParams(r *http.Request, method string) *tokenParams {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	return &tokenParams{
+		Issuer:               a.getIssuer(r.Context()),
+		AuthenticationMethod: method,
+		IP:                   ip,
+		UserAgent:            r.UserAgent(),
+	}
+}
+
+// getIssuer returns the OpenID Connect issuer of the instance, or an empty
+// string when none is configured.
+func (a *API) getIssuer(ctx context.Context) string {
+	config := a.getConfig(ctx)
+	if config.JWT.Issuer != "" {
+		return strings.TrimSuffix(config.JWT.Issuer, "/")
+	}
+	return strings.TrimSuffix(a.config.API.Endpoint, "/")
+}
+
+// OpenIDClaims are the standard claims about a user (OpenID Connect Core 5.1).
+type OpenIDClaims struct {
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	UpdatedAt     int64  `json:"updated_at,omitempty"`
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token.
+type IDTokenClaims struct {
+	jwt.StandardClaims //nolint:staticcheck // keep aud a string like access tokens
+	OpenIDClaims
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+}
+
+// UserInfoResponse is the response of the userinfo endpoint.
+type UserInfoResponse struct {
+	Subject string `json:"sub"`
+	OpenIDClaims
+}
+
+// newOpenIDClaims returns the claims about a user covered by the given scopes.
+func newOpenIDClaims(user *models.User, scopes string) OpenIDClaims {
+	claims := OpenIDClaims{}
+
+	if hasScope(scopes, scopeEmail) {
+		verified := user.IsConfirmed()
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+
+	if hasScope(scopes, scopeProfile) {
+		if name, ok := user.UserMetaData["full_name"].(string); ok {
+			claims.Name = name
+		}
+		if picture, ok := user.UserMetaData["avatar_url"].(string); ok {
+			claims.Picture = picture
+		}
+		claims.UpdatedAt = user.UpdatedAt.Unix()
+	}
+
+	return claims
+}
+
+func generateIDToken(user *models.User, expiresIn time.Duration, key *signingKey, params *tokenParams) (string, error) {
+	// ID tokens are meant for the client that requested them
+	aud := user.Aud
+	if params.ClientID != "" {
+		aud = params.ClientID
+	}
+
+	now := time.Now()
+	claims := &IDTokenClaims{
+		StandardClaims: jwt.StandardClaims{ //nolint:staticcheck
+			Issuer:    params.Issuer,
+			Subject:   user.ID.String(),
+			Audience:  aud,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiresIn).Unix(),
+		},
+		OpenIDClaims: newOpenIDClaims(user, params.Scope),
+		Nonce:        params.Nonce,
+	}
+	if user.LastSignInAt != nil {
+		claims.AuthTime = user.LastSignInAt.Unix()
+	}
+
+	return key.signWithType(idTokenType, claims)
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethods         []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+// OpenIDConfiguration serves the OpenID Connect discovery document.
+func (a *API) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	issuer := a.getIssuer(ctx)
+	if issuer == "" {
+		return notFoundError("OpenID Connect is not configured, an issuer is required")
+	}
+
+	key, err := a.getSigningKey(ctx)
+	if err != nil {
+		return internalServerError("Error loading signing key").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, &OpenIDConfiguration{
+		Issuer:                           issuer,
+		AuthorizationEndpoint:            issuer + "/authorize",
+		TokenEndpoint:                    issuer + "/token",
+		UserInfoEndpoint:                 issuer + "/userinfo",
+		JWKSURI:                          issuer + "/.well-known/jwks.json",
+		ScopesSupported:                  []string{scopeOpenID, scopeEmail, scopeProfile},
+		ResponseTypesSupported:           []string{"code"},
+		GrantTypesSupported:              []string{"authorization_code", "password", "refresh_token"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{key.Method.Alg()},
+		TokenEndpointAuthMethods:         []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:    []string{models.CodeChallengeS256},
+		ClaimsSupported:                  []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name", "picture", "updated_at"},
+	})
+}
+
+// UserInfo returns the claims about the authenticated user that the scopes of
+// the access token cover.
+func (a *API) UserInfo(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	claims := getClaims(ctx)
+	if claims == nil {
+		return badRequestError("Could not read claims")
+	}
+
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError("%s", err.Error())
+		}
+		return badRequestError("Could not read User ID claim").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, &UserInfoResponse{
+		Subject:      user.ID.String(),
+		OpenIDClaims: newOpenIDClaims(user, claims.Scope),
+	})
+}
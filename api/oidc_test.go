@@ -0,0 +1,236 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type OIDCTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestOIDC(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &OIDCTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *OIDCTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+	ts.Config.JWT.Issuer = "https://example.com/.netlify/identity/"
+
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, map[string]interface{}{
+		"full_name":  "Test User",
+		"avatar_url": "https://example.com/avatar.png",
+	})
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.ConfirmedAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+}
+
+func (ts *OIDCTestSuite) passwordGrant(scope string) *AccessTokenResponse {
+	body := strings.NewReader(url.Values{
+		"grant_type": {"password"},
+		"username":   {"test@example.com"},
+		"password":   {"password"},
+		"scope":      {scope},
+		"nonce":      {"n-0S6_WzA2Mj"},
+	}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	return token
+}
+
+func (ts *OIDCTestSuite) TestDiscovery() {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := OpenIDConfiguration{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.Equal(ts.T(), "https://example.com/.netlify/identity", data.Issuer)
+	assert.Equal(ts.T(), "https://example.com/.netlify/identity/userinfo", data.UserInfoEndpoint)
+	assert.Equal(ts.T(), "https://example.com/.netlify/identity/.well-known/jwks.json", data.JWKSURI)
+	assert.Equal(ts.T(), []string{"HS256"}, data.IDTokenSigningAlgValuesSupported)
+}
+
+func (ts *OIDCTestSuite) TestDiscoveryWithoutIssuer() {
+	ts.Config.JWT.Issuer = ""
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusNotFound, w.Code)
+}
+
+func (ts *OIDCTestSuite) TestIDToken() {
+	token := ts.passwordGrant("openid email")
+	require.NotEmpty(ts.T(), token.IDToken)
+
+	claims := &IDTokenClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	idToken, err := p.ParseWithClaims(token.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), idTokenType, idToken.Header["typ"])
+	assert.Equal(ts.T(), "https://example.com/.netlify/identity", claims.Issuer)
+	assert.Equal(ts.T(), "n-0S6_WzA2Mj", claims.Nonce)
+	assert.Equal(ts.T(), "test@example.com", claims.Email)
+	require.NotNil(ts.T(), claims.EmailVerified)
+	assert.True(ts.T(), *claims.EmailVerified)
+	assert.Empty(ts.T(), claims.Name, "profile claims require the profile scope")
+	assert.NotZero(ts.T(), claims.AuthTime)
+
+	access := &GoTrueClaims{}
+	_, err = p.ParseWithClaims(token.Token, access, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "https://example.com/.netlify/identity", access.Issuer)
+	assert.Equal(ts.T(), "openid email", access.Scope)
+}
+
+func (ts *OIDCTestSuite) TestNoIDTokenWithoutOpenIDScope() {
+	token := ts.passwordGrant("")
+	assert.Empty(ts.T(), token.IDToken)
+	assert.NotEmpty(ts.T(), token.Token)
+}
+
+func (ts *OIDCTestSuite) TestIDTokenIsNotAnAccessToken() {
+	token := ts.passwordGrant("openid email")
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/user", nil)
+	req.Header.Set("Authorization", "Bearer "+token.IDToken)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (ts *OIDCTestSuite) refreshGrant(refreshToken, scope string) *httptest.ResponseRecorder {
+	body := strings.NewReader(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"scope":         {scope},
+	}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *OIDCTestSuite) TestRefreshKeepsGrant() {
+	token := ts.passwordGrant("openid email")
+
+	w := ts.refreshGrant(token.RefreshToken, "")
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	refreshed := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(refreshed))
+	require.NotEmpty(ts.T(), refreshed.IDToken)
+
+	claims := &IDTokenClaims{}
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err := p.ParseWithClaims(refreshed.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "n-0S6_WzA2Mj", claims.Nonce)
+	assert.Equal(ts.T(), "test@example.com", claims.Email)
+	assert.Empty(ts.T(), claims.Name)
+}
+
+func (ts *OIDCTestSuite) TestRefreshCannotWidenScope() {
+	token := ts.passwordGrant("openid email")
+
+	w := ts.refreshGrant(token.RefreshToken, "openid email profile")
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	w = ts.refreshGrant(token.RefreshToken, "openid")
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	refreshed := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(refreshed))
+	assert.NotEmpty(ts.T(), refreshed.IDToken)
+}
+
+func (ts *OIDCTestSuite) TestUserInfo() {
+	token := ts.passwordGrant("openid profile")
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := map[string]interface{}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	assert.NotEmpty(ts.T(), data["sub"])
+	assert.Equal(ts.T(), "Test User", data["name"])
+	assert.Equal(ts.T(), "https://example.com/avatar.png", data["picture"])
+	assert.NotContains(ts.T(), data, "email", "email claims require the email scope")
+}
+
+func (ts *OIDCTestSuite) TestUserInfoRequiresAuthentication() {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/userinfo", nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusUnauthorized, w.Code)
+}
+
+func TestNewOpenIDClaims(t *testing.T) {
+	u := &models.User{
+		Email:        "test@example.com",
+		UserMetaData: map[string]interface{}{"full_name": "Test User"},
+	}
+
+	claims := newOpenIDClaims(u, "")
+	assert.Equal(t, OpenIDClaims{}, claims)
+
+	claims = newOpenIDClaims(u, "openid")
+	assert.Equal(t, OpenIDClaims{}, claims)
+
+	claims = newOpenIDClaims(u, "openid email")
+	assert.Equal(t, "test@example.com", claims.Email)
+	assert.Empty(t, claims.Name)
+	require.NotNil(t, claims.EmailVerified)
+	assert.False(t, *claims.EmailVerified)
+
+	claims = newOpenIDClaims(u, "openid profile")
+	assert.Empty(t, claims.Email)
+	assert.Equal(t, "Test User", claims.Name)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/sms"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// OTPParams holds the parameters for a one-time passcode request
+type OTPParams struct {
+	Phone string                 `json:"phone"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// validatePhone returns the phone number in E.164 format.
+func validatePhone(phone string) (string, error) {
+	if phone == "" {
+		return "", unprocessableEntityError("A phone number is required")
+	}
+	normalized, err := sms.NormalizePhone(phone)
+	if err != nil {
+		return "", unprocessableEntityError("Unable to validate phone number: %s", err.Error())
+	}
+	return normalized, nil
+}
+
+// phoneOTPThrottled checks if a passcode was sent to the user too recently.
+func phoneOTPThrottled(u *models.User, config *conf.Configuration) bool {
+	return u.PhoneOTPSentAt != nil && !u.PhoneOTPSentAt.Add(config.SMS.MaxFrequency).Before(time.Now())
+}
+
+func sendPhoneOTP(tx *storage.Connection, u *models.User, sender sms.Sender, config *conf.Configuration) error {
+	otp := crypto.GenerateOTP(config.SMS.OTPLength)
+	if err := sender.OTPMessage(u, otp); err != nil {
+		return errors.Wrap(err, "Error sending one-time passcode")
+	}
+	return errors.Wrap(u.SetPhoneOTP(tx, otp), "Database error updating user for one-time passcode")
+}
+
+// OTP sends a one-time passcode to log in to a phone number. Unknown numbers
+// are signed up unless signups are disabled.
+func (a *API) OTP(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+	params := &OTPParams{}
+	jsonDecoder := json.NewDecoder(r.Body)
+	if err := jsonDecoder.Decode(params); err != nil {
+		return badRequestError("Could not read one-time passcode params: %v", err)
+	}
+
+	phone, err := validatePhone(params.Phone)
+	if err != nil {
+		return err
+	}
+
+	aud := a.requestAud(ctx, r)
+	user, err := models.FindUserByPhoneAndAudience(a.db, instanceID, phone, aud)
+	if err != nil {
+		if !models.IsNotFoundError(err) {
+			return internalServerError("Database error finding user").WithInternalError(err)
+		}
+		// don't tell apart unknown numbers when new users can't sign up
+		if config.DisableSignup {
+			return sendJSON(w, http.StatusOK, &map[string]string{})
+		}
+	}
+
+	if user != nil && phoneOTPThrottled(user, config) {
+		return tooManyRequestsError("Rate limit exceeded, try again later")
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if user == nil {
+			user, terr = a.signupNewUser(ctx, tx, &SignupParams{
+				Phone:    phone,
+				Data:     params.Data,
+				Provider: "phone",
+				Aud:      aud,
+			})
+			if terr != nil {
+				return terr
+			}
+		}
+
+		if terr = models.NewAuditLogEntry(tx, instanceID, user, models.UserOTPRequestedAction, nil); terr != nil {
+			return terr
+		}
+
+		if terr = sendPhoneOTP(tx, user, a.SMSSender(ctx), config); terr != nil {
+			return internalServerError("Error sending one-time passcode").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, &map[string]string{})
+}
+
+// verifyPhoneOTP checks the one-time passcode sent to a phone number and
+// returns its user. Codes are invalidated after too many wrong attempts.
+func (a *API) verifyPhoneOTP(r *http.Request, params *VerifyParams) (*models.User, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if !config.External.Phone.Enabled {
+		return nil, badRequestError("Unsupported phone provider")
+	}
+	phone, err := validatePhone(params.Phone)
+	if err != nil {
+		return nil, err
+	}
+	if params.OTP == "" {
+		return nil, unprocessableEntityError("Verifying a phone number requires a one-time passcode")
+	}
+
+	invalid := unprocessableEntityError("Invalid or expired one-time passcode")
+	user, err := models.FindUserByPhoneAndAudience(a.db, instanceID, phone, a.requestAud(ctx, r))
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, invalid
+		}
+		return nil, internalServerError("Database error finding user").WithInternalError(err)
+	}
+
+	// guesses are checked one after the other against the stored code, so
+	// concurrent ones can't get past the attempts limit
+	var verr error
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		user, terr = models.FindUserForUpdate(tx, user.InstanceID, user.ID)
+		if terr != nil {
+			return terr
+		}
+		if user.PhoneOTPSentAt == nil || time.Now().After(user.PhoneOTPSentAt.Add(config.SMS.OTPMaxAge)) {
+			verr = invalid
+			return nil
+		}
+
+		if !user.PhoneOTPMatches(params.OTP) {
+			if user.PhoneOTP == "" {
+				verr = invalid
+				return nil
+			}
+			if terr = user.IncrementPhoneOTPAttempts(tx); terr != nil {
+				return terr
+			}
+			if user.PhoneOTPAttempts < config.SMS.OTPMaxAttempts {
+				verr = invalid
+				return nil
+			}
+			verr = tooManyRequestsError("Too many attempts, please request a new code")
+		}
+		return user.ConsumePhoneOTP(tx)
+	})
+	if err != nil {
+		return nil, internalServerError("Database error updating user").WithInternalError(err)
+	}
+	if verr != nil {
+		return nil, verr
+	}
+	return user, nil
+}
+
+func (a *API) smsVerify(ctx context.Context, conn *storage.Connection, user *models.User) (*models.User, error) {
+	instanceID := getInstanceID(ctx)
+	config := a.getConfig(ctx)
+
+	err := conn.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		// entering the code proves the user owns the number, which signs up
+		// users who only have a phone number
+		if !user.IsPhoneConfirmed() {
+			if !user.IsConfirmed() {
+				if terr = models.NewAuditLogEntry(tx, instanceID, user, models.UserSignedUpAction, nil); terr != nil {
+					return terr
+				}
+				if terr = triggerEventHooks(ctx, tx, SignupEvent, user, instanceID, config); terr != nil {
+					return terr
+				}
+			}
+			if terr = user.ConfirmPhone(tx); terr != nil {
+				return terr
+			}
+		}
+		return models.NewAuditLogEntry(tx, instanceID, user, models.LoginAction, map[string]interface{}{
+			"provider": "phone",
+		})
+	})
+
+	if err != nil {
+		return nil, internalServerError("Database error updating user").WithInternalError(err)
+	}
+	return user, nil
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PhoneTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+	twilio     *httptest.Server
+	messages   map[string]string
+}
+
+func TestPhone(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &PhoneTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	// a Twilio compatible API that keeps the last message per number
+	ts.twilio = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		ts.messages[r.PostForm.Get("To")] = r.PostForm.Get("Body")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM123", "status": "queued"}`))
+	}))
+	defer ts.twilio.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *PhoneTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+	ts.messages = map[string]string{}
+	ts.Config.DisableSignup = false
+	ts.Config.External.Phone.Enabled = true
+	ts.Config.External.Email.Disabled = false
+	ts.Config.SMS.Provider = conf.SMSProviderTwilio
+	ts.Config.SMS.Autoconfirm = false
+	ts.Config.SMS.Template = "{{ .OTP }}"
+	ts.Config.SMS.Twilio.AccountSID = "AC123"
+	ts.Config.SMS.Twilio.From = "+15005550006"
+	ts.Config.SMS.Twilio.APIURL = ts.twilio.URL
+}
+
+func (ts *PhoneTestSuite) post(path string, body map[string]interface{}) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost"+path, &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *PhoneTestSuite) verify(phone, otp string) *httptest.ResponseRecorder {
+	return ts.post("/verify", map[string]interface{}{"type": "sms", "phone": phone, "otp": otp})
+}
+
+func (ts *PhoneTestSuite) findUser() *models.User {
+	u, err := models.FindUserByPhoneAndAudience(ts.API.db, ts.instanceID, "+14155552671", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	return u
+}
+
+func (ts *PhoneTestSuite) TestSignupAndPasswordLogin() {
+	w := ts.post("/signup", map[string]interface{}{"phone": "+1 (415) 555-2671", "password": "test"})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	data := &models.User{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(data))
+	assert.Equal(ts.T(), "+14155552671", data.Phone)
+	assert.Empty(ts.T(), data.Email)
+	assert.Equal(ts.T(), "phone", data.AppMetaData["provider"])
+
+	otp := ts.messages["+14155552671"]
+	require.Len(ts.T(), otp, 6)
+
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token", strings.NewReader(url.Values{
+			"grant_type": {"password"},
+			"phone":      {"+14155552671"},
+			"password":   {"test"},
+		}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(ts.T(), http.StatusBadRequest, login().Code)
+
+	w = ts.verify("+14155552671", otp)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	u := ts.findUser()
+	assert.True(ts.T(), u.IsPhoneConfirmed())
+	assert.False(ts.T(), u.IsConfirmed(), "verifying the number doesn't confirm an email address")
+
+	assert.Equal(ts.T(), http.StatusOK, login().Code)
+
+	// phone logins don't depend on the email provider
+	ts.Config.External.Email.Disabled = true
+	assert.Equal(ts.T(), http.StatusOK, login().Code)
+
+	// the number can't be signed up again
+	w = ts.post("/signup", map[string]interface{}{"phone": "+14155552671", "password": "test"})
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *PhoneTestSuite) TestOTPLogin() {
+	w := ts.post("/otp", map[string]interface{}{"phone": "4155552671"})
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = ts.post("/otp", map[string]interface{}{"phone": "+14155552671", "data": map[string]interface{}{"name": "Phone"}})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	u := ts.findUser()
+	assert.Equal(ts.T(), "Phone", u.UserMetaData["name"])
+	assert.False(ts.T(), u.IsConfirmed())
+
+	// another code is throttled per number
+	w = ts.post("/otp", map[string]interface{}{"phone": "+14155552671"})
+	assert.Equal(ts.T(), http.StatusTooManyRequests, w.Code)
+
+	otp := ts.messages["+14155552671"]
+	w = ts.verify("+14155552671", otp)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	assert.NotEmpty(ts.T(), token.Token)
+	assert.True(ts.T(), ts.findUser().IsPhoneConfirmed())
+	assert.False(ts.T(), ts.findUser().IsConfirmed())
+
+	// codes work once
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, ts.verify("+14155552671", otp).Code)
+}
+
+func (ts *PhoneTestSuite) TestOTPLockout() {
+	require.Equal(ts.T(), http.StatusOK, ts.post("/otp", map[string]interface{}{"phone": "+14155552671"}).Code)
+	otp := ts.messages["+14155552671"]
+
+	wrong := "000000"
+	if otp == wrong {
+		wrong = "111111"
+	}
+	for i := 1; i < ts.Config.SMS.OTPMaxAttempts; i++ {
+		assert.Equal(ts.T(), http.StatusUnprocessableEntity, ts.verify("+14155552671", wrong).Code)
+	}
+	assert.Equal(ts.T(), http.StatusTooManyRequests, ts.verify("+14155552671", wrong).Code)
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, ts.verify("+14155552671", otp).Code)
+}
+
+func (ts *PhoneTestSuite) TestOTPSignupDisabled() {
+	ts.Config.DisableSignup = true
+	w := ts.post("/otp", map[string]interface{}{"phone": "+14155552671"})
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+	assert.Empty(ts.T(), ts.messages)
+}
+
+func (ts *PhoneTestSuite) TestPhoneProviderDisabled() {
+	ts.Config.External.Phone.Enabled = false
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.post("/otp", map[string]interface{}{"phone": "+14155552671"}).Code)
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.verify("+14155552671", "123456").Code)
+}
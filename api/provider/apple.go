@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"golang.org/x/oauth2"
+)
+
+// Apple
+
+const defaultAppleAPIBase = "appleid.apple.com"
+
+type appleProvider struct {
+	*oauth2.Config
+	Verifier *IDTokenVerifier
+
+	teamID     string
+	keyID      string
+	privateKey stdcrypto.Signer
+}
+
+// appleUser is posted to the callback on the first authorization only.
+type appleUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+}
+
+// NewAppleProvider creates a Sign in with Apple provider.
+func NewAppleProvider(ext conf.AppleProviderConfiguration) (OAuthProvider, error) {
+	if err := ext.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := crypto.ParseSigningKey(crypto.ES256, ext.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	host := chooseHost(ext.URL, defaultAppleAPIBase)
+	return &appleProvider{
+		Config: &oauth2.Config{
+			ClientID: ext.ClientID,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   host + "/auth/authorize",
+				TokenURL:  host + "/auth/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+			Scopes: []string{
+				"name",
+				"email",
+			},
+			RedirectURL: ext.RedirectURI,
+		},
+		Verifier: &IDTokenVerifier{
+			Issuer:   host,
+			ClientID: ext.ClientID,
+			JWKSURI:  host + "/auth/keys",
+		},
+		teamID:     ext.TeamID,
+		keyID:      ext.KeyID,
+		privateKey: key,
+	}, nil
+}
+
+// AuthCodeURL asks Apple to post back to the callback, which it requires
+// when requesting the name or email.
+func (p appleProvider) AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string {
+	opts = append(opts, oauth2.SetAuthURLParam("response_mode", "form_post"))
+	return p.Config.AuthCodeURL(state, opts...)
+}
+
+// clientSecret signs the short lived JWT Apple takes as the client secret.
+func (p appleProvider) clientSecret() (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Issuer:    p.teamID,
+		Subject:   p.ClientID,
+		Audience:  jwt.ClaimStrings{p.Verifier.Issuer},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	})
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.privateKey)
+}
+
+// secretConfig returns the config with a newly signed client secret.
+func (p appleProvider) secretConfig() (*oauth2.Config, error) {
+	secret, err := p.clientSecret()
+	if err != nil {
+		return nil, err
+	}
+	config := *p.Config
+	config.ClientSecret = secret
+	return &config, nil
+}
+
+func (p appleProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
+	config, err := p.secretConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Exchange(context.Background(), code)
+}
+
+// TokenSource refreshes tokens with a client secret, which the embedded
+// config doesn't carry.
+func (p appleProvider) TokenSource(ctx context.Context, tok *oauth2.Token) oauth2.TokenSource {
+	config, err := p.secretConfig()
+	if err != nil {
+		return errTokenSource{err}
+	}
+	return config.TokenSource(ctx, tok)
+}
+
+// errTokenSource fails to return a token with err.
+type errTokenSource struct {
+	err error
+}
+
+func (s errTokenSource) Token() (*oauth2.Token, error) {
+	return nil, s.err
+}
+
+func (p appleProvider) DefaultScopes() []string {
+	return p.Scopes
+}
+
+func (p appleProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
+	rawIDToken, _ := tok.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("ID token missing from Apple token response")
+	}
+
+	claims, err := p.Verifier.Verify(ctx, rawIDToken, nonceFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	data := claims.userData()
+
+	// private relay addresses forward to the verified email of the user
+	if claims.IsPrivateEmail {
+		for i := range data.Emails {
+			data.Emails[i].Verified = true
+		}
+		data.Metadata["is_private_email"] = "true"
+	}
+
+	if raw := callbackValues(ctx).Get("user"); raw != "" {
+		var u appleUser
+		if err := json.Unmarshal([]byte(raw), &u); err != nil {
+			return nil, err
+		}
+		data.Metadata[nameKey] = strings.TrimSpace(u.Name.FirstName + " " + u.Name.LastName)
+	}
+
+	if len(data.Emails) <= 0 {
+		return nil, errors.New("Unable to find email with Apple provider")
+	}
+
+	return data, nil
+}
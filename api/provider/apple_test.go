@@ -0,0 +1,125 @@
+package provider_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestAppleProvider(t *testing.T) {
+	teamKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(teamKey)
+	require.NoError(t, err)
+
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwk, err := crypto.NewJWK(&signingKey.PublicKey, "apple", "RS256")
+	require.NoError(t, err)
+
+	var server *httptest.Server
+	claims := jwt.MapClaims{}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/auth/keys":
+			require.NoError(t, json.NewEncoder(w).Encode(&crypto.JWKSet{Keys: []*crypto.JWK{jwk}}))
+		case "/auth/token":
+			assert.Equal(t, "com.example.web", r.FormValue("client_id"))
+			secret := jwt.RegisteredClaims{}
+			token, err := jwt.ParseWithClaims(r.FormValue("client_secret"), &secret, func(*jwt.Token) (interface{}, error) {
+				return &teamKey.PublicKey, nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "ES256", token.Method.Alg())
+			assert.Equal(t, "KEY123", token.Header["kid"])
+			assert.Equal(t, "TEAM123", secret.Issuer)
+			assert.Equal(t, "com.example.web", secret.Subject)
+			assert.True(t, secret.VerifyAudience(server.URL, true))
+
+			idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			idToken.Header["kid"] = "apple"
+			signed, err := idToken.SignedString(signingKey)
+			require.NoError(t, err)
+			fmt.Fprintf(w, `{"access_token":"apple_token","token_type":"bearer","expires_in":3600,"id_token":%q}`, signed)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p, err := provider.NewAppleProvider(conf.AppleProviderConfiguration{
+		Enabled:     true,
+		ClientID:    "com.example.web",
+		TeamID:      "TEAM123",
+		KeyID:       "KEY123",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		RedirectURI: "https://example.netlify.com/callback",
+		URL:         server.URL,
+	})
+	require.NoError(t, err)
+
+	u, err := url.Parse(p.AuthCodeURL("state"))
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/auth/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "form_post", u.Query().Get("response_mode"))
+	assert.Equal(t, "name email", u.Query().Get("scope"))
+
+	claims["iss"] = server.URL
+	claims["sub"] = "001234.apple"
+	claims["aud"] = "com.example.web"
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["nonce"] = "nonce"
+	claims["email"] = "abc@privaterelay.appleid.com"
+	claims["is_private_email"] = "true"
+
+	// the name is only posted to the callback on the first authorization
+	ctx := provider.WithNonce(context.Background(), "nonce")
+	ctx = provider.WithCallbackValues(ctx, url.Values{"user": {`{"name":{"firstName":"Apple","lastName":"Test"}}`}})
+	tok, err := p.GetOAuthToken("code")
+	require.NoError(t, err)
+	data, err := p.GetUserData(ctx, tok)
+	require.NoError(t, err)
+	assert.Equal(t, "001234.apple", data.ID)
+	assert.Equal(t, []provider.Email{{Email: "abc@privaterelay.appleid.com", Verified: true, Primary: true}}, data.Emails)
+	assert.Equal(t, "Apple Test", data.Metadata["full_name"])
+	assert.Equal(t, "true", data.Metadata["is_private_email"])
+
+	claims["nonce"] = "other"
+	tok, err = p.GetOAuthToken("code")
+	require.NoError(t, err)
+	_, err = p.GetUserData(ctx, tok)
+	assert.Error(t, err)
+
+	// refreshing signs a client secret like the code exchange
+	refresher, ok := p.(provider.TokenRefresher)
+	require.True(t, ok)
+	expired := &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)}
+	tok, err = refresher.TokenSource(context.Background(), expired).Token()
+	require.NoError(t, err)
+	assert.Equal(t, "apple_token", tok.AccessToken)
+}
+
+func TestAppleProviderConfiguration(t *testing.T) {
+	_, err := provider.NewAppleProvider(conf.AppleProviderConfiguration{Enabled: true, ClientID: "com.example.web", RedirectURI: "https://example.netlify.com/callback"})
+	assert.EqualError(t, err, "Missing team ID, key ID or private key")
+}
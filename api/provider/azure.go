@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"golang.org/x/oauth2"
+)
+
+// Azure AD / Microsoft Entra ID
+
+const (
+	defaultAzureAuthBase = "login.microsoftonline.com"
+
+	azureCommonTenant        = "common"
+	azureOrganizationsTenant = "organizations"
+	azureConsumersTenant     = "consumers"
+	// azureConsumersTenantID is the tenant of personal Microsoft accounts.
+	azureConsumersTenantID = "9188040d-6c67-4c5b-b112-36a304b66dad"
+)
+
+type azureProvider struct {
+	*oauth2.Config
+	Verifier *IDTokenVerifier
+
+	host           string
+	tenant         string
+	allowedTenants []string
+}
+
+// NewAzureProvider creates a Microsoft account provider.
+func NewAzureProvider(ext conf.AzureProviderConfiguration) (OAuthProvider, error) {
+	if err := ext.Validate(); err != nil {
+		return nil, err
+	}
+
+	tenant := strings.ToLower(ext.Tenant)
+	if tenant == "" {
+		tenant = azureCommonTenant
+	}
+
+	host := chooseHost(ext.URL, defaultAzureAuthBase)
+	return &azureProvider{
+		Config: &oauth2.Config{
+			ClientID:     ext.ClientID,
+			ClientSecret: ext.Secret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  host + "/" + tenant + "/oauth2/v2.0/authorize",
+				TokenURL: host + "/" + tenant + "/oauth2/v2.0/token",
+			},
+			RedirectURL: ext.RedirectURI,
+			Scopes: []string{
+				"openid",
+				"email",
+				"profile",
+			},
+		},
+		Verifier: &IDTokenVerifier{
+			ClientID: ext.ClientID,
+			JWKSURI:  host + "/" + tenant + "/discovery/v2.0/keys",
+		},
+		host:           host,
+		tenant:         tenant,
+		allowedTenants: ext.AllowedTenants,
+	}, nil
+}
+
+func (p azureProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
+	return p.Exchange(context.Background(), code)
+}
+
+func (p azureProvider) DefaultScopes() []string {
+	return p.Scopes
+}
+
+// allowsTenant reports whether users of tenant tid may sign in.
+func (p azureProvider) allowsTenant(tid string) bool {
+	if tid == "" {
+		return false
+	}
+
+	switch p.tenant {
+	case azureCommonTenant:
+	case azureOrganizationsTenant:
+		if tid == azureConsumersTenantID {
+			return false
+		}
+	case azureConsumersTenant:
+		if tid != azureConsumersTenantID {
+			return false
+		}
+	default:
+		if !strings.EqualFold(tid, p.tenant) {
+			return false
+		}
+	}
+
+	if len(p.allowedTenants) == 0 {
+		return true
+	}
+	for _, allowed := range p.allowedTenants {
+		if strings.EqualFold(tid, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p azureProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
+	rawIDToken, _ := tok.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("ID token missing from Azure token response")
+	}
+
+	// tokens of multi-tenant apps are issued by the tenant of the user, so
+	// the tenant is checked before the issuer can be
+	unverified := &IDTokenClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(rawIDToken, unverified); err != nil {
+		return nil, fmt.Errorf("Invalid ID token: %w", err)
+	}
+	if !p.allowsTenant(unverified.TenantID) {
+		return nil, fmt.Errorf("Azure tenant %q is not allowed", unverified.TenantID)
+	}
+
+	verifier := *p.Verifier
+	verifier.Issuer = p.host + "/" + unverified.TenantID + "/v2.0"
+	claims, err := verifier.Verify(ctx, rawIDToken, nonceFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// Microsoft doesn't verify the emails of work accounts, unless the domain
+	// of the email is owned by their tenant. Personal accounts are verified.
+	verified := claims.TenantID == azureConsumersTenantID || bool(claims.EmailDomainVerified)
+
+	data := claims.userData()
+	data.Emails = nil
+	if claims.Email != "" {
+		data.Emails = append(data.Emails, Email{
+			Email:    claims.Email,
+			Verified: verified,
+			Primary:  true,
+		})
+	}
+	// preferred_username is the sign-in name, which usually is an email
+	if strings.Contains(claims.PreferredUsername, "@") && !strings.EqualFold(claims.PreferredUsername, claims.Email) {
+		data.Emails = append(data.Emails, Email{
+			Email:    claims.PreferredUsername,
+			Verified: claims.TenantID == azureConsumersTenantID,
+			Primary:  len(data.Emails) == 0,
+		})
+	}
+	data.Metadata["tenant_id"] = claims.TenantID
+
+	if len(data.Emails) <= 0 {
+		return nil, errors.New("Unable to find email with Azure provider")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,162 @@
+package provider_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	contosoTenantID   = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+	fabrikamTenantID  = "3b2d4c5e-0000-4000-8000-0000fab00001"
+	consumersTenantID = "9188040d-6c67-4c5b-b112-36a304b66dad"
+)
+
+// fakeAzure serves the Microsoft identity platform endpoints for tenant,
+// returning an ID token with claims from its token endpoint.
+type fakeAzure struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+}
+
+func newFakeAzure(t *testing.T, tenant string) *fakeAzure {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwk, err := crypto.NewJWK(&key.PublicKey, "azure", "RS256")
+	require.NoError(t, err)
+
+	f := &fakeAzure{key: key}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/" + tenant + "/discovery/v2.0/keys":
+			require.NoError(t, json.NewEncoder(w).Encode(&crypto.JWKSet{Keys: []*crypto.JWK{jwk}}))
+		case "/" + tenant + "/oauth2/v2.0/token":
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, f.claims)
+			token.Header["kid"] = "azure"
+			signed, err := token.SignedString(key)
+			require.NoError(t, err)
+			fmt.Fprintf(w, `{"access_token":"azure_token","token_type":"bearer","expires_in":3600,"id_token":%q}`, signed)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// signIn returns the user data of a sign-in from tenant tid.
+func (f *fakeAzure) signIn(t *testing.T, p provider.OAuthProvider, tid string, claims jwt.MapClaims) (*provider.UserProvidedData, error) {
+	f.claims = jwt.MapClaims{
+		"iss":   f.URL + "/" + tid + "/v2.0",
+		"sub":   "azure-user",
+		"aud":   "client-id",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "nonce",
+		"tid":   tid,
+		"name":  "Azure Test",
+	}
+	for k, v := range claims {
+		f.claims[k] = v
+	}
+
+	tok, err := p.GetOAuthToken("code")
+	require.NoError(t, err)
+	return p.GetUserData(provider.WithNonce(context.Background(), "nonce"), tok)
+}
+
+func (f *fakeAzure) config(tenant string, allowed ...string) conf.AzureProviderConfiguration {
+	return conf.AzureProviderConfiguration{
+		Enabled:        true,
+		ClientID:       "client-id",
+		Secret:         "secret",
+		RedirectURI:    "https://example.netlify.com/callback",
+		Tenant:         tenant,
+		AllowedTenants: allowed,
+		URL:            f.URL,
+	}
+}
+
+func TestAzureProvider(t *testing.T) {
+	f := newFakeAzure(t, "common")
+	p, err := provider.NewAzureProvider(f.config("common", contosoTenantID, consumersTenantID))
+	require.NoError(t, err)
+
+	u, err := url.Parse(p.AuthCodeURL("state"))
+	require.NoError(t, err)
+	assert.Equal(t, f.URL+"/common/oauth2/v2.0/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "openid email profile", u.Query().Get("scope"))
+
+	// the email of a work account is only verified when its domain is
+	data, err := f.signIn(t, p, contosoTenantID, jwt.MapClaims{
+		"email":              "azure@contoso.com",
+		"preferred_username": "azure@contoso.onmicrosoft.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "azure-user", data.ID)
+	assert.Equal(t, "Azure Test", data.Metadata["full_name"])
+	assert.Equal(t, contosoTenantID, data.Metadata["tenant_id"])
+	assert.Equal(t, []provider.Email{
+		{Email: "azure@contoso.com", Verified: false, Primary: true},
+		{Email: "azure@contoso.onmicrosoft.com", Verified: false, Primary: false},
+	}, data.Emails)
+
+	data, err = f.signIn(t, p, contosoTenantID, jwt.MapClaims{"email": "azure@contoso.com", "xms_edov": true})
+	require.NoError(t, err)
+	assert.Equal(t, []provider.Email{{Email: "azure@contoso.com", Verified: true, Primary: true}}, data.Emails)
+
+	// personal accounts only have a verified sign-in name
+	data, err = f.signIn(t, p, consumersTenantID, jwt.MapClaims{"preferred_username": "azure@outlook.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []provider.Email{{Email: "azure@outlook.com", Verified: true, Primary: true}}, data.Emails)
+
+	_, err = f.signIn(t, p, contosoTenantID, jwt.MapClaims{"preferred_username": "not-an-email"})
+	assert.EqualError(t, err, "Unable to find email with Azure provider")
+}
+
+func TestAzureProviderTenants(t *testing.T) {
+	email := jwt.MapClaims{"email": "azure@example.com"}
+
+	f := newFakeAzure(t, "common")
+	p, err := provider.NewAzureProvider(f.config("common", contosoTenantID))
+	require.NoError(t, err)
+	_, err = f.signIn(t, p, contosoTenantID, email)
+	require.NoError(t, err)
+	_, err = f.signIn(t, p, fabrikamTenantID, email)
+	assert.EqualError(t, err, fmt.Sprintf("Azure tenant %q is not allowed", fabrikamTenantID))
+
+	// the issuer has to be the tenant of the token
+	_, err = f.signIn(t, p, contosoTenantID, jwt.MapClaims{"email": "azure@example.com", "iss": f.URL + "/" + fabrikamTenantID + "/v2.0"})
+	assert.Error(t, err)
+
+	f = newFakeAzure(t, "organizations")
+	p, err = provider.NewAzureProvider(f.config("organizations"))
+	require.NoError(t, err)
+	_, err = f.signIn(t, p, fabrikamTenantID, email)
+	require.NoError(t, err)
+	_, err = f.signIn(t, p, consumersTenantID, email)
+	assert.Error(t, err)
+
+	f = newFakeAzure(t, contosoTenantID)
+	p, err = provider.NewAzureProvider(f.config(contosoTenantID))
+	require.NoError(t, err)
+	_, err = f.signIn(t, p, contosoTenantID, email)
+	require.NoError(t, err)
+	_, err = f.signIn(t, p, fabrikamTenantID, email)
+	assert.Error(t, err)
+}
@@ -19,6 +19,7 @@ type bitbucketProvider struct {
 }
 
 type bitbucketUser struct {
+	UUID   string `json:"uuid"`
 	Name   string `json:"display_name"`
 	Avatar struct {
 		Href string `json:"href"`
@@ -63,6 +64,10 @@ func (g bitbucketProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
 	return g.Exchange(context.Background(), code)
 }
 
+func (g bitbucketProvider) DefaultScopes() []string {
+	return g.Scopes
+}
+
 func (g bitbucketProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
 	var u bitbucketUser
 	if err := makeRequest(ctx, tok, g.Config, g.APIPath+"/user", &u); err != nil {
@@ -70,6 +75,7 @@ func (g bitbucketProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (
 	}
 
 	data := &UserProvidedData{
+		ID: u.UUID,
 		Metadata: map[string]string{
 			nameKey:      u.Name,
 			avatarURLKey: u.Avatar.Href,
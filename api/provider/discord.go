@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/netlify/gotrue/conf"
+	"golang.org/x/oauth2"
+)
+
+// Discord
+
+const (
+	defaultDiscordAPIBase = "discord.com"
+	discordCDNBase        = "https://cdn.discordapp.com"
+)
+
+type discordProvider struct {
+	*oauth2.Config
+	APIPath string
+}
+
+type discordUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+	Avatar     string `json:"avatar"`
+	Email      string `json:"email"`
+	Verified   bool   `json:"verified"`
+}
+
+// NewDiscordProvider creates a Discord account provider.
+func NewDiscordProvider(ext conf.OAuthProviderConfiguration) (OAuthProvider, error) {
+	if err := ext.Validate(); err != nil {
+		return nil, err
+	}
+
+	apiPath := chooseHost(ext.URL, defaultDiscordAPIBase) + "/api"
+	return &discordProvider{
+		Config: &oauth2.Config{
+			ClientID:     ext.ClientID,
+			ClientSecret: ext.Secret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  apiPath + "/oauth2/authorize",
+				TokenURL: apiPath + "/oauth2/token",
+			},
+			RedirectURL: ext.RedirectURI,
+			Scopes: []string{
+				"identify",
+				"email",
+			},
+		},
+		APIPath: apiPath,
+	}, nil
+}
+
+func (p discordProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
+	return p.Exchange(context.Background(), code)
+}
+
+func (p discordProvider) DefaultScopes() []string {
+	return p.Scopes
+}
+
+func (p discordProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
+	var u discordUser
+	if err := makeRequest(ctx, tok, p.Config, p.APIPath+"/users/@me", &u); err != nil {
+		return nil, err
+	}
+
+	if u.Email == "" {
+		return nil, errors.New("Unable to find email with Discord provider")
+	}
+
+	name := u.GlobalName
+	if name == "" {
+		name = u.Username
+	}
+	avatarURL := ""
+	if u.Avatar != "" {
+		avatarURL = fmt.Sprintf("%s/avatars/%s/%s.png", discordCDNBase, u.ID, u.Avatar)
+	}
+
+	return &UserProvidedData{
+		ID: u.ID,
+		Metadata: map[string]string{
+			aliasKey:     u.Username,
+			nameKey:      name,
+			avatarURLKey: avatarURL,
+		},
+		Emails: []Email{{
+			Email:    u.Email,
+			Verified: u.Verified,
+			Primary:  true,
+		}},
+	}, nil
+}
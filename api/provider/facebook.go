@@ -24,6 +24,7 @@ type facebookProvider struct {
 }
 
 type facebookUser struct {
+	ID        string `json:"id"`
 	Email     string `json:"email"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
@@ -43,7 +44,7 @@ func NewFacebookProvider(ext conf.OAuthProviderConfiguration) (OAuthProvider, er
 
 	authHost := chooseHost(ext.URL, defaultFacebookAuthBase)
 	tokenHost := chooseHost(ext.URL, defaultFacebookTokenBase)
-	profileURL := chooseHost(ext.URL, defaultFacebookAPIBase) + "/me?fields=email,first_name,last_name,name,picture"
+	profileURL := chooseHost(ext.URL, defaultFacebookAPIBase) + "/me?fields=id,email,first_name,last_name,name,picture"
 
 	return &facebookProvider{
 		Config: &oauth2.Config{
@@ -64,6 +65,10 @@ func (p facebookProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
 	return p.Exchange(context.Background(), code)
 }
 
+func (p facebookProvider) DefaultScopes() []string {
+	return p.Scopes
+}
+
 func (p facebookProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
 	hash := hmac.New(sha256.New, []byte(p.Config.ClientSecret))
 	hash.Write([]byte(tok.AccessToken))
@@ -80,6 +85,7 @@ func (p facebookProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*
 	}
 
 	return &UserProvidedData{
+		ID: u.ID,
 		Metadata: map[string]string{
 			aliasKey:     u.Alias,
 			nameKey:      strings.TrimSpace(u.FirstName + " " + u.LastName),
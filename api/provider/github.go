@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"errors"
+	"strconv"
 	"strings"
 
 	"github.com/netlify/gotrue/conf"
@@ -22,6 +23,7 @@ type githubProvider struct {
 }
 
 type githubUser struct {
+	ID        int64  `json:"id"`
 	Email     string `json:"email"`
 	Name      string `json:"name"`
 	AvatarURL string `json:"avatar_url"`
@@ -33,6 +35,15 @@ type githubUserEmail struct {
 	Verified bool   `json:"verified"`
 }
 
+type githubOrg struct {
+	Login string `json:"login"`
+}
+
+type githubTeam struct {
+	Slug         string    `json:"slug"`
+	Organization githubOrg `json:"organization"`
+}
+
 // NewGithubProvider creates a Github account provider.
 func NewGithubProvider(ext conf.OAuthProviderConfiguration) (OAuthProvider, error) {
 	if err := ext.Validate(); err != nil {
@@ -64,6 +75,10 @@ func (g githubProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
 	return g.Exchange(context.Background(), code)
 }
 
+func (g githubProvider) DefaultScopes() []string {
+	return g.Scopes
+}
+
 func (g githubProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
 	var u githubUser
 	if err := makeRequest(ctx, tok, g.Config, g.APIHost+"/user", &u); err != nil {
@@ -71,6 +86,7 @@ func (g githubProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*Us
 	}
 
 	data := &UserProvidedData{
+		ID: strconv.FormatInt(u.ID, 10),
 		Metadata: map[string]string{
 			nameKey:      u.Name,
 			avatarURLKey: u.AvatarURL,
@@ -92,5 +108,52 @@ func (g githubProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*Us
 		return nil, errors.New("Unable to find email with GitHub provider")
 	}
 
+	if groupsRequested(ctx) {
+		groups, err := g.groups(ctx, tok)
+		if err != nil {
+			return nil, err
+		}
+		data.Groups = groups
+	}
+
 	return data, nil
 }
+
+// GroupScopes implements GroupProvider.
+func (g githubProvider) GroupScopes() []string {
+	return []string{"read:org"}
+}
+
+// groups lists the organizations of the user by login and their teams as
+// org/team.
+func (g githubProvider) groups(ctx context.Context, tok *oauth2.Token) ([]string, error) {
+	var orgs []githubOrg
+	next := g.APIHost + "/user/orgs?per_page=100"
+	for i := 0; next != "" && i < maxListPages; i++ {
+		var page []githubOrg
+		var err error
+		if next, err = makeListRequest(ctx, tok, g.Config, next, &page); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, page...)
+	}
+	var teams []githubTeam
+	next = g.APIHost + "/user/teams?per_page=100"
+	for i := 0; next != "" && i < maxListPages; i++ {
+		var page []githubTeam
+		var err error
+		if next, err = makeListRequest(ctx, tok, g.Config, next, &page); err != nil {
+			return nil, err
+		}
+		teams = append(teams, page...)
+	}
+
+	groups := make([]string, 0, len(orgs)+len(teams))
+	for _, o := range orgs {
+		groups = append(groups, o.Login)
+	}
+	for _, t := range teams {
+		groups = append(groups, t.Organization.Login+"/"+t.Slug)
+	}
+	return groups, nil
+}
@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"errors"
+	"strconv"
 
 	"github.com/netlify/gotrue/conf"
 	"golang.org/x/oauth2"
@@ -18,6 +19,7 @@ type gitlabProvider struct {
 }
 
 type gitlabUser struct {
+	ID          int64  `json:"id"`
 	Email       string `json:"email"`
 	Name        string `json:"name"`
 	AvatarURL   string `json:"avatar_url"`
@@ -29,6 +31,10 @@ type gitlabUserEmail struct {
 	Email string `json:"email"`
 }
 
+type gitlabGroup struct {
+	FullPath string `json:"full_path"`
+}
+
 // NewGitlabProvider creates a Gitlab account provider.
 func NewGitlabProvider(ext conf.OAuthProviderConfiguration) (OAuthProvider, error) {
 	if err := ext.Validate(); err != nil {
@@ -55,6 +61,10 @@ func (g gitlabProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
 	return g.Exchange(context.Background(), code)
 }
 
+func (g gitlabProvider) DefaultScopes() []string {
+	return g.Scopes
+}
+
 func (g gitlabProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
 	var u gitlabUser
 
@@ -63,6 +73,7 @@ func (g gitlabProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*Us
 	}
 
 	data := &UserProvidedData{
+		ID: strconv.FormatInt(u.ID, 10),
 		Metadata: map[string]string{
 			nameKey:      u.Name,
 			avatarURLKey: u.AvatarURL,
@@ -90,5 +101,25 @@ func (g gitlabProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*Us
 		return nil, errors.New("Unable to find email with GitLab provider")
 	}
 
+	if groupsRequested(ctx) {
+		// the groups the user is at least a guest of
+		next := g.Host + "/api/v4/groups?min_access_level=10&per_page=100"
+		for i := 0; next != "" && i < maxListPages; i++ {
+			var groups []gitlabGroup
+			var err error
+			if next, err = makeListRequest(ctx, tok, g.Config, next, &groups); err != nil {
+				return nil, err
+			}
+			for _, group := range groups {
+				data.Groups = append(data.Groups, group.FullPath)
+			}
+		}
+	}
+
 	return data, nil
 }
+
+// GroupScopes implements GroupProvider.
+func (g gitlabProvider) GroupScopes() []string {
+	return []string{"read_api"}
+}
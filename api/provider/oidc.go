@@ -0,0 +1,298 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"golang.org/x/oauth2"
+)
+
+// OpenID Connect
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	// oidcCacheTTL is how long discovery documents and key sets are reused.
+	oidcCacheTTL = time.Hour
+)
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+var oidcCache = struct {
+	sync.Mutex
+	entries map[string]oidcCacheEntry
+}{entries: make(map[string]oidcCacheEntry)}
+
+type oidcCacheEntry struct {
+	body      []byte
+	fetchedAt time.Time
+}
+
+// OIDCDiscovery is the metadata an OpenID Connect issuer publishes.
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims are the claims of an ID token used to sign users in.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string    `json:"nonce,omitempty"`
+	Email             string    `json:"email,omitempty"`
+	EmailVerified     boolClaim `json:"email_verified,omitempty"`
+	Name              string    `json:"name,omitempty"`
+	GivenName         string    `json:"given_name,omitempty"`
+	FamilyName        string    `json:"family_name,omitempty"`
+	Picture           string    `json:"picture,omitempty"`
+	PreferredUsername string    `json:"preferred_username,omitempty"`
+	// IsPrivateEmail is set by Apple for private relay addresses.
+	IsPrivateEmail boolClaim `json:"is_private_email,omitempty"`
+	// TenantID and EmailDomainVerified are set by Microsoft.
+	TenantID            string    `json:"tid,omitempty"`
+	EmailDomainVerified boolClaim `json:"xms_edov,omitempty"`
+}
+
+// boolClaim is a boolean claim that some providers send as a string.
+type boolClaim bool
+
+func (b *boolClaim) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("Invalid boolean claim %s", data)
+	}
+	return nil
+}
+
+// userData maps the standard claims to the data of a user.
+func (c *IDTokenClaims) userData() *UserProvidedData {
+	name := c.Name
+	if name == "" {
+		name = strings.TrimSpace(c.GivenName + " " + c.FamilyName)
+	}
+	data := &UserProvidedData{
+		ID: c.Subject,
+		Metadata: map[string]string{
+			nameKey:      name,
+			avatarURLKey: c.Picture,
+		},
+	}
+	if c.Email != "" {
+		data.Emails = append(data.Emails, Email{
+			Email:    c.Email,
+			Verified: bool(c.EmailVerified),
+			Primary:  true,
+		})
+	}
+	return data
+}
+
+// IDTokenVerifier checks the signature and claims of the ID tokens of an
+// issuer.
+type IDTokenVerifier struct {
+	Issuer   string
+	ClientID string
+	JWKSURI  string
+}
+
+// Verify returns the claims of a valid ID token. The token must carry nonce,
+// if one was sent with the authorization request.
+func (v *IDTokenVerifier) Verify(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	p := jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}}
+	_, err := p.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.verificationKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid ID token: %w", err)
+	}
+
+	if claims.Issuer != v.Issuer {
+		return nil, fmt.Errorf("ID token issued by %s instead of %s", claims.Issuer, v.Issuer)
+	}
+	if !claims.VerifyAudience(v.ClientID, true) {
+		return nil, errors.New("ID token is not intended for this client")
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("ID token has no expiry")
+	}
+	if nonce != "" && !crypto.SecureCompare(claims.Nonce, nonce) {
+		return nil, errors.New("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// verificationKey looks up a key of the issuer, refetching its keys once
+// when it's unknown as they may have been rotated.
+func (v *IDTokenVerifier) verificationKey(ctx context.Context, kid string) (interface{}, error) {
+	for _, refresh := range []bool{false, true} {
+		set := &crypto.JWKSet{}
+		if err := fetchJSON(ctx, v.JWKSURI, set, refresh); err != nil {
+			return nil, err
+		}
+
+		key := set.Key(kid)
+		if key == nil && kid == "" && len(set.Keys) == 1 {
+			key = set.Keys[0]
+		}
+		if key != nil {
+			return key.PublicKey()
+		}
+	}
+	return nil, fmt.Errorf("Unknown key %q", kid)
+}
+
+// DiscoverOIDC fetches the metadata of an issuer.
+func DiscoverOIDC(ctx context.Context, issuer string) (*OIDCDiscovery, error) {
+	doc := &OIDCDiscovery{}
+	if err := fetchJSON(ctx, strings.TrimSuffix(issuer, "/")+oidcDiscoveryPath, doc, false); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("Discovered issuer %s does not match %s", doc.Issuer, issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("Incomplete OpenID Connect metadata for %s", issuer)
+	}
+	return doc, nil
+}
+
+// fetchJSON decodes a document that is cached for oidcCacheTTL, unless
+// refresh is set.
+func fetchJSON(ctx context.Context, url string, dst interface{}, refresh bool) error {
+	oidcCache.Lock()
+	entry, ok := oidcCache.entries[url]
+	oidcCache.Unlock()
+
+	if !ok || refresh || time.Since(entry.fetchedAt) > oidcCacheTTL {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		res, err := oidcClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		if err != nil {
+			return err
+		}
+		if res.StatusCode/100 != 2 {
+			return &RequestError{code: res.StatusCode, body: string(body)}
+		}
+
+		entry = oidcCacheEntry{body: body, fetchedAt: time.Now()}
+		oidcCache.Lock()
+		oidcCache.entries[url] = entry
+		oidcCache.Unlock()
+	}
+
+	return json.Unmarshal(entry.body, dst)
+}
+
+type oidcProvider struct {
+	*oauth2.Config
+	Discovery *OIDCDiscovery
+	Verifier  *IDTokenVerifier
+}
+
+// NewOIDCProvider creates a provider for an OpenID Connect issuer.
+func NewOIDCProvider(ctx context.Context, ext conf.OIDCProviderConfiguration) (OAuthProvider, error) {
+	if err := ext.Validate(); err != nil {
+		return nil, err
+	}
+
+	doc, err := DiscoverOIDC(ctx, ext.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := ext.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	hasOpenID := false
+	for _, s := range scopes {
+		hasOpenID = hasOpenID || s == "openid"
+	}
+	if !hasOpenID {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	return &oidcProvider{
+		Config: &oauth2.Config{
+			ClientID:     ext.ClientID,
+			ClientSecret: ext.Secret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  doc.AuthorizationEndpoint,
+				TokenURL: doc.TokenEndpoint,
+			},
+			Scopes:      scopes,
+			RedirectURL: ext.RedirectURI,
+		},
+		Discovery: doc,
+		Verifier: &IDTokenVerifier{
+			Issuer:   doc.Issuer,
+			ClientID: ext.ClientID,
+			JWKSURI:  doc.JWKSURI,
+		},
+	}, nil
+}
+
+func (p oidcProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
+	return p.Exchange(context.Background(), code)
+}
+
+func (p oidcProvider) DefaultScopes() []string {
+	return p.Scopes
+}
+
+func (p oidcProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
+	rawIDToken, _ := tok.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("ID token missing from OpenID Connect token response")
+	}
+
+	claims, err := p.Verifier.Verify(ctx, rawIDToken, nonceFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	data := claims.userData()
+
+	// some issuers only return the email from the userinfo endpoint
+	if len(data.Emails) == 0 && p.Discovery.UserinfoEndpoint != "" {
+		info := &IDTokenClaims{}
+		if err := makeRequest(ctx, tok, p.Config, p.Discovery.UserinfoEndpoint, info); err != nil {
+			return nil, err
+		}
+		if info.Subject != claims.Subject {
+			return nil, errors.New("Userinfo subject does not match the ID token")
+		}
+		data = info.userData()
+	}
+
+	if len(data.Emails) <= 0 {
+		return nil, errors.New("Unable to find email with OpenID Connect provider")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,173 @@
+package provider_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIssuer is an OpenID Connect issuer that returns idToken from its
+// token endpoint and userinfo from its userinfo endpoint.
+type fakeIssuer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	idToken  string
+	userinfo string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwk, err := crypto.NewJWK(&key.PublicKey, "k1", "RS256")
+	require.NoError(t, err)
+
+	f := &fakeIssuer{key: key}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":"%[1]s/authorize","token_endpoint":"%[1]s/token","userinfo_endpoint":"%[1]s/userinfo","jwks_uri":"%[1]s/keys"}`, f.URL)
+		case "/keys":
+			require.NoError(t, json.NewEncoder(w).Encode(&crypto.JWKSet{Keys: []*crypto.JWK{jwk}}))
+		case "/token":
+			assert.Equal(t, "code", r.FormValue("code"))
+			fmt.Fprintf(w, `{"access_token":"access","token_type":"bearer","expires_in":3600,"id_token":%q}`, f.idToken)
+		case "/userinfo":
+			assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+			fmt.Fprint(w, f.userinfo)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(f.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (f *fakeIssuer) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            f.URL,
+		"sub":            "user-1",
+		"aud":            "client-id",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "nonce",
+		"email":          "oidc@example.com",
+		"email_verified": true,
+		"name":           "OIDC Test",
+	}
+}
+
+func (f *fakeIssuer) config() conf.OIDCProviderConfiguration {
+	return conf.OIDCProviderConfiguration{
+		Enabled:     true,
+		Issuer:      f.URL,
+		ClientID:    "client-id",
+		Secret:      "secret",
+		RedirectURI: "https://redirect.example.org/callback",
+	}
+}
+
+func TestOIDCProvider(t *testing.T) {
+	f := newFakeIssuer(t)
+	ctx := provider.WithNonce(context.Background(), "nonce")
+
+	p, err := provider.NewOIDCProvider(ctx, f.config())
+	require.NoError(t, err)
+	u, err := url.Parse(p.AuthCodeURL("state"))
+	require.NoError(t, err)
+	assert.Equal(t, f.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "openid email profile", u.Query().Get("scope"))
+
+	f.idToken = f.sign(t, f.claims())
+	tok, err := p.GetOAuthToken("code")
+	require.NoError(t, err)
+	data, err := p.GetUserData(ctx, tok)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", data.ID)
+	assert.Equal(t, []provider.Email{{Email: "oidc@example.com", Verified: true, Primary: true}}, data.Emails)
+	assert.Equal(t, "OIDC Test", data.Metadata["full_name"])
+
+	// the email may only be available from the userinfo endpoint
+	claims := f.claims()
+	delete(claims, "email")
+	f.idToken = f.sign(t, claims)
+	f.userinfo = `{"sub":"user-1","email":"info@example.com","email_verified":"true"}`
+	tok, err = p.GetOAuthToken("code")
+	require.NoError(t, err)
+	data, err = p.GetUserData(ctx, tok)
+	require.NoError(t, err)
+	assert.Equal(t, []provider.Email{{Email: "info@example.com", Verified: true, Primary: true}}, data.Emails)
+
+	f.userinfo = `{"sub":"user-2","email":"info@example.com"}`
+	tok, err = p.GetOAuthToken("code")
+	require.NoError(t, err)
+	_, err = p.GetUserData(ctx, tok)
+	assert.Error(t, err)
+}
+
+func TestIDTokenVerifier(t *testing.T) {
+	f := newFakeIssuer(t)
+	ctx := context.Background()
+	doc, err := provider.DiscoverOIDC(ctx, f.URL)
+	require.NoError(t, err)
+	v := &provider.IDTokenVerifier{Issuer: doc.Issuer, ClientID: "client-id", JWKSURI: doc.JWKSURI}
+
+	_, err = v.Verify(ctx, f.sign(t, f.claims()), "nonce")
+	require.NoError(t, err)
+
+	cases := map[string]func(jwt.MapClaims){
+		"nonce":     func(c jwt.MapClaims) { c["nonce"] = "other" },
+		"issuer":    func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"audience":  func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"expired":   func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no expiry": func(c jwt.MapClaims) { delete(c, "exp") },
+	}
+	for name, modify := range cases {
+		claims := f.claims()
+		modify(claims)
+		_, err := v.Verify(ctx, f.sign(t, claims), "nonce")
+		assert.Error(t, err, name)
+	}
+
+	// tokens signed by another key are rejected
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other := &fakeIssuer{key: otherKey}
+	_, err = v.Verify(ctx, other.sign(t, f.claims()), "nonce")
+	assert.Error(t, err)
+}
+
+func TestDiscoverOIDCIssuerMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"issuer":"https://evil.example.com","authorization_endpoint":"a","token_endpoint":"t","jwks_uri":"k"}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := provider.DiscoverOIDC(context.Background(), srv.URL)
+	assert.Error(t, err)
+
+	_, err = provider.NewOIDCProvider(context.Background(), conf.OIDCProviderConfiguration{Enabled: true, Issuer: srv.URL})
+	assert.EqualError(t, err, "Missing Oauth client ID")
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"golang.org/x/oauth2"
 )
@@ -22,8 +25,17 @@ type Email struct {
 }
 
 type UserProvidedData struct {
+	// ID is the stable identifier of the user at the provider.
+	ID       string
 	Emails   []Email
 	Metadata map[string]string
+	// Token is the token the provider issued for the user, if any.
+	Token *oauth2.Token
+	// Scopes are the scopes the user granted.
+	Scopes []string
+	// Groups are the groups, organizations or teams the user is a member
+	// of, if the provider was asked for them.
+	Groups []string
 }
 
 // Provider is an interface for interacting with external account providers
@@ -38,6 +50,60 @@ type OAuthProvider interface {
 	GetOAuthToken(string) (*oauth2.Token, error)
 }
 
+// GroupProvider is implemented by providers that can list the groups of
+// users. They only do so when asked with WithGroups, as it takes more
+// requests and scopes.
+type GroupProvider interface {
+	// GroupScopes are the scopes needed to list the groups of users.
+	GroupScopes() []string
+}
+
+// TokenRefresher is implemented by providers whose tokens can be refreshed,
+// which includes those embedding an oauth2.Config.
+type TokenRefresher interface {
+	TokenSource(context.Context, *oauth2.Token) oauth2.TokenSource
+}
+
+type contextKey string
+
+const (
+	nonceKey    = contextKey("nonce")
+	callbackKey = contextKey("callback")
+	groupsKey   = contextKey("groups")
+)
+
+// WithNonce adds the nonce sent with the authorization request to ctx, to
+// check ID tokens against.
+func WithNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, nonceKey, nonce)
+}
+
+func nonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceKey).(string)
+	return nonce
+}
+
+// WithCallbackValues adds the parameters the provider redirected or posted
+// back to the callback with to ctx.
+func WithCallbackValues(ctx context.Context, values url.Values) context.Context {
+	return context.WithValue(ctx, callbackKey, values)
+}
+
+func callbackValues(ctx context.Context) url.Values {
+	values, _ := ctx.Value(callbackKey).(url.Values)
+	return values
+}
+
+// WithGroups asks the provider for the groups of the user.
+func WithGroups(ctx context.Context) context.Context {
+	return context.WithValue(ctx, groupsKey, true)
+}
+
+func groupsRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(groupsKey).(bool)
+	return requested
+}
+
 func chooseHost(base, defaultHost string) string {
 	if base == "" {
 		return "https://" + defaultHost
@@ -61,24 +127,88 @@ func (r *RequestError) Error() string {
 }
 
 func makeRequest(ctx context.Context, tok *oauth2.Token, g *oauth2.Config, url string, dst interface{}) error {
+	return makeRequestWithHeader(ctx, tok, g, url, nil, dst)
+}
+
+// makeRequestWithHeader is makeRequest for APIs that require more headers
+// than the authorization.
+func makeRequestWithHeader(ctx context.Context, tok *oauth2.Token, g *oauth2.Config, url string, header http.Header, dst interface{}) error {
+	_, err := doRequest(ctx, tok, g, url, header, dst)
+	return err
+}
+
+// maxListPages bounds how many pages of a list are read.
+const maxListPages = 50
+
+// makeListRequest is makeRequest for a page of a list. It returns the URL
+// of the next page, or "" for the last one.
+func makeListRequest(ctx context.Context, tok *oauth2.Token, g *oauth2.Config, pageURL string, dst interface{}) (string, error) {
+	header, err := doRequest(ctx, tok, g, pageURL, nil, dst)
+	if err != nil {
+		return "", err
+	}
+	return nextPageURL(pageURL, header), nil
+}
+
+// nextPageURL returns the URL of the page after pageURL from the next link
+// of the Link header, or from the X-Next-Page header GitLab also sends.
+func nextPageURL(pageURL string, header http.Header) string {
+	for _, link := range strings.Split(strings.Join(header.Values("Link"), ","), ",") {
+		parts := strings.Split(link, ";")
+		target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "rel=") {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimPrefix(param, "rel="), `"`)) {
+				if rel == "next" && target != "" {
+					return target
+				}
+			}
+		}
+	}
+
+	if page := header.Get("X-Next-Page"); page != "" {
+		u, err := url.Parse(pageURL)
+		if err != nil {
+			return ""
+		}
+		q := u.Query()
+		q.Set("page", page)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return ""
+}
+
+func doRequest(ctx context.Context, tok *oauth2.Token, g *oauth2.Config, url string, header http.Header, dst interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
 	client := g.Client(ctx, tok)
-	res, err := client.Get(url)
+	res, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode/100 != 2 {
 		body, err := io.ReadAll(res.Body)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		return &RequestError{code: res.StatusCode, body: string(body)}
+		return nil, &RequestError{code: res.StatusCode, body: string(body)}
 	}
 
 	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return res.Header, nil
 }
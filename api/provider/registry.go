@@ -0,0 +1,251 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/storage"
+)
+
+// Config is the configuration of a registered provider.
+type Config interface {
+	IsEnabled() bool
+}
+
+// AuthorizeConfig is a Config that lets clients ask the provider for more
+// than signing in at /authorize.
+type AuthorizeConfig interface {
+	AllowsScope(scope string) bool
+	AllowsAuthParam(name string) bool
+}
+
+// labeledConfig is a Config that overrides the label of its provider.
+type labeledConfig interface {
+	DisplayName() string
+}
+
+// Options are what providers may need from the API to be created.
+type Options struct {
+	DB         *storage.Connection
+	InstanceID uuid.UUID
+}
+
+// Factory creates a provider from its configuration.
+type Factory func(ctx context.Context, config Config, opts Options) (Provider, error)
+
+// Registration describes an external provider that users can sign in with by
+// its name.
+type Registration struct {
+	// Name identifies the provider at /authorize and in /settings.
+	Name string
+	// Label is the name of the provider shown to users.
+	Label string
+	// Config returns the configuration of the provider from the external
+	// configuration of an instance, or nil if it has none.
+	Config func(ext *conf.ProviderConfiguration) (Config, error)
+	// New creates the provider.
+	New Factory
+}
+
+// Entry is a provider as it's offered to an instance.
+type Entry struct {
+	Name  string
+	Label string
+	// ConfigLabel is the label set in the configuration of the provider, if
+	// any, which Label is then too.
+	ConfigLabel string
+	Enabled     bool
+	// OIDC is set for the OpenID Connect providers of the instance.
+	OIDC bool
+}
+
+var registry = struct {
+	sync.RWMutex
+	providers map[string]*Registration
+}{providers: make(map[string]*Registration)}
+
+// Register makes a provider available by its name. It's meant to be called
+// from init or main before the API is started, and panics if the name is
+// already taken.
+func Register(r Registration) {
+	name := strings.ToLower(r.Name)
+	if name == "" || r.Config == nil || r.New == nil {
+		panic("provider: Register needs a name, config and factory")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, dup := registry.providers[name]; dup {
+		panic("provider: Register called twice for provider " + name)
+	}
+	r.Name = name
+	registry.providers[name] = &r
+}
+
+// CustomConfig returns a Registration.Config that decodes the configuration
+// of the provider from the custom providers of the external configuration
+// into the value newConfig returns.
+func CustomConfig(name string, newConfig func() Config) func(ext *conf.ProviderConfiguration) (Config, error) {
+	return func(ext *conf.ProviderConfiguration) (Config, error) {
+		raw, ok := ext.Custom[name]
+		if !ok {
+			return nil, nil
+		}
+		config := newConfig()
+		if err := json.Unmarshal(raw, config); err != nil {
+			return nil, fmt.Errorf("Invalid configuration of provider %s: %w", name, err)
+		}
+		return config, nil
+	}
+}
+
+// lookup finds a registered provider, or else an OpenID Connect provider of
+// the instance.
+func lookup(ext *conf.ProviderConfiguration, name string) (*Registration, Config, error) {
+	name = strings.ToLower(name)
+
+	registry.RLock()
+	r, ok := registry.providers[name]
+	registry.RUnlock()
+	if ok {
+		config, err := r.Config(ext)
+		return r, config, err
+	}
+
+	if oidc, ok := ext.OIDC[name]; ok {
+		return oidcRegistration(name), &oidc, nil
+	}
+	return nil, nil, fmt.Errorf("Provider %s could not be found", name)
+}
+
+// New creates the provider called name for an instance.
+func New(ctx context.Context, ext *conf.ProviderConfiguration, name string, opts Options) (Provider, error) {
+	r, config, err := lookup(ext, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("Provider %s is not configured", r.Name)
+	}
+	return r.New(ctx, config, opts)
+}
+
+// LookupConfig returns the configuration of the provider called name for an
+// instance, or nil if it has none.
+func LookupConfig(ext *conf.ProviderConfiguration, name string) (Config, error) {
+	_, config, err := lookup(ext, name)
+	return config, err
+}
+
+// Entries lists the registered providers and the OpenID Connect providers of
+// an instance by name. Providers whose configuration can't be read are
+// listed as disabled.
+func Entries(ext *conf.ProviderConfiguration) []Entry {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	entries := make([]Entry, 0, len(registry.providers)+len(ext.OIDC))
+	for _, r := range registry.providers {
+		config, _ := r.Config(ext)
+		entries = append(entries, newEntry(r, config))
+	}
+	for name, oidc := range ext.OIDC {
+		if _, taken := registry.providers[name]; taken {
+			continue
+		}
+		entry := newEntry(oidcRegistration(name), &oidc)
+		entry.OIDC = true
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+func newEntry(r *Registration, config Config) Entry {
+	entry := Entry{Name: r.Name, Label: r.Label}
+	if config == nil {
+		return entry
+	}
+	entry.Enabled = config.IsEnabled()
+	if c, ok := config.(labeledConfig); ok && c.DisplayName() != "" {
+		entry.Label = c.DisplayName()
+		entry.ConfigLabel = c.DisplayName()
+	}
+	return entry
+}
+
+func oidcRegistration(name string) *Registration {
+	return &Registration{
+		Name: name,
+		New: func(ctx context.Context, config Config, _ Options) (Provider, error) {
+			return NewOIDCProvider(ctx, *config.(*conf.OIDCProviderConfiguration))
+		},
+	}
+}
+
+// registerOAuth registers a provider configured like most OAuth providers.
+func registerOAuth(name, label string, config func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration, newProvider func(conf.OAuthProviderConfiguration) (OAuthProvider, error)) {
+	Register(Registration{
+		Name:  name,
+		Label: label,
+		Config: func(ext *conf.ProviderConfiguration) (Config, error) {
+			return config(ext), nil
+		},
+		New: func(_ context.Context, c Config, _ Options) (Provider, error) {
+			return newProvider(*c.(*conf.OAuthProviderConfiguration))
+		},
+	})
+}
+
+func init() {
+	registerOAuth("bitbucket", "Bitbucket", func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration { return &ext.Bitbucket }, NewBitbucketProvider)
+	registerOAuth("discord", "Discord", func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration { return &ext.Discord }, NewDiscordProvider)
+	registerOAuth("facebook", "Facebook", func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration { return &ext.Facebook }, NewFacebookProvider)
+	registerOAuth("github", "GitHub", func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration { return &ext.Github }, NewGithubProvider)
+	registerOAuth("gitlab", "GitLab", func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration { return &ext.Gitlab }, NewGitlabProvider)
+	registerOAuth("google", "Google", func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration { return &ext.Google }, NewGoogleProvider)
+	registerOAuth("slack", "Slack", func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration { return &ext.Slack }, NewSlackProvider)
+	registerOAuth("twitch", "Twitch", func(ext *conf.ProviderConfiguration) *conf.OAuthProviderConfiguration { return &ext.Twitch }, NewTwitchProvider)
+
+	Register(Registration{
+		Name:  "apple",
+		Label: "Apple",
+		Config: func(ext *conf.ProviderConfiguration) (Config, error) {
+			return &ext.Apple, nil
+		},
+		New: func(_ context.Context, c Config, _ Options) (Provider, error) {
+			return NewAppleProvider(*c.(*conf.AppleProviderConfiguration))
+		},
+	})
+	Register(Registration{
+		Name:  "azure",
+		Label: "Microsoft",
+		Config: func(ext *conf.ProviderConfiguration) (Config, error) {
+			return &ext.Azure, nil
+		},
+		New: func(_ context.Context, c Config, _ Options) (Provider, error) {
+			return NewAzureProvider(*c.(*conf.AzureProviderConfiguration))
+		},
+	})
+	Register(Registration{
+		Name:  "saml",
+		Label: "SAML",
+		Config: func(ext *conf.ProviderConfiguration) (Config, error) {
+			return &ext.Saml, nil
+		},
+		New: func(_ context.Context, c Config, opts Options) (Provider, error) {
+			p, err := NewSamlProvider(*c.(*conf.SamlProviderConfiguration), opts.DB, opts.InstanceID)
+			if err != nil {
+				return nil, err
+			}
+			return p, nil
+		},
+	})
+}
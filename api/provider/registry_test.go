@@ -0,0 +1,106 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+type intranetConfig struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+}
+
+func (c *intranetConfig) IsEnabled() bool { return c.Enabled }
+
+type intranetProvider struct {
+	*oauth2.Config
+}
+
+func init() {
+	provider.Register(provider.Registration{
+		Name:  "Intranet",
+		Label: "Intranet",
+		Config: provider.CustomConfig("intranet", func() provider.Config {
+			return &intranetConfig{}
+		}),
+		New: func(_ context.Context, config provider.Config, _ provider.Options) (provider.Provider, error) {
+			c := config.(*intranetConfig)
+			return &intranetProvider{Config: &oauth2.Config{
+				ClientID: "intranet",
+				Endpoint: oauth2.Endpoint{AuthURL: c.URL + "/authorize"},
+			}}, nil
+		},
+	})
+}
+
+func entry(entries []provider.Entry, name string) *provider.Entry {
+	for i := range entries {
+		if entries[i].Name == name {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	ext := &conf.ProviderConfiguration{
+		Github: conf.OAuthProviderConfiguration{Enabled: true, ClientID: "id", Secret: "secret", RedirectURI: "https://example.com/callback"},
+		Saml:   conf.SamlProviderConfiguration{Name: "Corporate SSO"},
+		OIDC: conf.OIDCProviders{
+			"okta": {Enabled: true, Name: "Okta"},
+		},
+		Custom: conf.CustomProviders{
+			"intranet": json.RawMessage(`{"enabled": true, "url": "https://intranet.example.com"}`),
+		},
+	}
+
+	p, err := provider.New(context.Background(), ext, "GitHub", provider.Options{})
+	require.NoError(t, err)
+	assert.Contains(t, p.AuthCodeURL("state"), "client_id=id")
+
+	p, err = provider.New(context.Background(), ext, "intranet", provider.Options{})
+	require.NoError(t, err)
+	assert.Contains(t, p.AuthCodeURL("state"), "https://intranet.example.com/authorize")
+
+	_, err = provider.New(context.Background(), ext, "unknown", provider.Options{})
+	assert.EqualError(t, err, "Provider unknown could not be found")
+
+	entries := provider.Entries(ext)
+	assert.Equal(t, &provider.Entry{Name: "github", Label: "GitHub", Enabled: true}, entry(entries, "github"))
+	assert.Equal(t, &provider.Entry{Name: "gitlab", Label: "GitLab"}, entry(entries, "gitlab"))
+	assert.Equal(t, &provider.Entry{Name: "saml", Label: "Corporate SSO", ConfigLabel: "Corporate SSO"}, entry(entries, "saml"))
+	assert.Equal(t, &provider.Entry{Name: "okta", Label: "Okta", ConfigLabel: "Okta", Enabled: true, OIDC: true}, entry(entries, "okta"))
+	assert.Equal(t, &provider.Entry{Name: "intranet", Label: "Intranet", Enabled: true}, entry(entries, "intranet"))
+	for i := 1; i < len(entries); i++ {
+		assert.Less(t, entries[i-1].Name, entries[i].Name)
+	}
+
+	// custom providers without configuration are offered but disabled
+	ext.Custom = nil
+	assert.Equal(t, &provider.Entry{Name: "intranet", Label: "Intranet"}, entry(provider.Entries(ext), "intranet"))
+	_, err = provider.New(context.Background(), ext, "intranet", provider.Options{})
+	assert.EqualError(t, err, "Provider intranet is not configured")
+
+	ext.Custom = conf.CustomProviders{"intranet": json.RawMessage(`{"enabled": "yes"}`)}
+	_, err = provider.New(context.Background(), ext, "intranet", provider.Options{})
+	assert.Error(t, err)
+}
+
+func TestRegisterTwice(t *testing.T) {
+	assert.Panics(t, func() {
+		provider.Register(provider.Registration{
+			Name:   "github",
+			Config: func(*conf.ProviderConfiguration) (provider.Config, error) { return nil, nil },
+			New: func(context.Context, provider.Config, provider.Options) (provider.Provider, error) {
+				return nil, nil
+			},
+		})
+	})
+}
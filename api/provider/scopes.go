@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// SplitScopes splits a list of scopes separated by spaces or commas, which
+// is how the providers differ in listing them.
+func SplitScopes(scopes string) []string {
+	return strings.FieldsFunc(scopes, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+// ScopedProvider is implemented by providers that ask for scopes, which
+// clients can add to if the configuration of the provider allows them.
+type ScopedProvider interface {
+	// DefaultScopes are the scopes the provider always asks for.
+	DefaultScopes() []string
+}
+
+// Scopes returns the scopes p asks for with extra added to them.
+func Scopes(p Provider, extra []string) []string {
+	var scopes []string
+	if sp, ok := p.(ScopedProvider); ok {
+		scopes = append(scopes, sp.DefaultScopes()...)
+	}
+	for _, scope := range extra {
+		if !containsScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// GrantedScopes returns the scopes a token was granted, which the provider
+// only tells if they differ from the requested ones.
+func GrantedScopes(tok *oauth2.Token, requested []string) []string {
+	if granted, ok := tok.Extra("scope").(string); ok && granted != "" {
+		return SplitScopes(granted)
+	}
+	return requested
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
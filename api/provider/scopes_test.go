@@ -0,0 +1,26 @@
+package provider_test
+
+import (
+	"testing"
+
+	"github.com/netlify/gotrue/api/provider"
+	"github.com/netlify/gotrue/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestScopes(t *testing.T) {
+	assert.Equal(t, []string{"repo", "read:org", "user"}, provider.SplitScopes("repo,read:org user"))
+
+	p, err := provider.NewGithubProvider(conf.OAuthProviderConfiguration{Enabled: true, ClientID: "id", Secret: "secret", RedirectURI: "https://example.com/callback"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:email"}, provider.Scopes(p, nil))
+	assert.Equal(t, []string{"user:email", "repo"}, provider.Scopes(p, []string{"user:email", "repo"}))
+	assert.Equal(t, []string{"user:email"}, p.(provider.ScopedProvider).DefaultScopes(), "extra scopes aren't added to the configuration")
+
+	tok := &oauth2.Token{AccessToken: "token"}
+	assert.Equal(t, []string{"user:email"}, provider.GrantedScopes(tok, []string{"user:email"}))
+	tok = tok.WithExtra(map[string]interface{}{"scope": "user:email,repo"})
+	assert.Equal(t, []string{"user:email", "repo"}, provider.GrantedScopes(tok, []string{"user:email"}))
+}
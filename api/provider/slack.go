@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/netlify/gotrue/conf"
+	"golang.org/x/oauth2"
+)
+
+// Slack
+
+const defaultSlackAPIBase = "slack.com"
+
+type slackProvider struct {
+	*oauth2.Config
+	APIPath string
+}
+
+// slackUser is the response of Sign in with Slack's userInfo method. Like
+// all Slack methods it reports failures with ok set to false.
+type slackUser struct {
+	OK            bool   `json:"ok"`
+	Error         string `json:"error"`
+	ID            string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	AvatarURL     string `json:"picture"`
+	TeamID        string `json:"https://slack.com/team_id"`
+}
+
+// NewSlackProvider creates a Slack account provider.
+func NewSlackProvider(ext conf.OAuthProviderConfiguration) (OAuthProvider, error) {
+	if err := ext.Validate(); err != nil {
+		return nil, err
+	}
+
+	host := chooseHost(ext.URL, defaultSlackAPIBase)
+	return &slackProvider{
+		Config: &oauth2.Config{
+			ClientID:     ext.ClientID,
+			ClientSecret: ext.Secret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  host + "/openid/connect/authorize",
+				TokenURL: host + "/api/openid.connect.token",
+			},
+			RedirectURL: ext.RedirectURI,
+			Scopes: []string{
+				"openid",
+				"email",
+				"profile",
+			},
+		},
+		APIPath: host + "/api",
+	}, nil
+}
+
+func (p slackProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
+	return p.Exchange(context.Background(), code)
+}
+
+func (p slackProvider) DefaultScopes() []string {
+	return p.Scopes
+}
+
+func (p slackProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
+	var u slackUser
+	if err := makeRequest(ctx, tok, p.Config, p.APIPath+"/openid.connect.userInfo", &u); err != nil {
+		return nil, err
+	}
+	if !u.OK {
+		return nil, fmt.Errorf("Slack error getting user info: %s", u.Error)
+	}
+
+	if u.Email == "" {
+		return nil, errors.New("Unable to find email with Slack provider")
+	}
+
+	return &UserProvidedData{
+		ID: u.ID,
+		Metadata: map[string]string{
+			nameKey:      u.Name,
+			avatarURLKey: u.AvatarURL,
+			"team_id":    u.TeamID,
+		},
+		Emails: []Email{{
+			Email:    u.Email,
+			Verified: u.EmailVerified,
+			Primary:  true,
+		}},
+	}, nil
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/netlify/gotrue/conf"
+	"golang.org/x/oauth2"
+)
+
+// Twitch
+
+const (
+	defaultTwitchAuthBase = "id.twitch.tv"
+	defaultTwitchAPIBase  = "api.twitch.tv"
+)
+
+type twitchProvider struct {
+	*oauth2.Config
+	APIHost string
+}
+
+type twitchUsers struct {
+	Data []twitchUser `json:"data"`
+}
+
+type twitchUser struct {
+	ID              string `json:"id"`
+	Login           string `json:"login"`
+	DisplayName     string `json:"display_name"`
+	ProfileImageURL string `json:"profile_image_url"`
+	Email           string `json:"email"`
+}
+
+// NewTwitchProvider creates a Twitch account provider.
+func NewTwitchProvider(ext conf.OAuthProviderConfiguration) (OAuthProvider, error) {
+	if err := ext.Validate(); err != nil {
+		return nil, err
+	}
+
+	authHost := chooseHost(ext.URL, defaultTwitchAuthBase)
+	apiHost := chooseHost(ext.URL, defaultTwitchAPIBase)
+	return &twitchProvider{
+		Config: &oauth2.Config{
+			ClientID:     ext.ClientID,
+			ClientSecret: ext.Secret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   authHost + "/oauth2/authorize",
+				TokenURL:  authHost + "/oauth2/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+			RedirectURL: ext.RedirectURI,
+			Scopes:      []string{"user:read:email"},
+		},
+		APIHost: apiHost,
+	}, nil
+}
+
+func (p twitchProvider) GetOAuthToken(code string) (*oauth2.Token, error) {
+	return p.Exchange(context.Background(), code)
+}
+
+func (p twitchProvider) DefaultScopes() []string {
+	return p.Scopes
+}
+
+func (p twitchProvider) GetUserData(ctx context.Context, tok *oauth2.Token) (*UserProvidedData, error) {
+	// the Helix API requires the client ID along with the token
+	header := http.Header{"Client-Id": {p.ClientID}}
+
+	var users twitchUsers
+	if err := makeRequestWithHeader(ctx, tok, p.Config, p.APIHost+"/helix/users", header, &users); err != nil {
+		return nil, err
+	}
+	if len(users.Data) == 0 {
+		return nil, errors.New("Unable to find user with Twitch provider")
+	}
+
+	u := users.Data[0]
+	if u.Email == "" {
+		return nil, errors.New("Unable to find email with Twitch provider")
+	}
+
+	return &UserProvidedData{
+		ID: u.ID,
+		Metadata: map[string]string{
+			aliasKey:     u.Login,
+			nameKey:      u.DisplayName,
+			avatarURLKey: u.ProfileImageURL,
+		},
+		// Twitch only returns the email once it's verified
+		Emails: []Email{{
+			Email:    u.Email,
+			Verified: true,
+			Primary:  true,
+		}},
+	}, nil
+}
@@ -50,7 +50,7 @@ func (a *API) Recover(w http.ResponseWriter, r *http.Request) error {
 
 		mailer := a.Mailer(ctx)
 		referrer := a.getReferrer(r)
-		return a.sendPasswordRecovery(tx, user, mailer, referrer)
+		return a.sendPasswordRecovery(tx, user, mailer, config, referrer)
 	})
 	if err != nil {
 		return internalServerError("Error recovering user").WithInternalError(err)
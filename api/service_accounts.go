@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+type adminServiceAccountParams struct {
+	Name        string                 `json:"name"`
+	Aud         string                 `json:"aud"`
+	Roles       []string               `json:"roles"`
+	AppMetaData map[string]interface{} `json:"app_metadata"`
+}
+
+// ServiceAccountResponse includes the secret of a service account, which is
+// only returned when the account is created.
+type ServiceAccountResponse struct {
+	*models.ServiceAccount
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (a *API) loadServiceAccount(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	id, err := uuid.FromString(chi.URLParam(r, "service_account_id"))
+	if err != nil {
+		return nil, badRequestError("service_account_id must be an UUID")
+	}
+
+	logEntrySetField(r, "service_account_id", id)
+	instanceID := getInstanceID(r.Context())
+
+	s, err := models.FindServiceAccountByID(a.db, instanceID, id)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("Service account not found")
+		}
+		return nil, internalServerError("Database error loading service account").WithInternalError(err)
+	}
+
+	return withServiceAccount(r.Context(), s), nil
+}
+
+func getServiceAccountParams(r *http.Request) (*adminServiceAccountParams, error) {
+	params := &adminServiceAccountParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return nil, badRequestError("Could not decode service account params: %v", err)
+	}
+	return params, nil
+}
+
+func serviceAccountTraits(s *models.ServiceAccount) map[string]interface{} {
+	return map[string]interface{}{
+		"service_account_id":   s.ID,
+		"service_account_name": s.Name,
+	}
+}
+
+// adminServiceAccounts lists the service accounts of the instance.
+func (a *API) adminServiceAccounts(w http.ResponseWriter, r *http.Request) error {
+	accounts, err := models.FindServiceAccounts(a.db, getInstanceID(r.Context()))
+	if err != nil {
+		return internalServerError("Database error finding service accounts").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"service_accounts": accounts,
+	})
+}
+
+// adminServiceAccountCreate creates a new service account.
+func (a *API) adminServiceAccountCreate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+
+	params, err := getServiceAccountParams(r)
+	if err != nil {
+		return err
+	}
+	if params.Name == "" {
+		return unprocessableEntityError("A name is required")
+	}
+	if params.Aud == "" {
+		params.Aud = a.requestAud(ctx, r)
+	}
+
+	account, secret, err := models.NewServiceAccount(instanceID, params.Name, params.Aud, params.Roles, params.AppMetaData)
+	if err != nil {
+		return internalServerError("Error creating service account").WithInternalError(err)
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, adminUser, models.ServiceAccountCreatedAction, serviceAccountTraits(account)); terr != nil {
+			return terr
+		}
+		return tx.Create(account)
+	})
+	if err != nil {
+		return internalServerError("Database error creating service account").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusCreated, &ServiceAccountResponse{ServiceAccount: account, ClientSecret: secret})
+}
+
+// adminServiceAccountGet returns information about a single service account.
+func (a *API) adminServiceAccountGet(w http.ResponseWriter, r *http.Request) error {
+	return sendJSON(w, http.StatusOK, getServiceAccount(r.Context()))
+}
+
+// adminServiceAccountUpdate updates the name, roles or app_metadata of a service account.
+func (a *API) adminServiceAccountUpdate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	account := getServiceAccount(ctx)
+
+	params, err := getServiceAccountParams(r)
+	if err != nil {
+		return err
+	}
+
+	if params.Name != "" {
+		account.Name = params.Name
+	}
+	if params.Roles != nil {
+		account.Roles = params.Roles
+	}
+	for key, value := range params.AppMetaData {
+		if value != nil {
+			account.AppMetaData[key] = value
+		} else {
+			delete(account.AppMetaData, key)
+		}
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, adminUser, models.ServiceAccountModifiedAction, serviceAccountTraits(account)); terr != nil {
+			return terr
+		}
+		return tx.UpdateOnly(account, "name", "roles", "raw_app_meta_data")
+	})
+	if err != nil {
+		return internalServerError("Database error updating service account").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, account)
+}
+
+// adminServiceAccountDelete deletes a service account. Tokens it already
+// obtained stay valid until they expire.
+func (a *API) adminServiceAccountDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	account := getServiceAccount(ctx)
+
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, adminUser, models.ServiceAccountDeletedAction, serviceAccountTraits(account)); terr != nil {
+			return terr
+		}
+		return tx.Destroy(account)
+	})
+	if err != nil {
+		return internalServerError("Database error deleting service account").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
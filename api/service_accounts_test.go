@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServiceAccountTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+	adminToken string
+}
+
+func TestServiceAccount(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &ServiceAccountTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *ServiceAccountTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+
+	u, err := models.NewUser(ts.instanceID, "admin@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	u.IsSuperAdmin = true
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	ts.adminToken, err = generateAccessToken(u, time.Minute, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	require.NoError(ts.T(), err)
+}
+
+func (ts *ServiceAccountTestSuite) createServiceAccount() *ServiceAccountResponse {
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"name":         "Nightly export",
+		"roles":        []string{"exporter"},
+		"app_metadata": map[string]interface{}{"team": "data"},
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/admin/service_accounts", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ts.adminToken)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusCreated, w.Code)
+
+	account := &ServiceAccountResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(account))
+	require.NotEmpty(ts.T(), account.ClientSecret)
+	return account
+}
+
+func (ts *ServiceAccountTestSuite) clientCredentialsGrant(clientID, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", strings.NewReader(url.Values{
+		"grant_type": {"client_credentials"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, secret)
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *ServiceAccountTestSuite) TestClientCredentialsGrant() {
+	account := ts.createServiceAccount()
+
+	w := ts.clientCredentialsGrant(account.ClientID, account.ClientSecret)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	assert.Empty(ts.T(), token.RefreshToken)
+
+	ctx := withConfig(withInstanceID(context.Background(), ts.instanceID), ts.Config)
+	parsed, err := ts.API.parseAccessToken(ctx, token.Token)
+	require.NoError(ts.T(), err)
+	claims := parsed.Claims.(*GoTrueClaims)
+	assert.Equal(ts.T(), account.ID.String(), claims.Subject)
+	assert.Equal(ts.T(), account.ClientID, claims.ClientID)
+	assert.Equal(ts.T(), "data", claims.AppMetaData["team"])
+	assert.Equal(ts.T(), []interface{}{"exporter"}, claims.AppMetaData["roles"])
+
+	// the audit log tells service accounts from users
+	logs, err := models.FindAuditLogEntries(ts.API.db, ts.instanceID, nil, "", nil)
+	require.NoError(ts.T(), err)
+	require.NotEmpty(ts.T(), logs)
+	assert.Equal(ts.T(), string(models.ServiceAccountTokenAction), logs[0].Payload["action"])
+	assert.Equal(ts.T(), "service_account", logs[0].Payload["actor_type"])
+}
+
+func (ts *ServiceAccountTestSuite) TestClientCredentialsGrant_InvalidSecret() {
+	account := ts.createServiceAccount()
+
+	w := ts.clientCredentialsGrant(account.ClientID, "wrong")
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	w = ts.clientCredentialsGrant("unknown", account.ClientSecret)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *ServiceAccountTestSuite) TestAdminServiceAccountDelete() {
+	account := ts.createServiceAccount()
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost/admin/service_accounts/%s", account.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+ts.adminToken)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	w = ts.clientCredentialsGrant(account.ClientID, account.ClientSecret)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func TestGenerateServiceAccountToken(t *testing.T) {
+	account, secret, err := models.NewServiceAccount(uuid.Nil, "Job", "myapp", []string{"reader"}, nil)
+	require.NoError(t, err)
+	assert.True(t, account.Authenticate(secret))
+	assert.False(t, account.Authenticate("wrong"))
+
+	token, err := generateServiceAccountToken(account, time.Minute, newHMACSigningKey("test-secret"), &tokenParams{ClientID: account.ClientID})
+	require.NoError(t, err)
+
+	claims := &GoTrueClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, account.ID.String(), claims.Subject)
+	assert.Equal(t, "myapp", claims.Audience)
+	assert.Empty(t, claims.Email)
+	assert.Equal(t, []interface{}{"reader"}, claims.AppMetaData["roles"])
+}
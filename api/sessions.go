@@ -0,0 +1,168 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+// SessionResponse is a session of a user, marking the one the request was made with.
+type SessionResponse struct {
+	*models.Session
+	Current bool `json:"current"`
+}
+
+func newSessionsResponse(sessions []*models.Session, current uuid.UUID) map[string]interface{} {
+	resp := make([]*SessionResponse, len(sessions))
+	for i, s := range sessions {
+		resp[i] = &SessionResponse{Session: s, Current: s.ID == current}
+	}
+	return map[string]interface{}{
+		"sessions": resp,
+	}
+}
+
+// currentSessionID returns the session of the access token, if it has one.
+func currentSessionID(r *http.Request) uuid.UUID {
+	claims := getClaims(r.Context())
+	if claims == nil || claims.SessionID == "" {
+		return uuid.Nil
+	}
+	return uuid.FromStringOrNil(claims.SessionID)
+}
+
+func (a *API) findSession(r *http.Request, user *models.User) (*models.Session, error) {
+	sessionID, err := uuid.FromString(chi.URLParam(r, "session_id"))
+	if err != nil {
+		return nil, badRequestError("session_id must be an UUID")
+	}
+
+	session, err := models.FindSessionByUserIDAndID(a.db, user.InstanceID, user.ID, sessionID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("Session not found")
+		}
+		return nil, internalServerError("Database error loading session").WithInternalError(err)
+	}
+	return session, nil
+}
+
+// deleteSessions signs out a single session, or all sessions of user but except.
+func (a *API) deleteSessions(r *http.Request, actor, user *models.User, session *models.Session, except uuid.UUID) error {
+	instanceID := getInstanceID(r.Context())
+
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		traits := map[string]interface{}{
+			"user_id":    user.ID,
+			"user_email": user.Email,
+		}
+		if session != nil {
+			traits["session_id"] = session.ID
+		}
+		if terr := models.NewAuditLogEntry(tx, instanceID, actor, models.SessionRevokedAction, traits); terr != nil {
+			return terr
+		}
+
+		if session != nil {
+			return models.DeleteSession(tx, session)
+		}
+		return models.DeleteUserSessions(tx, instanceID, user.ID, except)
+	})
+	if err != nil {
+		return internalServerError("Database error deleting sessions").WithInternalError(err)
+	}
+	return nil
+}
+
+// UserSessions lists the sessions of the logged in user.
+func (a *API) UserSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	sessions, err := models.FindSessionsByUserID(a.db, user.InstanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding sessions").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, newSessionsResponse(sessions, currentSessionID(r)))
+}
+
+// UserSessionsDelete signs out every session of the logged in user except
+// the one the request was made with.
+func (a *API) UserSessionsDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	if err := a.deleteSessions(r, user, user, nil, currentSessionID(r)); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// UserSessionDelete signs out a single session of the logged in user.
+func (a *API) UserSessionDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	session, err := a.findSession(r, user)
+	if err != nil {
+		return err
+	}
+	if session.ID == currentSessionID(r) {
+		a.clearCookieToken(ctx, w)
+	}
+
+	if err := a.deleteSessions(r, user, user, session, uuid.Nil); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// adminUserSessions lists the sessions of a user.
+func (a *API) adminUserSessions(w http.ResponseWriter, r *http.Request) error {
+	user := getUser(r.Context())
+
+	sessions, err := models.FindSessionsByUserID(a.db, user.InstanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding sessions").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, newSessionsResponse(sessions, uuid.Nil))
+}
+
+// adminUserSessionsDelete signs out every session of a user.
+func (a *API) adminUserSessionsDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	if err := a.deleteSessions(r, getAdminUser(ctx), getUser(ctx), nil, uuid.Nil); err != nil {
+		return err
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+// adminUserSessionDelete signs out a single session of a user.
+func (a *API) adminUserSessionDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user := getUser(ctx)
+
+	session, err := a.findSession(r, user)
+	if err != nil {
+		return err
+	}
+
+	if err := a.deleteSessions(r, getAdminUser(ctx), user, session, uuid.Nil); err != nil {
+		return err
+	}
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
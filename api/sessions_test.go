@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SessionsTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestSessions(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &SessionsTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *SessionsTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.ConfirmedAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+}
+
+func (ts *SessionsTestSuite) login(userAgent string) *AccessTokenResponse {
+	body := strings.NewReader(url.Values{
+		"grant_type": {"password"},
+		"username":   {"test@example.com"},
+		"password":   {"password"},
+	}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	return token
+}
+
+func (ts *SessionsTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "http://localhost"+path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *SessionsTestSuite) listSessions(token string) []*SessionResponse {
+	w := ts.request(http.MethodGet, "/user/sessions", token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	var resp struct {
+		Sessions []*SessionResponse `json:"sessions"`
+	}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&resp))
+	return resp.Sessions
+}
+
+func (ts *SessionsTestSuite) TestUserSessions() {
+	laptop := ts.login("laptop")
+	phone := ts.login("phone")
+
+	sessions := ts.listSessions(laptop.Token)
+	require.Len(ts.T(), sessions, 2)
+
+	var laptopSession, phoneSession *SessionResponse
+	for _, s := range sessions {
+		switch s.UserAgent {
+		case "laptop":
+			laptopSession = s
+		case "phone":
+			phoneSession = s
+		}
+		assert.Equal(ts.T(), "password", s.AuthenticationMethod)
+		assert.Equal(ts.T(), models.AAL1, s.AAL)
+	}
+	require.NotNil(ts.T(), laptopSession)
+	require.NotNil(ts.T(), phoneSession)
+	assert.True(ts.T(), laptopSession.Current)
+	assert.False(ts.T(), phoneSession.Current)
+
+	w := ts.request(http.MethodDelete, fmt.Sprintf("/user/sessions/%s", phoneSession.ID), laptop.Token)
+	require.Equal(ts.T(), http.StatusNoContent, w.Code)
+
+	// the phone can't refresh anymore, the laptop still can
+	body := strings.NewReader(url.Values{"refresh_token": {phone.RefreshToken}}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	body = strings.NewReader(url.Values{"refresh_token": {laptop.RefreshToken}}.Encode())
+	req = httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	assert.Equal(ts.T(), http.StatusOK, w.Code)
+
+	sessions = ts.listSessions(laptop.Token)
+	require.Len(ts.T(), sessions, 1)
+	assert.NotNil(ts.T(), sessions[0].RefreshedAt)
+}
+
+func (ts *SessionsTestSuite) TestUserSessionsDeleteOthers() {
+	laptop := ts.login("laptop")
+	ts.login("phone")
+	ts.login("tablet")
+
+	w := ts.request(http.MethodDelete, "/user/sessions", laptop.Token)
+	require.Equal(ts.T(), http.StatusNoContent, w.Code)
+
+	sessions := ts.listSessions(laptop.Token)
+	require.Len(ts.T(), sessions, 1)
+	assert.True(ts.T(), sessions[0].Current)
+}
+
+func (ts *SessionsTestSuite) TestAdminUserSessions() {
+	ts.login("laptop")
+
+	admin, err := models.NewUser(ts.instanceID, "admin@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	admin.IsSuperAdmin = true
+	require.NoError(ts.T(), ts.API.db.Create(admin))
+	adminToken, err := generateAccessToken(admin, time.Minute, newHMACSigningKey(ts.Config.JWT.Secret), nil)
+	require.NoError(ts.T(), err)
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	path := fmt.Sprintf("/admin/users/%s/sessions", u.ID)
+
+	w := ts.request(http.MethodGet, path, adminToken)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	var resp struct {
+		Sessions []*SessionResponse `json:"sessions"`
+	}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&resp))
+	require.Len(ts.T(), resp.Sessions, 1)
+
+	w = ts.request(http.MethodDelete, path+"/"+resp.Sessions[0].ID.String(), adminToken)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	sessions, err := models.FindSessionsByUserID(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Empty(ts.T(), sessions)
+}
@@ -1,19 +1,105 @@
 package api
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
 
+	"github.com/netlify/gotrue/api/provider"
+)
+
+// ProviderSettings tells which ways to sign in are enabled. The registered
+// external providers are listed by name next to the built-in ones.
 type ProviderSettings struct {
-	Bitbucket bool `json:"bitbucket"`
-	GitHub    bool `json:"github"`
-	GitLab    bool `json:"gitlab"`
-	Google    bool `json:"google"`
-	Facebook  bool `json:"facebook"`
-	Email     bool `json:"email"`
-	SAML      bool `json:"saml"`
+	Providers map[string]bool `json:"-"`
+	Email     bool            `json:"email"`
+	Phone     bool            `json:"phone"`
+	Anonymous bool            `json:"anonymous"`
+	// OIDC has the named OpenID Connect providers.
+	OIDC map[string]bool `json:"oidc,omitempty"`
+}
+
+func (p ProviderSettings) MarshalJSON() ([]byte, error) {
+	settings := make(map[string]interface{}, len(p.Providers)+4)
+	for name, enabled := range p.Providers {
+		settings[name] = enabled
+	}
+	settings["email"] = p.Email
+	settings["phone"] = p.Phone
+	settings["anonymous"] = p.Anonymous
+	if len(p.OIDC) > 0 {
+		settings["oidc"] = p.OIDC
+	}
+	return json.Marshal(settings)
+}
+
+func (p *ProviderSettings) UnmarshalJSON(data []byte) error {
+	settings := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return err
+	}
+
+	*p = ProviderSettings{Providers: make(map[string]bool)}
+	for name, raw := range settings {
+		var err error
+		switch name {
+		case "email":
+			err = json.Unmarshal(raw, &p.Email)
+		case "phone":
+			err = json.Unmarshal(raw, &p.Phone)
+		case "anonymous":
+			err = json.Unmarshal(raw, &p.Anonymous)
+		case "oidc":
+			err = json.Unmarshal(raw, &p.OIDC)
+		default:
+			var enabled bool
+			err = json.Unmarshal(raw, &enabled)
+			p.Providers[name] = enabled
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// ProviderLabels are the names shown to users of the external providers.
 type ProviderLabels struct {
-	SAML string `json:"saml,omitempty"`
+	Providers map[string]string `json:"-"`
+	OIDC      map[string]string `json:"oidc,omitempty"`
+}
+
+func (l ProviderLabels) MarshalJSON() ([]byte, error) {
+	labels := make(map[string]interface{}, len(l.Providers)+1)
+	for name, label := range l.Providers {
+		labels[name] = label
+	}
+	if len(l.OIDC) > 0 {
+		labels["oidc"] = l.OIDC
+	}
+	return json.Marshal(labels)
+}
+
+func (l *ProviderLabels) UnmarshalJSON(data []byte) error {
+	labels := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return err
+	}
+
+	*l = ProviderLabels{Providers: make(map[string]string)}
+	for name, raw := range labels {
+		var err error
+		if name == "oidc" {
+			err = json.Unmarshal(raw, &l.OIDC)
+		} else {
+			var label string
+			err = json.Unmarshal(raw, &label)
+			l.Providers[name] = label
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type Settings struct {
@@ -21,25 +107,45 @@ type Settings struct {
 	ExternalLabels    ProviderLabels   `json:"external_labels"`
 	DisableSignup     bool             `json:"disable_signup"`
 	Autoconfirm       bool             `json:"autoconfirm"`
+	MFAEnabled        bool             `json:"mfa_enabled"`
+	WebAuthnEnabled   bool             `json:"webauthn_enabled"`
 }
 
 func (a *API) Settings(w http.ResponseWriter, r *http.Request) error {
 	config := a.getConfig(r.Context())
 
+	providers := ProviderSettings{
+		Providers: make(map[string]bool),
+		Email:     !config.External.Email.Disabled,
+		Phone:     config.External.Phone.Enabled,
+		Anonymous: config.External.Anonymous.Enabled,
+		OIDC:      make(map[string]bool),
+	}
+	labels := ProviderLabels{
+		Providers: make(map[string]string),
+		OIDC:      make(map[string]string),
+	}
+	for _, p := range provider.Entries(&config.External) {
+		if p.OIDC {
+			providers.OIDC[p.Name] = p.Enabled
+			if p.ConfigLabel != "" {
+				labels.OIDC[p.Name] = p.ConfigLabel
+			}
+			continue
+		}
+		providers.Providers[p.Name] = p.Enabled
+		// built-in names are left to clients
+		if p.ConfigLabel != "" {
+			labels.Providers[p.Name] = p.ConfigLabel
+		}
+	}
+
 	return sendJSON(w, http.StatusOK, &Settings{
-		ExternalProviders: ProviderSettings{
-			Bitbucket: config.External.Bitbucket.Enabled,
-			GitHub:    config.External.Github.Enabled,
-			GitLab:    config.External.Gitlab.Enabled,
-			Google:    config.External.Google.Enabled,
-			Facebook:  config.External.Facebook.Enabled,
-			Email:     !config.External.Email.Disabled,
-			SAML:      config.External.Saml.Enabled,
-		},
-		ExternalLabels: ProviderLabels{
-			SAML: config.External.Saml.Name,
-		},
-		DisableSignup: config.DisableSignup,
-		Autoconfirm:   config.Mailer.Autoconfirm,
+		ExternalProviders: providers,
+		ExternalLabels:    labels,
+		DisableSignup:     config.DisableSignup,
+		Autoconfirm:       config.Mailer.Autoconfirm,
+		MFAEnabled:        config.MFA.Enabled,
+		WebAuthnEnabled:   config.WebAuthn.Enabled,
 	})
 }
@@ -26,12 +26,13 @@ func TestSettings_DefaultProviders(t *testing.T) {
 
 	p := resp.ExternalProviders
 	require.True(t, p.Email)
-	require.True(t, p.Google)
-	require.True(t, p.GitHub)
-	require.True(t, p.GitLab)
-	require.True(t, p.Bitbucket)
-	require.True(t, p.SAML)
-	require.True(t, p.Facebook)
+	require.True(t, p.Providers["google"])
+	require.True(t, p.Providers["github"])
+	require.True(t, p.Providers["gitlab"])
+	require.True(t, p.Providers["bitbucket"])
+	require.True(t, p.Providers["saml"])
+	require.True(t, p.Providers["facebook"])
+	require.False(t, p.Providers["apple"])
 }
 
 func TestSettings_EmailDisabled(t *testing.T) {
@@ -71,7 +72,8 @@ func TestSettings_ExternalName(t *testing.T) {
 
 	type SettingsWithExternalName struct {
 		ExternalLabels struct {
-			SAML string `json:"saml"`
+			SAML   string `json:"saml"`
+			GitHub string `json:"github"`
 		} `json:"external_labels"`
 	}
 	resp := SettingsWithExternalName{}
@@ -80,4 +82,25 @@ func TestSettings_ExternalName(t *testing.T) {
 
 	n := resp.ExternalLabels
 	require.Equal(t, n.SAML, "TestSamlName")
+	require.Empty(t, n.GitHub, "only configured labels are listed")
+}
+
+func TestProviderSettingsJSON(t *testing.T) {
+	settings := ProviderSettings{
+		Providers: map[string]bool{"github": true, "intranet": false},
+		Email:     true,
+		OIDC:      map[string]bool{"okta": true},
+	}
+	data, err := json.Marshal(settings)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"github": true, "intranet": false, "email": true, "phone": false, "anonymous": false, "oidc": {"okta": true}}`, string(data))
+
+	decoded := ProviderSettings{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, settings, decoded)
+
+	labels := ProviderLabels{Providers: map[string]string{"saml": "Corporate SSO"}}
+	data, err = json.Marshal(labels)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"saml": "Corporate SSO"}`, string(data))
 }
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+)
+
+type signingKeysResponse struct {
+	Keys []*models.SigningKey `json:"keys"`
+}
+
+func (a *API) loadSigningKey(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	keyID, err := uuid.FromString(chi.URLParam(r, "key_id"))
+	if err != nil {
+		return nil, badRequestError("key_id must be an UUID")
+	}
+
+	logEntrySetField(r, "key_id", keyID)
+	instanceID := getInstanceID(r.Context())
+
+	k, err := models.FindSigningKeyByID(a.db, instanceID, keyID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("Signing key not found")
+		}
+		return nil, internalServerError("Database error loading signing key").WithInternalError(err)
+	}
+
+	return withSigningKey(r.Context(), k), nil
+}
+
+func (a *API) sendSigningKeys(w http.ResponseWriter, status int, instanceID uuid.UUID) error {
+	keys, err := models.FindSigningKeys(a.db, instanceID)
+	if err != nil {
+		return internalServerError("Database error loading signing keys").WithInternalError(err)
+	}
+	return sendJSON(w, status, &signingKeysResponse{Keys: keys})
+}
+
+// adminSigningKeys lists the signing keys of the instance.
+func (a *API) adminSigningKeys(w http.ResponseWriter, r *http.Request) error {
+	return a.sendSigningKeys(w, http.StatusOK, getInstanceID(r.Context()))
+}
+
+// adminSigningKeysRotate rotates the signing keys of the instance.
+func (a *API) adminSigningKeysRotate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	config := a.getConfig(ctx)
+	adminUser := getAdminUser(ctx)
+
+	// make sure a generated key exists before it is imported
+	if _, err := a.getSigningKey(ctx); err != nil {
+		return internalServerError("Error loading signing key").WithInternalError(err)
+	}
+
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, adminUser, models.SigningKeysRotatedAction, nil); terr != nil {
+			return terr
+		}
+		return RotateSigningKeys(tx, instanceID, config)
+	})
+	a.signingKeys.invalidate(instanceID)
+	if err != nil {
+		return internalServerError("Error rotating signing keys").WithInternalError(err)
+	}
+
+	return a.sendSigningKeys(w, http.StatusOK, instanceID)
+}
+
+// adminSigningKeyDelete removes a signing key, invalidating every token it signed.
+func (a *API) adminSigningKeyDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+	adminUser := getAdminUser(ctx)
+	key := getSigningKey(ctx)
+
+	if key.State == models.SigningKeyCurrent {
+		return badRequestError("The current signing key can't be deleted, rotate the keys first")
+	}
+
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, adminUser, models.SigningKeyDeletedAction, map[string]interface{}{
+			"key_id": key.ID,
+			"kid":    key.KeyID,
+		}); terr != nil {
+			return terr
+		}
+		return tx.Destroy(key)
+	})
+	a.signingKeys.invalidate(instanceID)
+	if err != nil {
+		return internalServerError("Database error deleting signing key").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+// GetInstanceSigningKeys lists the signing keys of an instance for the operator.
+func (a *API) GetInstanceSigningKeys(w http.ResponseWriter, r *http.Request) error {
+	i := getInstance(r.Context())
+	return a.sendSigningKeys(w, http.StatusOK, i.ID)
+}
+
+// RotateInstanceSigningKeys rotates the signing keys of an instance for the operator.
+func (a *API) RotateInstanceSigningKeys(w http.ResponseWriter, r *http.Request) error {
+	i := getInstance(r.Context())
+	config, err := i.Config()
+	if err != nil {
+		return internalServerError("Error loading instance config").WithInternalError(err)
+	}
+
+	err = RotateSigningKeys(a.db, i.ID, config)
+	a.signingKeys.invalidate(i.ID)
+	if err != nil {
+		return internalServerError("Error rotating signing keys").WithInternalError(err)
+	}
+
+	return a.sendSigningKeys(w, http.StatusOK, i.ID)
+}
@@ -12,6 +12,7 @@ import (
 // SignupParams are the parameters the Signup endpoint accepts
 type SignupParams struct {
 	Email    string                 `json:"email"`
+	Phone    string                 `json:"phone"`
 	Password string                 `json:"password"`
 	Data     map[string]interface{} `json:"data"`
 	Provider string                 `json:"-"`
@@ -37,21 +38,43 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 	if params.Password == "" {
 		return unprocessableEntityError("Signup requires a valid password")
 	}
-	if err := a.validateEmail(ctx, params.Email); err != nil {
-		return err
-	}
 
 	instanceID := getInstanceID(ctx)
 	params.Aud = a.requestAud(ctx, r)
-	user, err := models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, params.Aud)
+	var user *models.User
+	if params.Phone != "" {
+		if !config.External.Phone.Enabled {
+			return badRequestError("Unsupported phone provider")
+		}
+		if params.Email != "" {
+			return unprocessableEntityError("Signup requires either an email address or a phone number")
+		}
+		if params.Phone, err = validatePhone(params.Phone); err != nil {
+			return err
+		}
+		user, err = models.FindUserByPhoneAndAudience(a.db, instanceID, params.Phone, params.Aud)
+	} else {
+		if err := a.validateEmail(ctx, params.Email); err != nil {
+			return err
+		}
+		user, err = models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, params.Aud)
+	}
 	if err != nil && !models.IsNotFoundError(err) {
 		return internalServerError("Database error finding user").WithInternalError(err)
 	}
 
+	autoconfirm := config.Mailer.Autoconfirm
+	if params.Phone != "" {
+		autoconfirm = config.SMS.Autoconfirm
+	}
+
 	err = a.db.Transaction(func(tx *storage.Connection) error {
 		var terr error
 		if user != nil {
-			if user.IsConfirmed() {
+			if params.Phone != "" && user.IsPhoneConfirmed() {
+				return badRequestError("A user with this phone number has already been registered")
+			}
+			if params.Phone == "" && user.IsConfirmed() {
 				return badRequestError("A user with this email address has already been registered")
 			}
 
@@ -60,26 +83,40 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 			}
 		} else {
 			params.Provider = "email"
+			if params.Phone != "" {
+				params.Provider = "phone"
+			}
 			user, terr = a.signupNewUser(ctx, tx, params)
 			if terr != nil {
 				return terr
 			}
 		}
 
-		if config.Mailer.Autoconfirm {
+		if autoconfirm {
 			if terr = models.NewAuditLogEntry(tx, instanceID, user, models.UserSignedUpAction, nil); terr != nil {
 				return terr
 			}
 			if terr = triggerEventHooks(ctx, tx, SignupEvent, user, instanceID, config); terr != nil {
 				return terr
 			}
-			if terr = user.Confirm(tx); terr != nil {
+			if params.Phone != "" {
+				terr = user.ConfirmPhone(tx)
+			} else {
+				terr = user.Confirm(tx)
+			}
+			if terr != nil {
 				return internalServerError("Database error updating user").WithInternalError(terr)
 			}
+		} else if params.Phone != "" {
+			if !phoneOTPThrottled(user, config) {
+				if terr = sendPhoneOTP(tx, user, a.SMSSender(ctx), config); terr != nil {
+					return internalServerError("Error sending one-time passcode").WithInternalError(terr)
+				}
+			}
 		} else {
 			mailer := a.Mailer(ctx)
 			referrer := a.getReferrer(r)
-			if terr = sendConfirmation(tx, user, mailer, config.SMTP.MaxFrequency, referrer); terr != nil {
+			if terr = sendConfirmation(tx, user, mailer, config, referrer); terr != nil {
 				return internalServerError("Error sending confirmation mail").WithInternalError(terr)
 			}
 		}
@@ -105,6 +142,7 @@ func (a *API) signupNewUser(ctx context.Context, conn *storage.Connection, param
 		user.AppMetaData = make(map[string]interface{})
 	}
 	user.AppMetaData["provider"] = params.Provider
+	user.Phone = params.Phone
 
 	if params.Password == "" {
 		user.EncryptedPassword = ""
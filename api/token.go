@@ -2,13 +2,16 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"time"
 
+	"github.com/gofrs/uuid"
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/metering"
 	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/sms"
 	"github.com/netlify/gotrue/storage"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -30,6 +33,33 @@ type GoTrueClaims struct {
 	Email              string                 `json:"email"`
 	AppMetaData        map[string]interface{} `json:"app_metadata"`
 	UserMetaData       map[string]interface{} `json:"user_metadata"`
+	Scope              string                 `json:"scope,omitempty"`
+	SessionID          string                 `json:"session_id,omitempty"`
+	AAL                string                 `json:"aal,omitempty"`
+	ClientID           string                 `json:"client_id,omitempty"`
+	IsAnonymous        bool                   `json:"is_anonymous,omitempty"`
+
+	// Custom holds the claims added by the token hook.
+	Custom map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON adds the custom claims to the standard ones, replacing those
+// with the same name.
+func (c GoTrueClaims) MarshalJSON() ([]byte, error) {
+	type claims GoTrueClaims
+	data, err := json.Marshal(claims(c))
+	if err != nil || len(c.Custom) == 0 {
+		return data, err
+	}
+
+	merged := map[string]interface{}{}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for name, value := range c.Custom {
+		merged[name] = value
+	}
+	return json.Marshal(merged)
 }
 
 // AccessTokenResponse represents an OAuth2 success response
@@ -37,7 +67,8 @@ type AccessTokenResponse struct {
 	Token        string `json:"access_token"`
 	TokenType    string `json:"token_type"` // Bearer
 	ExpiresIn    int    `json:"expires_in"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
 }
 
 const useCookieHeader = "x-use-cookie"
@@ -53,6 +84,14 @@ func (a *API) Token(w http.ResponseWriter, r *http.Request) error {
 		return a.ResourceOwnerPasswordGrant(ctx, w, r)
 	case "refresh_token":
 		return a.RefreshTokenGrant(ctx, w, r)
+	case "authorization_code":
+		return a.AuthorizationCodeGrant(ctx, w, r)
+	case "client_credentials":
+		return a.ClientCredentialsGrant(ctx, w, r)
+	case "webauthn":
+		return a.WebAuthnGrant(ctx, w, r)
+	case "anonymous":
+		return a.AnonymousGrant(ctx, w, r)
 	default:
 		return oauthError("unsupported_grant_type", "")
 	}
@@ -68,7 +107,25 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 	instanceID := getInstanceID(ctx)
 	config := a.getConfig(ctx)
 
-	user, err := models.FindUserByEmailAndAudience(a.db, instanceID, username, aud)
+	var (
+		user *models.User
+		err  error
+	)
+	phone := r.FormValue("phone")
+	if phone != "" {
+		if !config.External.Phone.Enabled {
+			return oauthError("invalid_request", "Unsupported phone provider")
+		}
+		if phone, err = sms.NormalizePhone(phone); err != nil {
+			return oauthError("invalid_request", "Invalid phone number: "+err.Error())
+		}
+		user, err = models.FindUserByPhoneAndAudience(a.db, instanceID, phone, aud)
+	} else {
+		if config.External.Email.Disabled {
+			return badRequestError("Unsupported email provider")
+		}
+		user, err = models.FindUserByEmailAndAudience(a.db, instanceID, username, aud)
+	}
 	if err != nil {
 		if models.IsNotFoundError(err) {
 			_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
@@ -77,7 +134,11 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 		return internalServerError("Database error finding user").WithInternalError(err)
 	}
 
-	if !user.IsConfirmed() {
+	if phone != "" {
+		if !user.IsPhoneConfirmed() {
+			return oauthError("invalid_grant", "Phone number not confirmed")
+		}
+	} else if !user.IsConfirmed() {
 		return oauthError("invalid_grant", "Email not confirmed")
 	}
 
@@ -85,6 +146,10 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 		return oauthError("invalid_grant", "No user found with that email, or password invalid.")
 	}
 
+	params := a.newTokenParams(r, "password")
+	params.Scope = r.FormValue("scope")
+	params.Nonce = r.FormValue("nonce")
+
 	var token *AccessTokenResponse
 	err = a.db.Transaction(func(tx *storage.Connection) error {
 		var terr error
@@ -95,7 +160,7 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 			return terr
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user)
+		token, terr = a.issueRefreshToken(ctx, tx, user, params)
 		if terr != nil {
 			return terr
 		}
@@ -133,9 +198,22 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 		return internalServerError("%s", err.Error())
 	}
 
+	var activeChild *models.RefreshToken
 	if token.Revoked {
-		a.clearCookieToken(ctx, w)
-		return oauthError("invalid_grant", "Invalid Refresh Token").WithInternalMessage("Possible abuse attempt: %v", r)
+		// concurrent refreshes with the same token share the token it was swapped for
+		if token.RevokedWithin(config.JWT.RefreshTokenReuseInterval) && a.isRefreshingClient(r, user, token) {
+			activeChild, err = models.FindActiveRefreshTokenChild(a.db, token)
+			if err != nil && !models.IsNotFoundError(err) {
+				return internalServerError("Database error finding refresh token").WithInternalError(err)
+			}
+		}
+		if activeChild == nil {
+			a.clearCookieToken(ctx, w)
+			if err := a.revokeTokenFamily(r, user, token); err != nil {
+				return err
+			}
+			return oauthError("invalid_grant", "Invalid Refresh Token").WithInternalMessage("Possible abuse attempt: %v", r)
+		}
 	}
 
 	if token.Expired(config.JWT.RefreshTokenLifetime) {
@@ -143,7 +221,16 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 		return oauthError("invalid_grant", "Refresh token expired")
 	}
 
-	var tokenString string
+	key, err := a.getSigningKey(ctx)
+	if err != nil {
+		return internalServerError("Error loading signing key").WithInternalError(err)
+	}
+
+	params := a.newTokenParams(r, "")
+	params.SessionID = token.SessionID.UUID
+	scope := r.FormValue("scope")
+
+	var tokenString, idTokenString string
 	var newToken *models.RefreshToken
 
 	err = a.db.Transaction(func(tx *storage.Connection) error {
@@ -152,14 +239,43 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 			return terr
 		}
 
-		newToken, terr = models.GrantRefreshTokenSwap(tx, user, token)
-		if terr != nil {
-			return internalServerError("%s", terr.Error())
+		if token.SessionID.Valid {
+			session, terr := models.FindSessionByUserIDAndID(tx, instanceID, user.ID, token.SessionID.UUID)
+			if terr != nil {
+				if models.IsNotFoundError(terr) {
+					return oauthError("invalid_grant", "Invalid Refresh Token")
+				}
+				return internalServerError("Database error finding session").WithInternalError(terr)
+			}
+			if terr = session.UpdateRefreshedAt(tx); terr != nil {
+				return internalServerError("Database error updating session").WithInternalError(terr)
+			}
+			params.AAL = session.AAL
+			params.Scope = session.Scope
+			params.ClientID = session.ClientID
+			params.Nonce = session.Nonce
+		}
+
+		// a refresh may narrow the scope of the login but never widen it
+		if scope != "" {
+			if !isSubScope(scope, params.Scope) {
+				return oauthError("invalid_scope", "The requested scope exceeds the scope originally granted")
+			}
+			params.Scope = scope
+		}
+
+		if activeChild != nil {
+			newToken = activeChild
+		} else {
+			newToken, terr = models.GrantRefreshTokenSwap(tx, user, token)
+			if terr != nil {
+				return internalServerError("%s", terr.Error())
+			}
 		}
 
-		tokenString, terr = generateAccessToken(user, time.Second*time.Duration(config.JWT.Exp), config.JWT.Secret)
+		tokenString, idTokenString, terr = a.generateTokens(ctx, user, time.Second*time.Duration(config.JWT.Exp), key, params)
 		if terr != nil {
-			return internalServerError("error generating jwt token").WithInternalError(terr)
+			return terr
 		}
 
 		if cookie != "" && config.Cookie.Duration > 0 {
@@ -178,10 +294,214 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 		TokenType:    "bearer",
 		ExpiresIn:    config.JWT.Exp,
 		RefreshToken: newToken.Token,
+		IDToken:      idTokenString,
+	})
+}
+
+// isRefreshingClient reports whether r comes from the client of the session
+// a refresh token belongs to: it carries an access token cookie of the
+// session, or the IP address and user agent the session was started from.
+// Only that client gets the token a recently rotated one was swapped for.
+func (a *API) isRefreshingClient(r *http.Request, user *models.User, token *models.RefreshToken) bool {
+	if !token.SessionID.Valid {
+		return false
+	}
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+
+	if config.Cookie.Key != "" {
+		if cookie, err := r.Cookie(config.Cookie.Key); err == nil && cookie.Value != "" {
+			// the access token of a client refreshing concurrently may have expired
+			p := jwt.Parser{SkipClaimsValidation: true}
+			claims := &GoTrueClaims{}
+			if _, err := p.ParseWithClaims(cookie.Value, claims, a.accessTokenKey(ctx)); err == nil {
+				return claims.SessionID == token.SessionID.UUID.String()
+			}
+		}
+	}
+
+	session, err := models.FindSessionByUserIDAndID(a.db, user.InstanceID, user.ID, token.SessionID.UUID)
+	if err != nil {
+		return false
+	}
+	params := a.newTokenParams(r, "")
+	return session.IP == params.IP && session.UserAgent == params.UserAgent
+}
+
+// revokeTokenFamily revokes every refresh token issued from the same login as
+// a reused token, since either the legitimate client or an attacker holds it.
+func (a *API) revokeTokenFamily(r *http.Request, user *models.User, token *models.RefreshToken) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	err := a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.TokenReusedAction, map[string]interface{}{
+			"family_id": token.FamilyID,
+		}); terr != nil {
+			return terr
+		}
+		return models.RevokeTokenFamily(tx, token)
+	})
+	if err != nil {
+		return internalServerError("Database error revoking refresh tokens").WithInternalError(err)
+	}
+
+	// the tokens stay revoked even if the webhook fails
+	if err := triggerEventHooks(ctx, a.db, TokenReusedEvent, user, instanceID, config); err != nil {
+		getLogEntry(r).WithError(err).Warn("Failed to trigger token reuse webhook")
+	}
+	return nil
+}
+
+// AuthorizationCodeGrant implements the authorization_code grant type flow with PKCE
+func (a *API) AuthorizationCodeGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	client, err := a.authenticateClient(r)
+	if err != nil {
+		return err
+	}
+
+	code, err := models.FindAuthorizationCode(a.db, instanceID, r.FormValue("code"))
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return oauthError("invalid_grant", "Invalid authorization code")
+		}
+		return internalServerError("Database error finding authorization code").WithInternalError(err)
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != r.FormValue("redirect_uri") {
+		return oauthError("invalid_grant", "Invalid authorization code")
+	}
+	if code.Expired() {
+		return oauthError("invalid_grant", "Authorization code expired")
+	}
+	if !code.VerifyCodeVerifier(r.FormValue("code_verifier")) {
+		return oauthError("invalid_grant", "Invalid code verifier")
+	}
+
+	user, err := models.FindUserByInstanceIDAndID(a.db, instanceID, code.UserID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return oauthError("invalid_grant", "Invalid authorization code")
+		}
+		return internalServerError("Database error finding user").WithInternalError(err)
+	}
+
+	params := a.newTokenParams(r, "authorization_code")
+	params.Scope = code.Scope
+	params.Nonce = code.Nonce
+	params.ClientID = client.ClientID
+
+	var token *AccessTokenResponse
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		// codes can only be used once, even by concurrent requests
+		count, terr := tx.RawQuery("DELETE FROM "+code.TableName()+" WHERE id = ?", code.ID).ExecWithCount()
+		if terr != nil {
+			return internalServerError("Database error using authorization code").WithInternalError(terr)
+		}
+		if count == 0 {
+			return oauthError("invalid_grant", "Invalid authorization code")
+		}
+
+		if terr = models.NewAuditLogEntry(tx, instanceID, user, models.LoginAction, map[string]interface{}{
+			"client_id": client.ClientID,
+		}); terr != nil {
+			return terr
+		}
+		if terr = triggerEventHooks(ctx, tx, LoginEvent, user, instanceID, config); terr != nil {
+			return terr
+		}
+
+		token, terr = a.issueRefreshToken(ctx, tx, user, params)
+		return terr
+	})
+	if err != nil {
+		return err
+	}
+	metering.RecordLogin("authorization_code", user.ID, instanceID)
+	return sendJSON(w, http.StatusOK, token)
+}
+
+// ClientCredentialsGrant implements the client_credentials grant type flow for service accounts
+func (a *API) ClientCredentialsGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.FormValue("client_id")
+		secret = r.FormValue("client_secret")
+	}
+	if clientID == "" || secret == "" {
+		return oauthError("invalid_client", "Client credentials required")
+	}
+
+	account, err := models.FindServiceAccountByClientID(a.db, instanceID, clientID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(secret))
+			return oauthError("invalid_client", "Invalid client credentials")
+		}
+		return internalServerError("Database error finding service account").WithInternalError(err)
+	}
+	if !account.Authenticate(secret) {
+		return oauthError("invalid_client", "Invalid client credentials")
+	}
+
+	key, err := a.getSigningKey(ctx)
+	if err != nil {
+		return internalServerError("Error loading signing key").WithInternalError(err)
+	}
+
+	params := a.newTokenParams(r, "client_credentials")
+	params.Scope = r.FormValue("scope")
+	params.ClientID = account.ClientID
+
+	var tokenString string
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = models.NewServiceAccountAuditLogEntry(tx, instanceID, account, models.ServiceAccountTokenAction, nil); terr != nil {
+			return terr
+		}
+
+		tokenString, terr = generateServiceAccountToken(account, time.Second*time.Duration(config.JWT.Exp), key, params)
+		if terr != nil {
+			return internalServerError("error generating jwt token").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metering.RecordLogin("client_credentials", account.ID, instanceID)
+	// no refresh token, service accounts can always request a new access token
+	return sendJSON(w, http.StatusOK, &AccessTokenResponse{
+		Token:     tokenString,
+		TokenType: "bearer",
+		ExpiresIn: config.JWT.Exp,
 	})
 }
 
-func generateAccessToken(user *models.User, expiresIn time.Duration, secret string) (string, error) {
+func generateServiceAccountToken(account *models.ServiceAccount, expiresIn time.Duration, key *signingKey, params *tokenParams) (string, error) {
+	claims := &GoTrueClaims{
+		StandardClaims: jwt.StandardClaims{ //nolint:staticcheck
+			Issuer:    params.Issuer,
+			Subject:   account.ID.String(),
+			Audience:  account.Aud,
+			ExpiresAt: time.Now().Add(expiresIn).Unix(),
+		},
+		AppMetaData: account.TokenAppMetaData(),
+		Scope:       params.Scope,
+		ClientID:    params.ClientID,
+	}
+
+	return key.sign(claims)
+}
+
+func newAccessTokenClaims(user *models.User, expiresIn time.Duration, params *tokenParams) *GoTrueClaims {
 	claims := &GoTrueClaims{
 		StandardClaims: jwt.StandardClaims{ //nolint:staticcheck
 			Subject:   user.ID.String(),
@@ -191,34 +511,85 @@ func generateAccessToken(user *models.User, expiresIn time.Duration, secret stri
 		Email:        user.Email,
 		AppMetaData:  user.AppMetaData,
 		UserMetaData: user.UserMetaData,
+		IsAnonymous:  user.IsAnonymous,
+	}
+	if params != nil {
+		claims.Issuer = params.Issuer
+		claims.Scope = params.Scope
+		claims.ClientID = params.ClientID
+		if params.SessionID != uuid.Nil {
+			claims.SessionID = params.SessionID.String()
+			claims.AAL = params.AAL
+		}
+	}
+	return claims
+}
+
+func generateAccessToken(user *models.User, expiresIn time.Duration, key *signingKey, params *tokenParams) (string, error) {
+	return key.sign(newAccessTokenClaims(user, expiresIn, params))
+}
+
+// generateTokens signs the access token, with the claims added by the token
+// hook, and, when the openid scope was requested from an instance with an
+// issuer, the ID token of a grant.
+func (a *API) generateTokens(ctx context.Context, user *models.User, expiresIn time.Duration, key *signingKey, params *tokenParams) (string, string, error) {
+	claims := newAccessTokenClaims(user, expiresIn, params)
+	if err := triggerTokenHook(ctx, user, claims, getInstanceID(ctx), a.getConfig(ctx)); err != nil {
+		return "", "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token.Header["kid"] = "nf-ident"
-	return token.SignedString([]byte(secret))
+	accessToken, err := key.sign(claims)
+	if err != nil {
+		return "", "", internalServerError("error generating jwt token").WithInternalError(err)
+	}
+
+	if !params.hasScope(scopeOpenID) || params.Issuer == "" {
+		return accessToken, "", nil
+	}
+
+	idToken, err := generateIDToken(user, expiresIn, key, params)
+	if err != nil {
+		return "", "", internalServerError("error generating id token").WithInternalError(err)
+	}
+	return accessToken, idToken, nil
 }
 
-func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, user *models.User) (*AccessTokenResponse, error) {
+func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, user *models.User, params *tokenParams) (*AccessTokenResponse, error) {
 	config := a.getConfig(ctx)
 
+	key, err := a.getSigningKey(ctx)
+	if err != nil {
+		return nil, internalServerError("Error loading signing key").WithInternalError(err)
+	}
+
 	now := time.Now()
 	user.LastSignInAt = &now
 
-	var tokenString string
+	var tokenString, idTokenString string
 	var refreshToken *models.RefreshToken
 
-	err := conn.Transaction(func(tx *storage.Connection) error {
+	err = conn.Transaction(func(tx *storage.Connection) error {
 		var terr error
-		refreshToken, terr = models.GrantAuthenticatedUser(tx, user)
+		session, terr := models.NewSession(user, params.AuthenticationMethod, params.IP, params.UserAgent)
 		if terr != nil {
-			return internalServerError("Database error granting user").WithInternalError(terr)
+			return internalServerError("Error creating session").WithInternalError(terr)
 		}
+		session.Scope = params.Scope
+		session.ClientID = params.ClientID
+		session.Nonce = params.Nonce
+		if terr = tx.Create(session); terr != nil {
+			return internalServerError("Database error creating session").WithInternalError(terr)
+		}
+		params.SessionID = session.ID
+		params.AAL = session.AAL
 
-		tokenString, terr = generateAccessToken(user, time.Second*time.Duration(config.JWT.Exp), config.JWT.Secret)
+		refreshToken, terr = models.GrantAuthenticatedUser(tx, user, session)
 		if terr != nil {
-			return internalServerError("error generating jwt token").WithInternalError(terr)
+			return internalServerError("Database error granting user").WithInternalError(terr)
 		}
-		return nil
+
+		tokenString, idTokenString, terr = a.generateTokens(ctx, user, time.Second*time.Duration(config.JWT.Exp), key, params)
+		return terr
 	})
 	if err != nil {
 		return nil, err
@@ -229,6 +600,7 @@ func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, u
 		TokenType:    "bearer",
 		ExpiresIn:    config.JWT.Exp,
 		RefreshToken: refreshToken.Token,
+		IDToken:      idTokenString,
 	}, nil
 }
 
@@ -54,7 +54,7 @@ func TestAccessTokenAudIsString(t *testing.T) {
 	user := &models.User{Email: "test@example.com", Aud: "myapp"}
 	user.ID = uuid.Must(uuid.NewV4())
 
-	tokenStr, err := generateAccessToken(user, time.Hour, "test-secret")
+	tokenStr, err := generateAccessToken(user, time.Hour, newHMACSigningKey("test-secret"), nil)
 	require.NoError(t, err)
 
 	// Decode the payload (second segment) without signature validation
@@ -81,7 +81,7 @@ func TestAccessTokenHasKidHeader(t *testing.T) {
 	user := &models.User{Email: "test@example.com", Aud: "myapp"}
 	user.ID = uuid.Must(uuid.NewV4())
 
-	tokenStr, err := generateAccessToken(user, time.Hour, "test-secret")
+	tokenStr, err := generateAccessToken(user, time.Hour, newHMACSigningKey("test-secret"), nil)
 	require.NoError(t, err)
 
 	parts := strings.Split(tokenStr, ".")
@@ -107,7 +107,7 @@ func (ts *TokenTestSuite) TestRefreshTokenGrantExpired() {
 	require.NoError(ts.T(), ts.API.db.Create(u))
 
 	// Create a refresh token
-	r, err := models.GrantAuthenticatedUser(ts.API.db, u)
+	r, err := models.GrantAuthenticatedUser(ts.API.db, u, nil)
 	require.NoError(ts.T(), err)
 
 	// Backdate the token to make it older than the default 30-day lifetime
@@ -163,3 +163,88 @@ func (ts *TokenTestSuite) TestRateLimitToken() {
 	ts.API.handler.ServeHTTP(w, req)
 	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
 }
+
+func (ts *TokenTestSuite) refreshTokenGrant(token string) *httptest.ResponseRecorder {
+	return ts.refreshTokenGrantFrom(token, "192.0.2.1:1234")
+}
+
+func (ts *TokenTestSuite) refreshTokenGrantFrom(token, remoteAddr string) *httptest.ResponseRecorder {
+	body := strings.NewReader(url.Values{"refresh_token": {token}}.Encode())
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *TokenTestSuite) TestRefreshTokenGrantReuse() {
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	first := ts.grantWithSession(u)
+
+	w := ts.refreshTokenGrant(first.Token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	second := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(second))
+
+	// a concurrent refresh within the grace window gets the same refresh token
+	w = ts.refreshTokenGrant(first.Token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	concurrent := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(concurrent))
+	assert.Equal(ts.T(), second.RefreshToken, concurrent.RefreshToken)
+
+	w = ts.refreshTokenGrant(second.RefreshToken)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	third := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(third))
+
+	// once the grace window is over, reusing a rotated token revokes the whole family
+	tableName := (&models.RefreshToken{}).TableName()
+	require.NoError(ts.T(), ts.API.db.RawQuery(
+		"UPDATE "+tableName+" SET updated_at = ? WHERE id = ?",
+		time.Now().Add(-time.Minute), first.ID,
+	).Exec())
+
+	w = ts.refreshTokenGrant(first.Token)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	w = ts.refreshTokenGrant(third.RefreshToken)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code, "descendant tokens must be revoked")
+}
+
+func (ts *TokenTestSuite) TestRefreshTokenGrantReuseFromAnotherClient() {
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	first := ts.grantWithSession(u)
+
+	w := ts.refreshTokenGrant(first.Token)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	second := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(second))
+
+	// replaying the rotated token from elsewhere is reuse even within the grace window
+	w = ts.refreshTokenGrantFrom(first.Token, "198.51.100.1:1234")
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	w = ts.refreshTokenGrant(second.RefreshToken)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code, "descendant tokens must be revoked")
+}
+
+// grantWithSession issues a refresh token for a session started from the
+// address refreshTokenGrant sends requests from.
+func (ts *TokenTestSuite) grantWithSession(u *models.User) *models.RefreshToken {
+	session, err := models.NewSession(u, "password", "192.0.2.1", "")
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(session))
+
+	token, err := models.GrantAuthenticatedUser(ts.API.db, u, session)
+	require.NoError(ts.T(), err)
+	return token
+}
@@ -121,6 +121,15 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 			if terr = user.ConfirmEmailChange(tx); terr != nil {
 				return internalServerError("Error updating user").WithInternalError(terr)
 			}
+			if user.IsAnonymous {
+				if terr = a.confirmAnonymousUser(ctx, tx, user); terr != nil {
+					return terr
+				}
+			}
+		} else if params.Email != "" && user.IsAnonymous {
+			if terr = a.upgradeAnonymousUser(r, tx, user, params.Email); terr != nil {
+				return terr
+			}
 		} else if params.Email != "" && params.Email != user.Email {
 			if terr = a.validateEmail(ctx, params.Email); terr != nil {
 				return terr
@@ -12,18 +12,26 @@ import (
 )
 
 const (
-	signupVerification   = "signup"
-	recoveryVerification = "recovery"
+	signupVerification    = "signup"
+	recoveryVerification  = "recovery"
+	magicLinkVerification = "magiclink"
+	smsVerification       = "sms"
 )
 
-// VerifyParams are the parameters the Verify endpoint accepts
+// VerifyParams are the parameters the Verify endpoint accepts. Instead of
+// the token of a link, an email and the one-time passcode sent with it can
+// be given. Phone numbers are always verified with a passcode.
 type VerifyParams struct {
 	Type     string `json:"type"`
 	Token    string `json:"token"`
 	Password string `json:"password"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	OTP      string `json:"otp"`
 }
 
-// Verify exchanges a confirmation or recovery token to a refresh token
+// Verify exchanges a confirmation, recovery or magic link token, or a
+// passcode sent to a phone number, to a refresh token
 func (a *API) Verify(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	config := a.getConfig(ctx)
@@ -35,16 +43,28 @@ func (a *API) Verify(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("Could not read verification params: %v", err)
 	}
 
-	if strings.TrimSpace(params.Token) == "" {
-		return unprocessableEntityError("Verify requires a token")
-	}
-
 	var (
-		user  *models.User
-		err   error
-		token *AccessTokenResponse
+		user      *models.User
+		phoneUser *models.User
+		err       error
+		token     *AccessTokenResponse
 	)
 
+	if params.Type == smsVerification {
+		if phoneUser, err = a.verifyPhoneOTP(r, params); err != nil {
+			return err
+		}
+	} else {
+		if params.OTP != "" {
+			if params.Token, err = a.verifyEmailOTP(r, params); err != nil {
+				return err
+			}
+		}
+		if strings.TrimSpace(params.Token) == "" {
+			return unprocessableEntityError("Verify requires a token")
+		}
+	}
+
 	err = a.db.Transaction(func(tx *storage.Connection) error {
 		var terr error
 		switch params.Type {
@@ -52,6 +72,10 @@ func (a *API) Verify(w http.ResponseWriter, r *http.Request) error {
 			user, terr = a.signupVerify(ctx, tx, params)
 		case recoveryVerification:
 			user, terr = a.recoverVerify(ctx, tx, params)
+		case magicLinkVerification:
+			user, terr = a.magicLinkVerify(ctx, tx, params)
+		case smsVerification:
+			user, terr = a.smsVerify(ctx, tx, phoneUser)
 		default:
 			return unprocessableEntityError("Verify requires a verification type")
 		}
@@ -60,7 +84,7 @@ func (a *API) Verify(w http.ResponseWriter, r *http.Request) error {
 			return terr
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user)
+		token, terr = a.issueRefreshToken(ctx, tx, user, a.newTokenParams(r, params.Type))
 		if terr != nil {
 			return terr
 		}
@@ -177,3 +201,126 @@ func (a *API) recoverVerify(ctx context.Context, conn *storage.Connection, param
 	}
 	return user, nil
 }
+
+func (a *API) magicLinkVerify(ctx context.Context, conn *storage.Connection, params *VerifyParams) (*models.User, error) {
+	instanceID := getInstanceID(ctx)
+	config := a.getConfig(ctx)
+	user, err := models.FindUserByMagicLinkToken(conn, params.Token)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("%s", err.Error())
+		}
+		return nil, internalServerError("Database error finding user").WithInternalError(err)
+	}
+
+	if user.MagicLinkSentAt != nil {
+		expiresAt := user.MagicLinkSentAt.Add(config.Mailer.MagicLinkMaxAge)
+		if time.Now().After(expiresAt) {
+			return nil, unprocessableEntityError("Magic link expired")
+		}
+	}
+
+	err = conn.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = user.ConsumeMagicLink(tx); terr != nil {
+			return terr
+		}
+		// following the link proves the user owns the email
+		if !user.IsConfirmed() {
+			if terr = models.NewAuditLogEntry(tx, instanceID, user, models.UserSignedUpAction, nil); terr != nil {
+				return terr
+			}
+			if terr = triggerEventHooks(ctx, tx, SignupEvent, user, instanceID, config); terr != nil {
+				return terr
+			}
+			if terr = user.Confirm(tx); terr != nil {
+				return terr
+			}
+		}
+		return models.NewAuditLogEntry(tx, instanceID, user, models.LoginAction, map[string]interface{}{
+			"provider": "magiclink",
+		})
+	})
+
+	if err != nil {
+		return nil, internalServerError("Database error updating user").WithInternalError(err)
+	}
+	return user, nil
+}
+
+// verifyEmailOTP checks the one-time passcode of a verification and returns
+// the token of the link it was sent with. Codes are invalidated after too
+// many wrong attempts.
+func (a *API) verifyEmailOTP(r *http.Request, params *VerifyParams) (string, error) {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if !config.Mailer.OTPEnabled {
+		return "", unprocessableEntityError("One-time passcodes are disabled")
+	}
+	switch params.Type {
+	case signupVerification, recoveryVerification, magicLinkVerification:
+	default:
+		return "", unprocessableEntityError("Verify requires a verification type")
+	}
+	if params.Email == "" {
+		return "", unprocessableEntityError("Verifying a one-time passcode requires an email")
+	}
+
+	invalid := unprocessableEntityError("Invalid or expired one-time passcode")
+	user, err := models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, a.requestAud(ctx, r))
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return "", invalid
+		}
+		return "", internalServerError("Database error finding user").WithInternalError(err)
+	}
+	// guesses are checked one after the other against the stored code, so
+	// concurrent ones can't get past the attempts limit
+	var verr error
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		otp, terr := models.FindEmailOTPForUpdate(tx, instanceID, user.ID, params.Type)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				verr = invalid
+				return nil
+			}
+			return terr
+		}
+
+		if !otp.Matches(params.OTP) {
+			if terr := otp.IncrementAttempts(tx); terr != nil {
+				return terr
+			}
+			if otp.Attempts < config.Mailer.OTPMaxAttempts {
+				verr = invalid
+				return nil
+			}
+			verr = tooManyRequestsError("Too many attempts, please request a new code")
+		}
+
+		// a code works once, like its link
+		return tx.Destroy(otp)
+	})
+	if err != nil {
+		return "", internalServerError("Database error verifying one-time passcode").WithInternalError(err)
+	}
+	if verr != nil {
+		return "", verr
+	}
+
+	var token string
+	switch params.Type {
+	case signupVerification:
+		token = user.ConfirmationToken
+	case recoveryVerification:
+		token = user.RecoveryToken
+	case magicLinkVerification:
+		token = user.MagicLinkToken
+	}
+	if token == "" {
+		return "", invalid
+	}
+	return token, nil
+}
@@ -199,3 +199,79 @@ func (ts *VerifyTestSuite) TestVerify_PasswordRecovery_Expired() {
 	ts.API.handler.ServeHTTP(w, req)
 	assert.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
 }
+
+func (ts *VerifyTestSuite) verifyOTP(otpType, otp string) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"type":  otpType,
+		"email": "test@example.com",
+		"otp":   otp,
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/verify", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *VerifyTestSuite) TestVerify_EmailOTP() {
+	ts.Config.Mailer.OTPEnabled = true
+	defer func() { ts.Config.Mailer.OTPEnabled = false }()
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.RecoveryToken = "recovery-token"
+	u.RecoverySentAt = &now
+	require.NoError(ts.T(), ts.API.db.Update(u))
+	otp, err := models.GenerateEmailOTP(ts.API.db, u, "recovery")
+	require.NoError(ts.T(), err)
+
+	// a code of another type doesn't work
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, ts.verifyOTP("magiclink", otp).Code)
+
+	w := ts.verifyOTP("recovery", otp)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	u, err = models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), u.IsConfirmed())
+	assert.Empty(ts.T(), u.RecoveryToken)
+
+	// the code works once
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, ts.verifyOTP("recovery", otp).Code)
+}
+
+func (ts *VerifyTestSuite) TestVerify_EmailOTPLockout() {
+	ts.Config.Mailer.OTPEnabled = true
+	defer func() { ts.Config.Mailer.OTPEnabled = false }()
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.ConfirmationToken = "confirmation-token"
+	u.ConfirmationSentAt = &now
+	require.NoError(ts.T(), ts.API.db.Update(u))
+	otp, err := models.GenerateEmailOTP(ts.API.db, u, "signup")
+	require.NoError(ts.T(), err)
+
+	wrong := "000000"
+	if otp == wrong {
+		wrong = "111111"
+	}
+	for i := 1; i < ts.Config.Mailer.OTPMaxAttempts; i++ {
+		assert.Equal(ts.T(), http.StatusUnprocessableEntity, ts.verifyOTP("signup", wrong).Code)
+	}
+	assert.Equal(ts.T(), http.StatusTooManyRequests, ts.verifyOTP("signup", wrong).Code)
+
+	// the code is gone, but the link still works
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, ts.verifyOTP("signup", otp).Code)
+	_, err = models.FindUserByConfirmationToken(ts.API.db, "confirmation-token")
+	assert.NoError(ts.T(), err)
+}
+
+func (ts *VerifyTestSuite) TestVerify_EmailOTPDisabled() {
+	assert.Equal(ts.T(), http.StatusUnprocessableEntity, ts.verifyOTP("signup", "123456").Code)
+}
@@ -0,0 +1,555 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/metering"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/webauthn"
+)
+
+// webAuthnChallengeSize is the number of random bytes of a challenge.
+const webAuthnChallengeSize = 32
+
+type webAuthnRegisterParams struct {
+	ChallengeID       string `json:"challenge_id"`
+	FriendlyName      string `json:"friendly_name"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AttestationObject string `json:"attestation_object"`
+}
+
+type webAuthnLoginParams struct {
+	Email string `json:"email"`
+}
+
+// WebAuthnCredentialDescriptor identifies a credential to the client.
+type WebAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// WebAuthnCreationOptions are the options of navigator.credentials.create(),
+// with binary values encoded as base64url.
+type WebAuthnCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []map[string]interface{}       `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	Attestation            string                         `json:"attestation"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection map[string]string              `json:"authenticatorSelection"`
+}
+
+// WebAuthnRequestOptions are the options of navigator.credentials.get(),
+// with binary values encoded as base64url.
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	RPID             string                         `json:"rpId"`
+	Timeout          int64                          `json:"timeout"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnCeremonyResponse starts a ceremony. The challenge ID is sent back
+// to finish it.
+type WebAuthnCeremonyResponse struct {
+	ChallengeID uuid.UUID   `json:"challenge_id"`
+	PublicKey   interface{} `json:"publicKey"`
+}
+
+// webAuthnRelyingParty returns the relying party of the instance, which
+// defaults to the site URL.
+func webAuthnRelyingParty(config *conf.Configuration) *webauthn.RelyingParty {
+	rp := &webauthn.RelyingParty{
+		ID:      config.WebAuthn.RPID,
+		Name:    config.WebAuthn.RPName,
+		Origins: config.WebAuthn.Origins,
+	}
+
+	site, err := url.Parse(config.SiteURL)
+	if err == nil && site.Host != "" {
+		if rp.ID == "" {
+			rp.ID = site.Hostname()
+		}
+		if len(rp.Origins) == 0 {
+			rp.Origins = []string{site.Scheme + "://" + site.Host}
+		}
+	}
+	if rp.Name == "" {
+		rp.Name = totpIssuer(config)
+	}
+	return rp
+}
+
+func (a *API) requireWebAuthnEnabled(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if !a.getConfig(ctx).WebAuthn.Enabled {
+		return nil, badRequestError("WebAuthn is disabled")
+	}
+	return ctx, nil
+}
+
+// optionalAuthentication parses the access token of the request if there is
+// one, so that passkeys can raise the assurance level of its session.
+func (a *API) optionalAuthentication(r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	matches := bearerRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+	if len(matches) != 2 {
+		return ctx, nil
+	}
+
+	token, err := a.parseAccessToken(ctx, matches[1])
+	if err != nil {
+		return nil, unauthorizedError("Invalid token: %v", err)
+	}
+	return withToken(ctx, token), nil
+}
+
+// newWebAuthnChallenge stores the challenge of a new ceremony.
+func (a *API) newWebAuthnChallenge(ctx context.Context, user *models.User, challengeType string) (*models.WebAuthnChallenge, error) {
+	b := make([]byte, webAuthnChallengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, internalServerError("Error generating challenge").WithInternalError(err)
+	}
+
+	challenge, err := models.NewWebAuthnChallenge(getInstanceID(ctx), user, challengeType, webauthn.EncodeChallenge(b))
+	if err != nil {
+		return nil, internalServerError("Error creating challenge").WithInternalError(err)
+	}
+	if err := a.db.Create(challenge); err != nil {
+		return nil, internalServerError("Database error creating challenge").WithInternalError(err)
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge loads and deletes the challenge of a ceremony,
+// returning its raw bytes.
+func (a *API) consumeWebAuthnChallenge(ctx context.Context, id, challengeType string) (*models.WebAuthnChallenge, []byte, error) {
+	challengeID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, nil, badRequestError("challenge_id must be an UUID")
+	}
+
+	challenge, err := models.ConsumeWebAuthnChallenge(a.db, getInstanceID(ctx), challengeID, challengeType)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, nil, notFoundError("Challenge not found")
+		}
+		return nil, nil, internalServerError("Database error finding challenge").WithInternalError(err)
+	}
+	if challenge.HasExpired() {
+		return nil, nil, unprocessableEntityError("Challenge has expired, please request a new one")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(challenge.Challenge)
+	if err != nil {
+		return nil, nil, internalServerError("Invalid stored challenge").WithInternalError(err)
+	}
+	return challenge, raw, nil
+}
+
+// hasSecondFactor returns whether a user verified a factor or registered a
+// passkey, after which changing them requires an aal2 token.
+func (a *API) hasSecondFactor(user *models.User) (bool, error) {
+	verified, err := models.HasVerifiedFactors(a.db, user.InstanceID, user.ID)
+	if err != nil || verified {
+		return verified, err
+	}
+	return models.HasWebAuthnCredentials(a.db, user.InstanceID, user.ID)
+}
+
+func webAuthnDescriptors(creds []*models.WebAuthnCredential) []WebAuthnCredentialDescriptor {
+	descriptors := make([]WebAuthnCredentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		descriptors = append(descriptors, WebAuthnCredentialDescriptor{Type: "public-key", ID: cred.CredentialID})
+	}
+	return descriptors
+}
+
+func webAuthnTraits(cred *models.WebAuthnCredential) map[string]interface{} {
+	return map[string]interface{}{
+		"webauthn_credential_id": cred.ID,
+		"friendly_name":          cred.FriendlyName,
+	}
+}
+
+// WebAuthnCredentials lists the passkeys of the logged in user.
+func (a *API) WebAuthnCredentials(w http.ResponseWriter, r *http.Request) error {
+	user, err := getUserFromClaims(r.Context(), a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	creds, err := models.FindWebAuthnCredentialsByUserID(a.db, user.InstanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding credentials").WithInternalError(err)
+	}
+	return sendJSON(w, http.StatusOK, creds)
+}
+
+// WebAuthnRegisterBegin starts the registration of a passkey for the logged
+// in user.
+func (a *API) WebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+	if err := a.requireAAL2ForSecondFactor(ctx, user); err != nil {
+		return err
+	}
+
+	creds, err := models.FindWebAuthnCredentialsByUserID(a.db, user.InstanceID, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding credentials").WithInternalError(err)
+	}
+	challenge, err := a.newWebAuthnChallenge(ctx, user, models.WebAuthnRegistration)
+	if err != nil {
+		return err
+	}
+
+	rp := webAuthnRelyingParty(config)
+	options := &WebAuthnCreationOptions{
+		Challenge: challenge.Challenge,
+		PubKeyCredParams: []map[string]interface{}{
+			{"type": "public-key", "alg": webauthn.AlgES256},
+			{"type": "public-key", "alg": webauthn.AlgEdDSA},
+			{"type": "public-key", "alg": webauthn.AlgRS256},
+		},
+		Timeout:            models.WebAuthnChallengeLifetime.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: webAuthnDescriptors(creds),
+		AuthenticatorSelection: map[string]string{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+	}
+	options.RP.ID = rp.ID
+	options.RP.Name = rp.Name
+	options.User.ID = base64.RawURLEncoding.EncodeToString(user.ID.Bytes())
+	options.User.Name = user.Email
+	options.User.DisplayName = user.Email
+	if user.Email == "" {
+		options.User.Name = user.ID.String()
+		options.User.DisplayName = user.ID.String()
+	}
+
+	return sendJSON(w, http.StatusOK, &WebAuthnCeremonyResponse{
+		ChallengeID: challenge.ID,
+		PublicKey:   options,
+	})
+}
+
+// requireAAL2ForSecondFactor keeps a stolen password from adding or removing
+// passkeys of users who already have a second factor.
+func (a *API) requireAAL2ForSecondFactor(ctx context.Context, user *models.User) error {
+	mfa, err := a.hasSecondFactor(user)
+	if err != nil {
+		return internalServerError("Database error finding factors").WithInternalError(err)
+	}
+	if mfa {
+		return requireAAL2(ctx)
+	}
+	return nil
+}
+
+// WebAuthnRegisterFinish verifies the new credential of a registration
+// ceremony and stores it.
+func (a *API) WebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+
+	params := &webAuthnRegisterParams{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return badRequestError("Could not read registration params: %v", err)
+	}
+	clientData, err := base64.RawURLEncoding.DecodeString(params.ClientDataJSON)
+	if err != nil {
+		return badRequestError("client_data_json must be base64url encoded")
+	}
+	attestation, err := base64.RawURLEncoding.DecodeString(params.AttestationObject)
+	if err != nil {
+		return badRequestError("attestation_object must be base64url encoded")
+	}
+
+	challenge, raw, err := a.consumeWebAuthnChallenge(ctx, params.ChallengeID, models.WebAuthnRegistration)
+	if err != nil {
+		return err
+	}
+	if !challenge.UserID.Valid || challenge.UserID.UUID != user.ID {
+		return notFoundError("Challenge not found")
+	}
+
+	verified, err := webAuthnRelyingParty(config).VerifyRegistration(raw, clientData, attestation)
+	if err != nil {
+		return unprocessableEntityError("Invalid WebAuthn registration").WithInternalError(err)
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(verified.ID)
+	if _, err := models.FindWebAuthnCredentialByCredentialID(a.db, instanceID, credentialID); err == nil {
+		return unprocessableEntityError("Credential is already registered")
+	} else if !models.IsNotFoundError(err) {
+		return internalServerError("Database error finding credential").WithInternalError(err)
+	}
+
+	cred, err := models.NewWebAuthnCredential(user, params.FriendlyName, credentialID,
+		base64.StdEncoding.EncodeToString(verified.PublicKey), verified.Algorithm,
+		hex.EncodeToString(verified.AAGUID), verified.SignCount)
+	if err != nil {
+		return internalServerError("Error creating credential").WithInternalError(err)
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.WebAuthnRegisteredAction, webAuthnTraits(cred)); terr != nil {
+			return terr
+		}
+		return tx.Create(cred)
+	})
+	if err != nil {
+		return internalServerError("Database error creating credential").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, cred)
+}
+
+// DeleteWebAuthnCredential deletes a passkey of the logged in user, which
+// requires an aal2 token.
+func (a *API) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	instanceID := getInstanceID(ctx)
+
+	user, err := getUserFromClaims(ctx, a.db)
+	if err != nil {
+		return unauthorizedError("Invalid user").WithInternalError(err)
+	}
+	if err := requireAAL2(ctx); err != nil {
+		return err
+	}
+
+	id, err := uuid.FromString(chi.URLParam(r, "credential_id"))
+	if err != nil {
+		return badRequestError("credential_id must be an UUID")
+	}
+	cred, err := models.FindWebAuthnCredentialByUserIDAndID(a.db, instanceID, user.ID, id)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError("Credential not found")
+		}
+		return internalServerError("Database error finding credential").WithInternalError(err)
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(tx, instanceID, user, models.WebAuthnDeletedAction, webAuthnTraits(cred)); terr != nil {
+			return terr
+		}
+		return tx.Destroy(cred)
+	})
+	if err != nil {
+		return internalServerError("Database error deleting credential").WithInternalError(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// WebAuthnLoginBegin starts an authentication ceremony. With an access token
+// the passkeys of its user are allowed, with an email those of that user,
+// and otherwise any discoverable passkey.
+func (a *API) WebAuthnLoginBegin(w http.ResponseWriter, r *http.Request) error {
+	ctx, err := a.optionalAuthentication(r)
+	if err != nil {
+		return err
+	}
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	params := &webAuthnLoginParams{}
+	if r.Body != nil && r.Body != http.NoBody {
+		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+			return badRequestError("Could not read login params: %v", err)
+		}
+	}
+
+	var user *models.User
+	if getClaims(ctx) != nil {
+		user, err = getUserFromClaims(ctx, a.db)
+		if err != nil {
+			return unauthorizedError("Invalid user").WithInternalError(err)
+		}
+	} else if params.Email != "" {
+		user, err = models.FindUserByEmailAndAudience(a.db, instanceID, params.Email, a.requestAud(ctx, r))
+		if err != nil && !models.IsNotFoundError(err) {
+			return internalServerError("Database error finding user").WithInternalError(err)
+		}
+		// unknown emails get a challenge without credentials, so they can't be told apart
+	}
+
+	creds := []*models.WebAuthnCredential{}
+	if user != nil {
+		creds, err = models.FindWebAuthnCredentialsByUserID(a.db, instanceID, user.ID)
+		if err != nil {
+			return internalServerError("Database error finding credentials").WithInternalError(err)
+		}
+	}
+
+	challenge, err := a.newWebAuthnChallenge(ctx, user, models.WebAuthnAuthentication)
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, &WebAuthnCeremonyResponse{
+		ChallengeID: challenge.ID,
+		PublicKey: &WebAuthnRequestOptions{
+			Challenge:        challenge.Challenge,
+			RPID:             webAuthnRelyingParty(config).ID,
+			Timeout:          models.WebAuthnChallengeLifetime.Milliseconds(),
+			AllowCredentials: webAuthnDescriptors(creds),
+			UserVerification: "preferred",
+		},
+	})
+}
+
+// WebAuthnGrant implements the webauthn grant type, which signs in with the
+// assertion of a passkey. With the access token of the same user the
+// assertion serves as second factor and raises its session to aal2.
+func (a *API) WebAuthnGrant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	config := a.getConfig(ctx)
+	instanceID := getInstanceID(ctx)
+
+	if !config.WebAuthn.Enabled {
+		return oauthError("unsupported_grant_type", "WebAuthn is disabled")
+	}
+
+	ctx, err := a.optionalAuthentication(r)
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+
+	clientData, cerr := base64.RawURLEncoding.DecodeString(r.FormValue("client_data_json"))
+	authData, aerr := base64.RawURLEncoding.DecodeString(r.FormValue("authenticator_data"))
+	signature, serr := base64.RawURLEncoding.DecodeString(r.FormValue("signature"))
+	if cerr != nil || aerr != nil || serr != nil {
+		return oauthError("invalid_request", "client_data_json, authenticator_data and signature must be base64url encoded")
+	}
+
+	challengeID := r.FormValue("challenge_id")
+	credentialID := r.FormValue("credential_id")
+	if challengeID == "" || credentialID == "" {
+		return oauthError("invalid_request", "challenge_id and credential_id required")
+	}
+
+	challenge, raw, err := a.consumeWebAuthnChallenge(ctx, challengeID, models.WebAuthnAuthentication)
+	if err != nil {
+		if httpErr, ok := err.(*HTTPError); ok && httpErr.Code < http.StatusInternalServerError {
+			return oauthError("invalid_grant", httpErr.Message)
+		}
+		return err
+	}
+
+	cred, err := models.FindWebAuthnCredentialByCredentialID(a.db, instanceID, credentialID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return oauthError("invalid_grant", "Invalid WebAuthn credential")
+		}
+		return internalServerError("Database error finding credential").WithInternalError(err)
+	}
+	if challenge.UserID.Valid && challenge.UserID.UUID != cred.UserID {
+		return oauthError("invalid_grant", "Invalid WebAuthn credential")
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(cred.PublicKey)
+	if err != nil {
+		return internalServerError("Invalid stored public key").WithInternalError(err)
+	}
+	assertion, err := webAuthnRelyingParty(config).VerifyAssertion(raw, clientData, authData, signature, publicKey, cred.Algorithm, uint32(cred.SignCount))
+	if err != nil {
+		if err == webauthn.ErrSignCount {
+			getLogEntry(r).WithField("webauthn_credential_id", cred.ID).Warn("WebAuthn signature counter did not increase, the authenticator may be cloned")
+		}
+		return oauthError("invalid_grant", "Invalid WebAuthn assertion").WithInternalError(err)
+	}
+
+	user, err := models.FindUserByInstanceIDAndID(a.db, instanceID, cred.UserID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return oauthError("invalid_grant", "Invalid WebAuthn credential")
+		}
+		return internalServerError("Database error finding user").WithInternalError(err)
+	}
+	if !user.IsConfirmed() {
+		return oauthError("invalid_grant", "Email not confirmed")
+	}
+
+	if claims := getClaims(ctx); claims != nil {
+		if claims.Subject != user.ID.String() {
+			return oauthError("invalid_grant", "Credential belongs to another user")
+		}
+		tokens, err := a.issueAAL2Tokens(r, user, func(tx *storage.Connection) error {
+			if terr := cred.UpdateSignCount(tx, assertion.SignCount); terr != nil {
+				return internalServerError("Database error updating credential").WithInternalError(terr)
+			}
+			return models.NewAuditLogEntry(tx, instanceID, user, models.FactorVerifiedAction, map[string]interface{}{
+				"factor_type":            "webauthn",
+				"webauthn_credential_id": cred.ID,
+			})
+		})
+		if err != nil {
+			return err
+		}
+		return sendJSON(w, http.StatusOK, tokens)
+	}
+
+	params := a.newTokenParams(r, "webauthn")
+	params.Scope = r.FormValue("scope")
+	params.Nonce = r.FormValue("nonce")
+
+	var token *AccessTokenResponse
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = cred.UpdateSignCount(tx, assertion.SignCount); terr != nil {
+			return internalServerError("Database error updating credential").WithInternalError(terr)
+		}
+		if terr = models.NewAuditLogEntry(tx, instanceID, user, models.LoginAction, map[string]interface{}{
+			"provider": "webauthn",
+		}); terr != nil {
+			return terr
+		}
+		if terr = triggerEventHooks(ctx, tx, LoginEvent, user, instanceID, config); terr != nil {
+			return terr
+		}
+		token, terr = a.issueRefreshToken(ctx, tx, user, params)
+		return terr
+	})
+	if err != nil {
+		return err
+	}
+	metering.RecordLogin("webauthn", user.ID, instanceID)
+	return sendJSON(w, http.StatusOK, token)
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/netlify/gotrue/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type WebAuthnTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.Configuration
+
+	instanceID uuid.UUID
+}
+
+func TestWebAuthn(t *testing.T) {
+	api, config, instanceID, err := setupAPIForTestForInstance()
+	require.NoError(t, err)
+
+	ts := &WebAuthnTestSuite{
+		API:        api,
+		Config:     config,
+		instanceID: instanceID,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *WebAuthnTestSuite) SetupTest() {
+	require.NoError(ts.T(), models.TruncateAll(ts.API.db))
+	ts.Config.WebAuthn.Enabled = true
+	ts.Config.WebAuthn.RPID = "example.com"
+	ts.Config.WebAuthn.Origins = []string{"https://example.com"}
+	ts.Config.MFA.Enabled = true
+
+	u, err := models.NewUser(ts.instanceID, "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.ConfirmedAt = &now
+	require.NoError(ts.T(), ts.API.db.Create(u))
+}
+
+func (ts *WebAuthnTestSuite) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *WebAuthnTestSuite) token(form url.Values, bearer string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return ts.serve(req)
+}
+
+func (ts *WebAuthnTestSuite) request(method, path, bearer string, body interface{}) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	if body != nil {
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+	}
+	req := httptest.NewRequest(method, "http://localhost"+path, &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return ts.serve(req)
+}
+
+func (ts *WebAuthnTestSuite) decodeTokens(w *httptest.ResponseRecorder) *AccessTokenResponse {
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	tokens := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(tokens))
+	return tokens
+}
+
+func (ts *WebAuthnTestSuite) login() *AccessTokenResponse {
+	return ts.decodeTokens(ts.token(url.Values{
+		"grant_type": {"password"},
+		"username":   {"test@example.com"},
+		"password":   {"password"},
+	}, ""))
+}
+
+func (ts *WebAuthnTestSuite) claims(token string) *GoTrueClaims {
+	claims := &GoTrueClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	return claims
+}
+
+// begin starts a ceremony and returns the challenge ID and raw challenge.
+func (ts *WebAuthnTestSuite) begin(path, bearer string, body interface{}) (string, []byte) {
+	w := ts.request(http.MethodPost, path, bearer, body)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	var res struct {
+		ChallengeID string `json:"challenge_id"`
+		PublicKey   struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&res))
+	challenge, err := base64.RawURLEncoding.DecodeString(res.PublicKey.Challenge)
+	require.NoError(ts.T(), err)
+	return res.ChallengeID, challenge
+}
+
+func (ts *WebAuthnTestSuite) register(bearer string, authenticator *webauthntest.Authenticator) *httptest.ResponseRecorder {
+	challengeID, challenge := ts.begin("/webauthn/register/begin", bearer, nil)
+	clientData, attestation := authenticator.Register(challenge)
+	return ts.request(http.MethodPost, "/webauthn/register/finish", bearer, map[string]interface{}{
+		"challenge_id":       challengeID,
+		"friendly_name":      "laptop",
+		"client_data_json":   base64.RawURLEncoding.EncodeToString(clientData),
+		"attestation_object": base64.RawURLEncoding.EncodeToString(attestation),
+	})
+}
+
+func (ts *WebAuthnTestSuite) authenticate(bearer string, body interface{}, authenticator *webauthntest.Authenticator) *httptest.ResponseRecorder {
+	challengeID, challenge := ts.begin("/webauthn/login/begin", bearer, body)
+	clientData, authData, signature := authenticator.Assert(challenge)
+	return ts.token(url.Values{
+		"grant_type":         {"webauthn"},
+		"challenge_id":       {challengeID},
+		"credential_id":      {base64.RawURLEncoding.EncodeToString(authenticator.CredentialID)},
+		"client_data_json":   {base64.RawURLEncoding.EncodeToString(clientData)},
+		"authenticator_data": {base64.RawURLEncoding.EncodeToString(authData)},
+		"signature":          {base64.RawURLEncoding.EncodeToString(signature)},
+	}, bearer)
+}
+
+func (ts *WebAuthnTestSuite) TestPasswordlessLogin() {
+	login := ts.login()
+	authenticator := webauthntest.NewAuthenticator("example.com", "https://example.com")
+
+	w := ts.register(login.Token, authenticator)
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	cred := &models.WebAuthnCredential{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(cred))
+	assert.Equal(ts.T(), "laptop", cred.FriendlyName)
+	assert.Equal(ts.T(), base64.RawURLEncoding.EncodeToString(authenticator.CredentialID), cred.CredentialID)
+
+	// discoverable and email scoped ceremonies both sign in
+	tokens := ts.decodeTokens(ts.authenticate("", nil, authenticator))
+	claims := ts.claims(tokens.Token)
+	assert.Equal(ts.T(), models.AAL1, claims.AAL)
+	assert.NotEqual(ts.T(), ts.claims(login.Token).SessionID, claims.SessionID)
+	ts.decodeTokens(ts.authenticate("", map[string]string{"email": "test@example.com"}, authenticator))
+}
+
+func (ts *WebAuthnTestSuite) TestSecondFactor() {
+	login := ts.login()
+	authenticator := webauthntest.NewAuthenticator("example.com", "https://example.com")
+	require.Equal(ts.T(), http.StatusOK, ts.register(login.Token, authenticator).Code)
+
+	// with the access token the passkey raises its session to aal2
+	tokens := ts.decodeTokens(ts.authenticate(login.Token, nil, authenticator))
+	claims := ts.claims(tokens.Token)
+	assert.Equal(ts.T(), models.AAL2, claims.AAL)
+	assert.Equal(ts.T(), ts.claims(login.Token).SessionID, claims.SessionID)
+
+	// an aal1 token can neither add nor delete passkeys anymore
+	other := webauthntest.NewAuthenticator("example.com", "https://example.com")
+	w := ts.request(http.MethodPost, "/webauthn/register/begin", login.Token, nil)
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+	require.Equal(ts.T(), http.StatusOK, ts.register(tokens.Token, other).Code)
+
+	w = ts.request(http.MethodGet, "/webauthn/credentials", login.Token, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	creds := []*models.WebAuthnCredential{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&creds))
+	require.Len(ts.T(), creds, 2)
+
+	path := fmt.Sprintf("/webauthn/credentials/%s", creds[1].ID)
+	w = ts.request(http.MethodDelete, path, login.Token, nil)
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+	w = ts.request(http.MethodDelete, path, tokens.Token, nil)
+	assert.Equal(ts.T(), http.StatusNoContent, w.Code)
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.authenticate("", nil, other).Code)
+}
+
+func (ts *WebAuthnTestSuite) TestPasskeyRequiresAAL2ToEnrollTOTP() {
+	login := ts.login()
+	authenticator := webauthntest.NewAuthenticator("example.com", "https://example.com")
+	require.Equal(ts.T(), http.StatusOK, ts.register(login.Token, authenticator).Code)
+
+	// a password alone can't add a factor next to the passkey
+	body := map[string]interface{}{"factor_type": "totp", "friendly_name": "phone"}
+	w := ts.request(http.MethodPost, "/factors", login.Token, body)
+	assert.Equal(ts.T(), http.StatusForbidden, w.Code)
+
+	tokens := ts.decodeTokens(ts.authenticate(login.Token, nil, authenticator))
+	w = ts.request(http.MethodPost, "/factors", tokens.Token, body)
+	assert.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+}
+
+func (ts *WebAuthnTestSuite) TestRejectsReplayedAssertions() {
+	login := ts.login()
+	authenticator := webauthntest.NewAuthenticator("example.com", "https://example.com")
+	require.Equal(ts.T(), http.StatusOK, ts.register(login.Token, authenticator).Code)
+	ts.decodeTokens(ts.authenticate("", nil, authenticator))
+
+	// a clone with a stale counter is rejected
+	authenticator.SignCount = 0
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.authenticate("", nil, authenticator).Code)
+
+	// and challenges can only be used once
+	challengeID, challenge := ts.begin("/webauthn/login/begin", "", nil)
+	authenticator.SignCount = 10
+	clientData, authData, signature := authenticator.Assert(challenge)
+	form := url.Values{
+		"grant_type":         {"webauthn"},
+		"challenge_id":       {challengeID},
+		"credential_id":      {base64.RawURLEncoding.EncodeToString(authenticator.CredentialID)},
+		"client_data_json":   {base64.RawURLEncoding.EncodeToString(clientData)},
+		"authenticator_data": {base64.RawURLEncoding.EncodeToString(authData)},
+		"signature":          {base64.RawURLEncoding.EncodeToString(signature)},
+	}
+	ts.decodeTokens(ts.token(form, ""))
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.token(form, "").Code)
+}
+
+func (ts *WebAuthnTestSuite) TestPasskeyOfDeletedUser() {
+	login := ts.login()
+	authenticator := webauthntest.NewAuthenticator("example.com", "https://example.com")
+	require.Equal(ts.T(), http.StatusOK, ts.register(login.Token, authenticator).Code)
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, ts.instanceID, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), models.DeleteUser(ts.API.db, u))
+
+	has, err := models.HasWebAuthnCredentials(ts.API.db, ts.instanceID, u.ID)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), has, "passkeys are deleted with their user")
+	assert.Equal(ts.T(), http.StatusBadRequest, ts.authenticate("", nil, authenticator).Code)
+}
+
+func (ts *WebAuthnTestSuite) TestWebAuthnDisabled() {
+	ts.Config.WebAuthn.Enabled = false
+	w := ts.request(http.MethodPost, "/webauthn/login/begin", "", nil)
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+	w = ts.token(url.Values{"grant_type": {"webauthn"}}, "")
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func TestWebAuthnRelyingPartyDefaults(t *testing.T) {
+	config := &conf.Configuration{SiteURL: "https://example.com:8443/app"}
+	rp := webAuthnRelyingParty(config)
+	assert.Equal(t, "example.com", rp.ID)
+	assert.Equal(t, "example.com:8443", rp.Name)
+	assert.Equal(t, []string{"https://example.com:8443"}, rp.Origins)
+
+	config.WebAuthn = conf.WebAuthnConfiguration{
+		RPID:    "login.example.com",
+		RPName:  "Example",
+		Origins: []string{"https://login.example.com"},
+	}
+	rp = webAuthnRelyingParty(config)
+	assert.Equal(t, "login.example.com", rp.ID)
+	assert.Equal(t, "Example", rp.Name)
+	assert.Equal(t, []string{"https://login.example.com"}, rp.Origins)
+}
@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/api"
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
@@ -11,6 +14,7 @@ import (
 
 var autoconfirm, isSuperAdmin, isAdmin bool
 var audience, instanceID string
+var olderThan time.Duration
 
 func getAudience(c *conf.Configuration) string {
 	if audience == "" {
@@ -25,7 +29,7 @@ func adminCmd() *cobra.Command {
 		Use: "admin",
 	}
 
-	adminCmd.AddCommand(&adminCreateUserCmd, &adminDeleteUserCmd)
+	adminCmd.AddCommand(&adminCreateUserCmd, &adminDeleteUserCmd, &adminRotateKeysCmd, &adminPurgeAnonymousCmd)
 	adminCmd.PersistentFlags().StringVarP(&audience, "aud", "a", "", "Set the new user's audience")
 	adminCmd.PersistentFlags().StringVarP(&instanceID, "instance_id", "i", "", "Set the instance ID to interact with")
 
@@ -33,6 +37,8 @@ func adminCmd() *cobra.Command {
 	adminCreateUserCmd.Flags().BoolVar(&isSuperAdmin, "superadmin", false, "Create user with superadmin privileges")
 	adminCreateUserCmd.Flags().BoolVar(&isAdmin, "admin", false, "Create user with admin privileges")
 
+	adminPurgeAnonymousCmd.Flags().DurationVar(&olderThan, "older-than", 30*24*time.Hour, "Delete anonymous users inactive for longer than this")
+
 	return adminCmd
 }
 
@@ -60,6 +66,20 @@ var adminDeleteUserCmd = cobra.Command{
 	},
 }
 
+var adminRotateKeysCmd = cobra.Command{
+	Use: "rotate-keys",
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfigAndArgs(cmd, adminRotateKeys, args)
+	},
+}
+
+var adminPurgeAnonymousCmd = cobra.Command{
+	Use: "purge-anonymous",
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfigAndArgs(cmd, adminPurgeAnonymous, args)
+	},
+}
+
 func adminCreateUser(globalConfig *conf.GlobalConfiguration, config *conf.Configuration, args []string) {
 	iid := uuid.Must(uuid.FromString(instanceID))
 
@@ -136,3 +156,64 @@ func adminDeleteUser(globalConfig *conf.GlobalConfiguration, config *conf.Config
 
 	logrus.Infof("Removed user: %s", args[0])
 }
+
+func adminRotateKeys(globalConfig *conf.GlobalConfiguration, config *conf.Configuration, args []string) {
+	// single instance deployments store their keys without an instance ID
+	iid := uuid.Nil
+	if instanceID != "" {
+		iid = uuid.Must(uuid.FromString(instanceID))
+	}
+
+	db, err := storage.Dial(globalConfig)
+	if err != nil {
+		logrus.Fatalf("Error opening database: %+v", err)
+	}
+	defer db.Close()
+
+	if iid != uuid.Nil {
+		instance, err := models.GetInstance(db, iid)
+		if err != nil {
+			logrus.Fatalf("Error loading instance (%s): %+v", iid, err)
+		}
+		if config, err = instance.Config(); err != nil {
+			logrus.Fatalf("Error loading instance config (%s): %+v", iid, err)
+		}
+	}
+
+	if err := api.RotateSigningKeys(db, iid, config); err != nil {
+		logrus.Fatalf("Error rotating signing keys: %+v", err)
+	}
+
+	keys, err := models.FindSigningKeys(db, iid)
+	if err != nil {
+		logrus.Fatalf("Error loading signing keys: %+v", err)
+	}
+	for _, k := range keys {
+		logrus.Infof("Signing key %s (%s, kid %s): %s", k.ID, k.Algorithm, k.KeyID, k.State)
+	}
+}
+
+func adminPurgeAnonymous(globalConfig *conf.GlobalConfiguration, config *conf.Configuration, args []string) {
+	iid := uuid.Nil
+	if instanceID != "" {
+		iid = uuid.Must(uuid.FromString(instanceID))
+	}
+
+	db, err := storage.Dial(globalConfig)
+	if err != nil {
+		logrus.Fatalf("Error opening database: %+v", err)
+	}
+	defer db.Close()
+
+	var deleted int
+	err = db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		deleted, terr = models.DeleteStaleAnonymousUsers(tx, iid, time.Now().Add(-olderThan))
+		return terr
+	})
+	if err != nil {
+		logrus.Fatalf("Error purging anonymous users: %+v", err)
+	}
+
+	logrus.Infof("Purged %d anonymous users", deleted)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -18,12 +19,51 @@ type OAuthProviderConfiguration struct {
 	RedirectURI string `json:"redirect_uri" split_words:"true"`
 	URL         string `json:"url"`
 	Enabled     bool   `json:"enabled"`
+	// AdditionalScopes are the scopes clients may request at /authorize on
+	// top of the ones the provider always asks for.
+	AdditionalScopes []string `json:"additional_scopes" split_words:"true"`
+	// AuthParams are the query parameters of /authorize that are passed on
+	// to the provider, like prompt or hd.
+	AuthParams []string `json:"auth_params" split_words:"true"`
+}
+
+// AppleProviderConfiguration holds the configuration of Sign in with Apple,
+// whose client secret is signed with a private key of the team.
+type AppleProviderConfiguration struct {
+	Enabled     bool   `json:"enabled"`
+	ClientID    string `json:"client_id" split_words:"true"`
+	TeamID      string `json:"team_id" split_words:"true"`
+	KeyID       string `json:"key_id" split_words:"true"`
+	PrivateKey  string `json:"private_key" split_words:"true"`
+	RedirectURI string `json:"redirect_uri" split_words:"true"`
+	URL         string `json:"url"`
+}
+
+// AzureProviderConfiguration holds the configuration of Microsoft accounts.
+// Tenant is `common`, `organizations` or the ID of a single tenant, and
+// AllowedTenants restricts the tenants users may sign in from.
+type AzureProviderConfiguration struct {
+	Enabled        bool     `json:"enabled"`
+	ClientID       string   `json:"client_id" split_words:"true"`
+	Secret         string   `json:"secret"`
+	RedirectURI    string   `json:"redirect_uri" split_words:"true"`
+	Tenant         string   `json:"tenant" default:"common"`
+	AllowedTenants []string `json:"allowed_tenants" split_words:"true"`
+	URL            string   `json:"url"`
 }
 
 type EmailProviderConfiguration struct {
 	Disabled bool `json:"disabled"`
 }
 
+type AnonymousProviderConfiguration struct {
+	Enabled bool `json:"enabled"`
+}
+
+type PhoneProviderConfiguration struct {
+	Enabled bool `json:"enabled"`
+}
+
 type SamlProviderConfiguration struct {
 	Enabled     bool   `json:"enabled"`
 	MetadataURL string `json:"metadata_url" envconfig:"METADATA_URL"`
@@ -31,6 +71,90 @@ type SamlProviderConfiguration struct {
 	Name        string `json:"name"`
 	SigningCert string `json:"signing_cert" envconfig:"SIGNING_CERT"`
 	SigningKey  string `json:"signing_key" envconfig:"SIGNING_KEY"`
+	// GroupsAttribute is the attribute of assertions that lists the groups
+	// of users, `groups` by default.
+	GroupsAttribute string `json:"groups_attribute" envconfig:"GROUPS_ATTRIBUTE"`
+}
+
+// OIDCProviderConfiguration holds the configuration of an OpenID Connect
+// provider, whose endpoints are discovered from its issuer.
+type OIDCProviderConfiguration struct {
+	Enabled     bool     `json:"enabled"`
+	Name        string   `json:"name"`
+	Issuer      string   `json:"issuer"`
+	ClientID    string   `json:"client_id"`
+	Secret      string   `json:"secret"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+}
+
+// OIDCProviders are OpenID Connect providers by name. In the environment
+// they are set as a JSON object.
+type OIDCProviders map[string]OIDCProviderConfiguration
+
+// Decode implements envconfig.Decoder.
+func (p *OIDCProviders) Decode(value string) error {
+	return json.Unmarshal([]byte(value), p)
+}
+
+// ProviderTokensConfiguration holds how the tokens users are issued by
+// external providers are kept. They are only stored when an encryption key
+// is set.
+type ProviderTokensConfiguration struct {
+	// EncryptionKey is a base64 encoded 256 bit AES key.
+	EncryptionKey    string `json:"encryption_key" split_words:"true"`
+	ReturnInCallback bool   `json:"return_in_callback" split_words:"true"`
+}
+
+// GroupRule gives the members of a group at an external provider roles.
+type GroupRule struct {
+	Provider string `json:"provider"`
+	Group    string `json:"group"`
+	// Role becomes the role of members, unless an earlier rule matched with
+	// one.
+	Role string `json:"role,omitempty"`
+	// Roles are listed in the roles of the app metadata of members.
+	Roles []string `json:"roles,omitempty"`
+}
+
+// GroupRules are rules in the order they apply. In the environment they are
+// set as a JSON array.
+type GroupRules []GroupRule
+
+// Decode implements envconfig.Decoder.
+func (r *GroupRules) Decode(value string) error {
+	return json.Unmarshal([]byte(value), r)
+}
+
+// GroupsConfiguration holds how the groups of external accounts map to the
+// roles of users. The roles are updated on every login with a provider that
+// has rules.
+type GroupsConfiguration struct {
+	Rules GroupRules `json:"rules"`
+	// Required rejects users who are in none of the groups of the rules for
+	// their provider.
+	Required bool `json:"required"`
+}
+
+// RulesFor returns the rules for the groups at provider, whose name is
+// matched in any case.
+func (c *GroupsConfiguration) RulesFor(provider string) []GroupRule {
+	var rules []GroupRule
+	for _, rule := range c.Rules {
+		if strings.EqualFold(rule.Provider, provider) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// CustomProviders are the configurations of providers registered by
+// embedders, by name. In the environment they are set as a JSON object.
+type CustomProviders map[string]json.RawMessage
+
+// Decode implements envconfig.Decoder.
+func (p *CustomProviders) Decode(value string) error {
+	return json.Unmarshal([]byte(value), p)
 }
 
 // DBConfiguration holds all the database related configuration.
@@ -43,12 +167,16 @@ type DBConfiguration struct {
 
 // JWTConfiguration holds all the JWT related configuration.
 type JWTConfiguration struct {
-	Secret               string `json:"secret" required:"true"`
-	Exp                  int    `json:"exp"`
-	Aud                  string `json:"aud"`
-	AdminGroupName       string `json:"admin_group_name" split_words:"true"`
-	DefaultGroupName     string `json:"default_group_name" split_words:"true"`
-	RefreshTokenLifetime int    `json:"refresh_token_lifetime" split_words:"true"`
+	Secret                    string `json:"secret" required:"true"`
+	Algorithm                 string `json:"algorithm"`
+	PrivateKey                string `json:"private_key" split_words:"true"`
+	Issuer                    string `json:"issuer"`
+	Exp                       int    `json:"exp"`
+	Aud                       string `json:"aud"`
+	AdminGroupName            string `json:"admin_group_name" split_words:"true"`
+	DefaultGroupName          string `json:"default_group_name" split_words:"true"`
+	RefreshTokenLifetime      int    `json:"refresh_token_lifetime" split_words:"true"`
+	RefreshTokenReuseInterval int    `json:"refresh_token_reuse_interval" split_words:"true" default:"10"`
 }
 
 // GlobalConfiguration holds all the configuration that applies to all instances.
@@ -76,17 +204,29 @@ type EmailContentConfiguration struct {
 	Confirmation string `json:"confirmation"`
 	Recovery     string `json:"recovery"`
 	EmailChange  string `json:"email_change" split_words:"true"`
+	MagicLink    string `json:"magic_link" split_words:"true"`
 }
 
 type ProviderConfiguration struct {
-	Bitbucket   OAuthProviderConfiguration `json:"bitbucket"`
-	Github      OAuthProviderConfiguration `json:"github"`
-	Gitlab      OAuthProviderConfiguration `json:"gitlab"`
-	Google      OAuthProviderConfiguration `json:"google"`
-	Facebook    OAuthProviderConfiguration `json:"facebook"`
-	Email       EmailProviderConfiguration `json:"email"`
-	Saml        SamlProviderConfiguration  `json:"saml"`
-	RedirectURL string                     `json:"redirect_url"`
+	Bitbucket   OAuthProviderConfiguration     `json:"bitbucket"`
+	Github      OAuthProviderConfiguration     `json:"github"`
+	Gitlab      OAuthProviderConfiguration     `json:"gitlab"`
+	Google      OAuthProviderConfiguration     `json:"google"`
+	Facebook    OAuthProviderConfiguration     `json:"facebook"`
+	Apple       AppleProviderConfiguration     `json:"apple"`
+	Azure       AzureProviderConfiguration     `json:"azure"`
+	Discord     OAuthProviderConfiguration     `json:"discord"`
+	Slack       OAuthProviderConfiguration     `json:"slack"`
+	Twitch      OAuthProviderConfiguration     `json:"twitch"`
+	Email       EmailProviderConfiguration     `json:"email"`
+	Phone       PhoneProviderConfiguration     `json:"phone"`
+	Anonymous   AnonymousProviderConfiguration `json:"anonymous"`
+	Saml        SamlProviderConfiguration      `json:"saml"`
+	OIDC        OIDCProviders                  `json:"oidc" envconfig:"OIDC"`
+	Custom      CustomProviders                `json:"custom" envconfig:"CUSTOM"`
+	Tokens      ProviderTokensConfiguration    `json:"tokens"`
+	Groups      GroupsConfiguration            `json:"groups"`
+	RedirectURL string                         `json:"redirect_url"`
 }
 
 type SMTPConfiguration struct {
@@ -106,17 +246,96 @@ type MailerConfiguration struct {
 	RecoveryMaxAge     time.Duration             `json:"recovery_max_age" split_words:"true"`
 	ConfirmationMaxAge time.Duration             `json:"confirmation_max_age" split_words:"true"`
 	InviteMaxAge       time.Duration             `json:"invite_max_age" split_words:"true"`
+	MagicLinkMaxAge    time.Duration             `json:"magic_link_max_age" split_words:"true"`
+	// OTPEnabled adds a one-time passcode to confirmation, recovery and
+	// magic link emails, for when links can't be followed.
+	OTPEnabled     bool `json:"otp_enabled" split_words:"true"`
+	OTPMaxAttempts int  `json:"otp_max_attempts" split_words:"true"`
+}
+
+// Values of SMSConfiguration.Provider.
+const (
+	SMSProviderTwilio = "twilio"
+	SMSProviderLog    = "log"
+)
+
+// SMSConfiguration holds the configuration of text messages sent to phone
+// numbers. Messages are dropped when no provider is configured.
+type SMSConfiguration struct {
+	// Provider is "twilio" to send messages through the Twilio API, or "log"
+	// to only log them during development.
+	Provider     string        `json:"provider"`
+	Autoconfirm  bool          `json:"autoconfirm"`
+	MaxFrequency time.Duration `json:"max_frequency" split_words:"true"`
+	// Template is the text of one-time passcode messages, which can use the
+	// OTP and SiteURL variables.
+	Template       string              `json:"template"`
+	OTPLength      int                 `json:"otp_length" split_words:"true"`
+	OTPMaxAge      time.Duration       `json:"otp_max_age" split_words:"true"`
+	OTPMaxAttempts int                 `json:"otp_max_attempts" split_words:"true"`
+	Twilio         TwilioConfiguration `json:"twilio"`
+}
+
+// TwilioConfiguration holds the credentials of the Twilio API. Messages are
+// sent from the From number, or else through the messaging service.
+type TwilioConfiguration struct {
+	AccountSID          string `json:"account_sid" envconfig:"ACCOUNT_SID"`
+	AuthToken           string `json:"auth_token" split_words:"true"`
+	From                string `json:"from"`
+	MessagingServiceSID string `json:"messaging_service_sid" envconfig:"MESSAGING_SERVICE_SID"`
+	// APIURL points to a Twilio compatible API. Defaults to Twilio itself.
+	APIURL string `json:"api_url" envconfig:"API_URL"`
+}
+
+// OAuthServerConfiguration holds the configuration of the authorization code flow.
+type OAuthServerConfiguration struct {
+	// LoginURL is the page users are sent to when they need to log in to or
+	// approve a client. It receives the query of the authorization request.
+	// Defaults to the site URL.
+	LoginURL string `json:"login_url" split_words:"true"`
+}
+
+// Values of MFAConfiguration.Required.
+const (
+	MFARequiredAdmins = "admins"
+	MFARequiredAll    = "all"
+)
+
+// MFAConfiguration holds the configuration of multi-factor authentication.
+type MFAConfiguration struct {
+	Enabled bool `json:"enabled"`
+	// Required is "admins" to only accept aal2 tokens on the admin API, or
+	// "all" to also require them for the user API.
+	Required           string `json:"required"`
+	ChallengeExpiry    int    `json:"challenge_expiry" split_words:"true"`
+	MaxEnrolledFactors int    `json:"max_enrolled_factors" split_words:"true"`
+}
+
+// WebAuthnConfiguration holds the configuration of passkeys.
+type WebAuthnConfiguration struct {
+	Enabled bool `json:"enabled"`
+	// RPID is the relying party ID credentials are scoped to. Defaults to
+	// the host of the site URL.
+	RPID   string `json:"rp_id" envconfig:"RP_ID"`
+	RPName string `json:"rp_name" split_words:"true"`
+	// Origins are the origins ceremonies may run on. Defaults to the origin
+	// of the site URL.
+	Origins []string `json:"origins"`
 }
 
 // Configuration holds all the per-instance configuration.
 type Configuration struct {
-	SiteURL       string                `json:"site_url" split_words:"true" required:"true"`
-	JWT           JWTConfiguration      `json:"jwt"`
-	SMTP          SMTPConfiguration     `json:"smtp"`
-	Mailer        MailerConfiguration   `json:"mailer"`
-	External      ProviderConfiguration `json:"external"`
-	DisableSignup bool                  `json:"disable_signup" split_words:"true"`
-	Webhook       WebhookConfig         `json:"webhook" split_words:"true"`
+	SiteURL       string                   `json:"site_url" split_words:"true" required:"true"`
+	JWT           JWTConfiguration         `json:"jwt"`
+	SMTP          SMTPConfiguration        `json:"smtp"`
+	Mailer        MailerConfiguration      `json:"mailer"`
+	SMS           SMSConfiguration         `json:"sms"`
+	External      ProviderConfiguration    `json:"external"`
+	DisableSignup bool                     `json:"disable_signup" split_words:"true"`
+	Webhook       WebhookConfig            `json:"webhook" split_words:"true"`
+	OAuthServer   OAuthServerConfiguration `json:"oauth_server" split_words:"true"`
+	MFA           MFAConfiguration         `json:"mfa"`
+	WebAuthn      WebAuthnConfiguration    `json:"webauthn"`
 	Cookie        struct {
 		Key      string `json:"key"`
 		Duration int    `json:"duration"`
@@ -197,6 +416,10 @@ func (config *Configuration) ApplyDefaults() {
 		config.JWT.AdminGroupName = "admin"
 	}
 
+	if config.JWT.Algorithm == "" {
+		config.JWT.Algorithm = "HS256"
+	}
+
 	if config.JWT.Exp == 0 {
 		config.JWT.Exp = 3600
 	}
@@ -205,6 +428,14 @@ func (config *Configuration) ApplyDefaults() {
 		config.JWT.RefreshTokenLifetime = 2592000 // 30 days
 	}
 
+	if config.MFA.ChallengeExpiry <= 0 {
+		config.MFA.ChallengeExpiry = 300
+	}
+
+	if config.MFA.MaxEnrolledFactors <= 0 {
+		config.MFA.MaxEnrolledFactors = 10
+	}
+
 	if config.Mailer.URLPaths.Invite == "" {
 		config.Mailer.URLPaths.Invite = "/"
 	}
@@ -217,6 +448,9 @@ func (config *Configuration) ApplyDefaults() {
 	if config.Mailer.URLPaths.EmailChange == "" {
 		config.Mailer.URLPaths.EmailChange = "/"
 	}
+	if config.Mailer.URLPaths.MagicLink == "" {
+		config.Mailer.URLPaths.MagicLink = "/"
+	}
 
 	if config.SMTP.MaxFrequency == 0 {
 		config.SMTP.MaxFrequency = 15 * time.Minute
@@ -234,6 +468,34 @@ func (config *Configuration) ApplyDefaults() {
 		config.Mailer.InviteMaxAge = 7 * 24 * time.Hour
 	}
 
+	if config.Mailer.MagicLinkMaxAge <= 0 {
+		config.Mailer.MagicLinkMaxAge = time.Hour
+	}
+
+	if config.Mailer.OTPMaxAttempts <= 0 {
+		config.Mailer.OTPMaxAttempts = 5
+	}
+
+	if config.SMS.MaxFrequency == 0 {
+		config.SMS.MaxFrequency = time.Minute
+	}
+
+	if config.SMS.OTPLength <= 0 {
+		config.SMS.OTPLength = 6
+	}
+
+	if config.SMS.OTPMaxAge <= 0 {
+		config.SMS.OTPMaxAge = 5 * time.Minute
+	}
+
+	if config.SMS.OTPMaxAttempts <= 0 {
+		config.SMS.OTPMaxAttempts = 5
+	}
+
+	if config.SMS.Twilio.APIURL == "" {
+		config.SMS.Twilio.APIURL = "https://api.twilio.com"
+	}
+
 	if config.Cookie.Key == "" {
 		config.Cookie.Key = "nf_jwt"
 	}
@@ -268,6 +530,56 @@ func (config *Configuration) Scan(src interface{}) error {
 	return json.Unmarshal(source, &config)
 }
 
+func (o *OAuthProviderConfiguration) IsEnabled() bool { return o.Enabled }
+func (o *OIDCProviderConfiguration) IsEnabled() bool  { return o.Enabled }
+func (o *AppleProviderConfiguration) IsEnabled() bool { return o.Enabled }
+func (o *AzureProviderConfiguration) IsEnabled() bool { return o.Enabled }
+func (o *SamlProviderConfiguration) IsEnabled() bool  { return o.Enabled }
+
+// DisplayName is the label of the provider shown to users.
+func (o *OIDCProviderConfiguration) DisplayName() string { return o.Name }
+
+// DisplayName is the label of the provider shown to users.
+func (o *SamlProviderConfiguration) DisplayName() string { return o.Name }
+
+// reservedAuthParams are the parameters of authorization requests that
+// clients can't set.
+var reservedAuthParams = map[string]bool{
+	"client_id":             true,
+	"code_challenge":        true,
+	"code_challenge_method": true,
+	"nonce":                 true,
+	"redirect_uri":          true,
+	"response_mode":         true,
+	"response_type":         true,
+	"scope":                 true,
+	"state":                 true,
+}
+
+// AllowsScope tells whether clients may request scope at /authorize.
+func (o *OAuthProviderConfiguration) AllowsScope(scope string) bool {
+	for _, s := range o.AdditionalScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAuthParam tells whether the query parameter name of /authorize is
+// passed on to the provider.
+func (o *OAuthProviderConfiguration) AllowsAuthParam(name string) bool {
+	if reservedAuthParams[name] {
+		return false
+	}
+	for _, p := range o.AuthParams {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (o *OAuthProviderConfiguration) Validate() error {
 	if !o.Enabled {
 		return errors.New("Provider is not enabled")
@@ -283,3 +595,54 @@ func (o *OAuthProviderConfiguration) Validate() error {
 	}
 	return nil
 }
+
+func (o *OIDCProviderConfiguration) Validate() error {
+	if !o.Enabled {
+		return errors.New("Provider is not enabled")
+	}
+	if o.Issuer == "" {
+		return errors.New("Missing OIDC issuer")
+	}
+	if o.ClientID == "" {
+		return errors.New("Missing Oauth client ID")
+	}
+	if o.Secret == "" {
+		return errors.New("Missing Oauth secret")
+	}
+	if o.RedirectURI == "" {
+		return errors.New("Missing redirect URI")
+	}
+	return nil
+}
+
+func (o *AzureProviderConfiguration) Validate() error {
+	if !o.Enabled {
+		return errors.New("Provider is not enabled")
+	}
+	if o.ClientID == "" {
+		return errors.New("Missing Oauth client ID")
+	}
+	if o.Secret == "" {
+		return errors.New("Missing Oauth secret")
+	}
+	if o.RedirectURI == "" {
+		return errors.New("Missing redirect URI")
+	}
+	return nil
+}
+
+func (o *AppleProviderConfiguration) Validate() error {
+	if !o.Enabled {
+		return errors.New("Provider is not enabled")
+	}
+	if o.ClientID == "" {
+		return errors.New("Missing Oauth client ID")
+	}
+	if o.TeamID == "" || o.KeyID == "" || o.PrivateKey == "" {
+		return errors.New("Missing team ID, key ID or private key")
+	}
+	if o.RedirectURI == "" {
+		return errors.New("Missing redirect URI")
+	}
+	return nil
+}
@@ -25,6 +25,53 @@ func TestGlobal(t *testing.T) {
 	assert.Equal(t, "X-Request-ID", gc.API.RequestIDHeader)
 }
 
+func TestOIDCProviders(t *testing.T) {
+	os.Setenv("GOTRUE_DB_DRIVER", "mysql")
+	os.Setenv("GOTRUE_DB_DATABASE_URL", "fake")
+	os.Setenv("GOTRUE_OPERATOR_TOKEN", "token")
+	os.Setenv("GOTRUE_EXTERNAL_OIDC", `{"okta": {"enabled": true, "issuer": "https://example.okta.com", "client_id": "id", "scopes": ["openid", "groups"]}}`)
+	defer os.Unsetenv("GOTRUE_EXTERNAL_OIDC")
+
+	gc, err := LoadGlobal("")
+	require.NoError(t, err)
+	okta := gc.External.OIDC["okta"]
+	assert.True(t, okta.Enabled)
+	assert.Equal(t, "https://example.okta.com", okta.Issuer)
+	assert.Equal(t, []string{"openid", "groups"}, okta.Scopes)
+	assert.EqualError(t, okta.Validate(), "Missing Oauth secret")
+}
+
+func TestAzureProvider(t *testing.T) {
+	os.Setenv("GOTRUE_DB_DRIVER", "mysql")
+	os.Setenv("GOTRUE_DB_DATABASE_URL", "fake")
+	os.Setenv("GOTRUE_OPERATOR_TOKEN", "token")
+	os.Setenv("GOTRUE_EXTERNAL_AZURE_ALLOWED_TENANTS", "tenant-a,tenant-b")
+	defer os.Unsetenv("GOTRUE_EXTERNAL_AZURE_ALLOWED_TENANTS")
+
+	gc, err := LoadGlobal("")
+	require.NoError(t, err)
+	assert.Equal(t, "common", gc.External.Azure.Tenant)
+	assert.Equal(t, []string{"tenant-a", "tenant-b"}, gc.External.Azure.AllowedTenants)
+}
+
+func TestGroupRules(t *testing.T) {
+	os.Setenv("GOTRUE_DB_DRIVER", "mysql")
+	os.Setenv("GOTRUE_DB_DATABASE_URL", "fake")
+	os.Setenv("GOTRUE_OPERATOR_TOKEN", "token")
+	os.Setenv("GOTRUE_EXTERNAL_GROUPS_RULES", `[{"provider": "github", "group": "acme/admins", "role": "admin", "roles": ["admin"]}, {"provider": "gitlab", "group": "acme"}]`)
+	os.Setenv("GOTRUE_EXTERNAL_GROUPS_REQUIRED", "true")
+	defer os.Unsetenv("GOTRUE_EXTERNAL_GROUPS_RULES")
+	defer os.Unsetenv("GOTRUE_EXTERNAL_GROUPS_REQUIRED")
+
+	gc, err := LoadGlobal("")
+	require.NoError(t, err)
+	assert.True(t, gc.External.Groups.Required)
+	assert.Equal(t, []GroupRule{{Provider: "github", Group: "acme/admins", Role: "admin", Roles: []string{"admin"}}}, gc.External.Groups.RulesFor("github"))
+	assert.Len(t, gc.External.Groups.RulesFor("gitlab"), 1)
+	assert.Len(t, gc.External.Groups.RulesFor("GitHub"), 1)
+	assert.Empty(t, gc.External.Groups.RulesFor("saml"))
+}
+
 func TestTracing(t *testing.T) {
 	os.Setenv("GOTRUE_DB_DRIVER", "mysql")
 	os.Setenv("GOTRUE_DB_DATABASE_URL", "fake")
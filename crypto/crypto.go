@@ -5,7 +5,9 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"fmt"
 	"io"
+	"math/big"
 	"strings"
 )
 
@@ -18,6 +20,16 @@ func SecureToken() string {
 	return removePadding(base64.URLEncoding.EncodeToString(b))
 }
 
+// GenerateOTP creates a random numeric one-time passcode with digits digits
+func GenerateOTP(digits int) string {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		panic(err.Error()) // rand should never fail
+	}
+	return fmt.Sprintf("%0*d", digits, n)
+}
+
 func removePadding(token string) string {
 	return strings.TrimRight(token, "=")
 }
@@ -0,0 +1,15 @@
+package crypto
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateOTP(t *testing.T) {
+	digits := regexp.MustCompile(`^[0-9]{6}$`)
+	for i := 0; i < 100; i++ {
+		assert.Regexp(t, digits, GenerateOTP(6))
+	}
+}
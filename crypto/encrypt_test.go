@@ -0,0 +1,45 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncrypt(t *testing.T) {
+	key, err := ParseEncryptionKey(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	require.NoError(t, err)
+
+	sealed, err := Encrypt(key, []byte("secret"), []byte("identity-1"))
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "secret")
+
+	other, err := Encrypt(key, []byte("secret"), []byte("identity-1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, other)
+
+	plaintext, err := Decrypt(key, sealed, []byte("identity-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	// ciphertexts are bound to their additional data
+	_, err = Decrypt(key, sealed, []byte("identity-2"))
+	assert.Error(t, err)
+
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	_, err = Decrypt(otherKey, sealed, []byte("identity-1"))
+	assert.Error(t, err)
+
+	_, err = Decrypt(key, "AAAA", nil)
+	assert.Error(t, err)
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	_, err := ParseEncryptionKey("not base64!")
+	assert.Error(t, err)
+	_, err = ParseEncryptionKey(base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	assert.EqualError(t, err, "Encryption key must be 32 bytes, not 16")
+}
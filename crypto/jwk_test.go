@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, pub := range []stdcrypto.PublicKey{&rsaKey.PublicKey, &ecKey.PublicKey, edKey} {
+		jwk, err := NewJWK(pub, "kid", "")
+		require.NoError(t, err)
+		parsed, err := jwk.PublicKey()
+		require.NoError(t, err)
+		assert.True(t, parsed.(interface {
+			Equal(stdcrypto.PublicKey) bool
+		}).Equal(pub))
+	}
+
+	_, err = (&JWK{KeyType: "EC", Curve: "P-256", X: "AQ", Y: "AQ"}).PublicKey()
+	assert.Error(t, err)
+	_, err = (&JWK{KeyType: "oct"}).PublicKey()
+	assert.Error(t, err)
+}
+
+func TestJWKSetKey(t *testing.T) {
+	set := &JWKSet{Keys: []*JWK{{KeyID: "a"}, {KeyID: "b"}}}
+	assert.Equal(t, "b", set.Key("b").KeyID)
+	assert.Nil(t, set.Key("c"))
+}
@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Supported JWS algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// IsAsymmetricAlgorithm returns whether alg names a supported public key JWS algorithm.
+func IsAsymmetricAlgorithm(alg string) bool {
+	switch alg {
+	case RS256, ES256, EdDSA:
+		return true
+	}
+	return false
+}
+
+// GenerateSigningKey creates a new private key suitable for signing with the given JWS algorithm.
+func GenerateSigningKey(alg string) (stdcrypto.Signer, error) {
+	switch alg {
+	case RS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("Unsupported signing algorithm %s", alg)
+}
+
+// ParseSigningKey parses a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key and
+// checks that it can be used with the given JWS algorithm.
+func ParseSigningKey(alg, data string) (stdcrypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("Private key is not PEM encoded")
+	}
+
+	var key interface{}
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+				return nil, errors.New("Unable to parse private key")
+			}
+		}
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg == RS256 {
+			return k, nil
+		}
+	case *ecdsa.PrivateKey:
+		if alg == ES256 && k.Curve == elliptic.P256() {
+			return k, nil
+		}
+	case ed25519.PrivateKey:
+		if alg == EdDSA {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("Private key can not be used with the %s algorithm", alg)
+}
+
+// EncodeSigningKey PEM encodes a private key in PKCS#8 form.
+func EncodeSigningKey(key stdcrypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
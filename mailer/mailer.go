@@ -10,13 +10,16 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// Mailer defines the interface a mailer must implement.
+// Mailer defines the interface a mailer must implement. The otp of
+// confirmation, recovery and magic link mails is empty unless one-time
+// passcodes are enabled.
 type Mailer interface {
 	Send(user *models.User, subject, body string, data map[string]interface{}) error
 	InviteMail(user *models.User, referrerURL string) error
-	ConfirmationMail(user *models.User, referrerURL string) error
-	RecoveryMail(user *models.User, referrerURL string) error
+	ConfirmationMail(user *models.User, otp, referrerURL string) error
+	RecoveryMail(user *models.User, otp, referrerURL string) error
 	EmailChangeMail(user *models.User, referrerURL string) error
+	MagicLinkMail(user *models.User, otp, referrerURL string) error
 	ValidateEmail(email string) error
 }
 
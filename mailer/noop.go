@@ -13,11 +13,11 @@ func (m *noopMailer) InviteMail(user *models.User, referrerURL string) error {
 	return nil
 }
 
-func (m *noopMailer) ConfirmationMail(user *models.User, referrerURL string) error {
+func (m *noopMailer) ConfirmationMail(user *models.User, otp, referrerURL string) error {
 	return nil
 }
 
-func (m noopMailer) RecoveryMail(user *models.User, referrerURL string) error {
+func (m noopMailer) RecoveryMail(user *models.User, otp, referrerURL string) error {
 	return nil
 }
 
@@ -25,6 +25,10 @@ func (m *noopMailer) EmailChangeMail(user *models.User, referrerURL string) erro
 	return nil
 }
 
+func (m *noopMailer) MagicLinkMail(user *models.User, otp, referrerURL string) error {
+	return nil
+}
+
 func (m noopMailer) Send(user *models.User, subject, body string, data map[string]interface{}) error {
 	return nil
 }
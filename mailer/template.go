@@ -25,13 +25,15 @@ const defaultConfirmationMail = `<h2>Confirm your signup</h2>
 
 <p>Follow this link to confirm your user:</p>
 <p><a href="{{ .ConfirmationURL }}">Confirm your email address</a></p>
-<p>This link is valid for 24 hours.</p>`
+{{ if .OTP }}<p>Alternatively, enter the code {{ .OTP }}</p>
+{{ end }}<p>This link is valid for 24 hours.</p>`
 
 const defaultRecoveryMail = `<h2>Reset password</h2>
 
 <p>Follow this link to reset the password for your user:</p>
 <p><a href="{{ .ConfirmationURL }}">Reset password</a></p>
-<p>This link is valid for 24 hours.</p>`
+{{ if .OTP }}<p>Alternatively, enter the code {{ .OTP }}</p>
+{{ end }}<p>This link is valid for 24 hours.</p>`
 
 const defaultEmailChangeMail = `<h2>Confirm email address change</h2>
 
@@ -39,6 +41,13 @@ const defaultEmailChangeMail = `<h2>Confirm email address change</h2>
 <p><a href="{{ .ConfirmationURL }}">Change email address</a></p>
 <p>This link is valid for 24 hours.</p>`
 
+const defaultMagicLinkMail = `<h2>Magic link</h2>
+
+<p>Follow this link to log in:</p>
+<p><a href="{{ .ConfirmationURL }}">Log in</a></p>
+{{ if .OTP }}<p>Alternatively, enter the code {{ .OTP }}</p>
+{{ end }}<p>This link is valid for 1 hour and can only be used once.</p>`
+
 // ValidateEmail returns nil if the email is valid,
 // otherwise an error indicating the reason it is invalid
 func (m TemplateMailer) ValidateEmail(email string) error {
@@ -70,7 +79,7 @@ func (m *TemplateMailer) InviteMail(user *models.User, referrerURL string) error
 }
 
 // ConfirmationMail sends a signup confirmation mail to a new user
-func (m *TemplateMailer) ConfirmationMail(user *models.User, referrerURL string) error {
+func (m *TemplateMailer) ConfirmationMail(user *models.User, otp, referrerURL string) error {
 	url, err := getSiteURL(referrerURL, m.Config.SiteURL, m.Config.Mailer.URLPaths.Confirmation, "confirmation_token="+user.ConfirmationToken)
 	if err != nil {
 		return err
@@ -79,7 +88,8 @@ func (m *TemplateMailer) ConfirmationMail(user *models.User, referrerURL string)
 		"SiteURL":         m.Config.SiteURL,
 		"ConfirmationURL": url,
 		"Email":           user.Email,
-		"Token":           user.ConfirmationToken,
+		"Token":           withDefault(otp, user.ConfirmationToken),
+		"OTP":             otp,
 		"Data":            user.UserMetaData,
 	}
 
@@ -117,7 +127,7 @@ func (m *TemplateMailer) EmailChangeMail(user *models.User, referrerURL string)
 }
 
 // RecoveryMail sends a password recovery mail
-func (m *TemplateMailer) RecoveryMail(user *models.User, referrerURL string) error {
+func (m *TemplateMailer) RecoveryMail(user *models.User, otp, referrerURL string) error {
 	url, err := getSiteURL(referrerURL, m.Config.SiteURL, m.Config.Mailer.URLPaths.Recovery, "recovery_token="+user.RecoveryToken)
 	if err != nil {
 		return err
@@ -126,7 +136,8 @@ func (m *TemplateMailer) RecoveryMail(user *models.User, referrerURL string) err
 		"SiteURL":         m.Config.SiteURL,
 		"ConfirmationURL": url,
 		"Email":           user.Email,
-		"Token":           user.RecoveryToken,
+		"Token":           withDefault(otp, user.RecoveryToken),
+		"OTP":             otp,
 		"Data":            user.UserMetaData,
 	}
 
@@ -139,6 +150,30 @@ func (m *TemplateMailer) RecoveryMail(user *models.User, referrerURL string) err
 	)
 }
 
+// MagicLinkMail sends a mail with a link to log in without a password
+func (m *TemplateMailer) MagicLinkMail(user *models.User, otp, referrerURL string) error {
+	url, err := getSiteURL(referrerURL, m.Config.SiteURL, m.Config.Mailer.URLPaths.MagicLink, "magiclink_token="+user.MagicLinkToken)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"SiteURL":         m.Config.SiteURL,
+		"ConfirmationURL": url,
+		"Email":           user.Email,
+		"Token":           withDefault(otp, user.MagicLinkToken),
+		"OTP":             otp,
+		"Data":            user.UserMetaData,
+	}
+
+	return m.Mailer.Mail(
+		user.Email,
+		string(withDefault(m.Config.Mailer.Subjects.MagicLink, "Your Magic Link")),
+		enforceRelativeURL(m.Config.Mailer.Templates.MagicLink),
+		defaultMagicLinkMail,
+		data,
+	)
+}
+
 // Send can be used to send one-off emails to users
 func (m TemplateMailer) Send(user *models.User, subject, body string, data map[string]interface{}) error {
 	return m.Mailer.Mail(
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}signing_keys` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `kid` varchar(255) NOT NULL,
+  `algorithm` varchar(255) NOT NULL,
+  `private_key` text NOT NULL,
+  `state` varchar(255) NOT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `signing_keys_instance_id_idx` (`instance_id`),
+  KEY `signing_keys_instance_id_kid_idx` (`instance_id`,`kid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
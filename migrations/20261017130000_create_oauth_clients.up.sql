@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}oauth_clients` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `client_id` varchar(255) NOT NULL,
+  `encrypted_secret` varchar(255) DEFAULT NULL,
+  `name` varchar(255) DEFAULT NULL,
+  `redirect_uris` json DEFAULT NULL,
+  `first_party` tinyint(1) DEFAULT NULL,
+  `confidential` tinyint(1) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `oauth_clients_instance_id_idx` (`instance_id`),
+  UNIQUE KEY `oauth_clients_instance_id_client_id_idx` (`instance_id`,`client_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}oauth_authorization_codes` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `code` varchar(255) NOT NULL,
+  `client_id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `redirect_uri` text,
+  `scope` varchar(255) DEFAULT NULL,
+  `nonce` varchar(255) DEFAULT NULL,
+  `code_challenge` varchar(255) DEFAULT NULL,
+  `code_challenge_method` varchar(255) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `oauth_authorization_codes_instance_id_code_idx` (`instance_id`,`code`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
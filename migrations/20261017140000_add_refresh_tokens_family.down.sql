@@ -0,0 +1 @@
+ALTER TABLE `{{ index .Options "Namespace" }}refresh_tokens` DROP INDEX refresh_tokens_instance_id_parent_id_idx, DROP INDEX refresh_tokens_instance_id_family_id_idx, DROP `parent_id`, DROP `family_id`;
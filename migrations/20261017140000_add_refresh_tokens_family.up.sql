@@ -0,0 +1,4 @@
+ALTER TABLE `{{ index .Options "Namespace" }}refresh_tokens` ADD `family_id` varchar(255) DEFAULT NULL AFTER `user_id`, ADD `parent_id` bigint(20) DEFAULT NULL AFTER `family_id`;
+UPDATE `{{ index .Options "Namespace" }}refresh_tokens` SET `family_id` = UUID() WHERE `family_id` IS NULL;
+CREATE INDEX refresh_tokens_instance_id_family_id_idx ON `{{ index .Options "Namespace" }}refresh_tokens` (instance_id, family_id);
+CREATE INDEX refresh_tokens_instance_id_parent_id_idx ON `{{ index .Options "Namespace" }}refresh_tokens` (instance_id, parent_id);
@@ -0,0 +1 @@
+ALTER TABLE `{{ index .Options "Namespace" }}sessions` DROP `scope`, DROP `client_id`, DROP `nonce`;
@@ -0,0 +1,2 @@
+ALTER TABLE `{{ index .Options "Namespace" }}sessions` ADD `scope` text AFTER `aal`, ADD `client_id` varchar(255) DEFAULT NULL AFTER `scope`, ADD `nonce` varchar(255) DEFAULT NULL AFTER `client_id`;
+UPDATE `{{ index .Options "Namespace" }}sessions` SET `scope` = '', `client_id` = '', `nonce` = '';
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}service_accounts` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `client_id` varchar(255) NOT NULL,
+  `encrypted_secret` varchar(255) NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `aud` varchar(255) DEFAULT NULL,
+  `roles` json DEFAULT NULL,
+  `raw_app_meta_data` json DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `service_accounts_instance_id_idx` (`instance_id`),
+  UNIQUE KEY `service_accounts_instance_id_client_id_idx` (`instance_id`,`client_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
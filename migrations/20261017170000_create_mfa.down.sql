@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `{{ index .Options "Namespace" }}mfa_challenges`;
+DROP TABLE IF EXISTS `{{ index .Options "Namespace" }}mfa_factors`;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}mfa_factors` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `friendly_name` varchar(255) DEFAULT NULL,
+  `factor_type` varchar(255) NOT NULL,
+  `status` varchar(255) NOT NULL,
+  `secret` varchar(255) NOT NULL,
+  `last_used_step` bigint(20) NOT NULL DEFAULT 0,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `mfa_factors_instance_id_idx` (`instance_id`),
+  KEY `mfa_factors_instance_id_user_id_idx` (`instance_id`,`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}mfa_challenges` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `factor_id` varchar(255) NOT NULL,
+  `ip` varchar(255) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `verified_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `mfa_challenges_instance_id_idx` (`instance_id`),
+  KEY `mfa_challenges_instance_id_factor_id_idx` (`instance_id`,`factor_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}mfa_recovery_codes` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `code_hash` varchar(255) NOT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `mfa_recovery_codes_instance_id_idx` (`instance_id`),
+  KEY `mfa_recovery_codes_instance_id_user_id_idx` (`instance_id`,`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `{{ index .Options "Namespace" }}webauthn_challenges`;
+DROP TABLE IF EXISTS `{{ index .Options "Namespace" }}webauthn_credentials`;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}webauthn_credentials` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `credential_id` varchar(1024) NOT NULL,
+  `public_key` text NOT NULL,
+  `algorithm` bigint(20) NOT NULL,
+  `aaguid` varchar(255) DEFAULT NULL,
+  `sign_count` bigint(20) NOT NULL DEFAULT 0,
+  `friendly_name` varchar(255) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `last_used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `webauthn_credentials_instance_id_idx` (`instance_id`),
+  KEY `webauthn_credentials_instance_id_user_id_idx` (`instance_id`,`user_id`),
+  KEY `webauthn_credentials_instance_id_credential_id_idx` (`instance_id`,`credential_id`(255))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}webauthn_challenges` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) DEFAULT NULL,
+  `type` varchar(255) NOT NULL,
+  `challenge` varchar(255) NOT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `webauthn_challenges_instance_id_idx` (`instance_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
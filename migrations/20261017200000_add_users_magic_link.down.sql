@@ -0,0 +1 @@
+ALTER TABLE `{{ index .Options "Namespace" }}users` DROP `magic_link_token`, DROP `magic_link_sent_at`;
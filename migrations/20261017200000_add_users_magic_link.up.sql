@@ -0,0 +1 @@
+ALTER TABLE `{{ index .Options "Namespace" }}users` ADD `magic_link_token` varchar(255) DEFAULT NULL AFTER `recovery_sent_at`, ADD `magic_link_sent_at` timestamp NULL DEFAULT NULL AFTER `magic_link_token`;
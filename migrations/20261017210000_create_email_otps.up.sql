@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}email_otps` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `type` varchar(255) NOT NULL,
+  `otp_hash` varchar(255) NOT NULL,
+  `attempts` int(11) NOT NULL DEFAULT 0,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `email_otps_instance_id_idx` (`instance_id`),
+  KEY `email_otps_instance_id_user_id_type_idx` (`instance_id`,`user_id`,`type`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
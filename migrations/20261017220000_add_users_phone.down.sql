@@ -0,0 +1,2 @@
+DROP INDEX users_instance_id_phone_idx ON `{{ index .Options "Namespace" }}users`;
+ALTER TABLE `{{ index .Options "Namespace" }}users` DROP `phone`, DROP `phone_confirmed_at`, DROP `phone_otp`, DROP `phone_otp_sent_at`, DROP `phone_otp_attempts`;
@@ -0,0 +1,2 @@
+ALTER TABLE `{{ index .Options "Namespace" }}users` ADD `phone` varchar(32) DEFAULT NULL AFTER `magic_link_sent_at`, ADD `phone_confirmed_at` timestamp NULL DEFAULT NULL AFTER `phone`, ADD `phone_otp` varchar(255) DEFAULT NULL AFTER `phone_confirmed_at`, ADD `phone_otp_sent_at` timestamp NULL DEFAULT NULL AFTER `phone_otp`, ADD `phone_otp_attempts` int(11) NOT NULL DEFAULT 0 AFTER `phone_otp_sent_at`;
+CREATE INDEX users_instance_id_phone_idx ON `{{ index .Options "Namespace" }}users` (instance_id, phone);
@@ -0,0 +1,2 @@
+DROP INDEX users_instance_id_is_anonymous_idx ON `{{ index .Options "Namespace" }}users`;
+ALTER TABLE `{{ index .Options "Namespace" }}users` DROP `is_anonymous`;
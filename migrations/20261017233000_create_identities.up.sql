@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `{{ index .Options "Namespace" }}identities` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `provider` varchar(255) NOT NULL,
+  `provider_id` varchar(255) NOT NULL,
+  `identity_data` json DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `last_sign_in_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `identities_instance_id_idx` (`instance_id`),
+  KEY `identities_instance_id_user_id_idx` (`instance_id`,`user_id`),
+  UNIQUE KEY `identities_instance_id_provider_provider_id_idx` (`instance_id`,`provider`,`provider_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,2 @@
+ALTER TABLE `{{ index .Options "Namespace" }}identities` ADD `encrypted_provider_token` text AFTER `identity_data`;
+UPDATE `{{ index .Options "Namespace" }}identities` SET `encrypted_provider_token` = '';
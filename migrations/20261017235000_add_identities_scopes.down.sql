@@ -0,0 +1 @@
+ALTER TABLE `{{ index .Options "Namespace" }}identities` DROP `scopes`;
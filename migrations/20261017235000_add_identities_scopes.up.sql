@@ -0,0 +1,2 @@
+ALTER TABLE `{{ index .Options "Namespace" }}identities` ADD `scopes` text AFTER `encrypted_provider_token`;
+UPDATE `{{ index .Options "Namespace" }}identities` SET `scopes` = '';
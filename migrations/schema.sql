@@ -32,6 +32,54 @@ CREATE TABLE `audit_log_entries` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `email_otps`
+--
+
+DROP TABLE IF EXISTS `email_otps`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `email_otps` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `type` varchar(255) NOT NULL,
+  `otp_hash` varchar(255) NOT NULL,
+  `attempts` int(11) NOT NULL DEFAULT 0,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `email_otps_instance_id_idx` (`instance_id`),
+  KEY `email_otps_instance_id_user_id_type_idx` (`instance_id`,`user_id`,`type`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `identities`
+--
+
+DROP TABLE IF EXISTS `identities`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `identities` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `provider` varchar(255) NOT NULL,
+  `provider_id` varchar(255) NOT NULL,
+  `identity_data` json DEFAULT NULL,
+  `encrypted_provider_token` text,
+  `scopes` text,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `last_sign_in_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `identities_instance_id_idx` (`instance_id`),
+  KEY `identities_instance_id_user_id_idx` (`instance_id`,`user_id`),
+  UNIQUE KEY `identities_instance_id_provider_provider_id_idx` (`instance_id`,`provider`,`provider_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `instances`
 --
@@ -49,6 +97,121 @@ CREATE TABLE `instances` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `mfa_challenges`
+--
+
+DROP TABLE IF EXISTS `mfa_challenges`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `mfa_challenges` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `factor_id` varchar(255) NOT NULL,
+  `ip` varchar(255) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `verified_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `mfa_challenges_instance_id_idx` (`instance_id`),
+  KEY `mfa_challenges_instance_id_factor_id_idx` (`instance_id`,`factor_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `mfa_factors`
+--
+
+DROP TABLE IF EXISTS `mfa_factors`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `mfa_factors` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `friendly_name` varchar(255) DEFAULT NULL,
+  `factor_type` varchar(255) NOT NULL,
+  `status` varchar(255) NOT NULL,
+  `secret` varchar(255) NOT NULL,
+  `last_used_step` bigint(20) NOT NULL DEFAULT '0',
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `mfa_factors_instance_id_idx` (`instance_id`),
+  KEY `mfa_factors_instance_id_user_id_idx` (`instance_id`,`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `mfa_recovery_codes`
+--
+
+DROP TABLE IF EXISTS `mfa_recovery_codes`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `mfa_recovery_codes` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `code_hash` varchar(255) NOT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `mfa_recovery_codes_instance_id_idx` (`instance_id`),
+  KEY `mfa_recovery_codes_instance_id_user_id_idx` (`instance_id`,`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `oauth_authorization_codes`
+--
+
+DROP TABLE IF EXISTS `oauth_authorization_codes`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `oauth_authorization_codes` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `code` varchar(255) NOT NULL,
+  `client_id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `redirect_uri` text,
+  `scope` varchar(255) DEFAULT NULL,
+  `nonce` varchar(255) DEFAULT NULL,
+  `code_challenge` varchar(255) DEFAULT NULL,
+  `code_challenge_method` varchar(255) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `oauth_authorization_codes_instance_id_code_idx` (`instance_id`,`code`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `oauth_clients`
+--
+
+DROP TABLE IF EXISTS `oauth_clients`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `oauth_clients` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `client_id` varchar(255) NOT NULL,
+  `encrypted_secret` varchar(255) DEFAULT NULL,
+  `name` varchar(255) DEFAULT NULL,
+  `redirect_uris` json DEFAULT NULL,
+  `first_party` tinyint(1) DEFAULT NULL,
+  `confidential` tinyint(1) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `oauth_clients_instance_id_idx` (`instance_id`),
+  UNIQUE KEY `oauth_clients_instance_id_client_id_idx` (`instance_id`,`client_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `refresh_tokens`
 --
@@ -61,13 +224,19 @@ CREATE TABLE `refresh_tokens` (
   `id` bigint(20) NOT NULL AUTO_INCREMENT,
   `token` varchar(255) DEFAULT NULL,
   `user_id` varchar(255) DEFAULT NULL,
+  `family_id` varchar(255) DEFAULT NULL,
+  `parent_id` bigint(20) DEFAULT NULL,
+  `session_id` varchar(255) DEFAULT NULL,
   `revoked` tinyint(1) DEFAULT NULL,
   `created_at` timestamp NULL DEFAULT NULL,
   `updated_at` timestamp NULL DEFAULT NULL,
   PRIMARY KEY (`id`),
   KEY `refresh_tokens_instance_id_idx` (`instance_id`),
   KEY `refresh_tokens_instance_id_user_id_idx` (`instance_id`,`user_id`),
-  KEY `refresh_tokens_token_idx` (`token`)
+  KEY `refresh_tokens_token_idx` (`token`),
+  KEY `refresh_tokens_instance_id_family_id_idx` (`instance_id`,`family_id`),
+  KEY `refresh_tokens_instance_id_parent_id_idx` (`instance_id`,`parent_id`),
+  KEY `refresh_tokens_instance_id_session_id_idx` (`instance_id`,`session_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
@@ -84,6 +253,79 @@ CREATE TABLE `schema_migration` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `service_accounts`
+--
+
+DROP TABLE IF EXISTS `service_accounts`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `service_accounts` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `client_id` varchar(255) NOT NULL,
+  `encrypted_secret` varchar(255) NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `aud` varchar(255) DEFAULT NULL,
+  `roles` json DEFAULT NULL,
+  `raw_app_meta_data` json DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `service_accounts_instance_id_idx` (`instance_id`),
+  UNIQUE KEY `service_accounts_instance_id_client_id_idx` (`instance_id`,`client_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `sessions`
+--
+
+DROP TABLE IF EXISTS `sessions`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `sessions` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `ip` varchar(255) DEFAULT NULL,
+  `user_agent` text,
+  `authentication_method` varchar(255) DEFAULT NULL,
+  `aal` varchar(255) DEFAULT NULL,
+  `scope` text,
+  `client_id` varchar(255) DEFAULT NULL,
+  `nonce` varchar(255) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `refreshed_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `sessions_instance_id_idx` (`instance_id`),
+  KEY `sessions_instance_id_user_id_idx` (`instance_id`,`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `signing_keys`
+--
+
+DROP TABLE IF EXISTS `signing_keys`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `signing_keys` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `kid` varchar(255) NOT NULL,
+  `algorithm` varchar(255) NOT NULL,
+  `private_key` text NOT NULL,
+  `state` varchar(255) NOT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `signing_keys_instance_id_idx` (`instance_id`),
+  KEY `signing_keys_instance_id_kid_idx` (`instance_id`,`kid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `users`
 --
@@ -104,6 +346,13 @@ CREATE TABLE `users` (
   `confirmation_sent_at` timestamp NULL DEFAULT NULL,
   `recovery_token` varchar(255) DEFAULT NULL,
   `recovery_sent_at` timestamp NULL DEFAULT NULL,
+  `magic_link_token` varchar(255) DEFAULT NULL,
+  `magic_link_sent_at` timestamp NULL DEFAULT NULL,
+  `phone` varchar(32) DEFAULT NULL,
+  `phone_confirmed_at` timestamp NULL DEFAULT NULL,
+  `phone_otp` varchar(255) DEFAULT NULL,
+  `phone_otp_sent_at` timestamp NULL DEFAULT NULL,
+  `phone_otp_attempts` int(11) NOT NULL DEFAULT 0,
   `email_change_token` varchar(255) DEFAULT NULL,
   `email_change` varchar(255) DEFAULT NULL,
   `email_change_sent_at` timestamp NULL DEFAULT NULL,
@@ -111,11 +360,61 @@ CREATE TABLE `users` (
   `raw_app_meta_data` json DEFAULT NULL,
   `raw_user_meta_data` json DEFAULT NULL,
   `is_super_admin` tinyint(1) DEFAULT NULL,
+  `is_anonymous` tinyint(1) NOT NULL DEFAULT 0,
   `created_at` timestamp NULL DEFAULT NULL,
   `updated_at` timestamp NULL DEFAULT NULL,
   PRIMARY KEY (`id`),
   KEY `users_instance_id_idx` (`instance_id`),
-  KEY `users_instance_id_email_idx` (`instance_id`,`email`)
+  KEY `users_instance_id_email_idx` (`instance_id`,`email`),
+  KEY `users_instance_id_phone_idx` (`instance_id`,`phone`),
+  KEY `users_instance_id_is_anonymous_idx` (`instance_id`,`is_anonymous`,`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `webauthn_challenges`
+--
+
+DROP TABLE IF EXISTS `webauthn_challenges`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `webauthn_challenges` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) DEFAULT NULL,
+  `type` varchar(255) NOT NULL,
+  `challenge` varchar(255) NOT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `webauthn_challenges_instance_id_idx` (`instance_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `webauthn_credentials`
+--
+
+DROP TABLE IF EXISTS `webauthn_credentials`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `webauthn_credentials` (
+  `instance_id` varchar(255) DEFAULT NULL,
+  `id` varchar(255) NOT NULL,
+  `user_id` varchar(255) NOT NULL,
+  `credential_id` varchar(1024) NOT NULL,
+  `public_key` text NOT NULL,
+  `algorithm` bigint(20) NOT NULL,
+  `aaguid` varchar(255) DEFAULT NULL,
+  `sign_count` bigint(20) NOT NULL DEFAULT 0,
+  `friendly_name` varchar(255) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT NULL,
+  `updated_at` timestamp NULL DEFAULT NULL,
+  `last_used_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `webauthn_credentials_instance_id_idx` (`instance_id`),
+  KEY `webauthn_credentials_instance_id_user_id_idx` (`instance_id`,`user_id`),
+  KEY `webauthn_credentials_instance_id_credential_id_idx` (`instance_id`,`credential_id`(255))
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 /*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
@@ -15,16 +15,39 @@ type AuditAction string
 type auditLogType string
 
 const (
-	LoginAction                 AuditAction = "login"
-	LogoutAction                AuditAction = "logout"
-	InviteAcceptedAction        AuditAction = "invite_accepted"
-	UserSignedUpAction          AuditAction = "user_signedup"
-	UserInvitedAction           AuditAction = "user_invited"
-	UserDeletedAction           AuditAction = "user_deleted"
-	UserModifiedAction          AuditAction = "user_modified"
-	UserRecoveryRequestedAction AuditAction = "user_recovery_requested"
-	TokenRevokedAction          AuditAction = "token_revoked"
-	TokenRefreshedAction        AuditAction = "token_refreshed"
+	LoginAction                  AuditAction = "login"
+	LogoutAction                 AuditAction = "logout"
+	InviteAcceptedAction         AuditAction = "invite_accepted"
+	UserSignedUpAction           AuditAction = "user_signedup"
+	UserInvitedAction            AuditAction = "user_invited"
+	UserDeletedAction            AuditAction = "user_deleted"
+	UserModifiedAction           AuditAction = "user_modified"
+	AnonymousUsersPurgedAction   AuditAction = "anonymous_users_purged"
+	UserRecoveryRequestedAction  AuditAction = "user_recovery_requested"
+	UserMagicLinkRequestedAction AuditAction = "user_magiclink_requested"
+	UserOTPRequestedAction       AuditAction = "user_otp_requested"
+	TokenRevokedAction           AuditAction = "token_revoked"
+	TokenRefreshedAction         AuditAction = "token_refreshed"
+	TokenReusedAction            AuditAction = "token_reused"
+	SessionRevokedAction         AuditAction = "session_revoked"
+	ServiceAccountCreatedAction  AuditAction = "service_account_created"
+	ServiceAccountModifiedAction AuditAction = "service_account_modified"
+	ServiceAccountDeletedAction  AuditAction = "service_account_deleted"
+	ServiceAccountTokenAction    AuditAction = "service_account_token_issued"
+	SigningKeysRotatedAction     AuditAction = "signing_keys_rotated"
+	SigningKeyDeletedAction      AuditAction = "signing_key_deleted"
+	OAuthClientCreatedAction     AuditAction = "oauth_client_created"
+	OAuthClientModifiedAction    AuditAction = "oauth_client_modified"
+	OAuthClientDeletedAction     AuditAction = "oauth_client_deleted"
+	FactorEnrolledAction         AuditAction = "factor_enrolled"
+	FactorUnenrolledAction       AuditAction = "factor_unenrolled"
+	FactorVerifiedAction         AuditAction = "factor_verified"
+	RecoveryCodesGeneratedAction AuditAction = "recovery_codes_generated"
+	RecoveryCodeUsedAction       AuditAction = "recovery_code_used"
+	WebAuthnRegisteredAction     AuditAction = "webauthn_credential_registered"
+	WebAuthnDeletedAction        AuditAction = "webauthn_credential_deleted"
+	IdentityLinkedAction         AuditAction = "identity_linked"
+	IdentityUnlinkedAction       AuditAction = "identity_unlinked"
 
 	account auditLogType = "account"
 	team    auditLogType = "team"
@@ -33,16 +56,39 @@ const (
 )
 
 var actionLogTypeMap = map[AuditAction]auditLogType{
-	LoginAction:                 account,
-	LogoutAction:                account,
-	InviteAcceptedAction:        account,
-	UserSignedUpAction:          team,
-	UserInvitedAction:           team,
-	UserDeletedAction:           team,
-	TokenRevokedAction:          token,
-	TokenRefreshedAction:        token,
-	UserModifiedAction:          user,
-	UserRecoveryRequestedAction: user,
+	LoginAction:                  account,
+	LogoutAction:                 account,
+	InviteAcceptedAction:         account,
+	UserSignedUpAction:           team,
+	UserInvitedAction:            team,
+	UserDeletedAction:            team,
+	AnonymousUsersPurgedAction:   team,
+	TokenRevokedAction:           token,
+	TokenRefreshedAction:         token,
+	TokenReusedAction:            token,
+	SessionRevokedAction:         account,
+	ServiceAccountCreatedAction:  team,
+	ServiceAccountModifiedAction: team,
+	ServiceAccountDeletedAction:  team,
+	ServiceAccountTokenAction:    token,
+	SigningKeysRotatedAction:     token,
+	SigningKeyDeletedAction:      token,
+	OAuthClientCreatedAction:     team,
+	OAuthClientModifiedAction:    team,
+	OAuthClientDeletedAction:     team,
+	FactorVerifiedAction:         account,
+	RecoveryCodeUsedAction:       account,
+	FactorEnrolledAction:         user,
+	FactorUnenrolledAction:       user,
+	RecoveryCodesGeneratedAction: user,
+	WebAuthnRegisteredAction:     user,
+	WebAuthnDeletedAction:        user,
+	IdentityLinkedAction:         user,
+	IdentityUnlinkedAction:       user,
+	UserModifiedAction:           user,
+	UserRecoveryRequestedAction:  user,
+	UserMagicLinkRequestedAction: user,
+	UserOTPRequestedAction:       user,
 }
 
 // AuditLogEntry is the database model for audit log entries.
@@ -66,6 +112,26 @@ func (AuditLogEntry) TableName() string {
 }
 
 func NewAuditLogEntry(tx *storage.Connection, instanceID uuid.UUID, actor *User, action AuditAction, traits map[string]interface{}) error {
+	payload := JSONMap{
+		"actor_id":    actor.ID,
+		"actor_email": actor.Email,
+	}
+	if name, ok := actor.UserMetaData["full_name"]; ok {
+		payload["actor_name"] = name
+	}
+	return createAuditLogEntry(tx, instanceID, payload, action, traits)
+}
+
+// NewServiceAccountAuditLogEntry records an action of a service account.
+func NewServiceAccountAuditLogEntry(tx *storage.Connection, instanceID uuid.UUID, actor *ServiceAccount, action AuditAction, traits map[string]interface{}) error {
+	return createAuditLogEntry(tx, instanceID, JSONMap{
+		"actor_id":   actor.ID,
+		"actor_name": actor.Name,
+		"actor_type": "service_account",
+	}, action, traits)
+}
+
+func createAuditLogEntry(tx *storage.Connection, instanceID uuid.UUID, payload JSONMap, action AuditAction, traits map[string]interface{}) error {
 	id, err := uuid.NewV4()
 	if err != nil {
 		return errors.Wrap(err, "Error generating unique id")
@@ -73,18 +139,11 @@ func NewAuditLogEntry(tx *storage.Connection, instanceID uuid.UUID, actor *User,
 	l := AuditLogEntry{
 		InstanceID: instanceID,
 		ID:         id,
-		Payload: JSONMap{
-			"timestamp":   time.Now().UTC().Format(time.RFC3339),
-			"actor_id":    actor.ID,
-			"actor_email": actor.Email,
-			"action":      action,
-			"log_type":    actionLogTypeMap[action],
-		},
-	}
-
-	if name, ok := actor.UserMetaData["full_name"]; ok {
-		l.Payload["actor_name"] = name
+		Payload:    payload,
 	}
+	l.Payload["timestamp"] = time.Now().UTC().Format(time.RFC3339)
+	l.Payload["action"] = action
+	l.Payload["log_type"] = actionLogTypeMap[action]
 
 	if traits != nil {
 		l.Payload["traits"] = traits
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// CodeChallengeS256 is the only supported PKCE code challenge method.
+const CodeChallengeS256 = "S256"
+
+// authorizationCodeLifetime is how long a code can be exchanged for tokens.
+const authorizationCodeLifetime = 10 * time.Minute
+
+// AuthorizationCode is the database model for codes issued by the authorization code flow.
+type AuthorizationCode struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+
+	Code                string    `db:"code"`
+	ClientID            uuid.UUID `db:"client_id"`
+	UserID              uuid.UUID `db:"user_id"`
+	RedirectURI         string    `db:"redirect_uri"`
+	Scope               string    `db:"scope"`
+	Nonce               string    `db:"nonce"`
+	CodeChallenge       string    `db:"code_challenge"`
+	CodeChallengeMethod string    `db:"code_challenge_method"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func (AuthorizationCode) TableName() string {
+	tableName := "oauth_authorization_codes"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewAuthorizationCode initializes a new code granted by user to client.
+func NewAuthorizationCode(client *OAuthClient, user *User, redirectURI, scope, nonce, codeChallenge string) (*AuthorizationCode, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &AuthorizationCode{
+		InstanceID:          client.InstanceID,
+		ID:                  id,
+		Code:                crypto.SecureToken(),
+		ClientID:            client.ID,
+		UserID:              user.ID,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		Nonce:               nonce,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: CodeChallengeS256,
+	}, nil
+}
+
+// Expired returns whether the code is too old to be exchanged.
+func (c *AuthorizationCode) Expired() bool {
+	return time.Now().After(c.CreatedAt.Add(authorizationCodeLifetime))
+}
+
+// VerifyCodeVerifier checks a PKCE code verifier against the challenge the code was issued with.
+func (c *AuthorizationCode) VerifyCodeVerifier(verifier string) bool {
+	if c.CodeChallengeMethod != CodeChallengeS256 || verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := strings.TrimRight(base64.URLEncoding.EncodeToString(sum[:]), "=")
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(c.CodeChallenge)) == 1
+}
+
+// FindAuthorizationCode finds an authorization code of an instance.
+func FindAuthorizationCode(tx *storage.Connection, instanceID uuid.UUID, code string) (*AuthorizationCode, error) {
+	if strings.TrimSpace(code) == "" {
+		return nil, AuthorizationCodeNotFoundError{}
+	}
+
+	obj := &AuthorizationCode{}
+	if err := tx.Q().Where("instance_id = ? and code = ?", instanceID, code).First(obj); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, AuthorizationCodeNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding authorization code")
+	}
+	return obj, nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// Challenge is the database model for an attempt to verify a factor.
+type Challenge struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	FactorID   uuid.UUID `json:"factor_id" db:"factor_id"`
+
+	IP string `json:"-" db:"ip"`
+
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"-" db:"updated_at"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty" db:"verified_at"`
+}
+
+func (Challenge) TableName() string {
+	tableName := "mfa_challenges"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewChallenge initializes a new challenge of factor.
+func NewChallenge(factor *Factor, ip string) (*Challenge, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &Challenge{
+		InstanceID: factor.InstanceID,
+		ID:         id,
+		FactorID:   factor.ID,
+		IP:         ip,
+	}, nil
+}
+
+// ExpiresAt returns when the challenge can no longer be verified.
+func (c *Challenge) ExpiresAt(expirySeconds int) time.Time {
+	return c.CreatedAt.Add(time.Second * time.Duration(expirySeconds))
+}
+
+// HasExpired returns whether the challenge is too old to be verified.
+func (c *Challenge) HasExpired(expirySeconds int) bool {
+	return time.Now().After(c.ExpiresAt(expirySeconds))
+}
+
+// Verify marks the challenge as verified, so that it can't be used again.
+func (c *Challenge) Verify(tx *storage.Connection) error {
+	now := time.Now()
+	c.VerifiedAt = &now
+	return tx.UpdateOnly(c, "verified_at")
+}
+
+// FindChallengeForUpdate finds a challenge of a factor and locks it until
+// the transaction tx ends, so that it is only verified once.
+func FindChallengeForUpdate(tx *storage.Connection, instanceID, factorID, id uuid.UUID) (*Challenge, error) {
+	challenge := &Challenge{}
+	query := "SELECT * FROM " + (&pop.Model{Value: Challenge{}}).TableName() + " WHERE instance_id = ? AND factor_id = ? AND id = ? FOR UPDATE"
+	if err := tx.RawQuery(query, instanceID, factorID, id).First(challenge); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ChallengeNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding challenge")
+	}
+	return challenge, nil
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChallengeHasExpired(t *testing.T) {
+	c := &Challenge{CreatedAt: time.Now().Add(-time.Minute)}
+	assert.False(t, c.HasExpired(300))
+	assert.True(t, c.HasExpired(30))
+	assert.Equal(t, c.CreatedAt.Add(5*time.Minute), c.ExpiresAt(300))
+}
@@ -41,6 +41,42 @@ func TruncateAll(conn *storage.Connection) error {
 		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: AuditLogEntry{}}).TableName()).Exec(); err != nil {
 			return err
 		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: SigningKey{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: OAuthClient{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: AuthorizationCode{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: Session{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: ServiceAccount{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: Factor{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: Challenge{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: RecoveryCode{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: WebAuthnCredential{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: WebAuthnChallenge{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: EmailOTP{}}).TableName()).Exec(); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("TRUNCATE " + (&pop.Model{Value: Identity{}}).TableName()).Exec(); err != nil {
+			return err
+		}
 		return tx.RawQuery("TRUNCATE " + (&pop.Model{Value: Instance{}}).TableName()).Exec()
 	})
 }
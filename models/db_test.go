@@ -14,9 +14,21 @@ func TestTableNameNamespacing(t *testing.T) {
 		value    interface{}
 	}{
 		{expected: "test_audit_log_entries", value: []*models.AuditLogEntry{}},
+		{expected: "test_email_otps", value: []*models.EmailOTP{}},
+		{expected: "test_identities", value: []*models.Identity{}},
 		{expected: "test_instances", value: []*models.Instance{}},
+		{expected: "test_mfa_challenges", value: []*models.Challenge{}},
+		{expected: "test_mfa_factors", value: []*models.Factor{}},
+		{expected: "test_mfa_recovery_codes", value: []*models.RecoveryCode{}},
+		{expected: "test_oauth_authorization_codes", value: []*models.AuthorizationCode{}},
+		{expected: "test_oauth_clients", value: []*models.OAuthClient{}},
 		{expected: "test_refresh_tokens", value: []*models.RefreshToken{}},
+		{expected: "test_service_accounts", value: []*models.ServiceAccount{}},
+		{expected: "test_sessions", value: []*models.Session{}},
+		{expected: "test_signing_keys", value: []*models.SigningKey{}},
 		{expected: "test_users", value: []*models.User{}},
+		{expected: "test_webauthn_challenges", value: []*models.WebAuthnChallenge{}},
+		{expected: "test_webauthn_credentials", value: []*models.WebAuthnCredential{}},
 	}
 
 	for _, tc := range cases {
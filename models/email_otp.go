@@ -0,0 +1,109 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// EmailOTPDigits is the length of email one-time passcodes.
+const EmailOTPDigits = 6
+
+// EmailOTP is the database model for a one-time passcode sent by email next
+// to a confirmation, recovery or magic link. Only a hash of the code is
+// stored, and it's invalidated after too many wrong attempts.
+type EmailOTP struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	UserID     uuid.UUID `json:"-" db:"user_id"`
+
+	// Type is the verification type the code is for.
+	Type     string `json:"type" db:"type"`
+	OTPHash  string `json:"-" db:"otp_hash"`
+	Attempts int    `json:"-" db:"attempts"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (EmailOTP) TableName() string {
+	tableName := "email_otps"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// hashEmailOTP binds the hash to the user and type of the code.
+func hashEmailOTP(userID uuid.UUID, otpType, otp string) string {
+	sum := sha256.Sum256([]byte(userID.String() + ":" + otpType + ":" + strings.TrimSpace(otp)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateEmailOTP replaces the code of a type of a user with a new one,
+// which is returned in plain text this one time.
+func GenerateEmailOTP(tx *storage.Connection, user *User, otpType string) (string, error) {
+	if err := deleteEmailOTPs(tx, user.InstanceID, user.ID, otpType); err != nil {
+		return "", err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", errors.Wrap(err, "Error generating unique id")
+	}
+	otp := crypto.GenerateOTP(EmailOTPDigits)
+	err = tx.Create(&EmailOTP{
+		InstanceID: user.InstanceID,
+		ID:         id,
+		UserID:     user.ID,
+		Type:       otpType,
+		OTPHash:    hashEmailOTP(user.ID, otpType, otp),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error creating email otp")
+	}
+	return otp, nil
+}
+
+// Matches checks an entered code against the stored hash.
+func (o *EmailOTP) Matches(otp string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashEmailOTP(o.UserID, o.Type, otp)), []byte(o.OTPHash)) == 1
+}
+
+// IncrementAttempts records a wrong code. Read the code with
+// FindEmailOTPForUpdate so concurrent guesses all count.
+func (o *EmailOTP) IncrementAttempts(tx *storage.Connection) error {
+	o.Attempts++
+	return tx.UpdateOnly(o, "attempts", "updated_at")
+}
+
+// FindEmailOTPForUpdate finds the code of a type of a user and locks it until
+// the transaction tx ends, so that guesses are checked one after the other.
+func FindEmailOTPForUpdate(tx *storage.Connection, instanceID, userID uuid.UUID, otpType string) (*EmailOTP, error) {
+	otp := &EmailOTP{}
+	query := "SELECT * FROM " + (&pop.Model{Value: EmailOTP{}}).TableName() + " WHERE instance_id = ? AND user_id = ? AND type = ? FOR UPDATE"
+	if err := tx.RawQuery(query, instanceID, userID, otpType).First(otp); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, EmailOTPNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding email otp")
+	}
+	return otp, nil
+}
+
+func deleteEmailOTPs(tx *storage.Connection, instanceID, userID uuid.UUID, otpType string) error {
+	err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: EmailOTP{}}).TableName()+" WHERE instance_id = ? AND user_id = ? AND type = ?", instanceID, userID, otpType).Exec()
+	return errors.Wrap(err, "error deleting email otps")
+}
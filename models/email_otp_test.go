@@ -0,0 +1,23 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailOTPMatches(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	otp := &EmailOTP{UserID: userID, Type: "signup", OTPHash: hashEmailOTP(userID, "signup", "123456")}
+
+	assert.True(t, otp.Matches("123456"))
+	assert.True(t, otp.Matches(" 123456 "))
+	assert.False(t, otp.Matches("654321"))
+
+	// the hash is bound to the user and type
+	other := &EmailOTP{UserID: uuid.Must(uuid.NewV4()), Type: "signup", OTPHash: otp.OTPHash}
+	assert.False(t, other.Matches("123456"))
+	recovery := &EmailOTP{UserID: userID, Type: "recovery", OTPHash: otp.OTPHash}
+	assert.False(t, recovery.Matches("123456"))
+}
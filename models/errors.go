@@ -9,6 +9,30 @@ func IsNotFoundError(err error) bool {
 		return true
 	case InstanceNotFoundError:
 		return true
+	case SigningKeyNotFoundError:
+		return true
+	case OAuthClientNotFoundError:
+		return true
+	case AuthorizationCodeNotFoundError:
+		return true
+	case SessionNotFoundError:
+		return true
+	case ServiceAccountNotFoundError:
+		return true
+	case FactorNotFoundError:
+		return true
+	case ChallengeNotFoundError:
+		return true
+	case RecoveryCodeNotFoundError:
+		return true
+	case WebAuthnCredentialNotFoundError:
+		return true
+	case WebAuthnChallengeNotFoundError:
+		return true
+	case EmailOTPNotFoundError:
+		return true
+	case IdentityNotFoundError:
+		return true
 	}
 	return false
 }
@@ -33,3 +57,87 @@ type InstanceNotFoundError struct{}
 func (e InstanceNotFoundError) Error() string {
 	return "Instance not found"
 }
+
+// SigningKeyNotFoundError represents when a signing key is not found.
+type SigningKeyNotFoundError struct{}
+
+func (e SigningKeyNotFoundError) Error() string {
+	return "Signing key not found"
+}
+
+// OAuthClientNotFoundError represents when an OAuth client is not found.
+type OAuthClientNotFoundError struct{}
+
+func (e OAuthClientNotFoundError) Error() string {
+	return "OAuth client not found"
+}
+
+// AuthorizationCodeNotFoundError represents when an authorization code is not found.
+type AuthorizationCodeNotFoundError struct{}
+
+func (e AuthorizationCodeNotFoundError) Error() string {
+	return "Authorization code not found"
+}
+
+// SessionNotFoundError represents when a session is not found.
+type SessionNotFoundError struct{}
+
+func (e SessionNotFoundError) Error() string {
+	return "Session not found"
+}
+
+// ServiceAccountNotFoundError represents when a service account is not found.
+type ServiceAccountNotFoundError struct{}
+
+func (e ServiceAccountNotFoundError) Error() string {
+	return "Service account not found"
+}
+
+// FactorNotFoundError represents when a factor is not found.
+type FactorNotFoundError struct{}
+
+func (e FactorNotFoundError) Error() string {
+	return "Factor not found"
+}
+
+// ChallengeNotFoundError represents when a challenge is not found.
+type ChallengeNotFoundError struct{}
+
+func (e ChallengeNotFoundError) Error() string {
+	return "Challenge not found"
+}
+
+// RecoveryCodeNotFoundError represents when an unused recovery code is not found.
+type RecoveryCodeNotFoundError struct{}
+
+func (e RecoveryCodeNotFoundError) Error() string {
+	return "Recovery code not found"
+}
+
+// WebAuthnCredentialNotFoundError represents when a WebAuthn credential is not found.
+type WebAuthnCredentialNotFoundError struct{}
+
+func (e WebAuthnCredentialNotFoundError) Error() string {
+	return "WebAuthn credential not found"
+}
+
+// WebAuthnChallengeNotFoundError represents when a WebAuthn challenge is not found.
+type WebAuthnChallengeNotFoundError struct{}
+
+func (e WebAuthnChallengeNotFoundError) Error() string {
+	return "WebAuthn challenge not found"
+}
+
+// EmailOTPNotFoundError represents when an email one-time passcode is not found.
+type EmailOTPNotFoundError struct{}
+
+func (e EmailOTPNotFoundError) Error() string {
+	return "One-time passcode not found"
+}
+
+// IdentityNotFoundError represents when an identity is not found.
+type IdentityNotFoundError struct{}
+
+func (e IdentityNotFoundError) Error() string {
+	return "Identity not found"
+}
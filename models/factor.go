@@ -0,0 +1,128 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// FactorTypeTOTP is a factor of time-based one-time passwords (RFC 6238).
+const FactorTypeTOTP = "totp"
+
+// Statuses of a factor. Factors are unverified until the user proved to own
+// them by verifying a first challenge.
+const (
+	FactorStatusUnverified = "unverified"
+	FactorStatusVerified   = "verified"
+)
+
+// Factor is the database model for a second authentication factor of a user.
+type Factor struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	UserID     uuid.UUID `json:"-" db:"user_id"`
+
+	FriendlyName string `json:"friendly_name" db:"friendly_name"`
+	FactorType   string `json:"factor_type" db:"factor_type"`
+	Status       string `json:"status" db:"status"`
+	Secret       string `json:"-" db:"secret"`
+
+	// LastUsedStep is the TOTP time step of the last accepted code, which
+	// can't be used again.
+	LastUsedStep int64 `json:"-" db:"last_used_step"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (Factor) TableName() string {
+	tableName := "mfa_factors"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewFactor initializes a new unverified factor of user.
+func NewFactor(user *User, friendlyName, factorType, secret string) (*Factor, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &Factor{
+		InstanceID:   user.InstanceID,
+		ID:           id,
+		UserID:       user.ID,
+		FriendlyName: friendlyName,
+		FactorType:   factorType,
+		Status:       FactorStatusUnverified,
+		Secret:       secret,
+	}, nil
+}
+
+// IsVerified returns whether the factor can be used to sign in.
+func (f *Factor) IsVerified() bool {
+	return f.Status == FactorStatusVerified
+}
+
+// UpdateLastUsedStep records the time step of an accepted code and marks the
+// factor as verified.
+func (f *Factor) UpdateLastUsedStep(tx *storage.Connection, step int64) error {
+	f.LastUsedStep = step
+	f.Status = FactorStatusVerified
+	return tx.UpdateOnly(f, "last_used_step", "status", "updated_at")
+}
+
+// FindFactorByUserIDAndID finds a factor of a user.
+func FindFactorByUserIDAndID(tx *storage.Connection, instanceID, userID, id uuid.UUID) (*Factor, error) {
+	factor := &Factor{}
+	if err := tx.Q().Where("instance_id = ? and user_id = ? and id = ?", instanceID, userID, id).First(factor); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, FactorNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding factor")
+	}
+	return factor, nil
+}
+
+// FindFactorForUpdate finds a factor of a user and locks it until the
+// transaction tx ends, so that a code is only accepted once.
+func FindFactorForUpdate(tx *storage.Connection, instanceID, userID, id uuid.UUID) (*Factor, error) {
+	factor := &Factor{}
+	query := "SELECT * FROM " + (&pop.Model{Value: Factor{}}).TableName() + " WHERE instance_id = ? AND user_id = ? AND id = ? FOR UPDATE"
+	if err := tx.RawQuery(query, instanceID, userID, id).First(factor); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, FactorNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding factor")
+	}
+	return factor, nil
+}
+
+// FindFactorsByUserID returns the factors of a user, oldest first.
+func FindFactorsByUserID(tx *storage.Connection, instanceID, userID uuid.UUID) ([]*Factor, error) {
+	factors := []*Factor{}
+	err := tx.Q().Where("instance_id = ? and user_id = ?", instanceID, userID).Order("created_at asc").All(&factors)
+	return factors, errors.Wrap(err, "error finding factors")
+}
+
+// HasVerifiedFactors returns whether a user enrolled a second factor.
+func HasVerifiedFactors(tx *storage.Connection, instanceID, userID uuid.UUID) (bool, error) {
+	return tx.Q().Where("instance_id = ? and user_id = ? and status = ?", instanceID, userID, FactorStatusVerified).Exists(&Factor{})
+}
+
+// DeleteFactor deletes a factor and its challenges.
+func DeleteFactor(tx *storage.Connection, factor *Factor) error {
+	if err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: Challenge{}}).TableName()+" WHERE instance_id = ? AND factor_id = ?", factor.InstanceID, factor.ID).Exec(); err != nil {
+		return errors.Wrap(err, "error deleting challenges")
+	}
+	return errors.Wrap(tx.Destroy(factor), "error deleting factor")
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// Identity is the database model for an external account linked to a user.
+type Identity struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+
+	Provider string `json:"provider" db:"provider"`
+	// ProviderID is the ID of the account at the provider.
+	ProviderID   string  `json:"provider_id" db:"provider_id"`
+	IdentityData JSONMap `json:"identity_data" db:"identity_data"`
+	// EncryptedProviderToken is the last token the provider issued for the
+	// account, see SetProviderToken.
+	EncryptedProviderToken string `json:"-" db:"encrypted_provider_token"`
+	// Scopes are the scopes last granted for the account, separated by
+	// spaces.
+	Scopes string `json:"scopes,omitempty" db:"scopes"`
+
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+	LastSignInAt *time.Time `json:"last_sign_in_at,omitempty" db:"last_sign_in_at"`
+}
+
+func (Identity) TableName() string {
+	tableName := "identities"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewIdentity initializes a new identity of user at provider.
+func NewIdentity(user *User, provider, providerID string, identityData map[string]interface{}) (*Identity, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	now := time.Now()
+	return &Identity{
+		InstanceID:   user.InstanceID,
+		ID:           id,
+		UserID:       user.ID,
+		Provider:     provider,
+		ProviderID:   providerID,
+		IdentityData: identityData,
+		LastSignInAt: &now,
+	}, nil
+}
+
+// UpdateSignIn records a sign-in with the identity and merges the data the
+// provider returned for it, as some providers only return parts of it on the
+// first sign-in.
+func (i *Identity) UpdateSignIn(tx *storage.Connection, identityData map[string]interface{}) error {
+	now := time.Now()
+	if i.IdentityData == nil {
+		i.IdentityData = make(map[string]interface{})
+	}
+	for k, v := range identityData {
+		i.IdentityData[k] = v
+	}
+	i.LastSignInAt = &now
+	return tx.UpdateOnly(i, "identity_data", "last_sign_in_at", "updated_at")
+}
+
+// SetScopes records the scopes granted for the account.
+func (i *Identity) SetScopes(tx *storage.Connection, scopes []string) error {
+	i.Scopes = strings.Join(scopes, " ")
+	return tx.UpdateOnly(i, "scopes", "updated_at")
+}
+
+// ProviderToken is a token a provider issued for the account of an identity.
+type ProviderToken struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// SetProviderToken stores the token of the provider encrypted with key.
+func (i *Identity) SetProviderToken(tx *storage.Connection, key []byte, token *ProviderToken) error {
+	plaintext, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "error encoding provider token")
+	}
+	encrypted, err := crypto.Encrypt(key, plaintext, i.ID.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "error encrypting provider token")
+	}
+	i.EncryptedProviderToken = encrypted
+	return tx.UpdateOnly(i, "encrypted_provider_token", "updated_at")
+}
+
+// ProviderToken decrypts the stored token of the provider with key. It
+// returns nil if no token is stored.
+func (i *Identity) ProviderToken(key []byte) (*ProviderToken, error) {
+	if i.EncryptedProviderToken == "" {
+		return nil, nil
+	}
+	plaintext, err := crypto.Decrypt(key, i.EncryptedProviderToken, i.ID.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting provider token")
+	}
+	token := &ProviderToken{}
+	if err := json.Unmarshal(plaintext, token); err != nil {
+		return nil, errors.Wrap(err, "error decoding provider token")
+	}
+	return token, nil
+}
+
+// FindIdentityByProviderID finds the identity of an account at provider.
+func FindIdentityByProviderID(tx *storage.Connection, instanceID uuid.UUID, provider, providerID string) (*Identity, error) {
+	return findIdentity(tx, "instance_id = ? and provider = ? and provider_id = ?", instanceID, provider, providerID)
+}
+
+// FindIdentityByUserIDAndID finds an identity of a user.
+func FindIdentityByUserIDAndID(tx *storage.Connection, instanceID, userID, id uuid.UUID) (*Identity, error) {
+	return findIdentity(tx, "instance_id = ? and user_id = ? and id = ?", instanceID, userID, id)
+}
+
+// FindIdentityForUpdate finds an identity of a user and locks it until the
+// transaction tx ends.
+func FindIdentityForUpdate(tx *storage.Connection, instanceID, userID, id uuid.UUID) (*Identity, error) {
+	identity := &Identity{}
+	query := "SELECT * FROM " + (&pop.Model{Value: Identity{}}).TableName() + " WHERE instance_id = ? AND user_id = ? AND id = ? FOR UPDATE"
+	if err := tx.RawQuery(query, instanceID, userID, id).First(identity); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, IdentityNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding identity")
+	}
+	return identity, nil
+}
+
+func findIdentity(tx *storage.Connection, query string, args ...interface{}) (*Identity, error) {
+	identity := &Identity{}
+	if err := tx.Q().Where(query, args...).First(identity); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, IdentityNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding identity")
+	}
+	return identity, nil
+}
+
+// FindIdentitiesByUserID returns the identities of a user, oldest first.
+func FindIdentitiesByUserID(tx *storage.Connection, instanceID, userID uuid.UUID) ([]*Identity, error) {
+	identities := []*Identity{}
+	err := tx.Q().Where("instance_id = ? and user_id = ?", instanceID, userID).Order("created_at asc").All(&identities)
+	return identities, errors.Wrap(err, "error finding identities")
+}
+
+// CountIdentitiesByUserID returns how many identities a user has.
+func CountIdentitiesByUserID(tx *storage.Connection, instanceID, userID uuid.UUID) (int, error) {
+	count, err := tx.Q().Where("instance_id = ? and user_id = ?", instanceID, userID).Count(&Identity{})
+	return count, errors.Wrap(err, "error counting identities")
+}
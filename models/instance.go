@@ -78,8 +78,20 @@ func GetInstanceByUUID(tx *storage.Connection, uuid uuid.UUID) (*Instance, error
 func DeleteInstance(conn *storage.Connection, instance *Instance) error {
 	return conn.Transaction(func(tx *storage.Connection) error {
 		delModels := map[string]*pop.Model{
-			"user":          {Value: &User{}},
-			"refresh token": {Value: &RefreshToken{}},
+			"user":                {Value: &User{}},
+			"refresh token":       {Value: &RefreshToken{}},
+			"signing key":         {Value: &SigningKey{}},
+			"oauth client":        {Value: &OAuthClient{}},
+			"authorization code":  {Value: &AuthorizationCode{}},
+			"session":             {Value: &Session{}},
+			"service account":     {Value: &ServiceAccount{}},
+			"factor":              {Value: &Factor{}},
+			"challenge":           {Value: &Challenge{}},
+			"recovery code":       {Value: &RecoveryCode{}},
+			"webauthn credential": {Value: &WebAuthnCredential{}},
+			"webauthn challenge":  {Value: &WebAuthnChallenge{}},
+			"email otp":           {Value: &EmailOTP{}},
+			"identity":            {Value: &Identity{}},
 		}
 
 		for name, dm := range delModels {
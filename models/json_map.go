@@ -32,3 +32,34 @@ func (j JSONMap) Scan(src interface{}) error {
 	}
 	return json.Unmarshal(source, &j)
 }
+
+// StringList is a list of strings stored as a JSON array.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		l = StringList{}
+	}
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return driver.Value(""), err
+	}
+	return driver.Value(string(data)), nil
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	var source []byte
+	switch v := src.(type) {
+	case string:
+		source = []byte(v)
+	case []byte:
+		source = v
+	default:
+		return errors.New("Invalid data type for StringList")
+	}
+
+	if len(source) == 0 {
+		source = []byte("[]")
+	}
+	return json.Unmarshal(source, (*[]string)(l))
+}
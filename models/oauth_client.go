@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OAuthClient is an application registered to obtain tokens through the
+// authorization code flow.
+type OAuthClient struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+
+	ClientID        string     `json:"client_id" db:"client_id"`
+	EncryptedSecret string     `json:"-" db:"encrypted_secret"`
+	Name            string     `json:"name" db:"name"`
+	RedirectURIs    StringList `json:"redirect_uris" db:"redirect_uris"`
+	FirstParty      bool       `json:"first_party" db:"first_party"`
+	Confidential    bool       `json:"confidential" db:"confidential"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (OAuthClient) TableName() string {
+	tableName := "oauth_clients"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewOAuthClient initializes a new client. Confidential clients get a secret,
+// which is returned once and only stored hashed.
+func NewOAuthClient(instanceID uuid.UUID, name string, redirectURIs []string, firstParty, confidential bool) (*OAuthClient, string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error generating unique id")
+	}
+
+	client := &OAuthClient{
+		InstanceID:   instanceID,
+		ID:           id,
+		ClientID:     crypto.SecureToken(),
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		FirstParty:   firstParty,
+		Confidential: confidential,
+	}
+
+	var secret string
+	if confidential {
+		secret = crypto.SecureToken() + crypto.SecureToken()
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		client.EncryptedSecret = string(hash)
+	}
+	return client, secret, nil
+}
+
+// Authenticate checks the secret of a confidential client.
+func (c *OAuthClient) Authenticate(secret string) bool {
+	if !c.Confidential {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.EncryptedSecret), []byte(secret)) == nil
+}
+
+// HasRedirectURI returns whether uri is on the allow-list of the client.
+// Redirect URIs must match exactly.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func findOAuthClient(tx *storage.Connection, query string, args ...interface{}) (*OAuthClient, error) {
+	obj := &OAuthClient{}
+	if err := tx.Q().Where(query, args...).First(obj); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, OAuthClientNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding oauth client")
+	}
+
+	return obj, nil
+}
+
+// FindOAuthClientByClientID finds a client of an instance by its public client ID.
+func FindOAuthClientByClientID(tx *storage.Connection, instanceID uuid.UUID, clientID string) (*OAuthClient, error) {
+	return findOAuthClient(tx, "instance_id = ? and client_id = ?", instanceID, clientID)
+}
+
+// FindOAuthClientByID finds a client of an instance by its ID.
+func FindOAuthClientByID(tx *storage.Connection, instanceID, id uuid.UUID) (*OAuthClient, error) {
+	return findOAuthClient(tx, "instance_id = ? and id = ?", instanceID, id)
+}
+
+// FindOAuthClients returns all clients of an instance.
+func FindOAuthClients(tx *storage.Connection, instanceID uuid.UUID) ([]*OAuthClient, error) {
+	clients := []*OAuthClient{}
+	err := tx.Q().Where("instance_id = ?", instanceID).Order("created_at asc").All(&clients)
+	return clients, errors.Wrap(err, "error finding oauth clients")
+}
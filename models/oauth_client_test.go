@@ -0,0 +1,76 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type OAuthClientTestSuite struct {
+	suite.Suite
+	db *storage.Connection
+}
+
+func (ts *OAuthClientTestSuite) SetupTest() {
+	require.NoError(ts.T(), TruncateAll(ts.db))
+}
+
+func TestOAuthClient(t *testing.T) {
+	globalConfig, err := conf.LoadGlobal(modelsTestConfig)
+	require.NoError(t, err)
+
+	conn, err := test.SetupDBConnection(globalConfig)
+	require.NoError(t, err)
+
+	ts := &OAuthClientTestSuite{
+		db: conn,
+	}
+	defer ts.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *OAuthClientTestSuite) TestFindOAuthClientByClientID() {
+	client, secret, err := NewOAuthClient(uuid.Nil, "Example", []string{"https://example.com/callback"}, false, true)
+	require.NoError(ts.T(), err)
+	require.NotEmpty(ts.T(), secret)
+	require.NoError(ts.T(), ts.db.Create(client))
+
+	found, err := FindOAuthClientByClientID(ts.db, uuid.Nil, client.ClientID)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), client.ID, found.ID)
+	assert.Equal(ts.T(), []string{"https://example.com/callback"}, []string(found.RedirectURIs))
+	assert.True(ts.T(), found.Authenticate(secret))
+	assert.False(ts.T(), found.Authenticate("wrong"))
+
+	_, err = FindOAuthClientByClientID(ts.db, uuid.Nil, "missing")
+	assert.True(ts.T(), IsNotFoundError(err))
+}
+
+func TestOAuthClientHasRedirectURI(t *testing.T) {
+	client, secret, err := NewOAuthClient(uuid.Nil, "Example", []string{"https://example.com/callback"}, false, false)
+	require.NoError(t, err)
+	assert.Empty(t, secret, "public clients have no secret")
+	assert.False(t, client.Authenticate(""))
+
+	assert.True(t, client.HasRedirectURI("https://example.com/callback"))
+	assert.False(t, client.HasRedirectURI("https://example.com/callback/"))
+	assert.False(t, client.HasRedirectURI("https://example.com/callback?next=/"))
+}
+
+func TestAuthorizationCodeVerifyCodeVerifier(t *testing.T) {
+	// example from RFC 7636 Appendix B
+	code := &AuthorizationCode{
+		CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeMethod: CodeChallengeS256,
+	}
+	assert.True(t, code.VerifyCodeVerifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+	assert.False(t, code.VerifyCodeVerifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXj"))
+	assert.False(t, code.VerifyCodeVerifier(""))
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time.
+const RecoveryCodeCount = 10
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RecoveryCode is the database model for a single-use code that replaces
+// the second factor of a user who lost it. Only a hash of the code is stored.
+type RecoveryCode struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	UserID     uuid.UUID `json:"-" db:"user_id"`
+
+	CodeHash string `json:"-" db:"code_hash"`
+
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
+
+func (RecoveryCode) TableName() string {
+	tableName := "mfa_recovery_codes"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// normalizeRecoveryCode ignores the case and separators users may type.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRecoveryCode() string {
+	b := make([]byte, 10)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err.Error()) // rand should never fail
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+	return code[:8] + "-" + code[8:]
+}
+
+// GenerateRecoveryCodes replaces the recovery codes of a user with new ones,
+// which are returned in plain text this one time.
+func GenerateRecoveryCodes(tx *storage.Connection, user *User) ([]string, error) {
+	if err := DeleteRecoveryCodes(tx, user.InstanceID, user.ID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error generating unique id")
+		}
+
+		codes[i] = generateRecoveryCode()
+		rc := &RecoveryCode{
+			InstanceID: user.InstanceID,
+			ID:         id,
+			UserID:     user.ID,
+			CodeHash:   hashRecoveryCode(codes[i]),
+		}
+		if err := tx.Create(rc); err != nil {
+			return nil, errors.Wrap(err, "error creating recovery code")
+		}
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used. The code
+// is only marked if it is still unused, so that parallel requests can't both
+// spend it.
+func UseRecoveryCode(tx *storage.Connection, user *User, code string) (*RecoveryCode, error) {
+	hash := hashRecoveryCode(code)
+	now := time.Now()
+	query := "UPDATE " + (&pop.Model{Value: RecoveryCode{}}).TableName() + " SET used_at = ?, updated_at = ? WHERE instance_id = ? AND user_id = ? AND code_hash = ? AND used_at IS NULL"
+	count, err := tx.RawQuery(query, now, now, user.InstanceID, user.ID, hash).ExecWithCount()
+	if err != nil {
+		return nil, errors.Wrap(err, "error using recovery code")
+	}
+	if count == 0 {
+		return nil, RecoveryCodeNotFoundError{}
+	}
+
+	rc := &RecoveryCode{}
+	if err := tx.Q().Where("instance_id = ? and user_id = ? and code_hash = ?", user.InstanceID, user.ID, hash).First(rc); err != nil {
+		return nil, errors.Wrap(err, "error finding recovery code")
+	}
+	return rc, nil
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes a user has left.
+func CountUnusedRecoveryCodes(tx *storage.Connection, instanceID, userID uuid.UUID) (int, error) {
+	count, err := tx.Q().Where("instance_id = ? and user_id = ? and used_at is null", instanceID, userID).Count(&RecoveryCode{})
+	return count, errors.Wrap(err, "error counting recovery codes")
+}
+
+// DeleteRecoveryCodes deletes all recovery codes of a user.
+func DeleteRecoveryCodes(tx *storage.Connection, instanceID, userID uuid.UUID) error {
+	err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: RecoveryCode{}}).TableName()+" WHERE instance_id = ? AND user_id = ?", instanceID, userID).Exec()
+	return errors.Wrap(err, "error deleting recovery codes")
+}
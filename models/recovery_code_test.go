@@ -0,0 +1,14 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoveryCodeHashIgnoresFormatting(t *testing.T) {
+	code := generateRecoveryCode()
+	assert.Len(t, code, 17)
+	assert.Equal(t, hashRecoveryCode(code), hashRecoveryCode(" "+code[:8]+code[9:]+" "))
+	assert.NotEqual(t, hashRecoveryCode(code), hashRecoveryCode(generateRecoveryCode()))
+}
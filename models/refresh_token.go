@@ -1,6 +1,7 @@
 package models
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/netlify/gotrue/storage/namespace"
@@ -21,6 +22,13 @@ type RefreshToken struct {
 
 	UserID uuid.UUID `db:"user_id"`
 
+	// FamilyID is shared by all tokens rotated from the same login, ParentID
+	// is the token this one was swapped for.
+	FamilyID uuid.UUID `db:"family_id"`
+	ParentID *int64    `db:"parent_id"`
+
+	SessionID uuid.NullUUID `db:"session_id"`
+
 	Revoked   bool      `db:"revoked"`
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
@@ -36,9 +44,17 @@ func (RefreshToken) TableName() string {
 	return tableName
 }
 
-// GrantAuthenticatedUser creates a refresh token for the provided user.
-func GrantAuthenticatedUser(tx *storage.Connection, user *User) (*RefreshToken, error) {
-	return createRefreshToken(tx, user)
+// GrantAuthenticatedUser creates a refresh token for the provided user, which
+// belongs to session if it isn't nil.
+func GrantAuthenticatedUser(tx *storage.Connection, user *User, session *Session) (*RefreshToken, error) {
+	token, err := newRefreshToken(user, nil)
+	if err != nil {
+		return nil, err
+	}
+	if session != nil {
+		token.SessionID = uuid.NullUUID{UUID: session.ID, Valid: true}
+	}
+	return token, saveRefreshToken(tx, token)
 }
 
 // GrantRefreshTokenSwap swaps a refresh token for a new one, revoking the provided token.
@@ -51,18 +67,57 @@ func GrantRefreshTokenSwap(tx *storage.Connection, user *User, token *RefreshTok
 		}
 
 		token.Revoked = true
-		if terr = tx.UpdateOnly(token, "revoked"); terr != nil {
+		if terr = tx.UpdateOnly(token, "revoked", "updated_at"); terr != nil {
+			return terr
+		}
+		newToken, terr = newRefreshToken(user, token)
+		if terr != nil {
 			return terr
 		}
-		newToken, terr = createRefreshToken(rtx, user)
-		return terr
+		return saveRefreshToken(rtx, newToken)
 	})
 	return newToken, err
 }
 
-// Logout deletes all refresh tokens for a user.
+// RevokeTokenFamily revokes every token rotated from the same login as token
+// and ends the session of the login.
+func RevokeTokenFamily(tx *storage.Connection, token *RefreshToken) error {
+	if err := tx.RawQuery("UPDATE "+(&pop.Model{Value: RefreshToken{}}).TableName()+" SET revoked = true, updated_at = ? WHERE instance_id = ? AND family_id = ?", time.Now(), token.InstanceID, token.FamilyID).Exec(); err != nil {
+		return err
+	}
+	if !token.SessionID.Valid {
+		return nil
+	}
+	return tx.RawQuery("DELETE FROM "+(&pop.Model{Value: Session{}}).TableName()+" WHERE instance_id = ? AND id = ?", token.InstanceID, token.SessionID.UUID).Exec()
+}
+
+// FindActiveRefreshTokenChild finds the token that token was swapped for, as
+// long as it is still active.
+func FindActiveRefreshTokenChild(tx *storage.Connection, token *RefreshToken) (*RefreshToken, error) {
+	child := &RefreshToken{}
+	if err := tx.Q().Where("instance_id = ? and parent_id = ? and revoked = false", token.InstanceID, token.ID).First(child); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, RefreshTokenNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding refresh token")
+	}
+	return child, nil
+}
+
+// RevokedWithin returns whether the token was revoked less than interval seconds ago.
+func (r *RefreshToken) RevokedWithin(intervalSeconds int) bool {
+	if !r.Revoked || intervalSeconds <= 0 {
+		return false
+	}
+	return time.Now().Before(r.UpdatedAt.Add(time.Second * time.Duration(intervalSeconds)))
+}
+
+// Logout deletes all refresh tokens and sessions for a user.
 func Logout(tx *storage.Connection, instanceID uuid.UUID, id uuid.UUID) error {
-	return tx.RawQuery("DELETE FROM "+(&pop.Model{Value: RefreshToken{}}).TableName()+" WHERE instance_id = ? AND user_id = ?", instanceID, id).Exec()
+	if err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: RefreshToken{}}).TableName()+" WHERE instance_id = ? AND user_id = ?", instanceID, id).Exec(); err != nil {
+		return err
+	}
+	return tx.RawQuery("DELETE FROM "+(&pop.Model{Value: Session{}}).TableName()+" WHERE instance_id = ? AND user_id = ?", instanceID, id).Exec()
 }
 
 func (r *RefreshToken) Expired(lifetimeSeconds int) bool {
@@ -74,15 +129,27 @@ func (r *RefreshToken) Expired(lifetimeSeconds int) bool {
 	return time.Now().After(expiresAt)
 }
 
-func createRefreshToken(tx *storage.Connection, user *User) (*RefreshToken, error) {
+func newRefreshToken(user *User, parent *RefreshToken) (*RefreshToken, error) {
 	token := &RefreshToken{
 		InstanceID: user.InstanceID,
 		UserID:     user.ID,
 		Token:      crypto.SecureToken(),
 	}
 
-	if err := tx.Create(token); err != nil {
-		return nil, errors.Wrap(err, "error creating refresh token")
+	if parent != nil {
+		token.FamilyID = parent.FamilyID
+		token.ParentID = &parent.ID
+		token.SessionID = parent.SessionID
+	} else {
+		familyID, err := uuid.NewV4()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error generating unique id")
+		}
+		token.FamilyID = familyID
 	}
 	return token, nil
 }
+
+func saveRefreshToken(tx *storage.Connection, token *RefreshToken) error {
+	return errors.Wrap(tx.Create(token), "error creating refresh token")
+}
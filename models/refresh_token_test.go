@@ -8,6 +8,7 @@ import (
 	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/storage"
 	"github.com/netlify/gotrue/storage/test"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -38,7 +39,7 @@ func TestRefreshToken(t *testing.T) {
 
 func (ts *RefreshTokenTestSuite) TestGrantAuthenticatedUser() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(ts.db, u, nil)
 	require.NoError(ts.T(), err)
 
 	require.NotEmpty(ts.T(), r.Token)
@@ -47,7 +48,7 @@ func (ts *RefreshTokenTestSuite) TestGrantAuthenticatedUser() {
 
 func (ts *RefreshTokenTestSuite) TestGrantRefreshTokenSwap() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(ts.db, u, nil)
 	require.NoError(ts.T(), err)
 
 	s, err := GrantRefreshTokenSwap(ts.db, u, r)
@@ -63,9 +64,41 @@ func (ts *RefreshTokenTestSuite) TestGrantRefreshTokenSwap() {
 	require.Equal(ts.T(), u.ID, s.UserID)
 }
 
+func (ts *RefreshTokenTestSuite) TestRevokeTokenFamily() {
+	u := ts.createUser()
+	r, err := GrantAuthenticatedUser(ts.db, u, nil)
+	require.NoError(ts.T(), err)
+	other, err := GrantAuthenticatedUser(ts.db, u, nil)
+	require.NoError(ts.T(), err)
+	require.NotEqual(ts.T(), r.FamilyID, other.FamilyID, "each login starts a new family")
+
+	s, err := GrantRefreshTokenSwap(ts.db, u, r)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), r.FamilyID, s.FamilyID)
+	require.NotNil(ts.T(), s.ParentID)
+	require.Equal(ts.T(), r.ID, *s.ParentID)
+
+	child, err := FindActiveRefreshTokenChild(ts.db, r)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), s.ID, child.ID)
+
+	require.NoError(ts.T(), RevokeTokenFamily(ts.db, r))
+
+	_, s, err = FindUserWithRefreshToken(ts.db, s.Token)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), s.Revoked, "expected descendant token to be revoked")
+
+	_, other, err = FindUserWithRefreshToken(ts.db, other.Token)
+	require.NoError(ts.T(), err)
+	require.False(ts.T(), other.Revoked, "expected tokens of other logins to stay valid")
+
+	_, err = FindActiveRefreshTokenChild(ts.db, r)
+	require.True(ts.T(), IsNotFoundError(err))
+}
+
 func (ts *RefreshTokenTestSuite) TestLogout() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(ts.db, u, nil)
 	require.NoError(ts.T(), err)
 
 	require.NoError(ts.T(), Logout(ts.db, uuid.Nil, u.ID))
@@ -77,7 +110,7 @@ func (ts *RefreshTokenTestSuite) TestLogout() {
 
 func (ts *RefreshTokenTestSuite) TestExpired() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(ts.db, u, nil)
 	require.NoError(ts.T(), err)
 
 	thirtyDays := 30 * 24 * 60 * 60
@@ -90,6 +123,16 @@ func (ts *RefreshTokenTestSuite) TestExpired() {
 	require.True(ts.T(), r.Expired(thirtyDays), "token older than lifetime should be expired")
 }
 
+func TestRefreshTokenRevokedWithin(t *testing.T) {
+	r := &RefreshToken{Revoked: true, UpdatedAt: time.Now().Add(-5 * time.Second)}
+	assert.True(t, r.RevokedWithin(10))
+	assert.False(t, r.RevokedWithin(2))
+	assert.False(t, r.RevokedWithin(-1), "negative interval disables the grace window")
+
+	r.Revoked = false
+	assert.False(t, r.RevokedWithin(10))
+}
+
 func (ts *RefreshTokenTestSuite) createUser() *User {
 	return ts.createUserWithEmail("david@netlify.com")
 }
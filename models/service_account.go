@@ -0,0 +1,119 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ServiceAccount is a non-human principal that obtains access tokens with the
+// client credentials grant.
+type ServiceAccount struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+
+	ClientID        string     `json:"client_id" db:"client_id"`
+	EncryptedSecret string     `json:"-" db:"encrypted_secret"`
+	Name            string     `json:"name" db:"name"`
+	Aud             string     `json:"aud" db:"aud"`
+	Roles           StringList `json:"roles" db:"roles"`
+	AppMetaData     JSONMap    `json:"app_metadata" db:"raw_app_meta_data"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (ServiceAccount) TableName() string {
+	tableName := "service_accounts"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewServiceAccount initializes a new service account. The secret is
+// returned once and only stored hashed.
+func NewServiceAccount(instanceID uuid.UUID, name, aud string, roles []string, appMetaData map[string]interface{}) (*ServiceAccount, string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error generating unique id")
+	}
+	if appMetaData == nil {
+		appMetaData = make(JSONMap)
+	}
+
+	account := &ServiceAccount{
+		InstanceID:  instanceID,
+		ID:          id,
+		ClientID:    crypto.SecureToken(),
+		Name:        name,
+		Aud:         aud,
+		Roles:       roles,
+		AppMetaData: appMetaData,
+	}
+
+	secret := crypto.SecureToken() + crypto.SecureToken()
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", err
+	}
+	account.EncryptedSecret = string(hash)
+	return account, secret, nil
+}
+
+// Authenticate checks the secret of the service account.
+func (s *ServiceAccount) Authenticate(secret string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(s.EncryptedSecret), []byte(secret)) == nil
+}
+
+// TokenAppMetaData returns the app_metadata claim of the tokens of the
+// service account, which includes its roles.
+func (s *ServiceAccount) TokenAppMetaData() map[string]interface{} {
+	metadata := make(map[string]interface{}, len(s.AppMetaData)+1)
+	for k, v := range s.AppMetaData {
+		metadata[k] = v
+	}
+	roles := make([]interface{}, len(s.Roles))
+	for i, r := range s.Roles {
+		roles[i] = r
+	}
+	metadata["roles"] = roles
+	return metadata
+}
+
+func findServiceAccount(tx *storage.Connection, query string, args ...interface{}) (*ServiceAccount, error) {
+	obj := &ServiceAccount{}
+	if err := tx.Q().Where(query, args...).First(obj); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ServiceAccountNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding service account")
+	}
+
+	return obj, nil
+}
+
+// FindServiceAccountByClientID finds a service account of an instance by its client ID.
+func FindServiceAccountByClientID(tx *storage.Connection, instanceID uuid.UUID, clientID string) (*ServiceAccount, error) {
+	return findServiceAccount(tx, "instance_id = ? and client_id = ?", instanceID, clientID)
+}
+
+// FindServiceAccountByID finds a service account of an instance by its ID.
+func FindServiceAccountByID(tx *storage.Connection, instanceID, id uuid.UUID) (*ServiceAccount, error) {
+	return findServiceAccount(tx, "instance_id = ? and id = ?", instanceID, id)
+}
+
+// FindServiceAccounts returns all service accounts of an instance.
+func FindServiceAccounts(tx *storage.Connection, instanceID uuid.UUID) ([]*ServiceAccount, error) {
+	accounts := []*ServiceAccount{}
+	err := tx.Q().Where("instance_id = ?", instanceID).Order("created_at asc").All(&accounts)
+	return accounts, errors.Wrap(err, "error finding service accounts")
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// Authenticator assurance levels of a session.
+const (
+	AAL1 = "aal1"
+	AAL2 = "aal2"
+)
+
+// Session is the database model for a login of a user on a device. The
+// refresh tokens rotated from the login belong to it.
+type Session struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+
+	IP                   string `json:"ip" db:"ip"`
+	UserAgent            string `json:"user_agent" db:"user_agent"`
+	AuthenticationMethod string `json:"authentication_method" db:"authentication_method"`
+	AAL                  string `json:"aal" db:"aal"`
+
+	// The grant of the login, which refreshing its tokens keeps.
+	Scope    string `json:"scope,omitempty" db:"scope"`
+	ClientID string `json:"client_id,omitempty" db:"client_id"`
+	Nonce    string `json:"-" db:"nonce"`
+
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty" db:"refreshed_at"`
+}
+
+func (Session) TableName() string {
+	tableName := "sessions"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewSession initializes a new session of user signed in with method.
+func NewSession(user *User, method, ip, userAgent string) (*Session, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &Session{
+		InstanceID:           user.InstanceID,
+		ID:                   id,
+		UserID:               user.ID,
+		IP:                   ip,
+		UserAgent:            userAgent,
+		AuthenticationMethod: method,
+		AAL:                  AAL1,
+	}, nil
+}
+
+// UpdateRefreshedAt records that a refresh token of the session was used.
+func (s *Session) UpdateRefreshedAt(tx *storage.Connection) error {
+	now := time.Now()
+	s.RefreshedAt = &now
+	return tx.UpdateOnly(s, "refreshed_at")
+}
+
+// UpdateAAL records the authenticator assurance level the session reached.
+func (s *Session) UpdateAAL(tx *storage.Connection, aal string) error {
+	s.AAL = aal
+	return tx.UpdateOnly(s, "aal", "updated_at")
+}
+
+// FindSessionByUserIDAndID finds a session of a user.
+func FindSessionByUserIDAndID(tx *storage.Connection, instanceID, userID, id uuid.UUID) (*Session, error) {
+	session := &Session{}
+	if err := tx.Q().Where("instance_id = ? and user_id = ? and id = ?", instanceID, userID, id).First(session); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, SessionNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding session")
+	}
+	return session, nil
+}
+
+// FindSessionsByUserID returns the sessions of a user, newest first.
+func FindSessionsByUserID(tx *storage.Connection, instanceID, userID uuid.UUID) ([]*Session, error) {
+	sessions := []*Session{}
+	err := tx.Q().Where("instance_id = ? and user_id = ?", instanceID, userID).Order("created_at desc").All(&sessions)
+	return sessions, errors.Wrap(err, "error finding sessions")
+}
+
+// DeleteSession signs out a session by deleting it with its refresh tokens.
+func DeleteSession(tx *storage.Connection, session *Session) error {
+	if err := tx.RawQuery("DELETE FROM "+(&pop.Model{Value: RefreshToken{}}).TableName()+" WHERE instance_id = ? AND session_id = ?", session.InstanceID, session.ID).Exec(); err != nil {
+		return errors.Wrap(err, "error deleting refresh tokens")
+	}
+	return errors.Wrap(tx.Destroy(session), "error deleting session")
+}
+
+// DeleteUserSessions signs out every session of a user except the one with
+// the given ID, which may be uuid.Nil to sign out all of them.
+func DeleteUserSessions(tx *storage.Connection, instanceID, userID, except uuid.UUID) error {
+	sessions, err := FindSessionsByUserID(tx, instanceID, userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.ID == except {
+			continue
+		}
+		if err := DeleteSession(tx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SessionTestSuite struct {
+	suite.Suite
+	db *storage.Connection
+}
+
+func (ts *SessionTestSuite) SetupTest() {
+	require.NoError(ts.T(), TruncateAll(ts.db))
+}
+
+func TestSession(t *testing.T) {
+	globalConfig, err := conf.LoadGlobal(modelsTestConfig)
+	require.NoError(t, err)
+
+	conn, err := test.SetupDBConnection(globalConfig)
+	require.NoError(t, err)
+
+	ts := &SessionTestSuite{
+		db: conn,
+	}
+	defer ts.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *SessionTestSuite) createSession(u *User) (*Session, *RefreshToken) {
+	s, err := NewSession(u, "password", "127.0.0.1", "test-agent")
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.db.Create(s))
+
+	r, err := GrantAuthenticatedUser(ts.db, u, s)
+	require.NoError(ts.T(), err)
+	return s, r
+}
+
+func (ts *SessionTestSuite) TestDeleteSession() {
+	u, err := NewUser(uuid.Nil, "david@netlify.com", "secret", "test", nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.db.Create(u))
+
+	first, firstToken := ts.createSession(u)
+	second, secondToken := ts.createSession(u)
+	assert.Equal(ts.T(), AAL1, first.AAL)
+
+	swapped, err := GrantRefreshTokenSwap(ts.db, u, firstToken)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), first.ID, swapped.SessionID.UUID, "rotated tokens stay in the session")
+
+	sessions, err := FindSessionsByUserID(ts.db, uuid.Nil, u.ID)
+	require.NoError(ts.T(), err)
+	assert.Len(ts.T(), sessions, 2)
+
+	require.NoError(ts.T(), DeleteSession(ts.db, first))
+
+	_, err = FindSessionByUserIDAndID(ts.db, uuid.Nil, u.ID, first.ID)
+	assert.True(ts.T(), IsNotFoundError(err))
+	_, _, err = FindUserWithRefreshToken(ts.db, swapped.Token)
+	assert.True(ts.T(), IsNotFoundError(err), "refresh tokens of the session must be deleted")
+
+	_, _, err = FindUserWithRefreshToken(ts.db, secondToken.Token)
+	require.NoError(ts.T(), err, "other sessions must stay signed in")
+
+	require.NoError(ts.T(), DeleteUserSessions(ts.db, uuid.Nil, u.ID, uuid.Nil))
+	_, err = FindSessionByUserIDAndID(ts.db, uuid.Nil, u.ID, second.ID)
+	assert.True(ts.T(), IsNotFoundError(err))
+}
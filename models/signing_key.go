@@ -0,0 +1,158 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// SigningKeyState is the lifecycle state of a signing key.
+type SigningKeyState string
+
+const (
+	// SigningKeyNext keys are published for verification but not yet used for signing.
+	SigningKeyNext SigningKeyState = "next"
+	// SigningKeyCurrent is the key new tokens are signed with.
+	SigningKeyCurrent SigningKeyState = "current"
+	// SigningKeyRetired keys only verify tokens issued before the last rotation.
+	SigningKeyRetired SigningKeyState = "retired"
+)
+
+// SigningKey is the database model for the keys an instance signs access tokens with.
+type SigningKey struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+
+	KeyID      string          `json:"kid" db:"kid"`
+	Algorithm  string          `json:"algorithm" db:"algorithm"`
+	PrivateKey string          `json:"-" db:"private_key"`
+	State      SigningKeyState `json:"state" db:"state"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (SigningKey) TableName() string {
+	tableName := "signing_keys"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewSigningKey generates a new key for the given JWS algorithm. HS256 keys
+// hold a random shared secret, the others a PEM encoded private key.
+func NewSigningKey(instanceID uuid.UUID, alg string, state SigningKeyState) (*SigningKey, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	key := &SigningKey{
+		InstanceID: instanceID,
+		ID:         id,
+		KeyID:      id.String(),
+		Algorithm:  alg,
+		State:      state,
+	}
+
+	if alg == crypto.HS256 {
+		key.PrivateKey = crypto.SecureToken() + crypto.SecureToken()
+		return key, nil
+	}
+
+	signer, err := crypto.GenerateSigningKey(alg)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating private key")
+	}
+	if key.PrivateKey, err = crypto.EncodeSigningKey(signer); err != nil {
+		return nil, errors.Wrap(err, "Error encoding private key")
+	}
+	jwk, err := crypto.NewJWK(signer.Public(), "", alg)
+	if err != nil {
+		return nil, err
+	}
+	key.KeyID = jwk.Thumbprint()
+	return key, nil
+}
+
+func findSigningKey(tx *storage.Connection, query string, args ...interface{}) (*SigningKey, error) {
+	obj := &SigningKey{}
+	if err := tx.Q().Where(query, args...).First(obj); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, SigningKeyNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding signing key")
+	}
+
+	return obj, nil
+}
+
+// FindSigningKeyByID finds a signing key of an instance by its ID.
+func FindSigningKeyByID(tx *storage.Connection, instanceID, id uuid.UUID) (*SigningKey, error) {
+	return findSigningKey(tx, "instance_id = ? and id = ?", instanceID, id)
+}
+
+// FindSigningKeys returns all signing keys of an instance, newest first.
+func FindSigningKeys(tx *storage.Connection, instanceID uuid.UUID) ([]*SigningKey, error) {
+	keys := []*SigningKey{}
+	err := tx.Q().Where("instance_id = ?", instanceID).Order("created_at desc").All(&keys)
+	return keys, errors.Wrap(err, "error finding signing keys")
+}
+
+// RotateSigningKeys retires the current key, promotes the next key to current
+// and generates a new next key. Retired keys older than retention are deleted,
+// since every token they signed has expired.
+func RotateSigningKeys(tx *storage.Connection, instanceID uuid.UUID, alg string, retention time.Duration) error {
+	keys, err := FindSigningKeys(tx, instanceID)
+	if err != nil {
+		return err
+	}
+
+	var next *SigningKey
+	for _, key := range keys {
+		switch key.State {
+		case SigningKeyCurrent:
+			key.State = SigningKeyRetired
+			if err := tx.UpdateOnly(key, "state", "updated_at"); err != nil {
+				return errors.Wrap(err, "error retiring signing key")
+			}
+		case SigningKeyNext:
+			next = key
+		case SigningKeyRetired:
+			if time.Since(key.UpdatedAt) > retention {
+				if err := tx.Destroy(key); err != nil {
+					return errors.Wrap(err, "error deleting signing key")
+				}
+			}
+		}
+	}
+
+	if next != nil {
+		next.State = SigningKeyCurrent
+		if err := tx.UpdateOnly(next, "state", "updated_at"); err != nil {
+			return errors.Wrap(err, "error promoting signing key")
+		}
+	} else {
+		current, err := NewSigningKey(instanceID, alg, SigningKeyCurrent)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(current); err != nil {
+			return errors.Wrap(err, "error creating signing key")
+		}
+	}
+
+	newNext, err := NewSigningKey(instanceID, alg, SigningKeyNext)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(tx.Create(newNext), "error creating signing key")
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/pop/v5"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/crypto"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/test"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SigningKeyTestSuite struct {
+	suite.Suite
+	db *storage.Connection
+}
+
+func (ts *SigningKeyTestSuite) SetupTest() {
+	require.NoError(ts.T(), TruncateAll(ts.db))
+}
+
+func TestSigningKey(t *testing.T) {
+	globalConfig, err := conf.LoadGlobal(modelsTestConfig)
+	require.NoError(t, err)
+
+	conn, err := test.SetupDBConnection(globalConfig)
+	require.NoError(t, err)
+
+	ts := &SigningKeyTestSuite{
+		db: conn,
+	}
+	defer ts.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *SigningKeyTestSuite) TestRotateSigningKeys() {
+	require.NoError(ts.T(), RotateSigningKeys(ts.db, uuid.Nil, crypto.ES256, time.Hour))
+
+	keys := ts.keysByState()
+	require.Len(ts.T(), keys[SigningKeyCurrent], 1)
+	require.Len(ts.T(), keys[SigningKeyNext], 1)
+	require.Empty(ts.T(), keys[SigningKeyRetired])
+	next := keys[SigningKeyNext][0]
+	current := keys[SigningKeyCurrent][0]
+
+	require.NoError(ts.T(), RotateSigningKeys(ts.db, uuid.Nil, crypto.ES256, time.Hour))
+
+	keys = ts.keysByState()
+	require.Len(ts.T(), keys[SigningKeyCurrent], 1)
+	require.Len(ts.T(), keys[SigningKeyNext], 1)
+	require.Len(ts.T(), keys[SigningKeyRetired], 1)
+	require.Equal(ts.T(), next.ID, keys[SigningKeyCurrent][0].ID, "expected next key to be promoted")
+	require.Equal(ts.T(), current.ID, keys[SigningKeyRetired][0].ID, "expected current key to be retired")
+}
+
+func (ts *SigningKeyTestSuite) TestRotateSigningKeysPrunesRetiredKeys() {
+	require.NoError(ts.T(), RotateSigningKeys(ts.db, uuid.Nil, crypto.HS256, 0))
+	require.NoError(ts.T(), RotateSigningKeys(ts.db, uuid.Nil, crypto.HS256, 0))
+	require.Len(ts.T(), ts.keysByState()[SigningKeyRetired], 1)
+
+	require.NoError(ts.T(), RotateSigningKeys(ts.db, uuid.Nil, crypto.HS256, 0))
+	require.Len(ts.T(), ts.keysByState()[SigningKeyRetired], 1, "expected expired retired key to be deleted")
+}
+
+func (ts *SigningKeyTestSuite) TestRotateSigningKeysKeepsRecentlyRetiredKeys() {
+	require.NoError(ts.T(), RotateSigningKeys(ts.db, uuid.Nil, crypto.HS256, time.Hour))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(ts.T(), ts.db.RawQuery("UPDATE "+(&pop.Model{Value: SigningKey{}}).TableName()+" SET created_at = ?, updated_at = ?", old, old).Exec())
+
+	require.NoError(ts.T(), RotateSigningKeys(ts.db, uuid.Nil, crypto.HS256, time.Hour))
+	require.NoError(ts.T(), RotateSigningKeys(ts.db, uuid.Nil, crypto.HS256, time.Hour))
+	require.Len(ts.T(), ts.keysByState()[SigningKeyRetired], 2, "expected keys retired within retention to be kept")
+}
+
+func (ts *SigningKeyTestSuite) TestNewSigningKey() {
+	k, err := NewSigningKey(uuid.Nil, crypto.HS256, SigningKeyNext)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), k.ID.String(), k.KeyID)
+	require.NotEmpty(ts.T(), k.PrivateKey)
+
+	k, err = NewSigningKey(uuid.Nil, crypto.RS256, SigningKeyNext)
+	require.NoError(ts.T(), err)
+	signer, err := crypto.ParseSigningKey(crypto.RS256, k.PrivateKey)
+	require.NoError(ts.T(), err)
+	jwk, err := crypto.NewJWK(signer.Public(), "", crypto.RS256)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), jwk.Thumbprint(), k.KeyID)
+
+	_, err = FindSigningKeyByID(ts.db, uuid.Nil, k.ID)
+	require.True(ts.T(), IsNotFoundError(err), "expected NotFoundError")
+}
+
+func (ts *SigningKeyTestSuite) keysByState() map[SigningKeyState][]*SigningKey {
+	keys, err := FindSigningKeys(ts.db, uuid.Nil)
+	require.NoError(ts.T(), err)
+
+	byState := map[SigningKeyState][]*SigningKey{}
+	for _, k := range keys {
+		byState[k.State] = append(byState[k.State], k)
+	}
+	return byState
+}
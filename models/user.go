@@ -1,7 +1,10 @@
 package models
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"strings"
 	"time"
 
@@ -35,6 +38,15 @@ type User struct {
 	RecoveryToken  string     `json:"-" db:"recovery_token"`
 	RecoverySentAt *time.Time `json:"recovery_sent_at,omitempty" db:"recovery_sent_at"`
 
+	MagicLinkToken  string     `json:"-" db:"magic_link_token"`
+	MagicLinkSentAt *time.Time `json:"magic_link_sent_at,omitempty" db:"magic_link_sent_at"`
+
+	Phone            string     `json:"phone,omitempty" db:"phone"`
+	PhoneConfirmedAt *time.Time `json:"phone_confirmed_at,omitempty" db:"phone_confirmed_at"`
+	PhoneOTP         string     `json:"-" db:"phone_otp"`
+	PhoneOTPSentAt   *time.Time `json:"phone_otp_sent_at,omitempty" db:"phone_otp_sent_at"`
+	PhoneOTPAttempts int        `json:"-" db:"phone_otp_attempts"`
+
 	EmailChangeToken  string     `json:"-" db:"email_change_token"`
 	EmailChange       string     `json:"new_email,omitempty" db:"email_change"`
 	EmailChangeSentAt *time.Time `json:"email_change_sent_at,omitempty" db:"email_change_sent_at"`
@@ -45,6 +57,7 @@ type User struct {
 	UserMetaData JSONMap `json:"user_metadata" db:"raw_user_meta_data"`
 
 	IsSuperAdmin bool `json:"-" db:"is_super_admin"`
+	IsAnonymous  bool `json:"is_anonymous" db:"is_anonymous"`
 
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
@@ -68,6 +81,15 @@ type UserForExport struct {
 	RecoveryToken  string     `json:"-" db:"recovery_token"`
 	RecoverySentAt *time.Time `json:"recovery_sent_at,omitempty" db:"recovery_sent_at"`
 
+	MagicLinkToken  string     `json:"-" db:"magic_link_token"`
+	MagicLinkSentAt *time.Time `json:"magic_link_sent_at,omitempty" db:"magic_link_sent_at"`
+
+	Phone            string     `json:"phone,omitempty" db:"phone"`
+	PhoneConfirmedAt *time.Time `json:"phone_confirmed_at,omitempty" db:"phone_confirmed_at"`
+	PhoneOTP         string     `json:"-" db:"phone_otp"`
+	PhoneOTPSentAt   *time.Time `json:"phone_otp_sent_at,omitempty" db:"phone_otp_sent_at"`
+	PhoneOTPAttempts int        `json:"-" db:"phone_otp_attempts"`
+
 	EmailChangeToken  string     `json:"-" db:"email_change_token"`
 	EmailChange       string     `json:"new_email,omitempty" db:"email_change"`
 	EmailChangeSentAt *time.Time `json:"email_change_sent_at,omitempty" db:"email_change_sent_at"`
@@ -78,6 +100,7 @@ type UserForExport struct {
 	UserMetaData JSONMap `json:"user_metadata" db:"raw_user_meta_data"`
 
 	IsSuperAdmin bool `json:"-" db:"is_super_admin"`
+	IsAnonymous  bool `json:"is_anonymous" db:"is_anonymous"`
 
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
@@ -163,6 +186,15 @@ func (u *User) BeforeSave(tx *pop.Connection) error {
 	if u.RecoverySentAt != nil && u.RecoverySentAt.IsZero() {
 		u.RecoverySentAt = nil
 	}
+	if u.MagicLinkSentAt != nil && u.MagicLinkSentAt.IsZero() {
+		u.MagicLinkSentAt = nil
+	}
+	if u.PhoneConfirmedAt != nil && u.PhoneConfirmedAt.IsZero() {
+		u.PhoneConfirmedAt = nil
+	}
+	if u.PhoneOTPSentAt != nil && u.PhoneOTPSentAt.IsZero() {
+		u.PhoneOTPSentAt = nil
+	}
 	if u.EmailChangeSentAt != nil && u.EmailChangeSentAt.IsZero() {
 		u.EmailChangeSentAt = nil
 	}
@@ -178,6 +210,12 @@ func (u *User) IsConfirmed() bool {
 	return u.ConfirmedAt != nil
 }
 
+// IsPhoneConfirmed checks if the phone number of a user
+// has been confirmed.
+func (u *User) IsPhoneConfirmed() bool {
+	return u.PhoneConfirmedAt != nil
+}
+
 // SetRole sets the users Role to roleName
 func (u *User) SetRole(tx *storage.Connection, roleName string) error {
 	u.Role = strings.TrimSpace(roleName)
@@ -228,6 +266,18 @@ func (u *User) SetEmail(tx *storage.Connection, email string) error {
 	return tx.UpdateOnly(u, "email")
 }
 
+// SetPhone changes the phone number of a user, which then has to be
+// confirmed again.
+func (u *User) SetPhone(tx *storage.Connection, phone string) error {
+	if u.Phone != phone {
+		u.Phone = phone
+		u.PhoneConfirmedAt = nil
+		u.PhoneOTP = ""
+		u.PhoneOTPAttempts = 0
+	}
+	return tx.UpdateOnly(u, "phone", "phone_confirmed_at", "phone_otp", "phone_otp_attempts")
+}
+
 // hashPassword generates a hashed password from a plaintext string
 func hashPassword(password string) (string, error) {
 	pw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -252,12 +302,14 @@ func (u *User) Authenticate(password string) bool {
 	return err == nil
 }
 
-// Confirm resets the confimation token and the confirm timestamp
+// Confirm resets the confimation token and the confirm timestamp. Confirmed
+// users are no longer anonymous.
 func (u *User) Confirm(tx *storage.Connection) error {
 	u.ConfirmationToken = ""
 	now := time.Now()
 	u.ConfirmedAt = &now
-	return tx.UpdateOnly(u, "confirmation_token", "confirmed_at")
+	u.IsAnonymous = false
+	return tx.UpdateOnly(u, "confirmation_token", "confirmed_at", "is_anonymous")
 }
 
 // ConfirmEmailChange confirm the change of email for a user
@@ -274,6 +326,58 @@ func (u *User) Recover(tx *storage.Connection) error {
 	return tx.UpdateOnly(u, "recovery_token")
 }
 
+// ConsumeMagicLink resets the magic link token
+func (u *User) ConsumeMagicLink(tx *storage.Connection) error {
+	u.MagicLinkToken = ""
+	return tx.UpdateOnly(u, "magic_link_token")
+}
+
+// hashPhoneOTP binds the hash of a one-time passcode to the user and the
+// number it was sent to.
+func hashPhoneOTP(userID uuid.UUID, phone, otp string) string {
+	sum := sha256.Sum256([]byte(userID.String() + ":" + phone + ":" + strings.TrimSpace(otp)))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetPhoneOTP stores the hash of a new one-time passcode sent to the phone
+// number of the user.
+func (u *User) SetPhoneOTP(tx *storage.Connection, otp string) error {
+	now := time.Now()
+	u.PhoneOTP = hashPhoneOTP(u.ID, u.Phone, otp)
+	u.PhoneOTPSentAt = &now
+	u.PhoneOTPAttempts = 0
+	return tx.UpdateOnly(u, "phone_otp", "phone_otp_sent_at", "phone_otp_attempts")
+}
+
+// PhoneOTPMatches checks an entered code against the stored hash.
+func (u *User) PhoneOTPMatches(otp string) bool {
+	if u.PhoneOTP == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashPhoneOTP(u.ID, u.Phone, otp)), []byte(u.PhoneOTP)) == 1
+}
+
+// IncrementPhoneOTPAttempts records a wrong code. Callers lock the user with
+// FindUserForUpdate so concurrent guesses all count.
+func (u *User) IncrementPhoneOTPAttempts(tx *storage.Connection) error {
+	u.PhoneOTPAttempts++
+	return tx.UpdateOnly(u, "phone_otp_attempts")
+}
+
+// ConsumePhoneOTP resets the one-time passcode
+func (u *User) ConsumePhoneOTP(tx *storage.Connection) error {
+	u.PhoneOTP = ""
+	u.PhoneOTPAttempts = 0
+	return tx.UpdateOnly(u, "phone_otp", "phone_otp_attempts")
+}
+
+// ConfirmPhone sets the phone confirmation timestamp
+func (u *User) ConfirmPhone(tx *storage.Connection) error {
+	now := time.Now()
+	u.PhoneConfirmedAt = &now
+	return tx.UpdateOnly(u, "phone_confirmed_at")
+}
+
 // CountOtherUsers counts how many other users exist besides the one provided
 func CountOtherUsers(tx *storage.Connection, instanceID, id uuid.UUID) (int, error) {
 	userCount, err := tx.Q().Where("instance_id = ? and id != ?", instanceID, id).Count(&User{})
@@ -305,6 +409,14 @@ func FindUserByEmailAndAudience(tx *storage.Connection, instanceID uuid.UUID, em
 	return findUser(tx, "instance_id = ? and email = ? and aud = ?", instanceID, email, aud)
 }
 
+// FindUserByPhoneAndAudience finds a user with the matching phone number and audience.
+func FindUserByPhoneAndAudience(tx *storage.Connection, instanceID uuid.UUID, phone, aud string) (*User, error) {
+	if phone == "" {
+		return nil, UserNotFoundError{}
+	}
+	return findUser(tx, "instance_id = ? and phone = ? and aud = ?", instanceID, phone, aud)
+}
+
 // FindUserByID finds a user matching the provided ID.
 func FindUserByID(tx *storage.Connection, id uuid.UUID) (*User, error) {
 	return findUser(tx, "id = ?", id)
@@ -315,6 +427,20 @@ func FindUserByInstanceIDAndID(tx *storage.Connection, instanceID, id uuid.UUID)
 	return findUser(tx, "instance_id = ? and id = ?", instanceID, id)
 }
 
+// FindUserForUpdate finds a user and locks it until the transaction tx ends,
+// so concurrent changes to it happen one after the other.
+func FindUserForUpdate(tx *storage.Connection, instanceID, id uuid.UUID) (*User, error) {
+	obj := &User{}
+	query := "SELECT * FROM " + (&pop.Model{Value: User{}}).TableName() + " WHERE instance_id = ? AND id = ? FOR UPDATE"
+	if err := tx.RawQuery(query, instanceID, id).First(obj); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, UserNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding user")
+	}
+	return obj, nil
+}
+
 // FindUserByRecoveryToken finds a user with the matching recovery token.
 func FindUserByRecoveryToken(tx *storage.Connection, token string) (*User, error) {
 	if strings.TrimSpace(token) == "" {
@@ -323,6 +449,14 @@ func FindUserByRecoveryToken(tx *storage.Connection, token string) (*User, error
 	return findUser(tx, "recovery_token = ?", token)
 }
 
+// FindUserByMagicLinkToken finds a user with the matching magic link token.
+func FindUserByMagicLinkToken(tx *storage.Connection, token string) (*User, error) {
+	if strings.TrimSpace(token) == "" {
+		return nil, UserNotFoundError{}
+	}
+	return findUser(tx, "magic_link_token = ?", token)
+}
+
 // FindUserWithRefreshToken finds a user from the provided refresh token.
 func FindUserWithRefreshToken(tx *storage.Connection, token string) (*User, *RefreshToken, error) {
 	refreshToken := &RefreshToken{}
@@ -349,7 +483,7 @@ func FindUsersInAudience(tx *storage.Connection, instanceID uuid.UUID, aud strin
 	if filter != "" {
 		lf := "%" + filter + "%"
 		// we must specify the collation in order to get case insensitive search for the JSON column
-		q = q.Where("(email LIKE ? OR raw_user_meta_data->>'$.full_name' COLLATE utf8mb4_unicode_ci LIKE ?)", lf, lf)
+		q = q.Where("(email LIKE ? OR phone LIKE ? OR raw_user_meta_data->>'$.full_name' COLLATE utf8mb4_unicode_ci LIKE ?)", lf, lf, lf)
 	}
 
 	if sortParams != nil && len(sortParams.Fields) > 0 {
@@ -377,7 +511,7 @@ func FindUsersForExportInAudience(tx *storage.Connection, instanceID uuid.UUID,
 	if filter != "" {
 		lf := "%" + filter + "%"
 		// we must specify the collation in order to get case insensitive search for the JSON column
-		q = q.Where("(email LIKE ? OR raw_user_meta_data->>'$.full_name' COLLATE utf8mb4_unicode_ci LIKE ?)", lf, lf)
+		q = q.Where("(email LIKE ? OR phone LIKE ? OR raw_user_meta_data->>'$.full_name' COLLATE utf8mb4_unicode_ci LIKE ?)", lf, lf, lf)
 	}
 
 	if sortParams != nil && len(sortParams.Fields) > 0 {
@@ -397,6 +531,66 @@ func FindUsersForExportInAudience(tx *storage.Connection, instanceID uuid.UUID,
 	return users, err
 }
 
+// DeleteStaleAnonymousUsers deletes the anonymous users created before a
+// time that haven't refreshed a token since, with their sessions and
+// refresh tokens. It returns the number of deleted users.
+func DeleteStaleAnonymousUsers(tx *storage.Connection, instanceID uuid.UUID, before time.Time) (int, error) {
+	refreshTokens := (&pop.Model{Value: RefreshToken{}}).TableName()
+	users := []*User{}
+	if err := tx.Q().Where("instance_id = ? and is_anonymous = ? and created_at < ?", instanceID, true, before).
+		Where("id not in (select user_id from "+refreshTokens+" where instance_id = ? and created_at >= ? and user_id is not null)", instanceID, before).
+		All(&users); err != nil {
+		return 0, errors.Wrap(err, "error finding stale anonymous users")
+	}
+
+	for _, u := range users {
+		if err := DeleteUser(tx, u); err != nil {
+			return 0, errors.Wrap(err, "error deleting anonymous user")
+		}
+	}
+	return len(users), nil
+}
+
+// DeleteUser deletes a user with everything that belongs to it: sessions,
+// refresh tokens, authorization codes, identities, second factors and their
+// challenges, passkeys and one-time passcodes.
+func DeleteUser(tx *storage.Connection, u *User) error {
+	challenges := (&pop.Model{Value: Challenge{}}).TableName()
+	factors := (&pop.Model{Value: Factor{}}).TableName()
+	if err := tx.RawQuery("DELETE FROM "+challenges+" WHERE instance_id = ? AND factor_id IN (SELECT id FROM "+factors+" WHERE instance_id = ? AND user_id = ?)", u.InstanceID, u.InstanceID, u.ID).Exec(); err != nil {
+		return errors.Wrap(err, "error deleting user challenges")
+	}
+
+	for _, m := range []*pop.Model{
+		{Value: RefreshToken{}},
+		{Value: Session{}},
+		{Value: AuthorizationCode{}},
+		{Value: Identity{}},
+		{Value: Factor{}},
+		{Value: RecoveryCode{}},
+		{Value: WebAuthnCredential{}},
+		{Value: WebAuthnChallenge{}},
+		{Value: EmailOTP{}},
+	} {
+		if err := tx.RawQuery("DELETE FROM "+m.TableName()+" WHERE instance_id = ? AND user_id = ?", u.InstanceID, u.ID).Exec(); err != nil {
+			return errors.Wrap(err, "error deleting user data")
+		}
+	}
+	return errors.Wrap(tx.Destroy(u), "error deleting user")
+}
+
+// IsDuplicatedPhone returns whether a user exists with a matching phone number and audience.
+func IsDuplicatedPhone(tx *storage.Connection, instanceID uuid.UUID, phone, aud string) (bool, error) {
+	_, err := FindUserByPhoneAndAudience(tx, instanceID, phone, aud)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // IsDuplicatedEmail returns whether a user exists with a matching email and audience.
 func IsDuplicatedEmail(tx *storage.Connection, instanceID uuid.UUID, email, aud string) (bool, error) {
 	_, err := FindUserByEmailAndAudience(tx, instanceID, email, aud)
@@ -2,6 +2,7 @@ package models
 
 import (
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/netlify/gotrue/conf"
@@ -101,6 +102,68 @@ func (ts *UserTestSuite) TestFindUserByEmailAndAudience() {
 	require.EqualError(ts.T(), err, UserNotFoundError{}.Error())
 }
 
+func (ts *UserTestSuite) TestFindUserByPhoneAndAudience() {
+	u := ts.createUser()
+	require.NoError(ts.T(), u.SetPhone(ts.db, "+14155552671"))
+
+	n, err := FindUserByPhoneAndAudience(ts.db, u.InstanceID, "+14155552671", "test")
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), u.ID, n.ID)
+
+	_, err = FindUserByPhoneAndAudience(ts.db, u.InstanceID, "+14155552671", "invalid")
+	require.EqualError(ts.T(), err, UserNotFoundError{}.Error())
+
+	// users without a phone number are never found
+	ts.createUserWithEmail("other@netlify.com")
+	_, err = FindUserByPhoneAndAudience(ts.db, u.InstanceID, "", "test")
+	require.EqualError(ts.T(), err, UserNotFoundError{}.Error())
+}
+
+func (ts *UserTestSuite) TestPhoneOTP() {
+	u := ts.createUser()
+	require.NoError(ts.T(), u.SetPhone(ts.db, "+14155552671"))
+	require.NoError(ts.T(), u.SetPhoneOTP(ts.db, "123456"))
+
+	n, err := FindUserByID(ts.db, u.ID)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), n.PhoneOTPMatches("123456"))
+	assert.False(ts.T(), n.PhoneOTPMatches("654321"))
+
+	// changing the number drops the code and confirmation
+	require.NoError(ts.T(), n.ConfirmPhone(ts.db))
+	require.NoError(ts.T(), n.SetPhone(ts.db, "+14155552672"))
+	assert.False(ts.T(), n.IsPhoneConfirmed())
+	assert.False(ts.T(), n.PhoneOTPMatches("123456"))
+}
+
+func (ts *UserTestSuite) TestDeleteStaleAnonymousUsers() {
+	stale := ts.createUserWithEmail("")
+	active := ts.createUserWithEmail("")
+	confirmed := ts.createUserWithEmail("confirmed@example.com")
+	for _, u := range []*User{stale, active, confirmed} {
+		u.IsAnonymous = true
+		require.NoError(ts.T(), ts.db.UpdateOnly(u, "is_anonymous"))
+	}
+	require.NoError(ts.T(), confirmed.Confirm(ts.db))
+	_, err := GrantAuthenticatedUser(ts.db, active, nil)
+	require.NoError(ts.T(), err)
+
+	n, err := DeleteStaleAnonymousUsers(ts.db, uuid.Nil, time.Now().Add(-time.Second))
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 0, n)
+
+	n, err = DeleteStaleAnonymousUsers(ts.db, uuid.Nil, time.Now().Add(time.Minute))
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), 1, n)
+
+	_, err = FindUserByID(ts.db, stale.ID)
+	assert.True(ts.T(), IsNotFoundError(err))
+	for _, u := range []*User{active, confirmed} {
+		_, err = FindUserByID(ts.db, u.ID)
+		assert.NoError(ts.T(), err)
+	}
+}
+
 func (ts *UserTestSuite) TestFindUsersInAudience() {
 	u := ts.createUser()
 
@@ -158,7 +221,7 @@ func (ts *UserTestSuite) TestFindUserByRecoveryToken() {
 
 func (ts *UserTestSuite) TestFindUserWithRefreshToken() {
 	u := ts.createUser()
-	r, err := GrantAuthenticatedUser(ts.db, u)
+	r, err := GrantAuthenticatedUser(ts.db, u, nil)
 	require.NoError(ts.T(), err)
 
 	n, nr, err := FindUserWithRefreshToken(ts.db, r.Token)
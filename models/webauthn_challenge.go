@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// WebAuthnChallengeLifetime is how long a ceremony can take.
+const WebAuthnChallengeLifetime = 5 * time.Minute
+
+// Types of WebAuthn ceremonies.
+const (
+	WebAuthnRegistration   = "registration"
+	WebAuthnAuthentication = "authentication"
+)
+
+// WebAuthnChallenge is the database model for the challenge of a pending
+// WebAuthn ceremony. Challenges are deleted once they are used.
+type WebAuthnChallenge struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	// UserID is unset for authentication ceremonies of unknown users.
+	UserID uuid.NullUUID `json:"-" db:"user_id"`
+
+	Type string `json:"type" db:"type"`
+	// Challenge is the base64url encoded random challenge.
+	Challenge string `json:"challenge" db:"challenge"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"-" db:"updated_at"`
+}
+
+func (WebAuthnChallenge) TableName() string {
+	tableName := "webauthn_challenges"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewWebAuthnChallenge initializes a new challenge of a ceremony. user may be
+// nil for authentication ceremonies.
+func NewWebAuthnChallenge(instanceID uuid.UUID, user *User, challengeType, challenge string) (*WebAuthnChallenge, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	c := &WebAuthnChallenge{
+		InstanceID: instanceID,
+		ID:         id,
+		Type:       challengeType,
+		Challenge:  challenge,
+	}
+	if user != nil {
+		c.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	}
+	return c, nil
+}
+
+// HasExpired returns whether the ceremony took too long.
+func (c *WebAuthnChallenge) HasExpired() bool {
+	return time.Now().After(c.CreatedAt.Add(WebAuthnChallengeLifetime))
+}
+
+// ConsumeWebAuthnChallenge finds a challenge of a ceremony and deletes it, so
+// that it can't be used again.
+func ConsumeWebAuthnChallenge(tx *storage.Connection, instanceID, id uuid.UUID, challengeType string) (*WebAuthnChallenge, error) {
+	c := &WebAuthnChallenge{}
+	if err := tx.Q().Where("instance_id = ? and id = ? and type = ?", instanceID, id, challengeType).First(c); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, WebAuthnChallengeNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding webauthn challenge")
+	}
+	if err := tx.Destroy(c); err != nil {
+		return nil, errors.Wrap(err, "error deleting webauthn challenge")
+	}
+	return c, nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/netlify/gotrue/storage/namespace"
+	"github.com/pkg/errors"
+)
+
+// WebAuthnCredential is the database model for a passkey of a user.
+type WebAuthnCredential struct {
+	InstanceID uuid.UUID `json:"-" db:"instance_id"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	UserID     uuid.UUID `json:"-" db:"user_id"`
+
+	// CredentialID is the base64url encoded ID chosen by the authenticator.
+	CredentialID string `json:"credential_id" db:"credential_id"`
+	// PublicKey is the base64 encoded, PKIX DER public key of the credential.
+	PublicKey string `json:"-" db:"public_key"`
+	Algorithm int64  `json:"-" db:"algorithm"`
+	AAGUID    string `json:"aaguid" db:"aaguid"`
+	SignCount int64  `json:"-" db:"sign_count"`
+
+	FriendlyName string `json:"friendly_name" db:"friendly_name"`
+
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	tableName := "webauthn_credentials"
+
+	if namespace.GetNamespace() != "" {
+		return namespace.GetNamespace() + "_" + tableName
+	}
+
+	return tableName
+}
+
+// NewWebAuthnCredential initializes a new credential of user.
+func NewWebAuthnCredential(user *User, friendlyName, credentialID, publicKey string, algorithm int64, aaguid string, signCount uint32) (*WebAuthnCredential, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error generating unique id")
+	}
+
+	return &WebAuthnCredential{
+		InstanceID:   user.InstanceID,
+		ID:           id,
+		UserID:       user.ID,
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		Algorithm:    algorithm,
+		AAGUID:       aaguid,
+		SignCount:    int64(signCount),
+		FriendlyName: friendlyName,
+	}, nil
+}
+
+// UpdateSignCount records the signature counter of a successful assertion.
+func (c *WebAuthnCredential) UpdateSignCount(tx *storage.Connection, signCount uint32) error {
+	now := time.Now()
+	c.SignCount = int64(signCount)
+	c.LastUsedAt = &now
+	return tx.UpdateOnly(c, "sign_count", "last_used_at", "updated_at")
+}
+
+// FindWebAuthnCredentialByCredentialID finds a credential by the ID chosen by
+// its authenticator.
+func FindWebAuthnCredentialByCredentialID(tx *storage.Connection, instanceID uuid.UUID, credentialID string) (*WebAuthnCredential, error) {
+	return findWebAuthnCredential(tx, "instance_id = ? and credential_id = ?", instanceID, credentialID)
+}
+
+// FindWebAuthnCredentialByUserIDAndID finds a credential of a user.
+func FindWebAuthnCredentialByUserIDAndID(tx *storage.Connection, instanceID, userID, id uuid.UUID) (*WebAuthnCredential, error) {
+	return findWebAuthnCredential(tx, "instance_id = ? and user_id = ? and id = ?", instanceID, userID, id)
+}
+
+func findWebAuthnCredential(tx *storage.Connection, query string, args ...interface{}) (*WebAuthnCredential, error) {
+	cred := &WebAuthnCredential{}
+	if err := tx.Q().Where(query, args...).First(cred); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, WebAuthnCredentialNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding webauthn credential")
+	}
+	return cred, nil
+}
+
+// FindWebAuthnCredentialsByUserID returns the credentials of a user, oldest
+// first.
+func FindWebAuthnCredentialsByUserID(tx *storage.Connection, instanceID, userID uuid.UUID) ([]*WebAuthnCredential, error) {
+	creds := []*WebAuthnCredential{}
+	err := tx.Q().Where("instance_id = ? and user_id = ?", instanceID, userID).Order("created_at asc").All(&creds)
+	return creds, errors.Wrap(err, "error finding webauthn credentials")
+}
+
+// HasWebAuthnCredentials returns whether a user registered a passkey.
+func HasWebAuthnCredentials(tx *storage.Connection, instanceID, userID uuid.UUID) (bool, error) {
+	return tx.Q().Where("instance_id = ? and user_id = ?", instanceID, userID).Exists(&WebAuthnCredential{})
+}
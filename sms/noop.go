@@ -0,0 +1,38 @@
+package sms
+
+import (
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/sirupsen/logrus"
+)
+
+type noopSender struct {
+}
+
+func (s noopSender) Send(phone, body string) error {
+	return nil
+}
+
+func (s noopSender) OTPMessage(user *models.User, otp string) error {
+	return nil
+}
+
+// logSender writes messages to the log instead of sending them, for
+// development.
+type logSender struct {
+	Config *conf.Configuration
+	Logger logrus.FieldLogger
+}
+
+func (s *logSender) Send(phone, body string) error {
+	s.Logger.WithField("phone", phone).Info(body)
+	return nil
+}
+
+func (s *logSender) OTPMessage(user *models.User, otp string) error {
+	body, err := otpMessage(s.Config, otp)
+	if err != nil {
+		return err
+	}
+	return s.Send(user.Phone, body)
+}
@@ -0,0 +1,72 @@
+// Package sms sends text messages to the phone numbers of users.
+package sms
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultOTPMessage = `Your code is {{ .OTP }}`
+
+// Sender defines the interface an SMS sender must implement.
+type Sender interface {
+	Send(phone, body string) error
+	OTPMessage(user *models.User, otp string) error
+}
+
+// NewSender returns a sender for the configured provider
+func NewSender(instanceConfig *conf.Configuration) Sender {
+	switch instanceConfig.SMS.Provider {
+	case conf.SMSProviderTwilio:
+		return NewTwilioSender(instanceConfig)
+	case conf.SMSProviderLog:
+		return &logSender{Config: instanceConfig, Logger: logrus.WithField("component", "sms")}
+	}
+	return &noopSender{}
+}
+
+var (
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+	e164Regexp      = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+)
+
+// NormalizePhone returns a phone number in E.164 format. Spaces, dashes,
+// dots and parentheses are removed and a 00 international prefix is
+// accepted in place of the plus sign.
+func NormalizePhone(phone string) (string, error) {
+	phone = phoneSeparators.Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	if !e164Regexp.MatchString(phone) {
+		return "", errors.New("phone number must be in international format, like +14155552671")
+	}
+	return phone, nil
+}
+
+// otpMessage renders the configured one-time passcode message.
+func otpMessage(config *conf.Configuration, otp string) (string, error) {
+	text := config.SMS.Template
+	if text == "" {
+		text = defaultOTPMessage
+	}
+	tmpl, err := template.New("otp").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing sms template")
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, map[string]string{
+		"SiteURL": config.SiteURL,
+		"OTP":     otp,
+	}); err != nil {
+		return "", errors.Wrap(err, "error rendering sms template")
+	}
+	return body.String(), nil
+}
@@ -0,0 +1,87 @@
+package sms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	cases := map[string]string{
+		"+14155552671":       "+14155552671",
+		" +1 (415) 555-2671": "+14155552671",
+		"0049.30.1234567":    "+49301234567",
+	}
+	for input, expected := range cases {
+		phone, err := NormalizePhone(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, phone)
+	}
+
+	for _, input := range []string{"", "4155552671", "+0155552671", "+1415555267100000", "+1415abc2671"} {
+		_, err := NormalizePhone(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestTwilioSender(t *testing.T) {
+	var form map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", r.URL.Path)
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "AC123", user)
+		assert.Equal(t, "secret", pass)
+		require.NoError(t, r.ParseForm())
+		form = map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if form["To"] == "+15005550001" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": 21211, "message": "The 'To' number is not a valid phone number.", "status": 400}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM123", "status": "queued"}`))
+	}))
+	defer server.Close()
+
+	config := &conf.Configuration{SiteURL: "https://example.com"}
+	config.SMS.Provider = conf.SMSProviderTwilio
+	config.SMS.Template = "{{ .OTP }} is your code for {{ .SiteURL }}"
+	config.SMS.Twilio = conf.TwilioConfiguration{
+		AccountSID:          "AC123",
+		AuthToken:           "secret",
+		MessagingServiceSID: "MG123",
+		APIURL:              server.URL,
+	}
+
+	sender := NewSender(config)
+	require.NoError(t, sender.OTPMessage(&models.User{Phone: "+14155552671"}, "123456"))
+	assert.Equal(t, map[string]string{
+		"To":                  "+14155552671",
+		"MessagingServiceSid": "MG123",
+		"Body":                "123456 is your code for https://example.com",
+	}, form)
+
+	config.SMS.Twilio.From = "+15005550006"
+	require.NoError(t, sender.Send("+14155552671", "hello"))
+	assert.Equal(t, "+15005550006", form["From"])
+
+	err := sender.Send("+15005550001", "hello")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "21211")
+}
+
+func TestNewSenderWithoutProvider(t *testing.T) {
+	sender := NewSender(&conf.Configuration{})
+	assert.NoError(t, sender.OTPMessage(&models.User{Phone: "+14155552671"}, "123456"))
+}
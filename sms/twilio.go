@@ -0,0 +1,101 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/netlify/gotrue/conf"
+	"github.com/netlify/gotrue/models"
+	"github.com/pkg/errors"
+)
+
+const twilioTimeout = 10 * time.Second
+
+// TwilioSender sends messages through the Twilio API, or any API
+// compatible with it.
+type TwilioSender struct {
+	Config *conf.Configuration
+	Client *http.Client
+}
+
+// twilioMessage is the part of a message resource that is checked.
+type twilioMessage struct {
+	SID          string `json:"sid"`
+	Status       string `json:"status"`
+	ErrorCode    int    `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+// twilioError is the body of an error response.
+type twilioError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewTwilioSender returns a sender for the Twilio API
+func NewTwilioSender(instanceConfig *conf.Configuration) *TwilioSender {
+	return &TwilioSender{
+		Config: instanceConfig,
+		Client: &http.Client{Timeout: twilioTimeout},
+	}
+}
+
+// Send creates a message resource for the phone number
+func (s *TwilioSender) Send(phone, body string) error {
+	config := s.Config.SMS.Twilio
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", strings.TrimSuffix(config.APIURL, "/"), url.PathEscape(config.AccountSID))
+
+	form := url.Values{
+		"To":   {phone},
+		"Body": {body},
+	}
+	if config.From != "" {
+		form.Set("From", config.From)
+	} else {
+		form.Set("MessagingServiceSid", config.MessagingServiceSID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "error creating twilio request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(config.AccountSID, config.AuthToken)
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending twilio request")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		e := &twilioError{}
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+			return errors.Wrapf(err, "error decoding twilio error with status %d", res.StatusCode)
+		}
+		return fmt.Errorf("twilio error %d: %s", e.Code, e.Message)
+	}
+
+	msg := &twilioMessage{}
+	if err := json.NewDecoder(res.Body).Decode(msg); err != nil {
+		return errors.Wrap(err, "error decoding twilio response")
+	}
+	if msg.Status == "failed" || msg.Status == "undelivered" {
+		return fmt.Errorf("twilio message %s %s with error %d: %s", msg.SID, msg.Status, msg.ErrorCode, msg.ErrorMessage)
+	}
+	return nil
+}
+
+// OTPMessage sends a one-time passcode to the phone number of a user
+func (s *TwilioSender) OTPMessage(user *models.User, otp string) error {
+	body, err := otpMessage(s.Config, otp)
+	if err != nil {
+		return err
+	}
+	return s.Send(user.Phone, body)
+}
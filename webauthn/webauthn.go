@@ -0,0 +1,326 @@
+// Package webauthn verifies the registration and authentication ceremonies
+// of WebAuthn credentials (https://www.w3.org/TR/webauthn-2/). Only the "none"
+// attestation format is supported, so authenticators aren't attested.
+package webauthn
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of the supported credential public keys.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// Client data types of the ceremonies.
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+	flagExtensionData          = 0x80
+)
+
+// ErrSignCount is returned when the signature counter of an authenticator
+// didn't increase, which hints at a cloned authenticator.
+var ErrSignCount = errors.New("webauthn: signature counter did not increase")
+
+// RelyingParty is the site credentials are scoped to.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Credential is a newly registered public key credential.
+type Credential struct {
+	ID []byte
+	// PublicKey is the PKIX, ASN.1 DER encoded public key of the credential.
+	PublicKey    []byte
+	Algorithm    int64
+	AAGUID       []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+// Assertion is the verified result of an authentication ceremony.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// EncodeChallenge encodes a challenge like clients do in the client data.
+func EncodeChallenge(challenge []byte) string {
+	return base64.RawURLEncoding.EncodeToString(challenge)
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, typ string, challenge []byte) error {
+	cd := clientData{}
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("webauthn: unexpected client data type %q", cd.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(EncodeChallenge(challenge))) != 1 {
+		return errors.New("webauthn: challenge mismatch")
+	}
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("webauthn: unexpected origin %q", cd.Origin)
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(ad *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(ad.rpIDHash, rpIDHash[:]) != 1 {
+		return errors.New("webauthn: relying party ID mismatch")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return errors.New("webauthn: user not present")
+	}
+	return nil
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if ad.flags&flagAttestedCredentialData != 0 {
+		if len(rest) < 18 {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		ad.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("webauthn: credential ID too short")
+		}
+		ad.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if ad.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: invalid extension data: %w", err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("webauthn: trailing authenticator data")
+	}
+	return ad, nil
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create()
+// to the challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid attestation object: %w", err)
+	}
+	att, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("webauthn: invalid attestation object")
+	}
+	if format, _ := att["fmt"].(string); format != "none" {
+		return nil, fmt.Errorf("webauthn: unsupported attestation format %q", format)
+	}
+	rawAuthData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("webauthn: missing authenticator data")
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, errors.New("webauthn: missing attested credential data")
+	}
+
+	pub, alg, err := parseCOSEKey(ad.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+	}
+
+	return &Credential{
+		ID:           ad.credentialID,
+		PublicKey:    der,
+		Algorithm:    alg,
+		AAGUID:       ad.aaguid,
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get() to the
+// challenge with the public key of the credential and the last signature
+// counter seen from it.
+func (rp *RelyingParty) VerifyAssertion(challenge, clientDataJSON, rawAuthData, signature, publicKey []byte, alg int64, signCount uint32) (*Assertion, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := verifySignature(pub, alg, signed, signature); err != nil {
+		return nil, err
+	}
+
+	// authenticators without a counter always report 0
+	if (ad.signCount != 0 || signCount != 0) && ad.signCount <= signCount {
+		return nil, ErrSignCount
+	}
+
+	return &Assertion{
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+func verifySignature(pub stdcrypto.PublicKey, alg int64, data, signature []byte) error {
+	digest := sha256.Sum256(data)
+
+	switch alg {
+	case AlgES256:
+		if k, ok := pub.(*ecdsa.PublicKey); ok && ecdsa.VerifyASN1(k, digest[:], signature) {
+			return nil
+		}
+	case AlgRS256:
+		if k, ok := pub.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(k, stdcrypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case AlgEdDSA:
+		if k, ok := pub.(ed25519.PublicKey); ok && ed25519.Verify(k, data, signature) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("webauthn: unsupported algorithm %d", alg)
+	}
+	return errors.New("webauthn: invalid signature")
+}
+
+// parseCOSEKey decodes a COSE_Key (RFC 8152) of a supported algorithm.
+func parseCOSEKey(data []byte) (stdcrypto.PublicKey, int64, error) {
+	obj, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+	}
+	key, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("webauthn: invalid credential public key")
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+	crv, _ := key[int64(-1)].(int64)
+	x, _ := key[int64(-2)].([]byte)
+	y, _ := key[int64(-3)].([]byte)
+
+	switch {
+	case kty == 2 && alg == AlgES256 && crv == 1:
+		if len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("webauthn: invalid P-256 public key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, errors.New("webauthn: invalid P-256 public key")
+		}
+		return pub, alg, nil
+	case kty == 1 && alg == AlgEdDSA && crv == 6:
+		if len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("webauthn: invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("webauthn: invalid RSA public key")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, alg, nil
+	}
+	return nil, 0, fmt.Errorf("webauthn: unsupported credential public key (kty %d, alg %d)", kty, alg)
+}
@@ -0,0 +1,71 @@
+package webauthn_test
+
+import (
+	"testing"
+
+	"github.com/netlify/gotrue/webauthn"
+	"github.com/netlify/gotrue/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var rp = &webauthn.RelyingParty{
+	ID:      "example.com",
+	Name:    "Example",
+	Origins: []string{"https://example.com"},
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("example.com", "https://example.com")
+	authenticator.UserVerified = true
+
+	challenge := []byte("registration-challenge")
+	clientData, attestation := authenticator.Register(challenge)
+	cred, err := rp.VerifyRegistration(challenge, clientData, attestation)
+	require.NoError(t, err)
+	assert.Equal(t, authenticator.CredentialID, cred.ID)
+	assert.Equal(t, webauthn.AlgES256, cred.Algorithm)
+	assert.True(t, cred.UserVerified)
+
+	challenge = []byte("authentication-challenge")
+	clientData, authData, signature := authenticator.Assert(challenge)
+	assertion, err := rp.VerifyAssertion(challenge, clientData, authData, signature, cred.PublicKey, cred.Algorithm, cred.SignCount)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), assertion.SignCount)
+	assert.True(t, assertion.UserVerified)
+
+	// replaying the assertion fails the signature counter check
+	_, err = rp.VerifyAssertion(challenge, clientData, authData, signature, cred.PublicKey, cred.Algorithm, assertion.SignCount)
+	assert.Equal(t, webauthn.ErrSignCount, err)
+
+	// so does a tampered signature or another challenge
+	clientData, authData, signature = authenticator.Assert(challenge)
+	signature[len(signature)-1] ^= 0xff
+	_, err = rp.VerifyAssertion(challenge, clientData, authData, signature, cred.PublicKey, cred.Algorithm, assertion.SignCount)
+	assert.Error(t, err)
+
+	clientData, authData, signature = authenticator.Assert(challenge)
+	_, err = rp.VerifyAssertion([]byte("other"), clientData, authData, signature, cred.PublicKey, cred.Algorithm, assertion.SignCount)
+	assert.Error(t, err)
+}
+
+func TestRegistrationChecksRelyingParty(t *testing.T) {
+	challenge := []byte("challenge")
+
+	otherOrigin := webauthntest.NewAuthenticator("example.com", "https://evil.example")
+	clientData, attestation := otherOrigin.Register(challenge)
+	_, err := rp.VerifyRegistration(challenge, clientData, attestation)
+	assert.Error(t, err)
+
+	otherRP := webauthntest.NewAuthenticator("evil.example", "https://example.com")
+	clientData, attestation = otherRP.Register(challenge)
+	_, err = rp.VerifyRegistration(challenge, clientData, attestation)
+	assert.Error(t, err)
+
+	// an assertion isn't a registration
+	authenticator := webauthntest.NewAuthenticator("example.com", "https://example.com")
+	clientData, _, _ = authenticator.Assert(challenge)
+	_, attestation = authenticator.Register(challenge)
+	_, err = rp.VerifyRegistration(challenge, clientData, attestation)
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+// Package webauthntest provides a software authenticator for testing
+// WebAuthn ceremonies.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+)
+
+// Authenticator holds a single P-256 credential scoped to a relying party.
+type Authenticator struct {
+	RPID         string
+	Origin       string
+	CredentialID []byte
+	SignCount    uint32
+	UserVerified bool
+
+	key *ecdsa.PrivateKey
+}
+
+// NewAuthenticator creates an authenticator with a new credential.
+func NewAuthenticator(rpID, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return &Authenticator{RPID: rpID, Origin: origin, CredentialID: id, key: key}
+}
+
+// Register returns the client data and "none" attestation object of a
+// registration ceremony for challenge.
+func (a *Authenticator) Register(challenge []byte) ([]byte, []byte) {
+	clientData := a.clientData("webauthn.create", challenge)
+
+	cose := encode(map[int64]interface{}{
+		1:  int64(2),
+		3:  int64(-7),
+		-1: int64(1),
+		-2: pad(a.key.X.Bytes()),
+		-3: pad(a.key.Y.Bytes()),
+	})
+	attested := make([]byte, 18)
+	binary.BigEndian.PutUint16(attested[16:], uint16(len(a.CredentialID)))
+	attested = append(append(attested, a.CredentialID...), cose...)
+	authData := append(a.authData(0x40), attested...)
+
+	attestation := encode(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	return clientData, attestation
+}
+
+// Assert returns the client data, authenticator data and signature of an
+// authentication ceremony for challenge, increasing the signature counter.
+func (a *Authenticator) Assert(challenge []byte) ([]byte, []byte, []byte) {
+	a.SignCount++
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(0)
+
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), hash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return clientData, authData, signature
+}
+
+func (a *Authenticator) clientData(typ string, challenge []byte) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.Origin,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func (a *Authenticator) authData(flags byte) []byte {
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.SignCount)
+	return data
+}
+
+func pad(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// encode is a minimal CBOR encoder for the values used above.
+func encode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return header(1, uint64(-1-v))
+		}
+		return header(0, uint64(v))
+	case []byte:
+		return append(header(2, uint64(len(v))), v...)
+	case string:
+		return append(header(3, uint64(len(v))), v...)
+	case map[int64]interface{}:
+		keys := make([]int64, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		out := header(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(append(out, encode(k)...), encode(v[k])...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := header(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(append(out, encode(k)...), encode(v[k])...)
+		}
+		return out
+	}
+	panic("webauthntest: unsupported CBOR value")
+}
+
+func header(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		b := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	}
+	b := []byte{major<<5 | 26, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(n))
+	return b
+}